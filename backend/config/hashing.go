@@ -0,0 +1,25 @@
+package config
+
+// Argon2 holds the cost parameters for Argon2id password hashes
+type Argon2 struct {
+	Memory      uint32 // Memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2 returns the OWASP recommended minimum parameters
+func DefaultArgon2() Argon2 {
+	return Argon2{
+		Memory:      19 * 1024,
+		Iterations:  2,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (a *Argon2) IsValid() bool {
+	return a.Memory >= 8*uint32(a.Parallelism) && a.Iterations > 0 && a.Parallelism > 0 && a.SaltLength >= 8 && a.KeyLength >= 16
+}
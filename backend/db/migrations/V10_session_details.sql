@@ -0,0 +1,7 @@
+-- Session details
+
+-- Sessions record the client they were started from and when they were last refreshed
+-- so users can recognise their devices and sign out the ones they do not.
+alter table session add column if not exists user_agent varchar(512);
+alter table session add column if not exists ip varchar(45);
+alter table session add column if not exists last_seen_at timestamp;
@@ -0,0 +1,20 @@
+-- Soft account deletion and preserved financial records
+
+-- The table for the accounts scheduled for deletion
+-- A deleted account cannot log in. Its personal data is anonymized once purge_after has passed,
+-- until then the owner can restore it. The user row itself is kept so transactions still refer to it.
+create table if not exists account_deletion (
+    uid uuid primary key,
+    requested_at timestamp default current_timestamp not null,
+    purge_after timestamp not null,
+    anonymized_at timestamp,
+    constraint fk_account_deletion_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- Transactions are financial records, removing a buyer or vendor must not remove them
+alter table transaction drop constraint if exists fk_trans_buyer;
+alter table transaction drop constraint if exists fk_trans_vendor;
+alter table transaction add constraint fk_trans_buyer foreign key (bid) references buyer(uid) on delete restrict;
+alter table transaction add constraint fk_trans_vendor foreign key (vid) references vendor(uid) on delete restrict;
@@ -0,0 +1,41 @@
+-- Append-only audit log of security events
+
+-- The table for the security events of the system
+-- Written by the auth service and middleware for logins, credential changes, role changes and deletions.
+-- Rows are never updated or deleted, except that anonymizing an account clears the client details of its events.
+-- There are no foreign keys so events outlive the rows they mention. uid is the account the event is about,
+-- actor is who caused it and differs for admin actions, both are empty when the account is unknown.
+create table if not exists auth_event (
+    eid bigint generated always as identity primary key,
+    uid uuid,
+    actor uuid,
+    event varchar(40) not null,
+    outcome varchar(10) not null check (outcome in ('success', 'failure', 'denied')),
+    email varchar(255),
+    ip varchar(45),
+    user_agent varchar(512),
+    detail varchar(255),
+    created_at timestamp default current_timestamp not null
+);
+create index if not exists auth_event_uid_created_at on auth_event (uid, created_at desc);
+create index if not exists auth_event_created_at on auth_event (created_at desc);
+
+create or replace function auth_event_append_only() returns trigger as $$
+begin
+    if tg_op = 'UPDATE'
+        and new.email is null and new.ip is null and new.user_agent is null
+        and (new.eid, new.uid, new.actor, new.event, new.outcome, new.detail, new.created_at)
+            is not distinct from (old.eid, old.uid, old.actor, old.event, old.outcome, old.detail, old.created_at) then
+        return new;
+    end if;
+    raise exception 'auth_event is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists auth_event_append_only on auth_event;
+create trigger auth_event_append_only before update or delete on auth_event
+for each row execute function auth_event_append_only();
+
+drop trigger if exists auth_event_no_truncate on auth_event;
+create trigger auth_event_no_truncate before truncate on auth_event
+for each statement execute function auth_event_append_only();
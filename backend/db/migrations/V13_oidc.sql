@@ -0,0 +1,29 @@
+-- OpenID Connect sign-in
+
+-- The table for the OpenID Connect logins in progress
+-- A row is written when a user is sent to the identity provider and claimed when the provider redirects back.
+-- Only the sha256 hash of the state is stored, nonce and code_verifier are checked against the provider's answer.
+create table if not exists oidc_login (
+    state_hash varchar(64) primary key,
+    nonce varchar(64) not null,
+    code_verifier varchar(128) not null,
+    expires_at timestamp not null
+);
+
+-- The table for the external identities of the system
+-- Links the subject an identity provider knows a user by to their account. email is the address the provider
+-- last reported, kept for support.
+create table if not exists user_identity (
+    issuer varchar(255) not null,
+    subject varchar(255) not null,
+    uid uuid not null,
+    email varchar(255) not null,
+    created_at timestamp default current_timestamp not null,
+    last_login_at timestamp,
+    primary key (issuer, subject),
+    constraint fk_user_identity_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+create index if not exists idx_user_identity_uid on user_identity (uid);
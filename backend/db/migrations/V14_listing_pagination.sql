@@ -0,0 +1,12 @@
+-- Keyset pagination of catalog and transaction listings
+
+-- Items remember when they were listed so the catalog can be sorted newest first.
+-- Existing items all get the time of the migration.
+alter table item add column if not exists created_at timestamp default current_timestamp not null;
+
+-- Every listing order ends with the primary key so rows with the same sort value keep a stable order
+-- between pages. name is unique and already indexed.
+create index if not exists idx_item_created_at on item (created_at desc, iid desc);
+create index if not exists idx_item_cost on item (cost, iid);
+create index if not exists idx_item_vid_created_at on item (vid, created_at desc, iid desc);
+create index if not exists idx_transaction_vid_t_time on transaction (vid, t_time desc, tid desc);
@@ -0,0 +1,62 @@
+-- Full-text search over the catalog
+
+-- The table for the search documents of items
+-- An item's document weighs its name above its category and vendor name, and those above its description.
+-- It is kept up to date by the triggers below, also when the vendor is renamed, so it is never written directly.
+create table if not exists item_search (
+    iid uuid primary key,
+    document tsvector not null,
+    constraint fk_item_search_item foreign key (iid) references item(iid) on
+    delete
+        cascade
+);
+create index if not exists idx_item_search_document on item_search using gin (document);
+
+create or replace function item_search_document(item_name text, description text, category CATEGORY, vendor_name text)
+returns tsvector as $$
+    select setweight(to_tsvector('english', coalesce(item_name, '')), 'A')
+        || setweight(to_tsvector('english', replace(lower(category::text), '_', ' ')), 'B')
+        || setweight(to_tsvector('english', coalesce(vendor_name, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C');
+$$ language sql stable;
+
+create or replace function item_search_item_changed() returns trigger as $$
+begin
+    insert into item_search (iid, document)
+    select new.iid, item_search_document(new.name, new.description, new.category, vendor.name)
+    from vendor
+    where vendor.uid = new.vid
+    on conflict (iid) do update set document = excluded.document;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_item_changed on item;
+create trigger item_search_item_changed after insert or update of name, description, category, vid on item
+for each row execute function item_search_item_changed();
+
+create or replace function item_search_vendor_renamed() returns trigger as $$
+begin
+    update item_search
+    set document = item_search_document(item.name, item.description, item.category, new.name)
+    from item
+    where item.iid = item_search.iid and item.vid = new.uid;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_vendor_renamed on vendor;
+create trigger item_search_vendor_renamed after update of name on vendor
+for each row when (old.name is distinct from new.name) execute function item_search_vendor_renamed();
+
+-- Search snippets are sent as HTML with the matched words in <mark>, so the text around them is escaped first
+create or replace function html_escape(s text) returns text as $$
+    select replace(replace(replace(replace(s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;');
+$$ language sql immutable;
+
+-- Items listed before search existed get their documents
+insert into item_search (iid, document)
+select item.iid, item_search_document(item.name, item.description, item.category, vendor.name)
+from item
+join vendor on vendor.uid = item.vid
+on conflict (iid) do nothing;
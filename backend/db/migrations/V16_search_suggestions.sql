@@ -0,0 +1,10 @@
+-- Search suggestions and corrections
+
+-- pg_trgm matches names sharing most of their three letter sequences with what was typed, fuzzystrmatch
+-- counts the edits between short words trigrams cannot tell apart
+create extension if not exists pg_trgm;
+create extension if not exists fuzzystrmatch;
+
+-- Trigram indexes serve both prefix matches (ilike 'lam%') and similarity matches (<%) on names
+create index if not exists idx_item_name_trgm on item using gin (name gin_trgm_ops);
+create index if not exists idx_vendor_name_trgm on vendor using gin (name gin_trgm_ops);
@@ -0,0 +1,104 @@
+-- Categories managed by admins in place of the CATEGORY enum
+
+-- The table for the categories of items
+-- Categories form a tree through parent_cid. Items refer to a category by its slug, which renames follow.
+-- Inactive categories are left out of the public tree and cannot be given to items, their items keep them.
+create table if not exists category (
+    cid uuid default gen_random_uuid() primary key,
+    parent_cid uuid,
+    name varchar(100) not null,
+    slug varchar(100) unique not null check (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    position integer default 0 not null,
+    active boolean default true not null,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_category_parent foreign key (parent_cid) references category(cid) on
+    delete
+        restrict
+);
+create index if not exists idx_category_parent on category (parent_cid, position, name);
+
+-- The slugs of the given categories and of every category below them, catalog filters include subcategories
+create or replace function category_subtree(slugs text[]) returns setof varchar as $$
+    with recursive tree as (
+        select cid, slug from category where slug = any(slugs)
+        union
+        select child.cid, child.slug from category child join tree on child.parent_cid = tree.cid
+    )
+    select slug from tree;
+$$ language sql stable;
+
+-- The enum's values become the first categories, with slugs made from them
+insert into category (name, slug, position) values
+    ('Fashion', 'fashion', 1),
+    ('Electronics', 'electronics', 2),
+    ('Services', 'services', 3),
+    ('Books & Supplies', 'books-supplies', 4)
+on conflict (slug) do nothing;
+
+-- The search document took the enum, it is made from the category's name from now on
+drop function if exists item_search_document(text, text, CATEGORY, text);
+
+alter table item alter column category type varchar(100) using lower(replace(category::text, '_', '-'));
+alter table item add constraint fk_item_category foreign key (category) references category(slug) on
+    update
+        cascade
+    on
+    delete
+        restrict;
+create index if not exists idx_item_category on item (category);
+
+drop type if exists CATEGORY;
+
+create or replace function item_search_document(item_name text, description text, category_name text, vendor_name text)
+returns tsvector as $$
+    select setweight(to_tsvector('english', coalesce(item_name, '')), 'A')
+        || setweight(to_tsvector('english', coalesce(category_name, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(vendor_name, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C');
+$$ language sql immutable;
+
+create or replace function item_search_item_changed() returns trigger as $$
+begin
+    insert into item_search (iid, document)
+    select new.iid, item_search_document(new.name, new.description, category.name, vendor.name)
+    from vendor
+    join category on category.slug = new.category
+    where vendor.uid = new.vid
+    on conflict (iid) do update set document = excluded.document;
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace function item_search_vendor_renamed() returns trigger as $$
+begin
+    update item_search
+    set document = item_search_document(item.name, item.description, category.name, new.name)
+    from item
+    join category on category.slug = item.category
+    where item.iid = item_search.iid and item.vid = new.uid;
+    return null;
+end;
+$$ language plpgsql;
+
+create or replace function item_search_category_renamed() returns trigger as $$
+begin
+    update item_search
+    set document = item_search_document(item.name, item.description, new.name, vendor.name)
+    from item
+    join vendor on vendor.uid = item.vid
+    where item.iid = item_search.iid and item.category = new.slug;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_category_renamed on category;
+create trigger item_search_category_renamed after update of name on category
+for each row when (old.name is distinct from new.name) execute function item_search_category_renamed();
+
+-- Documents made from the enum are made again from the category names
+update item_search
+set document = item_search_document(item.name, item.description, category.name, vendor.name)
+from item
+join vendor on vendor.uid = item.vid
+join category on category.slug = item.category
+where item.iid = item_search.iid;
@@ -0,0 +1,66 @@
+-- Options like size and colour on items, with a variant for each combination sold
+
+-- The table for the options of items
+-- choices are the values of the option, in the order they are shown. An item with no options has no variants.
+create table if not exists item_option (
+    iid uuid not null,
+    name varchar(50) not null,
+    position integer default 0 not null,
+    choices varchar(50)[] not null check (cardinality(choices) > 0),
+    primary key (iid, name),
+    constraint fk_item_option_item foreign key (iid) references item(iid) on
+    delete
+        cascade
+);
+
+-- The table for the variants of items
+-- options holds a value of each of the item's options, in the order of the options' positions.
+-- Each variant has its own stock and, when cost is set, its own price in place of the item's.
+-- The options of variants are only checked to be unique once the transaction changing them commits,
+-- so variants can swap options.
+create table if not exists item_variant (
+    vrid uuid default gen_random_uuid() primary key,
+    iid uuid not null,
+    sku varchar(64) not null,
+    options varchar(50)[] not null,
+    quantity integer default 0 not null check (quantity >= 0),
+    cost decimal(12, 2) check (cost >= 0),
+    created_at timestamp default current_timestamp not null,
+    constraint uq_item_variant_sku unique (iid, sku),
+    constraint uq_item_variant_options unique (iid, options) deferrable initially deferred,
+    constraint fk_item_variant_item foreign key (iid) references item(iid) on
+    delete
+        cascade
+);
+
+-- The stock of an item with variants is the sum of theirs, so listings and the in stock filter keep using item.quantity
+create or replace function item_variant_stock_changed() returns trigger as $$
+declare
+    changed uuid;
+begin
+    if tg_op = 'DELETE' then
+        changed := old.iid;
+    else
+        changed := new.iid;
+    end if;
+    update item
+    set quantity = (select coalesce(sum(item_variant.quantity), 0) from item_variant where item_variant.iid = changed)
+    where item.iid = changed;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_variant_stock_changed on item_variant;
+create trigger item_variant_stock_changed after insert or update of quantity or delete on item_variant
+for each row execute function item_variant_stock_changed();
+
+-- Cart lines and purchases of items with variants name the variant
+alter table cart add column if not exists vrid uuid;
+alter table cart add constraint fk_cart_item_variant foreign key (vrid) references item_variant(vrid) on
+    delete
+        cascade;
+
+alter table transaction add column if not exists vrid uuid;
+alter table transaction add constraint fk_trans_item_variant foreign key (vrid) references item_variant(vrid) on
+    delete
+        set null;
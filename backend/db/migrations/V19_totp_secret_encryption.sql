@@ -0,0 +1,7 @@
+-- TOTP secrets encrypted at rest
+
+-- Unlike recovery codes a TOTP secret cannot be hashed since codes are computed from it, so a copy of the
+-- database would be enough to produce second factors. Secrets are encrypted with AES-256-GCM under
+-- TOTP_SECRET_KEY, which is kept in the environment and never in the database, and stored as "v1:" followed
+-- by the base64 nonce and ciphertext. Secrets without the prefix were stored before the key was configured.
+alter table mfa_totp alter column secret type varchar(255);
@@ -0,0 +1,28 @@
+-- Sessions and refresh tokens
+
+-- The table for the login sessions of the system
+-- A session is created on every login and groups every refresh token issued from it into a single family.
+-- Revoking a session invalidates its refresh tokens and any access tokens carrying its sid.
+create table if not exists session (
+    sid uuid default gen_random_uuid() primary key,
+    uid uuid not null,
+    created_at timestamp default current_timestamp not null,
+    revoked_at timestamp,
+    constraint fk_session_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the refresh tokens of the system
+-- Only the sha256 hash of a token is stored. A token is single use, presenting one that has already been used
+-- revokes the whole session it belongs to.
+create table if not exists refresh_token (
+    token_hash varchar(64) primary key,
+    sid uuid not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_refresh_token_session foreign key (sid) references session(sid) on
+    delete
+        cascade
+);
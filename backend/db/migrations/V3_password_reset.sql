@@ -0,0 +1,14 @@
+-- Password reset tokens
+
+-- The table for the password reset tokens of the system
+-- Only the sha256 hash of a token is stored. A token can be used once and expires after a short while.
+create table if not exists password_reset (
+    token_hash varchar(64) primary key,
+    uid uuid not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_password_reset_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
@@ -0,0 +1,5 @@
+-- Email ownership verification
+
+-- Users confirm they own their email address by following a signed link sent to it.
+-- Existing accounts start unverified and are asked to confirm on their next sign in.
+alter table "user" add column if not exists email_verified boolean default false not null;
@@ -0,0 +1,14 @@
+-- Signup domain exceptions
+
+-- The table for the signup exceptions of the system
+-- Emails listed here may sign up even though their domain is not on the allowlist, e.g. invited outside vendors.
+create table if not exists email_exception (
+    email varchar(255) primary key,
+    user_type varchar(10) default 'vendor' not null check (user_type in ('buyer', 'vendor')),
+    note varchar(255),
+    created_by uuid,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_email_exception_user foreign key (created_by) references "user"(uid) on
+    delete
+        set null
+);
@@ -0,0 +1,10 @@
+-- Login throttling
+
+-- The table for the failed login attempts of the system
+-- Subjects are an account ("account:<email>") or a client address ("ip:<addr>"), shared by every backend instance.
+create table if not exists login_attempt (
+    subject varchar(320) primary key,
+    failures integer default 0 not null,
+    last_failure_at timestamp not null,
+    locked_until timestamp
+);
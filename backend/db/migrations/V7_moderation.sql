@@ -0,0 +1,31 @@
+-- Account suspensions and item takedowns
+
+-- The table for the suspended accounts of the system
+-- A suspended user cannot log in or use an existing token, the row is deleted when the account is reinstated.
+create table if not exists user_suspension (
+    uid uuid primary key,
+    reason varchar(255),
+    suspended_by uuid,
+    suspended_at timestamp default current_timestamp not null,
+    constraint fk_user_suspension_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade,
+    constraint fk_user_suspension_admin foreign key (suspended_by) references "user"(uid) on
+    delete
+        set null
+);
+
+-- The table for the items taken down by an admin
+-- Taken down items are hidden from buyers but kept so the vendor's transactions still refer to them.
+create table if not exists item_takedown (
+    iid uuid primary key,
+    reason varchar(255),
+    taken_down_by uuid,
+    taken_down_at timestamp default current_timestamp not null,
+    constraint fk_item_takedown_item foreign key (iid) references item(iid) on
+    delete
+        cascade,
+    constraint fk_item_takedown_admin foreign key (taken_down_by) references "user"(uid) on
+    delete
+        set null
+);
@@ -0,0 +1,41 @@
+-- Two-factor authentication
+
+-- Sessions remember whether the second factor was presented so refreshed tokens keep the mfa claim.
+alter table session add column if not exists mfa boolean default false not null;
+
+-- The table for the TOTP authenticators of the system
+-- A row is created when enrollment starts and only counts once enabled_at is set by confirming a first code.
+-- last_used_step is the time step of the last accepted code, a code is never accepted twice.
+create table if not exists mfa_totp (
+    uid uuid primary key,
+    secret varchar(64) not null,
+    enabled_at timestamp,
+    last_used_step bigint default 0 not null,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_mfa_totp_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the recovery codes of the system
+-- Only the sha256 hash of a code is stored. A code can be used once in place of a TOTP code.
+create table if not exists mfa_recovery_code (
+    code_hash varchar(64) primary key,
+    uid uuid not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_mfa_recovery_code_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the platform settings changed by admins at runtime
+create table if not exists platform_setting (
+    name varchar(64) primary key,
+    value varchar(255) not null,
+    updated_by uuid,
+    updated_at timestamp default current_timestamp not null,
+    constraint fk_platform_setting_admin foreign key (updated_by) references "user"(uid) on
+    delete
+        set null
+);
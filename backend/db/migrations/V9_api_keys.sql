@@ -0,0 +1,19 @@
+-- Vendor API keys
+
+-- The table for the API keys of the system
+-- Vendors create keys for scripts that manage their inventory. Only the sha256 hash of a key is stored,
+-- prefix keeps its first characters so vendors can tell their keys apart. A key may only do what its scopes allow.
+create table if not exists api_key (
+    kid uuid default gen_random_uuid() primary key,
+    uid uuid not null,
+    name varchar(100) not null,
+    key_hash varchar(64) not null unique,
+    prefix varchar(16) not null,
+    scopes varchar(32)[] not null,
+    created_at timestamp default current_timestamp not null,
+    last_used_at timestamp,
+    revoked_at timestamp,
+    constraint fk_api_key_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
@@ -4,6 +4,10 @@ CREATE SCHEMA public;
 GRANT ALL ON SCHEMA public TO postgres;
 GRANT ALL ON SCHEMA public TO public;
 
+-- Trigram similarity and edit distance for search suggestions
+create extension if not exists pg_trgm;
+create extension if not exists fuzzystrmatch;
+
 -- The table for the users of the system
 -- This table is used to store the users of the system. The uid is a unique identifier for each user.
 create table if not exists "user" (
@@ -11,6 +15,7 @@ create table if not exists "user" (
     email varchar(255) unique not null,
     passhash varchar(255) not null,
     isAdmin boolean default false,
+    email_verified boolean default false not null,
     constraint email_format check (
         email ~ '^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$'
     )
@@ -27,6 +32,7 @@ create table if not exists vendor (
     delete
         cascade
 );
+create index if not exists idx_vendor_name_trgm on vendor using gin (name gin_trgm_ops);
 
 -- The table for accounts
 -- This table is used to store the accounts of the vendors. The uid is a foreign key that references the vendor table.
@@ -49,25 +55,127 @@ create table if not exists buyer (
         cascade
 );
 
--- The table for the category of items
--- This table is used to store the categories of items. The uid is a foreign key that references the user table.
-create type CATEGORY as enum('FASHION', 'ELECTRONICS', 'SERVICES', 'BOOKS_SUPPLIES');
+-- The table for the categories of items
+-- Categories form a tree through parent_cid. Items refer to a category by its slug, which renames follow.
+-- Inactive categories are left out of the public tree and cannot be given to items, their items keep them.
+create table if not exists category (
+    cid uuid default gen_random_uuid() primary key,
+    parent_cid uuid,
+    name varchar(100) not null,
+    slug varchar(100) unique not null check (slug ~ '^[a-z0-9]+(-[a-z0-9]+)*$'),
+    position integer default 0 not null,
+    active boolean default true not null,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_category_parent foreign key (parent_cid) references category(cid) on
+    delete
+        restrict
+);
+create index if not exists idx_category_parent on category (parent_cid, position, name);
+
+-- The slugs of the given categories and of every category below them, catalog filters include subcategories
+create or replace function category_subtree(slugs text[]) returns setof varchar as $$
+    with recursive tree as (
+        select cid, slug from category where slug = any(slugs)
+        union
+        select child.cid, child.slug from category child join tree on child.parent_cid = tree.cid
+    )
+    select slug from tree;
+$$ language sql stable;
+
+-- The categories the marketplace starts with
+insert into category (name, slug, position) values
+    ('Fashion', 'fashion', 1),
+    ('Electronics', 'electronics', 2),
+    ('Services', 'services', 3),
+    ('Books & Supplies', 'books-supplies', 4)
+on conflict (slug) do nothing;
+
+-- The table for the items of the system
+-- This table is used to store the items vendors sell. The vid is a foreign key that references the vendor table.
 create table if not exists item (
     iid uuid default gen_random_uuid() primary key,
     vid uuid default gen_random_uuid() not null,
     name varchar(255) unique not null,
     pictureUrl varchar(255),
     description varchar(255),
-    category CATEGORY not null,
+    category varchar(100) not null,
     quantity integer default 1 not null check (quantity >= 0),
     cost decimal( 12, 2) not null check (cost >= 0),
+    created_at timestamp default current_timestamp not null,
     constraint fk_item_vendor foreign key (vid) references vendor(uid) on
+    delete
+        cascade,
+    constraint fk_item_category foreign key (category) references category(slug) on
+    update
+        cascade
+    on
+    delete
+        restrict
+);
+create index if not exists idx_item_created_at on item (created_at desc, iid desc);
+create index if not exists idx_item_cost on item (cost, iid);
+create index if not exists idx_item_vid_created_at on item (vid, created_at desc, iid desc);
+create index if not exists idx_item_name_trgm on item using gin (name gin_trgm_ops);
+create index if not exists idx_item_category on item (category);
+
+-- The table for the options of items
+-- choices are the values of the option, in the order they are shown. An item with no options has no variants.
+create table if not exists item_option (
+    iid uuid not null,
+    name varchar(50) not null,
+    position integer default 0 not null,
+    choices varchar(50)[] not null check (cardinality(choices) > 0),
+    primary key (iid, name),
+    constraint fk_item_option_item foreign key (iid) references item(iid) on
+    delete
+        cascade
+);
+
+-- The table for the variants of items
+-- options holds a value of each of the item's options, in the order of the options' positions.
+-- Each variant has its own stock and, when cost is set, its own price in place of the item's.
+-- The options of variants are only checked to be unique once the transaction changing them commits,
+-- so variants can swap options.
+create table if not exists item_variant (
+    vrid uuid default gen_random_uuid() primary key,
+    iid uuid not null,
+    sku varchar(64) not null,
+    options varchar(50)[] not null,
+    quantity integer default 0 not null check (quantity >= 0),
+    cost decimal(12, 2) check (cost >= 0),
+    created_at timestamp default current_timestamp not null,
+    constraint uq_item_variant_sku unique (iid, sku),
+    constraint uq_item_variant_options unique (iid, options) deferrable initially deferred,
+    constraint fk_item_variant_item foreign key (iid) references item(iid) on
     delete
         cascade
 );
 
+-- The stock of an item with variants is the sum of theirs, so listings and the in stock filter keep using item.quantity
+create or replace function item_variant_stock_changed() returns trigger as $$
+declare
+    changed uuid;
+begin
+    if tg_op = 'DELETE' then
+        changed := old.iid;
+    else
+        changed := new.iid;
+    end if;
+    update item
+    set quantity = (select coalesce(sum(item_variant.quantity), 0) from item_variant where item_variant.iid = changed)
+    where item.iid = changed;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_variant_stock_changed on item_variant;
+create trigger item_variant_stock_changed after insert or update of quantity or delete on item_variant
+for each row execute function item_variant_stock_changed();
+
 -- The table for the transactions of the system
 -- This table is used to store the transactions of the system. The uid is a foreign key that references the user table.
+-- Transactions are financial records, buyers and vendors cannot be removed while they have any.
+-- vrid is the variant bought of an item with variants, and null for other items or once the variant is removed.
 create table if not exists transaction (
     tid uuid default gen_random_uuid() primary key,
     bid uuid default gen_random_uuid() not null,
@@ -79,26 +187,343 @@ create table if not exists transaction (
     ) not null,
     qty_bought integer not null check(qty_bought > 0),
     t_time timestamp default current_timestamp,
+    vrid uuid,
     constraint fk_trans_buyer foreign key (bid) references buyer(uid) on
     delete
-        cascade,
+        restrict,
         constraint fk_trans_vendor foreign key (vid) references vendor(uid) on
         delete
-            cascade
+            restrict,
+    constraint fk_trans_item_variant foreign key (vrid) references item_variant(vrid) on
+    delete
+        set null
 );
+create index if not exists idx_transaction_vid_t_time on transaction (vid, t_time desc, tid desc);
 
 -- The table for the cart of the system
 -- This table is used to store the items in the cart of the buyer. The uid is a foreign key that references the user table.
+-- vrid is the variant bought of an item with variants, and null for other items.
 create table if not exists cart (
     bid uuid default gen_random_uuid() not null, 
     iid uuid default gen_random_uuid() not null,
     vid uuid default gen_random_uuid() not null,
     quantity integer not null check(quantity > 0),
     added_time timestamp default current_timestamp,
+    vrid uuid,
     constraint fk_cart_buyer foreign key (bid) references buyer(uid) on 
     delete cascade,
     constraint fk_cart_item foreign key (iid) references item(iid) on
     delete cascade,
     constraint fk_cart_item_vendor foreign key(vid) references vendor(uid)
-    on delete cascade
+    on delete cascade,
+    constraint fk_cart_item_variant foreign key (vrid) references item_variant(vrid) on
+    delete
+        cascade
 );
+
+-- The table for the login sessions of the system
+-- A session is created on every login and groups every refresh token issued from it into a single family.
+-- Revoking a session invalidates its refresh tokens and any access tokens carrying its sid.
+-- mfa is set once the second factor was presented so refreshed tokens keep the mfa claim.
+-- user_agent and ip describe the client the session was started from, last_seen_at is its last refresh.
+create table if not exists session (
+    sid uuid default gen_random_uuid() primary key,
+    uid uuid not null,
+    created_at timestamp default current_timestamp not null,
+    revoked_at timestamp,
+    mfa boolean default false not null,
+    user_agent varchar(512),
+    ip varchar(45),
+    last_seen_at timestamp,
+    constraint fk_session_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the refresh tokens of the system
+-- Only the sha256 hash of a token is stored. A token is single use, presenting one that has already been used
+-- revokes the whole session it belongs to.
+create table if not exists refresh_token (
+    token_hash varchar(64) primary key,
+    sid uuid not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_refresh_token_session foreign key (sid) references session(sid) on
+    delete
+        cascade
+);
+
+-- The table for the password reset tokens of the system
+-- Only the sha256 hash of a token is stored. A token can be used once and expires after a short while.
+create table if not exists password_reset (
+    token_hash varchar(64) primary key,
+    uid uuid not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_password_reset_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the signup exceptions of the system
+-- Emails listed here may sign up even though their domain is not on the allowlist, e.g. invited outside vendors.
+create table if not exists email_exception (
+    email varchar(255) primary key,
+    user_type varchar(10) default 'vendor' not null check (user_type in ('buyer', 'vendor')),
+    note varchar(255),
+    created_by uuid,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_email_exception_user foreign key (created_by) references "user"(uid) on
+    delete
+        set null
+);
+
+-- The table for the failed login attempts of the system
+-- Subjects are an account ("account:<email>") or a client address ("ip:<addr>"), shared by every backend instance.
+create table if not exists login_attempt (
+    subject varchar(320) primary key,
+    failures integer default 0 not null,
+    last_failure_at timestamp not null,
+    locked_until timestamp
+);
+
+-- The table for the suspended accounts of the system
+-- A suspended user cannot log in or use an existing token, the row is deleted when the account is reinstated.
+create table if not exists user_suspension (
+    uid uuid primary key,
+    reason varchar(255),
+    suspended_by uuid,
+    suspended_at timestamp default current_timestamp not null,
+    constraint fk_user_suspension_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade,
+    constraint fk_user_suspension_admin foreign key (suspended_by) references "user"(uid) on
+    delete
+        set null
+);
+
+-- The table for the items taken down by an admin
+-- Taken down items are hidden from buyers but kept so the vendor's transactions still refer to them.
+create table if not exists item_takedown (
+    iid uuid primary key,
+    reason varchar(255),
+    taken_down_by uuid,
+    taken_down_at timestamp default current_timestamp not null,
+    constraint fk_item_takedown_item foreign key (iid) references item(iid) on
+    delete
+        cascade,
+    constraint fk_item_takedown_admin foreign key (taken_down_by) references "user"(uid) on
+    delete
+        set null
+);
+
+-- The table for the TOTP authenticators of the system
+-- A row is created when enrollment starts and only counts once enabled_at is set by confirming a first code.
+-- last_used_step is the time step of the last accepted code, a code is never accepted twice.
+-- secret is encrypted with TOTP_SECRET_KEY as "v1:" followed by the base64 nonce and ciphertext, secrets
+-- without the prefix were stored before the key was configured.
+create table if not exists mfa_totp (
+    uid uuid primary key,
+    secret varchar(255) not null,
+    enabled_at timestamp,
+    last_used_step bigint default 0 not null,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_mfa_totp_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the recovery codes of the system
+-- Only the sha256 hash of a code is stored. A code can be used once in place of a TOTP code.
+create table if not exists mfa_recovery_code (
+    code_hash varchar(64) primary key,
+    uid uuid not null,
+    used_at timestamp,
+    created_at timestamp default current_timestamp not null,
+    constraint fk_mfa_recovery_code_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the platform settings changed by admins at runtime
+create table if not exists platform_setting (
+    name varchar(64) primary key,
+    value varchar(255) not null,
+    updated_by uuid,
+    updated_at timestamp default current_timestamp not null,
+    constraint fk_platform_setting_admin foreign key (updated_by) references "user"(uid) on
+    delete
+        set null
+);
+
+-- The table for the API keys of the system
+-- Vendors create keys for scripts that manage their inventory. Only the sha256 hash of a key is stored,
+-- prefix keeps its first characters so vendors can tell their keys apart. A key may only do what its scopes allow.
+create table if not exists api_key (
+    kid uuid default gen_random_uuid() primary key,
+    uid uuid not null,
+    name varchar(100) not null,
+    key_hash varchar(64) not null unique,
+    prefix varchar(16) not null,
+    scopes varchar(32)[] not null,
+    created_at timestamp default current_timestamp not null,
+    last_used_at timestamp,
+    revoked_at timestamp,
+    constraint fk_api_key_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the accounts scheduled for deletion
+-- A deleted account cannot log in. Its personal data is anonymized once purge_after has passed,
+-- until then the owner can restore it. The user row itself is kept so transactions still refer to it.
+create table if not exists account_deletion (
+    uid uuid primary key,
+    requested_at timestamp default current_timestamp not null,
+    purge_after timestamp not null,
+    anonymized_at timestamp,
+    constraint fk_account_deletion_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+-- The table for the security events of the system
+-- Written by the auth service and middleware for logins, credential changes, role changes and deletions.
+-- Rows are never updated or deleted, except that anonymizing an account clears the client details of its events.
+-- There are no foreign keys so events outlive the rows they mention. uid is the account the event is about,
+-- actor is who caused it and differs for admin actions, both are empty when the account is unknown.
+create table if not exists auth_event (
+    eid bigint generated always as identity primary key,
+    uid uuid,
+    actor uuid,
+    event varchar(40) not null,
+    outcome varchar(10) not null check (outcome in ('success', 'failure', 'denied')),
+    email varchar(255),
+    ip varchar(45),
+    user_agent varchar(512),
+    detail varchar(255),
+    created_at timestamp default current_timestamp not null
+);
+create index if not exists auth_event_uid_created_at on auth_event (uid, created_at desc);
+create index if not exists auth_event_created_at on auth_event (created_at desc);
+
+create or replace function auth_event_append_only() returns trigger as $$
+begin
+    if tg_op = 'UPDATE'
+        and new.email is null and new.ip is null and new.user_agent is null
+        and (new.eid, new.uid, new.actor, new.event, new.outcome, new.detail, new.created_at)
+            is not distinct from (old.eid, old.uid, old.actor, old.event, old.outcome, old.detail, old.created_at) then
+        return new;
+    end if;
+    raise exception 'auth_event is append-only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists auth_event_append_only on auth_event;
+create trigger auth_event_append_only before update or delete on auth_event
+for each row execute function auth_event_append_only();
+
+drop trigger if exists auth_event_no_truncate on auth_event;
+create trigger auth_event_no_truncate before truncate on auth_event
+for each statement execute function auth_event_append_only();
+
+-- The table for the OpenID Connect logins in progress
+-- A row is written when a user is sent to the identity provider and claimed when the provider redirects back.
+-- Only the sha256 hash of the state is stored, nonce and code_verifier are checked against the provider's answer.
+create table if not exists oidc_login (
+    state_hash varchar(64) primary key,
+    nonce varchar(64) not null,
+    code_verifier varchar(128) not null,
+    expires_at timestamp not null
+);
+
+-- The table for the external identities of the system
+-- Links the subject an identity provider knows a user by to their account. email is the address the provider
+-- last reported, kept for support.
+create table if not exists user_identity (
+    issuer varchar(255) not null,
+    subject varchar(255) not null,
+    uid uuid not null,
+    email varchar(255) not null,
+    created_at timestamp default current_timestamp not null,
+    last_login_at timestamp,
+    primary key (issuer, subject),
+    constraint fk_user_identity_user foreign key (uid) references "user"(uid) on
+    delete
+        cascade
+);
+
+create index if not exists idx_user_identity_uid on user_identity (uid);
+
+-- The table for the search documents of items
+-- An item's document weighs its name above its category and vendor name, and those above its description.
+-- It is kept up to date by the triggers below, also when the vendor is renamed, so it is never written directly.
+create table if not exists item_search (
+    iid uuid primary key,
+    document tsvector not null,
+    constraint fk_item_search_item foreign key (iid) references item(iid) on
+    delete
+        cascade
+);
+create index if not exists idx_item_search_document on item_search using gin (document);
+
+create or replace function item_search_document(item_name text, description text, category_name text, vendor_name text)
+returns tsvector as $$
+    select setweight(to_tsvector('english', coalesce(item_name, '')), 'A')
+        || setweight(to_tsvector('english', coalesce(category_name, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(vendor_name, '')), 'B')
+        || setweight(to_tsvector('english', coalesce(description, '')), 'C');
+$$ language sql immutable;
+
+create or replace function item_search_item_changed() returns trigger as $$
+begin
+    insert into item_search (iid, document)
+    select new.iid, item_search_document(new.name, new.description, category.name, vendor.name)
+    from vendor
+    join category on category.slug = new.category
+    where vendor.uid = new.vid
+    on conflict (iid) do update set document = excluded.document;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_item_changed on item;
+create trigger item_search_item_changed after insert or update of name, description, category, vid on item
+for each row execute function item_search_item_changed();
+
+create or replace function item_search_vendor_renamed() returns trigger as $$
+begin
+    update item_search
+    set document = item_search_document(item.name, item.description, category.name, new.name)
+    from item
+    join category on category.slug = item.category
+    where item.iid = item_search.iid and item.vid = new.uid;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_vendor_renamed on vendor;
+create trigger item_search_vendor_renamed after update of name on vendor
+for each row when (old.name is distinct from new.name) execute function item_search_vendor_renamed();
+
+create or replace function item_search_category_renamed() returns trigger as $$
+begin
+    update item_search
+    set document = item_search_document(item.name, item.description, new.name, vendor.name)
+    from item
+    join vendor on vendor.uid = item.vid
+    where item.iid = item_search.iid and item.category = new.slug;
+    return null;
+end;
+$$ language plpgsql;
+
+drop trigger if exists item_search_category_renamed on category;
+create trigger item_search_category_renamed after update of name on category
+for each row when (old.name is distinct from new.name) execute function item_search_category_renamed();
+
+-- Search snippets are sent as HTML with the matched words in <mark>, so the text around them is escaped first
+create or replace function html_escape(s text) returns text as $$
+    select replace(replace(replace(replace(s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;');
+$$ language sql immutable;
@@ -1,6 +1,9 @@
 -- name: GetUserByEmail :one
 select * from "user" where email like $1 limit 1;
 
+-- name: GetUserByExactEmail :one
+select * from "user" where lower(email) = lower($1) limit 1;
+
 -- name: GetUserById :one
 select * from "user" where uid = $1 limit 1;
 
@@ -75,7 +78,8 @@ insert into buyer (uid, name) values ($1, $2);
 with updated_user as (
     update "user"
     set 
-    email = $2
+    email = $2,
+    email_verified = email_verified and email = $2
     where "user".uid = $3
     returning uid
 )
@@ -85,11 +89,205 @@ name = $1
 where uid in (select uid from updated_user);
 
 
--- name: GetAllItems :many
-select * from "item";
-
--- name: GetItemsByVendorId :many
-select * from "item" where vid = $1;
+-- name: ListItemsNewest :many
+select * from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+    and (sqlc.narg(after_iid)::uuid is null or (created_at, iid) < (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_iid)))
+order by created_at desc, iid desc
+limit @row_limit;
+
+-- name: ListItemsByPriceAsc :many
+select * from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+    and (sqlc.narg(after_iid)::uuid is null or (cost, iid) > (sqlc.narg(after_cost)::decimal, sqlc.narg(after_iid)))
+order by cost, iid
+limit @row_limit;
+
+-- name: ListItemsByPriceDesc :many
+select * from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+    and (sqlc.narg(after_iid)::uuid is null or (cost, iid) < (sqlc.narg(after_cost)::decimal, sqlc.narg(after_iid)))
+order by cost desc, iid desc
+limit @row_limit;
+
+-- name: ListItemsByNameAsc :many
+select * from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+    and (sqlc.narg(after_iid)::uuid is null or (name, iid) > (sqlc.narg(after_name)::text, sqlc.narg(after_iid)))
+order by name, iid
+limit @row_limit;
+
+-- name: ListItemsByNameDesc :many
+select * from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+    and (sqlc.narg(after_iid)::uuid is null or (name, iid) < (sqlc.narg(after_name)::text, sqlc.narg(after_iid)))
+order by name desc, iid desc
+limit @row_limit;
+
+-- name: CountItemsByCategory :many
+select category, count(*) as items from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (sqlc.narg(min_cost)::decimal is null or cost >= sqlc.narg(min_cost))
+    and (sqlc.narg(max_cost)::decimal is null or cost <= sqlc.narg(max_cost))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+group by category
+order by category;
+
+-- name: CountItemsByPriceBucket :many
+select width_bucket(cost::float8, @bounds::float8[])::integer as bucket, count(*) as items from item
+where (sqlc.narg(vid)::uuid is null or vid = sqlc.narg(vid))
+    and (not @visible_only::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality(@categories::text[]), 0) = 0 or category in (select category_subtree(@categories::text[])))
+    and (not @in_stock::boolean or quantity > 0)
+    and (sqlc.narg(query)::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', sqlc.narg(query))
+    ))
+group by bucket
+order by bucket;
+
+-- name: SearchCatalog :many
+with search as (
+    select websearch_to_tsquery('english', @query::text) as query
+), matches as (
+    select item.*, ts_rank_cd(item_search.document, search.query)::real as rank
+    from item_search
+    join item on item.iid = item_search.iid
+    cross join search
+    where item_search.document @@ search.query
+        and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+        and (sqlc.narg(after_iid)::uuid is null
+            or (ts_rank_cd(item_search.document, search.query)::real, item.iid) < (sqlc.narg(after_rank)::real, sqlc.narg(after_iid)))
+    order by rank desc, item.iid desc
+    limit @row_limit
+)
+select matches.iid, matches.vid, matches.name, matches.pictureurl, matches.description, matches.category,
+    matches.quantity, matches.cost, matches.created_at, vendor.name as vendor_name, matches.rank,
+    ts_headline('english', html_escape(matches.name), search.query,
+        'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text as name_snippet,
+    ts_headline('english', html_escape(coalesce(matches.description, '')), search.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=10, MaxFragments=2')::text as description_snippet
+from matches
+join vendor on vendor.uid = matches.vid
+cross join search
+order by matches.rank desc, matches.iid desc;
+
+-- name: SuggestNames :many
+select suggestion.name, suggestion.kind, suggestion.score::real as score from (
+    select item.name, 'item'::text as kind, word_similarity(@term::text, item.name) as score
+    from item
+    where (item.name ilike @prefix::text or @term::text <% item.name)
+        and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    union all
+    select vendor.name, 'vendor'::text as kind, word_similarity(@term::text, vendor.name) as score
+    from vendor
+    where (vendor.name ilike @prefix::text or @term::text <% vendor.name)
+        and not exists (select 1 from user_suspension where user_suspension.uid = vendor.uid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = vendor.uid)
+) as suggestion
+order by suggestion.name ilike @prefix::text desc, suggestion.score desc, suggestion.name
+limit @row_limit;
+
+-- name: SuggestNamesByDistance :many
+select suggestion.name, suggestion.kind, suggestion.distance::integer as distance from (
+    select item.name, 'item'::text as kind,
+        levenshtein_less_equal(lower(@term::text), lower(left(item.name, length(@term::text))), @max_distance::integer) as distance
+    from item
+    where not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    union all
+    select vendor.name, 'vendor'::text as kind,
+        levenshtein_less_equal(lower(@term::text), lower(left(vendor.name, length(@term::text))), @max_distance::integer) as distance
+    from vendor
+    where not exists (select 1 from user_suspension where user_suspension.uid = vendor.uid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = vendor.uid)
+) as suggestion
+where suggestion.distance <= @max_distance::integer
+order by suggestion.distance, suggestion.name
+limit @row_limit;
 
 -- name: GetItemByName :one
 select * from item where name like $1;
@@ -97,6 +295,13 @@ select * from item where name like $1;
 -- name: GetItemById :one
 select * from item where iid = $1;
 
+-- name: GetVisibleItemById :one
+select * from item
+where iid = $1
+    and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+    and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+    and not exists (select 1 from account_deletion where account_deletion.uid = item.vid);
+
 -- name: GetItemByIdWithVendorInfo :one
 select
     iid,
@@ -117,7 +322,10 @@ join vendor v on
 join "user" u on
     u.uid = v.uid
 where
-    iid = $1;
+    iid = $1
+    and not exists (select 1 from item_takedown t where t.iid = i.iid)
+    and not exists (select 1 from user_suspension s where s.uid = i.vid)
+    and not exists (select 1 from account_deletion d where d.uid = i.vid);
 
 -- name: InsertVendor :exec
 insert into vendor (uid, name) values ($1, $2);
@@ -129,7 +337,8 @@ delete from "user" where uid = $1;
 with updated_user as (
     update "user"
     set 
-    email = $3
+    email = $3,
+    email_verified = email_verified and email = $3
     where "user".uid = $4
     returning uid
 )
@@ -143,21 +352,90 @@ where uid in (select uid from updated_user);
 insert into item (vid, name, pictureurl, description, category, quantity, cost) values ($1, $2, $3, $4, $5, $6, $7) returning iid;
 
 -- name: UpdateItem :exec
-update item set name = $1,  description = $2, cost = $3, pictureurl = $4, category = $5, quantity = $6 
+update item set name = $1,  description = $2, cost = $3, pictureurl = $4, category = $5,
+    -- The stock of an item with variants is theirs, kept in item.quantity by item_variant_stock_changed
+    quantity = case when exists (select 1 from item_variant where item_variant.iid = item.iid) then item.quantity else $6 end
 where iid = $7
 and vid = $8;
 
+-- name: ListCategories :many
+select * from category
+order by position, name;
+
+-- name: GetCategoryById :one
+select * from category where cid = $1;
+
+-- name: GetCategoryBySlug :one
+select * from category where slug = $1;
+
+-- name: InsertCategory :one
+insert into category (parent_cid, name, slug, position, active) values ($1, $2, $3, $4, $5)
+returning *;
+
+-- name: UpdateCategory :one
+update category set parent_cid = $1, name = $2, slug = $3, position = $4, active = $5
+where cid = $6
+returning *;
+
+-- name: DeleteCategory :execrows
+delete from category where cid = $1;
+
+-- name: IsCategoryInSubtree :one
+with recursive tree as (
+    select category.cid from category where category.cid = @root
+    union
+    select child.cid from category child join tree on child.parent_cid = tree.cid
+)
+select exists (select 1 from tree where tree.cid = @cid);
+
 -- name: DeleteItem :exec
 delete from item where iid = $1;
 
+-- name: ListItemOptions :many
+select * from item_option
+where iid = $1
+order by position;
+
+-- name: DeleteItemOptions :exec
+delete from item_option where iid = $1;
+
+-- name: InsertItemOption :exec
+insert into item_option (iid, name, position, choices) values ($1, $2, $3, $4);
+
+-- name: ListItemVariants :many
+select * from item_variant
+where iid = $1
+order by created_at, sku;
+
+-- name: GetItemVariant :one
+select * from item_variant where vrid = $1;
+
+-- name: ItemHasVariants :one
+select exists (select 1 from item_variant where iid = $1);
+
+-- name: UpsertItemVariant :one
+insert into item_variant (iid, sku, options, quantity, cost) values ($1, $2, $3, $4, $5)
+on conflict (iid, sku) do update set options = excluded.options, quantity = excluded.quantity, cost = excluded.cost
+returning *;
+
+-- name: DeleteItemVariantsExcept :exec
+delete from item_variant
+where iid = @iid and not (sku = any(@skus::text[]));
+
+-- name: DeleteCartItemsWithoutVariant :exec
+delete from cart where iid = $1 and vrid is null;
+
 -- name: CreateTransaction :one
-insert into transaction (bid, vid, iid, amt, qty_bought, t_time) values($1, $2, $3, $4, $5, now()) returning tid;
+insert into transaction (bid, vid, iid, amt, qty_bought, t_time, vrid) values($1, $2, $3, $4, $5, now(), $6) returning tid;
 
 -- name: GetTransactionsForVendor :many
-select item.name, amt, t_time from transaction 
+select transaction.tid, item.name, amt, t_time, item_variant.sku from transaction
 left join item on item.iid = transaction.iid
-where transaction.vid = $1 
-order by t_time desc;
+left join item_variant on item_variant.vrid = transaction.vrid
+where transaction.vid = @vid
+    and (sqlc.narg(after_tid)::uuid is null or (t_time, tid) < (sqlc.narg(after_t_time)::timestamp, sqlc.narg(after_tid)))
+order by t_time desc, tid desc
+limit @row_limit;
 
 
 -- name: GetTotalSales :one
@@ -173,40 +451,548 @@ update item set quantity = quantity - $3
 where iid = $1
 and vid = $2;
 
+-- name: ReduceQuantityOfVariant :exec
+update item_variant set quantity = quantity - $2
+where vrid = $1;
+
 -- name: GetCartItemsForBuyer :many
 select
     vendor.name as vendor_name,
     item.name,
-    item.cost,
+    coalesce(item_variant.cost, item.cost)::decimal(12, 2) as cost,
     item.pictureurl,
     cart.quantity,
     cart.added_time,
     item.iid,
-    item.vid 
+    item.vid,
+    cart.vrid,
+    item_variant.sku,
+    item_variant.options
 from
     cart
 left join vendor on
     vendor.uid = cart.vid
 left join item on
     item.iid = cart.iid
+left join item_variant on
+    item_variant.vrid = cart.vrid
 where
     cart.bid = $1
 order by
     added_time desc;
 
 -- name: AddToCart :exec
-insert into cart (bid, iid, vid, quantity) values($1, $2, $3, $4);
+insert into cart (bid, iid, vid, quantity, vrid) values($1, $2, $3, $4, $5);
 
 -- name: GetCartItem :one
 select bid, iid, vid from cart
-where bid = $1 and iid = $2 and vid = $3;
+where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $4;
 
 -- name: DeleteCartItem :exec
-delete from cart where bid = $1 and iid = $2 and vid = $3;
+delete from cart where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $4;
 
 -- name: UpdateQuantityOfCartItem :exec
 update cart set quantity = $4
-where bid = $1 and iid = $2 and vid = $3;
+where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $5;
 
 -- name: ClearCart :exec
 delete from cart where bid = $1;
+
+-- name: CreateSession :one
+insert into session (uid, mfa, user_agent, ip) values ($1, $2, $3, $4) returning sid;
+
+-- name: GetSession :one
+select * from session where sid = $1 limit 1;
+
+-- name: RevokeSession :exec
+update session set revoked_at = now()
+where sid = $1 and revoked_at is null;
+
+-- name: RevokeSessionsForUser :exec
+update session set revoked_at = now()
+where uid = $1 and revoked_at is null;
+
+-- name: InsertRefreshToken :exec
+insert into refresh_token (token_hash, sid, expires_at) values ($1, $2, $3);
+
+-- name: GetRefreshToken :one
+select
+    refresh_token.token_hash,
+    refresh_token.sid,
+    refresh_token.expires_at,
+    refresh_token.used_at,
+    session.uid,
+    session.revoked_at,
+    session.mfa
+from
+    refresh_token
+inner join session on
+    session.sid = refresh_token.sid
+where
+    refresh_token.token_hash = $1
+limit 1;
+
+-- name: UseRefreshToken :execrows
+update refresh_token set used_at = now()
+where token_hash = $1 and used_at is null;
+
+-- name: UpdatePasshash :exec
+update "user" set passhash = $1 where uid = $2;
+
+-- name: InsertPasswordReset :exec
+insert into password_reset (token_hash, uid, expires_at) values ($1, $2, $3);
+
+-- name: GetPasswordReset :one
+select * from password_reset where token_hash = $1 limit 1;
+
+-- name: UsePasswordReset :execrows
+update password_reset set used_at = now()
+where token_hash = $1 and used_at is null;
+
+-- name: InvalidatePasswordResetsForUser :exec
+update password_reset set used_at = now()
+where uid = $1 and used_at is null;
+
+-- name: VerifyUserEmail :execrows
+update "user" set email_verified = true
+where uid = $1 and email = $2;
+
+-- name: UpsertEmailException :exec
+insert into email_exception (email, user_type, note, created_by) values ($1, $2, $3, $4)
+on conflict (email) do update set user_type = excluded.user_type, note = excluded.note, created_by = excluded.created_by;
+
+-- name: GetEmailException :one
+select * from email_exception where email = $1 limit 1;
+
+-- name: ListEmailExceptions :many
+select * from email_exception order by created_at desc;
+
+-- name: DeleteEmailException :execrows
+delete from email_exception where email = $1;
+
+-- name: GetLoginAttempt :one
+select * from login_attempt where subject = $1 limit 1;
+
+-- name: RecordLoginFailure :one
+insert into login_attempt (subject, failures, last_failure_at) values (@subject, 1, @now)
+on conflict (subject) do update set
+    failures = case when login_attempt.last_failure_at < @reset_before then 1 else login_attempt.failures + 1 end,
+    last_failure_at = @now
+returning failures;
+
+-- name: LockLoginSubject :exec
+update login_attempt set locked_until = $2 where subject = $1;
+
+-- name: ClearLoginAttempts :execrows
+delete from login_attempt where subject = $1;
+
+-- name: GetSessionStatus :one
+select
+    session.uid,
+    session.revoked_at,
+    user_suspension.suspended_at
+from
+    session
+left join user_suspension on
+    user_suspension.uid = session.uid
+where
+    session.sid = $1
+limit 1;
+
+-- name: GetUserStatus :one
+select
+    "user".email,
+    "user".isadmin,
+    user_suspension.suspended_at,
+    exists(select 1 from buyer where buyer.uid = "user".uid) as is_buyer,
+    exists(select 1 from vendor where vendor.uid = "user".uid) as is_vendor,
+    exists(select 1 from mfa_totp where mfa_totp.uid = "user".uid and mfa_totp.enabled_at is not null) as mfa_enabled,
+    exists(select 1 from account_deletion where account_deletion.uid = "user".uid) as is_deleted
+from
+    "user"
+left join user_suspension on
+    user_suspension.uid = "user".uid
+where
+    "user".uid = $1
+limit 1;
+
+-- name: SuspendUser :execrows
+insert into user_suspension (uid, reason, suspended_by) values ($1, $2, $3)
+on conflict (uid) do nothing;
+
+-- name: ReinstateUser :execrows
+delete from user_suspension where uid = $1;
+
+-- name: TakeDownItem :execrows
+insert into item_takedown (iid, reason, taken_down_by) values ($1, $2, $3)
+on conflict (iid) do nothing;
+
+-- name: RestoreItem :execrows
+delete from item_takedown where iid = $1;
+
+-- name: SearchUsers :many
+select
+    "user".uid,
+    "user".email,
+    "user".isadmin,
+    "user".email_verified,
+    coalesce(buyer.name, vendor.name, '')::varchar as name,
+    (case when buyer.uid is not null then 'buyer' else 'vendor' end)::varchar as user_type,
+    user_suspension.suspended_at,
+    user_suspension.reason as suspension_reason
+from
+    "user"
+left join buyer on
+    buyer.uid = "user".uid
+left join vendor on
+    vendor.uid = "user".uid
+left join user_suspension on
+    user_suspension.uid = "user".uid
+where
+    (@query::text = ''
+    or "user".email ilike '%' || @query || '%'
+    or buyer.name ilike '%' || @query || '%'
+    or vendor.name ilike '%' || @query || '%')
+    and (not @suspended_only::boolean or user_suspension.uid is not null)
+order by
+    "user".email
+limit @row_limit offset @row_offset;
+
+-- name: SearchVendors :many
+select
+    vendor.uid,
+    "user".email,
+    vendor.name,
+    vendor.logo,
+    user_suspension.suspended_at,
+    (select count(*) from item where item.vid = vendor.uid) as item_count,
+    (select coalesce(sum(amt), 0)::decimal(12, 2) from transaction where transaction.vid = vendor.uid) as total_sales
+from
+    vendor
+inner join "user" on
+    "user".uid = vendor.uid
+left join user_suspension on
+    user_suspension.uid = vendor.uid
+where
+    (@query::text = ''
+    or "user".email ilike '%' || @query || '%'
+    or vendor.name ilike '%' || @query || '%')
+    and (not @suspended_only::boolean or user_suspension.uid is not null)
+order by
+    vendor.name
+limit @row_limit offset @row_offset;
+
+-- name: SearchItems :many
+select
+    item.iid,
+    item.vid,
+    item.name,
+    item.category,
+    item.quantity,
+    item.cost,
+    vendor.name as vendor_name,
+    item_takedown.taken_down_at,
+    item_takedown.reason as takedown_reason
+from
+    item
+inner join vendor on
+    vendor.uid = item.vid
+left join item_takedown on
+    item_takedown.iid = item.iid
+where
+    (@query::text = ''
+    or item.name ilike '%' || @query || '%'
+    or item.description ilike '%' || @query || '%'
+    or vendor.name ilike '%' || @query || '%')
+    and (not @taken_down_only::boolean or item_takedown.iid is not null)
+order by
+    item.name
+limit @row_limit offset @row_offset;
+
+-- name: GetPlatformSales :one
+select
+    count(*) as transactions,
+    coalesce(sum(qty_bought), 0)::bigint as items_sold,
+    coalesce(sum(amt), 0)::decimal(12, 2) as total
+from
+    transaction
+where
+    (sqlc.narg(since)::timestamp is null or t_time >= sqlc.narg(since))
+    and (sqlc.narg(until)::timestamp is null or t_time < sqlc.narg(until));
+
+-- name: GetSalesByVendor :many
+select
+    transaction.vid,
+    vendor.name as vendor_name,
+    count(*) as transactions,
+    coalesce(sum(qty_bought), 0)::bigint as items_sold,
+    coalesce(sum(amt), 0)::decimal(12, 2) as total
+from
+    transaction
+inner join vendor on
+    vendor.uid = transaction.vid
+where
+    (sqlc.narg(since)::timestamp is null or t_time >= sqlc.narg(since))
+    and (sqlc.narg(until)::timestamp is null or t_time < sqlc.narg(until))
+group by
+    transaction.vid,
+    vendor.name
+order by
+    total desc;
+
+-- name: MarkSessionMfa :exec
+update session set mfa = true where sid = $1;
+
+-- name: UpsertTotpSecret :execrows
+insert into mfa_totp (uid, secret) values ($1, $2)
+on conflict (uid) do update set secret = excluded.secret, created_at = now()
+where mfa_totp.enabled_at is null;
+
+-- name: GetTotp :one
+select * from mfa_totp where uid = $1 limit 1;
+
+-- name: EnableTotp :execrows
+update mfa_totp set enabled_at = now(), last_used_step = $2
+where uid = $1 and enabled_at is null;
+
+-- name: UseTotpStep :execrows
+update mfa_totp set last_used_step = $2
+where uid = $1 and enabled_at is not null and last_used_step < $2;
+
+-- name: DeleteTotp :exec
+delete from mfa_totp where uid = $1;
+
+-- name: InsertRecoveryCode :exec
+insert into mfa_recovery_code (code_hash, uid) values ($1, $2);
+
+-- name: DeleteRecoveryCodes :exec
+delete from mfa_recovery_code where uid = $1;
+
+-- name: UseRecoveryCode :execrows
+update mfa_recovery_code set used_at = now()
+where code_hash = $1 and uid = $2 and used_at is null;
+
+-- name: CountRecoveryCodes :one
+select count(*) from mfa_recovery_code where uid = $1 and used_at is null;
+
+-- name: GetSetting :one
+select value from platform_setting where name = $1 limit 1;
+
+-- name: UpsertSetting :exec
+insert into platform_setting (name, value, updated_by) values ($1, $2, $3)
+on conflict (name) do update set value = excluded.value, updated_by = excluded.updated_by, updated_at = now();
+
+-- name: InsertApiKey :one
+insert into api_key (uid, name, key_hash, prefix, scopes) values ($1, $2, $3, $4, $5)
+returning kid, name, prefix, scopes, created_at, last_used_at;
+
+-- name: ListApiKeys :many
+select kid, name, prefix, scopes, created_at, last_used_at from api_key
+where uid = $1 and revoked_at is null
+order by created_at desc;
+
+-- name: RevokeApiKey :execrows
+update api_key set revoked_at = now()
+where kid = $1 and uid = $2 and revoked_at is null;
+
+-- name: GetApiKeyByHash :one
+select
+    api_key.kid,
+    api_key.uid,
+    api_key.scopes,
+    "user".email,
+    user_suspension.suspended_at,
+    exists(select 1 from vendor where vendor.uid = api_key.uid) as is_vendor
+from
+    api_key
+inner join "user" on
+    "user".uid = api_key.uid
+left join user_suspension on
+    user_suspension.uid = api_key.uid
+where
+    api_key.key_hash = $1
+    and api_key.revoked_at is null
+limit 1;
+
+-- name: TouchApiKey :exec
+update api_key set last_used_at = now()
+where kid = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute');
+
+-- name: ListActiveSessions :many
+select sid, created_at, last_seen_at, user_agent, ip, mfa from session
+where
+    uid = $1
+    and revoked_at is null
+    and exists(
+        select 1 from refresh_token
+        where refresh_token.sid = session.sid and used_at is null and expires_at > now()
+    )
+order by coalesce(last_seen_at, created_at) desc;
+
+-- name: RevokeUserSession :execrows
+update session set revoked_at = now()
+where sid = $1 and uid = $2 and revoked_at is null;
+
+-- name: RevokeOtherSessions :execrows
+update session set revoked_at = now()
+where uid = $1 and sid <> $2 and revoked_at is null;
+
+-- name: TouchSession :exec
+update session set last_seen_at = now() where sid = $1;
+
+-- name: ChangeUserEmail :execrows
+update "user" set email = @new_email, email_verified = true
+where uid = @uid and email = @old_email;
+
+-- name: ScheduleAccountDeletion :execrows
+insert into account_deletion (uid, purge_after) values ($1, $2)
+on conflict (uid) do nothing;
+
+-- name: CancelAccountDeletion :execrows
+delete from account_deletion where uid = $1 and anonymized_at is null;
+
+-- name: RevokeApiKeysForUser :exec
+update api_key set revoked_at = now()
+where uid = $1 and revoked_at is null;
+
+-- name: DeleteCartItemsForVendor :exec
+delete from cart where vid = $1;
+
+-- name: ListDueAccountDeletions :many
+select uid from account_deletion
+where anonymized_at is null and purge_after <= now()
+order by purge_after
+limit $1;
+
+-- name: ClaimAccountDeletion :execrows
+update account_deletion set anonymized_at = now()
+where uid = $1 and anonymized_at is null and purge_after <= now();
+
+-- name: AnonymizeUser :exec
+with anonymized_buyer as (
+    update buyer set name = 'deleted-' || buyer.uid::text where buyer.uid = $1
+), anonymized_vendor as (
+    update vendor set name = 'deleted-' || vendor.uid::text, logo = null where vendor.uid = $1
+), payout_accounts as (
+    delete from accounts where accounts.uid = $1
+), cart_items as (
+    delete from cart where cart.bid = $1
+), sessions as (
+    delete from session where session.uid = $1
+), password_resets as (
+    delete from password_reset where password_reset.uid = $1
+), totp as (
+    delete from mfa_totp where mfa_totp.uid = $1
+), recovery_codes as (
+    delete from mfa_recovery_code where mfa_recovery_code.uid = $1
+), api_keys as (
+    delete from api_key where api_key.uid = $1
+), identities as (
+    delete from user_identity where user_identity.uid = $1
+), auth_events as (
+    update auth_event set email = null, ip = null, user_agent = null where auth_event.uid = $1
+), login_attempts as (
+    delete from login_attempt
+    where login_attempt.subject = (select 'account:' || lower(u.email) from "user" u where u.uid = $1)
+)
+update "user"
+set
+    email = 'deleted-' || "user".uid::text || '@deleted.invalid',
+    passhash = '',
+    isadmin = false,
+    email_verified = false
+where "user".uid = $1;
+
+-- name: ListPurchasesForBuyer :many
+select
+    transaction.tid,
+    vendor.name as vendor_name,
+    item.name as item_name,
+    item_variant.sku,
+    transaction.amt,
+    transaction.qty_bought,
+    transaction.t_time
+from
+    transaction
+left join vendor on
+    vendor.uid = transaction.vid
+left join item on
+    item.iid = transaction.iid
+left join item_variant on
+    item_variant.vrid = transaction.vrid
+where
+    transaction.bid = $1
+order by
+    transaction.t_time desc;
+
+-- name: ListSalesForVendor :many
+select
+    transaction.tid,
+    item.name as item_name,
+    item_variant.sku,
+    transaction.amt,
+    transaction.qty_bought,
+    transaction.t_time
+from
+    transaction
+left join item on
+    item.iid = transaction.iid
+left join item_variant on
+    item_variant.vrid = transaction.vrid
+where
+    transaction.vid = $1
+order by
+    transaction.t_time desc;
+
+-- name: InsertAuthEvent :exec
+insert into auth_event (uid, actor, event, outcome, email, ip, user_agent, detail)
+values ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: SearchAuthEvents :many
+select * from auth_event
+where
+    (sqlc.narg(uid)::uuid is null or uid = sqlc.narg(uid))
+    and (sqlc.narg(actor)::uuid is null or actor = sqlc.narg(actor))
+    and (sqlc.narg(event)::text is null or event = sqlc.narg(event))
+    and (sqlc.narg(outcome)::text is null or outcome = sqlc.narg(outcome))
+    and (sqlc.narg(email)::text is null or email = lower(sqlc.narg(email)))
+    and (sqlc.narg(ip)::text is null or ip = sqlc.narg(ip))
+    and (sqlc.narg(since)::timestamp is null or created_at >= sqlc.narg(since))
+    and (sqlc.narg(until)::timestamp is null or created_at < sqlc.narg(until))
+order by
+    created_at desc, eid desc
+limit @row_limit offset @row_offset;
+
+-- name: ListRecentAuthEvents :many
+select eid, event, outcome, ip, user_agent, detail, created_at from auth_event
+where uid = $1
+order by created_at desc, eid desc
+limit $2;
+
+-- name: DeleteExpiredOidcLogins :exec
+delete from oidc_login where expires_at < now();
+
+-- name: InsertOidcLogin :exec
+insert into oidc_login (state_hash, nonce, code_verifier, expires_at) values ($1, $2, $3, $4);
+
+-- name: ClaimOidcLogin :one
+delete from oidc_login where state_hash = $1
+returning nonce, code_verifier, expires_at;
+
+-- name: GetUserIdentity :one
+select uid from user_identity where issuer = $1 and subject = $2;
+
+-- name: InsertUserIdentity :exec
+insert into user_identity (issuer, subject, uid, email, last_login_at) values ($1, $2, $3, $4, now());
+
+-- name: TouchUserIdentity :exec
+update user_identity set email = $3, last_login_at = now()
+where issuer = $1 and subject = $2;
+
+-- name: ListUserIdentities :many
+select issuer, subject, email, created_at, last_login_at from user_identity
+where uid = $1
+order by created_at;
+
+-- name: BuyerNameTaken :one
+select exists(select 1 from buyer where name = $1);
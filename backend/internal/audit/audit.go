@@ -0,0 +1,170 @@
+// Package audit records security relevant account events, such as logins and credential changes,
+// in the append-only auth_event table.
+package audit
+
+import (
+	"backend/db"
+	"backend/internal/logging"
+	"backend/internal/principal"
+	"backend/repository"
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Event types
+const (
+	Login                 = "login"
+	LoginMFA              = "login_mfa"
+	Logout                = "logout"
+	RefreshTokenReuse     = "refresh_token_reuse"
+	TokenRejected         = "token_rejected"
+	APIKeyRejected        = "api_key_rejected"
+	PasswordChange        = "password_change"
+	PasswordResetRequest  = "password_reset_request"
+	PasswordReset         = "password_reset"
+	EmailChangeRequest    = "email_change_request"
+	EmailChange           = "email_change"
+	MFAEnable             = "mfa_enable"
+	MFADisable            = "mfa_disable"
+	RecoveryCodesReplaced = "recovery_codes_replaced"
+	APIKeyCreate          = "api_key_create"
+	APIKeyRevoke          = "api_key_revoke"
+	SessionRevoke         = "session_revoke"
+	RoleGrant             = "role_grant"
+	AccountDelete         = "account_delete"
+	AccountRestore        = "account_restore"
+	AccountAnonymize      = "account_anonymize"
+	AccountSuspend        = "account_suspend"
+	AccountReinstate      = "account_reinstate"
+	LoginUnlock           = "login_unlock"
+	IdentityLink          = "identity_link"
+)
+
+// Outcomes of an event
+const (
+	Success = "success"
+	Failure = "failure" // Wrong credentials or an invalid token
+	Denied  = "denied"  // Correct credentials refused by policy, e.g. a suspended account or a lockout
+)
+
+// Column sizes of auth_event
+const (
+	maxEmail     = 255
+	maxIP        = 45
+	maxUserAgent = 512
+	maxDetail    = 255
+)
+
+// Event is one row of the audit log
+type Event struct {
+	Uid       pgtype.UUID // Account the event is about
+	Actor     pgtype.UUID // Who caused it, the account itself unless an admin acted on it
+	Type      string
+	Outcome   string
+	Email     string // Email the attempt named, kept for failed logins to unknown accounts
+	IP        string
+	UserAgent string
+	Detail    string
+}
+
+// By starts an event caused by the authenticated caller on their own account
+func By(p principal.Principal, eventType, outcome string) Event {
+	return Event{
+		Uid:       p.Uid,
+		Actor:     p.Uid,
+		Type:      eventType,
+		Outcome:   outcome,
+		IP:        p.IP,
+		UserAgent: p.UserAgent,
+	}
+}
+
+// Recorder appends events to the audit log. Implementations must be safe for concurrent use.
+type Recorder interface {
+	Record(ctx context.Context, e Event)
+}
+
+// Default is the recorder Record writes to, main replaces it with a PgRecorder
+var Default Recorder = &MemoryRecorder{}
+
+// Record appends an event to the audit log through Default
+func Record(ctx context.Context, e Event) {
+	Default.Record(ctx, e)
+}
+
+// optional returns nil for an empty string so the column is left null, cutting s to at most max bytes without
+// splitting a character. Postgres refuses invalid UTF-8, so invalid bytes from headers are replaced first.
+func optional(s string, max int) *string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	return &s
+}
+
+// PgRecorder writes events to the auth_event table
+type PgRecorder struct {
+	Pool db.Pool
+}
+
+// Record implements the Recorder interface. Failing to write an event is logged but does not fail the
+// request the event belongs to.
+func (r PgRecorder) Record(ctx context.Context, e Event) {
+	q := repository.New(r.Pool)
+	err := q.InsertAuthEvent(ctx, repository.InsertAuthEventParams{
+		Uid:       e.Uid,
+		Actor:     e.Actor,
+		Event:     e.Type,
+		Outcome:   e.Outcome,
+		Email:     optional(strings.ToLower(e.Email), maxEmail),
+		Ip:        optional(e.IP, maxIP),
+		UserAgent: optional(e.UserAgent, maxUserAgent),
+		Detail:    optional(e.Detail, maxDetail),
+	})
+	if err != nil {
+		logging.Errorf("Error recording %s event -> %v", e.Type, err)
+	}
+}
+
+// MemoryRecorder keeps events in memory, used in tests
+type MemoryRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Record implements the Recorder interface by keeping the event
+func (r *MemoryRecorder) Record(ctx context.Context, e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events returns a copy of every recorded event, oldest first
+func (r *MemoryRecorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// Last returns the most recent event of the given type
+func (r *MemoryRecorder) Last(eventType string) (Event, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].Type == eventType {
+			return r.events[i], true
+		}
+	}
+	return Event{}, false
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestOptional(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		max  int
+		want *string
+	}{
+		{"Empty", "", 10, nil},
+		{"Short", "curl/8.0", 10, utils.MakePointer("curl/8.0")},
+		{"Cut", "curl/8.0.1", 4, utils.MakePointer("curl")},
+		// "é" is two bytes, cutting after its first byte would leave invalid UTF-8
+		{"Cut before a multi-byte character", "café", 4, utils.MakePointer("caf")},
+		{"Cut after a multi-byte character", "café", 5, utils.MakePointer("café")},
+		{"Four byte character", "ok 🙂", 5, utils.MakePointer("ok ")},
+		{"Invalid bytes", "bad\xff", 10, utils.MakePointer("bad�")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := optional(tt.in, tt.max)
+			assert.Equal(t, tt.want, got)
+			if got != nil {
+				assert.True(t, utf8.ValidString(*got))
+				assert.LessOrEqual(t, len(*got), tt.max)
+			}
+		})
+	}
+}
+
+func TestPgRecorder(t *testing.T) {
+	ctx := context.Background()
+	uid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	t.Run("Non-ASCII user agent", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		var params []any
+		it.SetupMock(mockPool, "Exec", []any{ctx, repository.InsertAuthEvent, mock.Anything}, pgconn.NewCommandTag("INSERT 0 1"), nil).
+			Run(func(args mock.Arguments) {
+				params = args.Get(2).([]any)
+			})
+
+		// Cutting at maxUserAgent bytes lands in the middle of a two byte character
+		userAgent := "Mozilla/5.0 (" + strings.Repeat("ü", maxUserAgent)
+		PgRecorder{Pool: mockPool}.Record(ctx, Event{
+			Uid:       uid,
+			Actor:     uid,
+			Type:      Login,
+			Outcome:   Success,
+			Email:     "ÀMA@test.com",
+			UserAgent: userAgent,
+		})
+
+		mockPool.AssertExpectations(t)
+		stored := *params[6].(*string)
+		assert.True(t, utf8.ValidString(stored))
+		assert.LessOrEqual(t, len(stored), maxUserAgent)
+		assert.True(t, strings.HasPrefix(userAgent, stored))
+		assert.Equal(t, "àma@test.com", *params[4].(*string))
+	})
+}
@@ -0,0 +1,414 @@
+// Package keys manages the asymmetric keys tokens are signed with.
+//
+// Keys live in a directory as PKCS#8 PEM files named <kid>.pem, so every backend instance sharing the
+// directory signs and verifies with the same keys. A key starts signing at its activation time, taken
+// from an "Activates-At" PEM header or else the file's modification time, and the newest active key is
+// used for signing. Older keys keep verifying for a retention period after being replaced so tokens
+// issued before a rotation stay valid until they expire.
+package keys
+
+import (
+	"backend/internal/logging"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+)
+
+// activatesAtHeader is the PEM header recording when a key starts signing
+const activatesAtHeader = "Activates-At"
+
+// Methods lists the algorithms tokens may be signed with, anything else is rejected when parsing
+var Methods = []string{EdDSA, RS256}
+
+var errNoSigningKey = errors.New("no active signing key")
+
+// Key is a single signing key
+type Key struct {
+	ID          string
+	Algorithm   string
+	ActivatesAt time.Time
+	signer      crypto.Signer
+}
+
+// Public returns the key used to verify tokens signed by k
+func (k *Key) Public() crypto.PublicKey {
+	return k.signer.Public()
+}
+
+// method returns the jwt signing method for the key's algorithm
+func (k *Key) method() jwt.SigningMethod {
+	if k.Algorithm == RS256 {
+		return jwt.SigningMethodRS256
+	}
+	return jwt.SigningMethodEdDSA
+}
+
+// Rotation describes how often keys are replaced and how long replaced keys keep verifying
+type Rotation struct {
+	Algorithm string        // Algorithm for generated keys
+	Every     time.Duration // Age after which a new key is generated, zero disables rotation
+	Overlap   time.Duration // Delay between generating a key and signing with it, lets other instances load it first
+	Retain    time.Duration // How long a replaced key keeps verifying, at least the longest token lifetime
+}
+
+// DefaultRotation rotates Ed25519 keys every 30 days
+var DefaultRotation = Rotation{
+	Algorithm: EdDSA,
+	Every:     time.Hour * 24 * 30,
+	Overlap:   time.Minute * 10,
+	Retain:    time.Hour * 24 * 7,
+}
+
+// KeySet is the set of signing and verification keys, it is safe for concurrent use
+type KeySet struct {
+	Dir      string // Key directory, empty keeps keys in memory only
+	Rotation Rotation
+	Now      func() time.Time // Clock used for activation and retirement, defaults to time.Now
+
+	mu   sync.RWMutex
+	keys []*Key // Sorted by activation, oldest first
+}
+
+// Default is the key set tokens are signed and verified with. It starts out with a single in-memory
+// key, main replaces it with a directory backed set.
+var Default = func() *KeySet {
+	ks := &KeySet{Rotation: DefaultRotation}
+	if _, err := ks.generate(ks.clock()); err != nil {
+		panic(err)
+	}
+	return ks
+}()
+
+// Load creates a key set from a directory, generating the first key if there are none
+func Load(dir string, rotation Rotation) (*KeySet, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{Dir: dir, Rotation: rotation}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	if err := ks.Rotate(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) clock() time.Time {
+	if ks.Now != nil {
+		return ks.Now()
+	}
+	return time.Now()
+}
+
+// Reload reads every key in the directory, replacing the keys held in memory
+func (ks *KeySet) Reload() error {
+	if ks.Dir == "" {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(ks.Dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return fmt.Errorf("loading key %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	sortKeys(keys)
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.mu.Unlock()
+	return nil
+}
+
+// Rotate generates a new key once the newest key is older than the rotation period, or when there are no keys
+func (ks *KeySet) Rotate() error {
+	now := ks.clock()
+
+	ks.mu.RLock()
+	var newest *Key
+	if len(ks.keys) > 0 {
+		newest = ks.keys[len(ks.keys)-1]
+	}
+	ks.mu.RUnlock()
+
+	switch {
+	case newest == nil:
+		// Nothing can be signed until a key exists, so the first one is active straight away
+		_, err := ks.generate(now)
+		return err
+	case ks.Rotation.Every > 0 && now.Sub(newest.ActivatesAt) >= ks.Rotation.Every:
+		key, err := ks.generate(now.Add(ks.Rotation.Overlap))
+		if err == nil {
+			logging.Infof("Rotated signing key, %s activates at %v", key.ID, key.ActivatesAt)
+		}
+		return err
+	}
+	return nil
+}
+
+// Watch reloads the directory and rotates keys every interval until ctx is done
+func (ks *KeySet) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				logging.Errorf("Error reloading signing keys -> %v", err)
+				continue
+			}
+			if err := ks.Rotate(); err != nil {
+				logging.Errorf("Error rotating signing keys -> %v", err)
+			}
+		}
+	}
+}
+
+// generate creates a new key activating at the given time, writing it to the directory if there is one
+func (ks *KeySet) generate(activatesAt time.Time) (*Key, error) {
+	key, err := newKey(ks.Rotation.Algorithm, activatesAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if ks.Dir != "" {
+		if err = writeKey(filepath.Join(ks.Dir, key.ID+".pem"), key); err != nil {
+			return nil, err
+		}
+	}
+
+	ks.mu.Lock()
+	ks.keys = append(ks.keys, key)
+	sortKeys(ks.keys)
+	ks.mu.Unlock()
+	return key, nil
+}
+
+// signing returns the newest key that has activated
+func (ks *KeySet) signing(now time.Time) *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if !ks.keys[i].ActivatesAt.After(now) {
+			return ks.keys[i]
+		}
+	}
+	return nil
+}
+
+// verifying returns the keys tokens may currently be signed with, including keys that are about to
+// activate so other instances can start using them before this one reloads
+func (ks *KeySet) verifying(now time.Time) []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var keys []*Key
+	for i, key := range ks.keys {
+		// A key is retired once its successor has been signing for longer than the retention period
+		if i+1 < len(ks.keys) {
+			successor := ks.keys[i+1].ActivatesAt
+			if !successor.After(now) && now.Sub(successor) > ks.Rotation.Retain {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Sign signs claims with the current signing key, recording its kid in the token header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := ks.signing(ks.clock())
+	if key == nil {
+		return "", errNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signer)
+}
+
+// Keyfunc finds the verification key for a token by its kid, it is meant to be passed to jwt.Parse
+func (ks *KeySet) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	for _, key := range ks.verifying(ks.clock()) {
+		if key.ID != kid {
+			continue
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s for key %s", t.Method.Alg(), kid)
+		}
+		return key.Public(), nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys tokens may currently be verified with
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.verifying(ks.clock()) {
+		jwk := JWK{Kid: key.ID, Alg: key.Algorithm, Use: "sig"}
+
+		switch pub := key.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// sortKeys orders keys by activation time, oldest first
+func sortKeys(keys []*Key) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ActivatesAt.Before(keys[j].ActivatesAt)
+	})
+}
+
+// newKey generates a key for the algorithm, kids are random so instances rotating at once cannot collide
+func newKey(algorithm string, activatesAt time.Time) (*Key, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch algorithm {
+	case EdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case RS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		ID:          activatesAt.UTC().Format("20060102") + "-" + hex.EncodeToString(id),
+		Algorithm:   algorithm,
+		ActivatesAt: activatesAt,
+		signer:      signer,
+	}, nil
+}
+
+// readKey parses a PKCS#8 PEM key file, the file name is the kid
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("expected a PKCS#8 PRIVATE KEY PEM block")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Algorithm, key.signer = EdDSA, k
+	case *rsa.PrivateKey:
+		key.Algorithm, key.signer = RS256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if activatesAt, ok := block.Headers[activatesAtHeader]; ok {
+		key.ActivatesAt, err = time.Parse(time.RFC3339, activatesAt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		key.ActivatesAt = info.ModTime()
+	}
+	return key, nil
+}
+
+// writeKey stores a key as a PKCS#8 PEM file recording its activation time
+func writeKey(path string, key *Key) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{activatesAtHeader: key.ActivatesAt.UTC().Format(time.RFC3339)},
+		Bytes:   der,
+	})
+	return os.WriteFile(path, data, 0o600)
+}
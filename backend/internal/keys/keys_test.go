@@ -0,0 +1,197 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRotation = Rotation{Algorithm: EdDSA, Every: time.Hour * 24, Overlap: time.Minute * 10, Retain: time.Hour}
+
+// memorySet returns an in-memory key set with one key and a clock the test moves by changing now
+func memorySet(t *testing.T, rotation Rotation, now *time.Time) *KeySet {
+	ks := &KeySet{Rotation: rotation, Now: func() time.Time { return *now }}
+	assert.NoError(t, ks.Rotate())
+	return ks
+}
+
+// verify parses a token with the key set, the way utils.ParseJWT does
+func verify(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc, jwt.WithValidMethods(Methods))
+	return err
+}
+
+// kidOf returns the kid header of a signed token without verifying it
+func kidOf(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	assert.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
+
+func TestRotate(t *testing.T) {
+	now := time.Now()
+	ks := memorySet(t, testRotation, &now)
+	first := ks.keys[0]
+
+	t.Run("Young key is kept", func(t *testing.T) {
+		now = now.Add(testRotation.Every - time.Minute)
+		assert.NoError(t, ks.Rotate())
+		assert.Len(t, ks.keys, 1)
+	})
+
+	t.Run("Old key is replaced after the overlap", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		assert.NoError(t, ks.Rotate())
+		assert.Len(t, ks.keys, 2)
+		second := ks.keys[1]
+		assert.Equal(t, now.Add(testRotation.Overlap), second.ActivatesAt)
+
+		// The new key is published straight away but the old one signs until it activates
+		token, err := ks.Sign(jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, first.ID, kidOf(t, token))
+		assert.Len(t, ks.JWKS().Keys, 2)
+
+		now = now.Add(testRotation.Overlap)
+		token, err = ks.Sign(jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, second.ID, kidOf(t, token))
+	})
+
+	t.Run("Rotation disabled", func(t *testing.T) {
+		now := time.Now()
+		fixed := memorySet(t, Rotation{Algorithm: EdDSA}, &now)
+
+		now = now.Add(time.Hour * 24 * 365)
+		assert.NoError(t, fixed.Rotate())
+		assert.Len(t, fixed.keys, 1)
+	})
+
+	t.Run("No active key", func(t *testing.T) {
+		now := time.Now()
+		empty := &KeySet{Rotation: testRotation, Now: func() time.Time { return now }}
+		_, err := empty.generate(now.Add(time.Minute))
+		assert.NoError(t, err)
+
+		_, err = empty.Sign(jwt.MapClaims{})
+		assert.ErrorIs(t, err, errNoSigningKey)
+	})
+}
+
+func TestRetiredKeys(t *testing.T) {
+	now := time.Now()
+	ks := memorySet(t, testRotation, &now)
+	old, err := ks.Sign(jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	now = now.Add(testRotation.Every)
+	assert.NoError(t, ks.Rotate())
+	now = now.Add(testRotation.Overlap)
+	current, err := ks.Sign(jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	t.Run("Replaced key verifies until the retention period ends", func(t *testing.T) {
+		now = now.Add(testRotation.Retain)
+		assert.NoError(t, verify(ks, old))
+		assert.NoError(t, verify(ks, current))
+	})
+
+	t.Run("Retired key no longer verifies", func(t *testing.T) {
+		now = now.Add(time.Second)
+		assert.Error(t, verify(ks, old))
+		assert.NoError(t, verify(ks, current))
+		assert.Len(t, ks.JWKS().Keys, 1)
+		assert.Equal(t, kidOf(t, current), ks.JWKS().Keys[0].Kid)
+	})
+}
+
+func TestKeyfunc(t *testing.T) {
+	now := time.Now()
+	ks := memorySet(t, testRotation, &now)
+
+	t.Run("Unknown kid", func(t *testing.T) {
+		other := memorySet(t, testRotation, &now)
+		token, err := other.Sign(jwt.MapClaims{})
+		assert.NoError(t, err)
+
+		assert.Error(t, verify(ks, token))
+	})
+
+	t.Run("Algorithm not matching the key", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{})
+		token.Header["kid"] = ks.keys[0].ID
+		_, err := ks.Keyfunc(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Ed25519", func(t *testing.T) {
+		ks := memorySet(t, testRotation, &now)
+		key := ks.keys[0]
+
+		jwks := ks.JWKS()
+		assert.Len(t, jwks.Keys, 1)
+		jwk := jwks.Keys[0]
+		assert.Equal(t, JWK{Kty: "OKP", Kid: key.ID, Alg: EdDSA, Use: "sig", Crv: "Ed25519", X: jwk.X}, jwk)
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		assert.NoError(t, err)
+		assert.Equal(t, key.Public().(ed25519.PublicKey), ed25519.PublicKey(x))
+	})
+
+	t.Run("RSA", func(t *testing.T) {
+		ks := memorySet(t, Rotation{Algorithm: RS256}, &now)
+		pub := ks.keys[0].Public().(*rsa.PublicKey)
+
+		jwk := ks.JWKS().Keys[0]
+		assert.Equal(t, "RSA", jwk.Kty)
+		assert.Equal(t, RS256, jwk.Alg)
+		assert.Empty(t, jwk.Crv)
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		assert.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		assert.NoError(t, err)
+		assert.Equal(t, pub.N, new(big.Int).SetBytes(n))
+		assert.Equal(t, int64(pub.E), new(big.Int).SetBytes(e).Int64())
+	})
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := Load(dir, testRotation)
+	assert.NoError(t, err)
+
+	t.Run("Keys are written with their activation time", func(t *testing.T) {
+		key := ks.keys[0]
+		read, err := readKey(filepath.Join(dir, key.ID+".pem"))
+		assert.NoError(t, err)
+		assert.Equal(t, key.ID, read.ID)
+		assert.Equal(t, key.ActivatesAt.UTC().Truncate(time.Second), read.ActivatesAt)
+	})
+
+	t.Run("Reloading keeps the same keys", func(t *testing.T) {
+		other, err := Load(dir, testRotation)
+		assert.NoError(t, err)
+		assert.Equal(t, ks.JWKS(), other.JWKS())
+	})
+
+	t.Run("Invalid key file", func(t *testing.T) {
+		badDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(badDir, "bad.pem"), []byte("not a key"), 0o600))
+
+		_, err := Load(badDir, testRotation)
+		assert.Error(t, err)
+	})
+}
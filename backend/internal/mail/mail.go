@@ -0,0 +1,145 @@
+package mail
+
+// This file defines the Mailer abstraction used to deliver transactional emails (password resets, confirmations, ...)
+// along with its SMTP, in-memory and file implementations.
+
+import (
+	"backend/internal/logging"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format renders the message as an RFC 5322 email
+func format(from string, msg Message) []byte {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("From: %s\r\n", from))
+	sb.WriteString(fmt.Sprintf("To: %s\r\n", msg.To))
+	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	sb.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(msg.Body)
+	return []byte(sb.String())
+}
+
+// SMTPMailer sends emails through an SMTP server using PLAIN auth
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements the Mailer interface using net/smtp
+func (m SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	err := smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{msg.To}, format(m.From, msg))
+	if err != nil {
+		logging.Errorf("Error sending email to %s -> %v", msg.To, err)
+		return err
+	}
+	return nil
+}
+
+// MemoryMailer keeps sent emails in memory, used in tests
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+// Send implements the Mailer interface by recording the message
+func (m *MemoryMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of every message sent so far
+func (m *MemoryMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message{}, m.sent...)
+}
+
+// Last returns the most recent message sent to the address, if any
+func (m *MemoryMailer) Last(to string) (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			return m.sent[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// FileMailer writes every email as an .eml file into Dir, used for local development
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send implements the Mailer interface by writing the message to disk
+func (m FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), strings.ReplaceAll(msg.To, "@", "_at_"))
+	path := filepath.Join(m.Dir, name)
+	if err := os.WriteFile(path, format(m.From, msg), 0o644); err != nil {
+		return err
+	}
+
+	logging.Infof("Email to %s written to %s", msg.To, path)
+	return nil
+}
+
+// Env abstracts reading optional configuration, see utils.EnvOr
+type Env func(key, fallback string) string
+
+// FromEnv builds the Mailer selected by MAIL_DRIVER (smtp, file or memory), defaulting to file
+func FromEnv(env Env) Mailer {
+	from := env("MAIL_FROM", "Ashesi Dwa <no-reply@dwa.local>")
+
+	switch strings.ToLower(env("MAIL_DRIVER", "file")) {
+	case "smtp":
+		return SMTPMailer{
+			Host:     env("SMTP_HOST", "localhost"),
+			Port:     env("SMTP_PORT", "587"),
+			Username: env("SMTP_USER", ""),
+			Password: env("SMTP_PASS", ""),
+			From:     from,
+		}
+	case "memory":
+		return &MemoryMailer{}
+	default:
+		return FileMailer{Dir: env("MAIL_DIR", "tmp/mail"), From: from}
+	}
+}
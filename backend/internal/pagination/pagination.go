@@ -0,0 +1,136 @@
+// Package pagination pages through listings by keyset: rows are read in a fixed order and a page starts after
+// the sort key of the last row of the page before it, which clients pass back as an opaque cursor. Unlike
+// offsets, pages do not skip or repeat rows while rows are added, and a deep page costs as little as the first.
+package pagination
+
+import (
+	"backend/internal/utils"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Page sizes used when a client does not ask for one and the most a client may ask for
+const (
+	DefaultLimit int32 = 20
+	MaxLimit     int32 = 100
+)
+
+// ErrInvalidCursor is returned for cursors that were not made by Encode for the same listing order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query is the page a client asks for, bound from the query string. Listings embed it in their own query.
+type Query struct {
+	Cursor string `form:"cursor" validate:"max=512"`                // next_cursor of the previous page, empty for the first
+	Limit  int32  `form:"limit" validate:"omitempty,min=1,max=100"` // Page size, DefaultLimit when empty
+}
+
+// PageLimit returns the page size asked for or DefaultLimit
+func (q Query) PageLimit() int32 {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(q.Limit, MaxLimit)
+}
+
+// cursor is what a cursor carries: the listing order it was made for and the sort key of the row it points after
+type cursor struct {
+	Order string          `json:"o"`
+	Key   json.RawMessage `json:"k"`
+}
+
+// Encode makes the cursor of the page after the row with the given sort key
+func Encode(order string, key any) (string, error) {
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	buf, err := json.Marshal(cursor{Order: order, Key: raw})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Decode reads the sort key of a cursor into key. A cursor made for another order is refused since its key
+// would skip or repeat rows in this one.
+func Decode(s, order string, key any) error {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	var c cursor
+	if err = json.Unmarshal(buf, &c); err != nil || c.Order != order {
+		return ErrInvalidCursor
+	}
+	if err = json.Unmarshal(c.Key, key); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// Trim cuts the extra row a listing reads past the page and reports whether there is another page.
+// Listings ask for limit+1 rows so the last page is known without counting.
+func Trim[T any](rows []T, limit int32) ([]T, bool) {
+	if int32(len(rows)) > limit {
+		return rows[:limit], true
+	}
+	return rows, false
+}
+
+// jsonFields returns the JSON names of the fields of T
+func jsonFields[T any]() map[string]bool {
+	names := map[string]bool{}
+	t := reflect.TypeFor[T]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Fields parses a comma separated list of the JSON fields of T a client wants returned.
+// An empty list returns nil, meaning every field.
+func Fields[T any](spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	known := jsonFields[T]()
+	var fields []string
+	for _, f := range strings.Split(spec, ",") {
+		f = strings.TrimSpace(f)
+		if !known[f] {
+			return nil, fmt.Errorf("unknown field '%s'", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// Select keeps only the given JSON fields of each item
+func Select[T any](items []T, fields []string) ([]utils.JMap, error) {
+	selected := make([]utils.JMap, 0, len(items))
+	for _, item := range items {
+		buf, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err = json.Unmarshal(buf, &all); err != nil {
+			return nil, err
+		}
+
+		row := utils.JMap{}
+		for _, f := range fields {
+			row[f] = all[f]
+		}
+		selected = append(selected, row)
+	}
+	return selected, nil
+}
@@ -0,0 +1,250 @@
+// Package password checks new passwords against a strength policy and a list of passwords known from
+// data breaches. Breach lists are looked up the k-anonymity way, by the first five hex characters of
+// the password's SHA-1 hash, so a list never needs to be handed the password or its full hash.
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy describes the passwords accepted for an account
+type Policy struct {
+	MinLength  int     // In characters
+	MaxLength  int     // In characters, bounds the work done hashing a password
+	MinEntropy float64 // Lowest accepted Entropy estimate in bits
+}
+
+// DefaultPolicy is used unless main configures another one
+var DefaultPolicy = Policy{MinLength: 8, MaxLength: 128, MinEntropy: 40}
+
+// minPersonalLen is the shortest piece of an email or name a password may not contain,
+// shorter pieces match too many passwords by accident
+const minPersonalLen = 4
+
+// Check returns what is wrong with a password, nothing if the policy accepts it. personal holds the
+// account's email and names, which the password may not contain in any case.
+func (p Policy) Check(password string, personal ...string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d characters long", p.MaxLength))
+	}
+
+	lower := strings.ToLower(password)
+	for _, piece := range personalPieces(personal) {
+		if strings.Contains(lower, piece) {
+			problems = append(problems, "must not contain your email or name")
+			break
+		}
+	}
+
+	if length >= p.MinLength && Entropy(password) < p.MinEntropy {
+		problems = append(problems, "is too easy to guess, use a longer password or mix in other kinds of characters")
+	}
+	return problems
+}
+
+// personalPieces splits emails and names into the lower case words a password may not contain
+func personalPieces(personal []string) []string {
+	var pieces []string
+	for _, s := range personal {
+		s = strings.ToLower(s)
+		local, domain, isEmail := strings.Cut(s, "@")
+		if isEmail {
+			// The whole local part, its words and the organisation in the domain
+			pieces = append(pieces, local)
+			s = local + " " + strings.Split(domain, ".")[0]
+		}
+		words := strings.FieldsFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		pieces = append(pieces, words...)
+	}
+
+	kept := pieces[:0]
+	for _, piece := range pieces {
+		if utf8.RuneCountInString(piece) >= minPersonalLen {
+			kept = append(kept, piece)
+		}
+	}
+	return kept
+}
+
+// Entropy estimates the bits needed to guess a password by brute force over the kinds of characters it
+// uses. A character repeating the one before it or continuing a run such as "abc" or "321" only adds a bit,
+// so padding a password with "aaaa" or "1234" does not make it look strong.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, kind := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if kind.used {
+			pool += kind.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+	perChar := math.Log2(float64(pool))
+
+	bits := 0.0
+	var prev rune
+	for i, r := range password {
+		d := r - prev
+		if i > 0 && (d == 0 || d == 1 || d == -1) {
+			bits++
+		} else {
+			bits += perChar
+		}
+		prev = r
+	}
+	return bits
+}
+
+// HashRange splits the upper case hex SHA-1 hash of a password into the five character prefix a breach
+// list is asked for and the suffix looked for in its answer
+func HashRange(password string) (prefix, suffix string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:5], hash[5:]
+}
+
+// BreachList holds the SHA-1 hashes of passwords exposed in data breaches
+type BreachList interface {
+	// Range returns the hash suffixes of every breached password whose hash starts with prefix
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// Breached reports whether the password is on the list
+func Breached(ctx context.Context, list BreachList, password string) (bool, error) {
+	prefix, suffix := HashRange(password)
+	suffixes, err := list.Range(ctx, prefix)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range suffixes {
+		if s == suffix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseLine reads a "HASH:COUNT" line of a breach list, the count is optional and ignored
+func parseLine(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.ToUpper(hash)
+}
+
+// NoBreachList is an empty list, used when no breach list is configured
+type NoBreachList struct{}
+
+func (NoBreachList) Range(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+// RangeDir reads a breach list split into one file per prefix, the layout the Have I Been Pwned
+// downloader produces: Dir/ABCDE.txt holds "SUFFIX:COUNT" lines for hashes starting with ABCDE.
+// Only the file for the prefix asked for is read, the full list never has to fit in memory.
+type RangeDir struct {
+	Dir string
+}
+
+func (d RangeDir) Range(ctx context.Context, prefix string) ([]string, error) {
+	f, err := os.Open(filepath.Join(d.Dir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var suffixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if suffix := parseLine(scanner.Text()); suffix != "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes, scanner.Err()
+}
+
+// MemoryList keeps a breach list in memory grouped by prefix, for small lists and tests
+type MemoryList struct {
+	ranges map[string][]string
+}
+
+// LoadList reads a breach list of full SHA-1 hashes, one "HASH:COUNT" line per password
+func LoadList(r io.Reader) (*MemoryList, error) {
+	list := &MemoryList{ranges: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		hash := parseLine(scanner.Text())
+		if hash == "" {
+			continue
+		}
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d is not a SHA-1 hash", n)
+		}
+		list.ranges[hash[:5]] = append(list.ranges[hash[:5]], hash[5:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *MemoryList) Range(ctx context.Context, prefix string) ([]string, error) {
+	return l.ranges[prefix], nil
+}
+
+// Open loads the breach list at path, a directory of range files or a single file of full hashes
+func Open(path string) (BreachList, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return RangeDir{Dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadList(f)
+}
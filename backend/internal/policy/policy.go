@@ -0,0 +1,104 @@
+// Package policy decides what an authenticated caller may do. Every ownership and role check is
+// declared once in the rules table so route groups and services ask the same question, Can.
+package policy
+
+import (
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CodeForbidden is the error code sent with every refusal
+const CodeForbidden = "forbidden"
+
+// ErrForbidden is returned when the caller may not perform an action
+var ErrForbidden = errors.New("you are not allowed to perform this action")
+
+// Action is something a caller can do to a resource
+type Action string
+
+const (
+	ItemRead        Action = "item:read"
+	ItemCreate      Action = "item:create"
+	ItemUpdate      Action = "item:update"
+	ItemDelete      Action = "item:delete"
+	TransactionRead Action = "transaction:read"
+	CartRead        Action = "cart:read"
+	CartWrite       Action = "cart:write"
+	PaymentCreate   Action = "payment:create"
+	UserUpdate      Action = "user:update"
+	UserDelete      Action = "user:delete"
+	UserExport      Action = "user:export"
+	APIKeyManage    Action = "api_key:manage"
+	SessionManage   Action = "session:manage"
+)
+
+// Scopes a scoped caller, e.g. an API key, can be limited to
+const (
+	ScopeItemsRead        = "items:read"
+	ScopeItemsWrite       = "items:write"
+	ScopeTransactionsRead = "transactions:read"
+)
+
+// Resource is what an action is performed on
+type Resource struct {
+	Owner pgtype.UUID // The user the resource belongs to, e.g. the vendor of an item or the buyer of a cart
+}
+
+// rule is the requirement for performing an action
+type rule struct {
+	role  string // Role the caller must hold, empty for any
+	owner bool   // Whether the caller must own the resource
+	scope string // Scope a scoped caller must hold, empty actions are closed to scoped callers
+}
+
+var rules = map[Action]rule{
+	ItemRead:        {role: "vendor", owner: true, scope: ScopeItemsRead},
+	ItemCreate:      {role: "vendor", owner: true, scope: ScopeItemsWrite},
+	ItemUpdate:      {role: "vendor", owner: true, scope: ScopeItemsWrite},
+	ItemDelete:      {role: "vendor", owner: true, scope: ScopeItemsWrite},
+	TransactionRead: {role: "vendor", owner: true, scope: ScopeTransactionsRead},
+	CartRead:        {role: "buyer", owner: true},
+	CartWrite:       {role: "buyer", owner: true},
+	PaymentCreate:   {role: "buyer", owner: true},
+	UserUpdate:      {owner: true},
+	UserDelete:      {owner: true},
+	UserExport:      {owner: true},
+	APIKeyManage:    {role: "vendor", owner: true},
+	SessionManage:   {owner: true},
+}
+
+// Can returns nil when the caller may perform the action on the resource and ErrForbidden otherwise.
+// Unknown actions are always refused.
+func Can(p principal.Principal, action Action, res Resource) error {
+	r, ok := rules[action]
+	if !ok {
+		return ErrForbidden
+	}
+
+	if r.role != "" && !slices.Contains(p.Roles, r.role) {
+		return ErrForbidden
+	}
+
+	if r.owner && (!p.Uid.Valid || p.Uid != res.Owner) {
+		return ErrForbidden
+	}
+
+	if len(p.Scopes) > 0 && (r.scope == "" || !p.HasScope(r.scope)) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// Authorize is Can as a service response, ServiceErr is nil when the action is allowed
+func Authorize(p principal.Principal, action Action, res Resource) utils.ServiceReturn[any] {
+	if err := Can(p, action, res); err != nil {
+		return utils.MakeCodedError(err, http.StatusForbidden, CodeForbidden)
+	}
+	return utils.ServiceReturn[any]{}
+}
@@ -0,0 +1,90 @@
+package policy
+
+import (
+	"backend/internal/principal"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	callerUid = pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	otherUid  = pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+)
+
+// callers are the kinds of principal the rules distinguish, all acting as callerUid
+var callers = map[string]principal.Principal{
+	"buyer":  {Uid: callerUid, Roles: []string{"buyer"}},
+	"vendor": {Uid: callerUid, Roles: []string{"vendor"}},
+	// Admin is a flag beside the roles, it grants nothing through the policy on its own
+	"admin":      {Uid: callerUid, Roles: []string{"buyer"}, Admin: true},
+	"multi-role": {Uid: callerUid, Roles: []string{"buyer", "vendor"}},
+	"read key":   {Uid: callerUid, Roles: []string{"vendor"}, Scopes: []string{ScopeItemsRead}},
+	"full key":   {Uid: callerUid, Roles: []string{"vendor"}, Scopes: []string{ScopeItemsRead, ScopeItemsWrite, ScopeTransactionsRead}},
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		action  Action
+		allowed []string // Callers allowed on resources they own, every caller is refused on someone else's
+	}{
+		{ItemRead, []string{"vendor", "multi-role", "read key", "full key"}},
+		{ItemCreate, []string{"vendor", "multi-role", "full key"}},
+		{ItemUpdate, []string{"vendor", "multi-role", "full key"}},
+		{ItemDelete, []string{"vendor", "multi-role", "full key"}},
+		{TransactionRead, []string{"vendor", "multi-role", "full key"}},
+		{CartRead, []string{"buyer", "admin", "multi-role"}},
+		{CartWrite, []string{"buyer", "admin", "multi-role"}},
+		{PaymentCreate, []string{"buyer", "admin", "multi-role"}},
+		// Actions with no scope are closed to scoped callers, however many scopes they hold
+		{UserUpdate, []string{"buyer", "vendor", "admin", "multi-role"}},
+		{UserDelete, []string{"buyer", "vendor", "admin", "multi-role"}},
+		{UserExport, []string{"buyer", "vendor", "admin", "multi-role"}},
+		{SessionManage, []string{"buyer", "vendor", "admin", "multi-role"}},
+		{APIKeyManage, []string{"vendor", "multi-role"}},
+		{Action("item:publish"), nil},
+	}
+
+	covered := make(map[Action]bool, len(tests))
+	for _, tt := range tests {
+		covered[tt.action] = true
+		for name, p := range callers {
+			t.Run(string(tt.action)+" by "+name, func(t *testing.T) {
+				err := Can(p, tt.action, Resource{Owner: callerUid})
+				if slices.Contains(tt.allowed, name) {
+					assert.NoError(t, err)
+				} else {
+					assert.ErrorIs(t, err, ErrForbidden)
+				}
+
+				assert.ErrorIs(t, Can(p, tt.action, Resource{Owner: otherUid}), ErrForbidden)
+			})
+		}
+	}
+
+	for action := range rules {
+		assert.True(t, covered[action], "no test for %s", action)
+	}
+
+	t.Run("Caller without a uid", func(t *testing.T) {
+		p := principal.Principal{Roles: []string{"buyer"}}
+		assert.ErrorIs(t, Can(p, CartRead, Resource{}), ErrForbidden)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	t.Run("Allowed", func(t *testing.T) {
+		sr := Authorize(callers["vendor"], ItemUpdate, Resource{Owner: callerUid})
+		assert.Nil(t, sr.ServiceErr)
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		sr := Authorize(callers["buyer"], ItemUpdate, Resource{Owner: callerUid})
+		assert.NotNil(t, sr.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, sr.ServiceErr.Status)
+		assert.Equal(t, CodeForbidden, sr.ServiceErr.Code)
+	})
+}
@@ -0,0 +1,99 @@
+// Package principal describes who is making a request. AuthMiddleware authenticates the request once
+// and stores the Principal in the gin context, handlers read it back with Get or MustGet.
+package principal
+
+import (
+	"backend/internal/utils"
+	"errors"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// contextKey is the gin context key the principal is stored under
+const contextKey = "principal"
+
+var errInvalidClaims = errors.New("invalid token claims")
+
+// Principal is the authenticated caller
+type Principal struct {
+	Uid       pgtype.UUID
+	Email     string
+	Roles     []string // buyer and/or vendor, one account can hold both profiles
+	Admin     bool     // Platform administrator, set from the isAdmin column when the token is issued
+	SessionID pgtype.UUID
+	Scopes    []string // Empty for interactive sessions, which may do anything their roles allow
+	MFA       bool     // The session was started or confirmed with a second factor
+	IP        string   // Address the request came from, set by AuthMiddleware
+	UserAgent string   // User agent the request came from, set by AuthMiddleware
+}
+
+// HasRole reports whether the caller holds the given user type
+func (p Principal) HasRole(userType utils.UserType) bool {
+	return slices.Contains(p.Roles, utils.StringifyUserType(userType))
+}
+
+// HasScope reports whether the caller may use the given scope
+func (p Principal) HasScope(scope string) bool {
+	return len(p.Scopes) == 0 || slices.Contains(p.Scopes, scope)
+}
+
+// Claims is the payload of an access token
+type Claims struct {
+	Uid    pgtype.UUID `json:"uid"`
+	Email  string      `json:"email"`
+	Roles  []string    `json:"roles"`
+	Admin  bool        `json:"admin,omitempty"`
+	Sid    pgtype.UUID `json:"sid"`
+	Scopes []string    `json:"scopes,omitempty"`
+	MFA    bool        `json:"mfa,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Principal checks the claims are complete and returns the caller they describe
+func (c *Claims) Principal() (Principal, error) {
+	if !c.Uid.Valid || !c.Sid.Valid || len(c.Roles) == 0 {
+		return Principal{}, errInvalidClaims
+	}
+	for _, role := range c.Roles {
+		if role != "buyer" && role != "vendor" {
+			return Principal{}, errInvalidClaims
+		}
+	}
+
+	return Principal{
+		Uid:       c.Uid,
+		Email:     c.Email,
+		Roles:     c.Roles,
+		Admin:     c.Admin,
+		SessionID: c.Sid,
+		Scopes:    c.Scopes,
+		MFA:       c.MFA,
+	}, nil
+}
+
+// Set stores the authenticated caller in the request context
+func Set(c *gin.Context, p Principal) {
+	c.Set(contextKey, p)
+}
+
+// Get returns the authenticated caller, ok is false when the request was not authenticated
+func Get(c *gin.Context) (p Principal, ok bool) {
+	v, exists := c.Get(contextKey)
+	if !exists {
+		return Principal{}, false
+	}
+	p, ok = v.(Principal)
+	return p, ok
+}
+
+// MustGet returns the authenticated caller, it panics when called on a route without AuthMiddleware
+func MustGet(c *gin.Context) Principal {
+	p, ok := Get(c)
+	if !ok {
+		panic("principal: route is missing AuthMiddleware")
+	}
+	return p
+}
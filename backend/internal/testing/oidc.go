@@ -0,0 +1,189 @@
+package testing
+
+import (
+	"backend/internal/oidc"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockOIDCKeyID = "mock-key"
+
+// MockOIDCProvider is a local OpenID Connect provider for tests. It serves discovery, its signing key and a token
+// endpoint that checks the client, redirect url and PKCE verifier of every code before issuing an ID token.
+type MockOIDCProvider struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+// mockAuthorization is a code handed out by Authorize, waiting to be exchanged
+type mockAuthorization struct {
+	redirectURI string
+	challenge   string
+	claims      jwt.MapClaims
+}
+
+// NewMockOIDCProvider starts a provider that accepts one registered client. Close it when done.
+func NewMockOIDCProvider(clientID, clientSecret string) *MockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	m := &MockOIDCProvider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		codes:        map[string]mockAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// Config returns the client registration for the provider
+func (m *MockOIDCProvider) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:       m.URL,
+		ClientID:     m.ClientID,
+		ClientSecret: m.ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Authorize stands in for the user logging in at the provider: it reads a url from oidc.Provider.AuthURL and
+// returns the code and state the provider would redirect back with. claims are added to the ID token, the
+// nonce of the request and a default subject, issuer, audience and lifetime are filled in.
+func (m *MockOIDCProvider) Authorize(authURL string, claims jwt.MapClaims) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := u.Query()
+	if query.Get("client_id") != m.ClientID || query.Get("response_type") != "code" {
+		return "", "", errors.New("unknown client or response type")
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", errors.New("missing PKCE challenge")
+	}
+
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":   m.URL,
+		"aud":   m.ClientID,
+		"sub":   "mock-subject",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	code, err = oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	m.mu.Lock()
+	m.codes[code] = mockAuthorization{
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		claims:      all,
+	}
+	m.mu.Unlock()
+	return code, query.Get("state"), nil
+}
+
+// Sign signs claims with the provider's key, for tests that hand oidc.Provider.Verify a token directly
+func (m *MockOIDCProvider) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mockOIDCKeyID
+	return token.SignedString(m.Key)
+}
+
+func (m *MockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                 m.URL,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *MockOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockOIDCKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostForm.Get("client_id")
+	}
+	if id != m.ClientID || secret != m.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use, a replayed code is refused like an unknown one
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	auth, found := m.codes[code]
+	delete(m.codes, code)
+	m.mu.Unlock()
+
+	if !found || auth.redirectURI != r.PostForm.Get("redirect_uri") || oidc.Challenge(r.PostForm.Get("code_verifier")) != auth.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := m.Sign(auth.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
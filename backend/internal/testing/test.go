@@ -55,6 +55,24 @@ func SetupScanNotExists(mockRow *MockRow, err error) *mock.Call {
 	return SetupScanReturn(mockRow, err)
 }
 
+// UserScanReturn sets up the mock row to return a specific value when scanning a full "user" row
+// also returns the mock.Call object for additional assertions
+func UserScanReturn(mockRow *MockRow, ret any) *mock.Call {
+	return SetupScanReturnArgs(mockRow, ret, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// UserScanExists sets up the mock row to return a nil error indicating the user exists
+// also returns the mock.Call object for additional assertions
+func UserScanExists(mockRow *MockRow) *mock.Call {
+	return UserScanReturn(mockRow, nil)
+}
+
+// UserScanNotExists sets up the mock row to return a non-nil error indicating the user does not exist
+// also returns the mock.Call object for additional assertions
+func UserScanNotExists(mockRow *MockRow, err error) *mock.Call {
+	return UserScanReturn(mockRow, err)
+}
+
 // SetupPoolQueryRow sets up the mock pool to return a mock row when the query is executed
 // also returns the mock.Call object for additional assertions
 func SetupPoolQueryRow(mockPool *MockPool, mockRow *MockRow, sqlCmd string, ctx context.Context, extra []any) *mock.Call {
@@ -86,7 +104,26 @@ func VendorScanExists(mockRow *MockRow) {
 
 // itemScanExists is a helper function to setup a mock row that confirms an item exists on scan
 func ItemScanExists(mockRow *MockRow) {
-	SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// CategoryScanActive sets up the mock row to scan a category that is active or not
+func CategoryScanActive(mockRow *MockRow, active bool) *mock.Call {
+	return SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		if dest, ok := args.Get(5).(*bool); ok {
+			*dest = active
+		}
+	})
+}
+
+// ItemScanWithVendor sets up the mock row to scan an existing item sold by vid
+// also returns the mock.Call object for additional assertions
+func ItemScanWithVendor(mockRow *MockRow, vid pgtype.UUID) *mock.Call {
+	return SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		if dest, ok := args.Get(1).(*pgtype.UUID); ok {
+			*dest = vid
+		}
+	})
 }
 
 // vendorScanNotExists  is a helper function to setup a mock row that confirms a vendor does exists on scan returning an
@@ -98,7 +135,7 @@ func VendorScanNotExists(mockRow *MockRow, err error) {
 // itemScanNotExists is a helper function to setup a mock row that confirms an item does exists on scan returning an
 // appropriate error
 func ItemScanNotExists(mockRow *MockRow, err error) {
-	SetupScanReturnArgs(mockRow, err, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	SetupScanReturnArgs(mockRow, err, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 }
 
 // printError is a helper function to print out unexpected errors
@@ -0,0 +1,167 @@
+// Package throttle tracks failed attempts per subject (an account, a client address) and
+// locks a subject out for exponentially longer periods once it fails too often.
+package throttle
+
+import (
+	"backend/db"
+	"backend/repository"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Policy describes when and for how long a subject is locked out
+type Policy struct {
+	Threshold int           // Failures allowed before the first lockout
+	BaseDelay time.Duration // Length of the first lockout, doubled for every further failure
+	MaxDelay  time.Duration // Upper bound on a single lockout
+	Window    time.Duration // Failures older than this are forgotten
+}
+
+// Lockout returns how long a subject with the given number of consecutive failures is locked out for
+func (p Policy) Lockout(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Throttler records failures and reports lockouts
+type Throttler interface {
+	// Check returns how long the subject is still locked out for, zero if it is not
+	Check(ctx context.Context, subject string) (time.Duration, error)
+	// Fail records a failure and returns the lockout it caused, zero if none
+	Fail(ctx context.Context, subject string) (time.Duration, error)
+	// Reset forgets every failure of the subject and lifts any lockout
+	Reset(ctx context.Context, subject string) error
+}
+
+// PgThrottler keeps its counters in Postgres so every backend instance sees the same lockouts
+type PgThrottler struct {
+	Pool   db.Pool
+	Policy Policy
+}
+
+func (t PgThrottler) Check(ctx context.Context, subject string) (time.Duration, error) {
+	q := repository.New(t.Pool)
+	attempt, err := q.GetLoginAttempt(ctx, subject)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if !attempt.LockedUntil.Valid {
+		return 0, nil
+	}
+	return max(time.Until(attempt.LockedUntil.Time), 0), nil
+}
+
+func (t PgThrottler) Fail(ctx context.Context, subject string) (time.Duration, error) {
+	now := time.Now().UTC()
+
+	q := repository.New(t.Pool)
+	failures, err := q.RecordLoginFailure(ctx, repository.RecordLoginFailureParams{
+		Subject:     subject,
+		Now:         pgtype.Timestamp{Time: now, Valid: true},
+		ResetBefore: pgtype.Timestamp{Time: now.Add(-t.Policy.Window), Valid: true},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	lockout := t.Policy.Lockout(int(failures))
+	if lockout == 0 {
+		return 0, nil
+	}
+
+	err = q.LockLoginSubject(ctx, repository.LockLoginSubjectParams{
+		Subject:     subject,
+		LockedUntil: pgtype.Timestamp{Time: now.Add(lockout), Valid: true},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+func (t PgThrottler) Reset(ctx context.Context, subject string) error {
+	q := repository.New(t.Pool)
+	_, err := q.ClearLoginAttempts(ctx, subject)
+	return err
+}
+
+// memoryAttempt is the in-memory counterpart of a login_attempt row
+type memoryAttempt struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// MemoryThrottler keeps its counters in process memory, it is meant for tests and single instance development
+type MemoryThrottler struct {
+	Policy Policy
+	Now    func() time.Time // Clock used for lockouts, defaults to time.Now
+
+	mu       sync.Mutex
+	attempts map[string]*memoryAttempt
+}
+
+func (t *MemoryThrottler) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *MemoryThrottler) Check(ctx context.Context, subject string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempt, ok := t.attempts[subject]
+	if !ok {
+		return 0, nil
+	}
+	return max(attempt.lockedUntil.Sub(t.now()), 0), nil
+}
+
+func (t *MemoryThrottler) Fail(ctx context.Context, subject string) (time.Duration, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.attempts == nil {
+		t.attempts = map[string]*memoryAttempt{}
+	}
+
+	now := t.now()
+	attempt, ok := t.attempts[subject]
+	if !ok || attempt.lastFailureAt.Before(now.Add(-t.Policy.Window)) {
+		attempt = &memoryAttempt{}
+		t.attempts[subject] = attempt
+	}
+	attempt.failures++
+	attempt.lastFailureAt = now
+
+	lockout := t.Policy.Lockout(attempt.failures)
+	if lockout > 0 {
+		attempt.lockedUntil = now.Add(lockout)
+	}
+	return lockout, nil
+}
+
+func (t *MemoryThrottler) Reset(ctx context.Context, subject string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, subject)
+	return nil
+}
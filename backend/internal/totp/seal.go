@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks a secret encrypted by a Sealer, secrets stored before encryption was configured have none
+const sealedPrefix = "v1:"
+
+// KeySize is the length in bytes of a sealing key, an AES-256 key
+const KeySize = 32
+
+var errNoSealer = errors.New("secret is encrypted but no TOTP secret key is configured")
+
+// Sealer encrypts TOTP secrets at rest with AES-256-GCM. Unlike recovery codes the secret cannot be hashed,
+// it is needed to compute codes, so a copy of the database alone must not be enough to produce them. A nil
+// Sealer leaves secrets in plain text.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer from a KeySize byte key
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("TOTP secret key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// ParseSealer creates a sealer from a base64 encoded key, as kept in the environment
+func ParseSealer(key string) (*Sealer, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewSealer(raw)
+}
+
+// Seal encrypts a secret for storage
+func (s *Sealer) Seal(secret string) (string, error) {
+	if s == nil {
+		return secret, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a stored secret, secrets stored in plain text are returned as they are
+func (s *Sealer) Open(stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedPrefix)
+	if !ok {
+		return stored, nil
+	}
+	if s == nil {
+		return "", errNoSealer
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	size := s.aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("sealed secret is too short")
+	}
+	secret, err := s.aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
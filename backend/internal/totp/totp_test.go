@@ -0,0 +1,162 @@
+package totp
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfcSecret is the RFC 6238 appendix B SHA1 seed "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors for SHA1, the last six of their eight digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, tt.code, code, "time: %d", tt.unix)
+	}
+
+	t.Run("Secret as typed by hand", func(t *testing.T) {
+		code, err := Code(strings.ToLower("GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"), time.Unix(59, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, "287082", code)
+	})
+
+	t.Run("Invalid secret", func(t *testing.T) {
+		_, err := Code("not base32!", time.Unix(59, 0))
+		assert.Error(t, err)
+	})
+
+	t.Run("Generated secrets", func(t *testing.T) {
+		secret, err := GenerateSecret()
+		assert.NoError(t, err)
+		key, err := decodeSecret(secret)
+		assert.NoError(t, err)
+		assert.Len(t, key, SecretSize)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := "005924"
+
+	t.Run("Codes within the skew window", func(t *testing.T) {
+		for _, drift := range []time.Duration{-Period, 0, Period} {
+			step, ok := Validate(rfcSecret, code, now.Add(drift), 1)
+			assert.True(t, ok, "drift: %v", drift)
+			// The step the code was made for is returned whichever step the clock is in
+			assert.Equal(t, Step(now), step)
+		}
+	})
+
+	t.Run("Codes outside the skew window", func(t *testing.T) {
+		for _, drift := range []time.Duration{-2 * Period, 2 * Period} {
+			_, ok := Validate(rfcSecret, code, now.Add(drift), 1)
+			assert.False(t, ok, "drift: %v", drift)
+		}
+	})
+
+	t.Run("No skew", func(t *testing.T) {
+		_, ok := Validate(rfcSecret, code, now, 0)
+		assert.True(t, ok)
+		_, ok = Validate(rfcSecret, code, now.Add(Period), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("Malformed codes", func(t *testing.T) {
+		for _, c := range []string{"", "05924", "0005924", "abcdef"} {
+			_, ok := Validate(rfcSecret, c, now, 1)
+			assert.False(t, ok, "code: %q", c)
+		}
+	})
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI(rfcSecret, "Ashesi Dwa", "vendor@test.com")
+	assert.Contains(t, uri, "otpauth://totp/Ashesi%20Dwa:vendor@test.com?")
+	assert.Contains(t, uri, "secret="+rfcSecret)
+	assert.Contains(t, uri, "issuer=Ashesi+Dwa")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
+
+func TestSealer(t *testing.T) {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	sealer, err := NewSealer(key)
+	assert.NoError(t, err)
+
+	t.Run("Round trip", func(t *testing.T) {
+		sealed, err := sealer.Seal(rfcSecret)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(sealed, sealedPrefix))
+		assert.NotContains(t, sealed, rfcSecret)
+		// Fits the mfa_totp.secret column
+		assert.LessOrEqual(t, len(sealed), 255)
+
+		again, _ := sealer.Seal(rfcSecret)
+		assert.NotEqual(t, sealed, again)
+
+		opened, err := sealer.Open(sealed)
+		assert.NoError(t, err)
+		assert.Equal(t, rfcSecret, opened)
+	})
+
+	t.Run("Plain text secrets stored before encryption", func(t *testing.T) {
+		opened, err := sealer.Open(rfcSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, rfcSecret, opened)
+	})
+
+	t.Run("Other key", func(t *testing.T) {
+		sealed, _ := sealer.Seal(rfcSecret)
+		other := make([]byte, KeySize)
+		rand.Read(other)
+		otherSealer, _ := NewSealer(other)
+
+		_, err := otherSealer.Open(sealed)
+		assert.Error(t, err)
+	})
+
+	t.Run("Tampered secret", func(t *testing.T) {
+		sealed, _ := sealer.Seal(rfcSecret)
+		_, err := sealer.Open(sealed[:len(sealed)-2] + "AA")
+		assert.Error(t, err)
+		_, err = sealer.Open(sealedPrefix + "AA")
+		assert.Error(t, err)
+	})
+
+	t.Run("No key", func(t *testing.T) {
+		var none *Sealer
+		stored, err := none.Seal(rfcSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, rfcSecret, stored)
+
+		sealed, _ := sealer.Seal(rfcSecret)
+		_, err = none.Open(sealed)
+		assert.ErrorIs(t, err, errNoSealer)
+	})
+
+	t.Run("Invalid keys", func(t *testing.T) {
+		_, err := NewSealer(key[:16])
+		assert.Error(t, err)
+		_, err = ParseSealer("not base64!")
+		assert.Error(t, err)
+	})
+}
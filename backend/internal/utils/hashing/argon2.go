@@ -0,0 +1,112 @@
+package hashing
+
+import (
+	"backend/config"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix starts every PHC formatted Argon2id hash
+const argon2idPrefix = "$argon2id$"
+
+var errInvalidArgon2Hash = errors.New("invalid argon2id hash")
+
+// Argon2idHash implements the Hasher interface using Argon2id. Hashes are stored in the PHC string
+// format, $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>, so each one records
+// the parameters it was made with. Bcrypt hashes from before the switch can still be compared.
+type Argon2idHash struct {
+	Params config.Argon2
+}
+
+// argon2idHash is a decoded PHC Argon2id hash
+type argon2idHash struct {
+	params config.Argon2
+	salt   []byte
+	key    []byte
+}
+
+// decodeArgon2id parses a PHC formatted Argon2id hash
+func decodeArgon2id(hash string) (argon2idHash, error) {
+	var decoded argon2idHash
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return decoded, errInvalidArgon2Hash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return decoded, errInvalidArgon2Hash
+	}
+
+	p := &decoded.params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return decoded, errInvalidArgon2Hash
+	}
+
+	var err error
+	decoded.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return decoded, errInvalidArgon2Hash
+	}
+	decoded.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(decoded.key) == 0 {
+		return decoded, errInvalidArgon2Hash
+	}
+	p.SaltLength = uint32(len(decoded.salt))
+	p.KeyLength = uint32(len(decoded.key))
+
+	return decoded, nil
+}
+
+// Hash implements the Hasher interface using Argon2id.
+func (a Argon2idHash) Hash(password string) (string, error) {
+	p := a.Params
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Compare implements the Hasher interface using Argon2id, falling back to bcrypt for older hashes.
+func (a Argon2idHash) Compare(password, hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		return bcryptCompare(password, hash)
+	}
+
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	p := decoded.params
+	key := argon2.IDKey([]byte(password), decoded.salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1
+}
+
+// NeedsRehash implements the Rehasher interface, any hash that is not Argon2id with the current parameters is outdated.
+func (a Argon2idHash) NeedsRehash(hash string) bool {
+	decoded, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return decoded.params != a.Params
+}
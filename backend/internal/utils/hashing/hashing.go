@@ -14,6 +14,12 @@ type Hasher interface {
 	Compare(password, hash string) bool          // Compare plain password with hashed one
 }
 
+// Rehasher is implemented by hashers that can tell when a stored hash was made with an outdated
+// algorithm or cost and should be replaced the next time the plain password is known.
+type Rehasher interface {
+	NeedsRehash(hash string) bool
+}
+
 // BcryptHash is a struct that implements the Hasher interface using bcrypt.
 type BcryptHash struct{}
 
@@ -39,3 +45,9 @@ func (b BcryptHash) Hash(password string) (string, error) {
 func (b BcryptHash) Compare(password, hash string) bool {
 	return bcryptCompare(password, hash)
 }
+
+// NeedsRehash implements the Rehasher interface, hashes with a different cost are outdated.
+func (b BcryptHash) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != ROUNDS
+}
@@ -0,0 +1,27 @@
+package hashing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// TOKEN_BYTES defines how many random bytes back an opaque token.
+const TOKEN_BYTES int = 32
+
+// GenerateToken returns a random, url-safe opaque token (e.g. a refresh token).
+func GenerateToken() (string, error) {
+	buf := make([]byte, TOKEN_BYTES)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns the hex encoded sha256 digest of a token.
+// Opaque tokens are high entropy so a fast hash is enough, and only the digest is ever stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,13 +1,16 @@
 package utils
 
 import (
+	"backend/internal/keys"
 	"backend/internal/logging"
 	"encoding/hex"
 	"fmt"
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -15,10 +18,12 @@ import (
 	"github.com/spf13/viper"
 )
 
-// ServiceError describes the structure of an error returned by a service
+// ServiceError describes the structure of an error returned by a service, Code is an optional
+// machine readable identifier clients can switch on
 type ServiceError struct {
 	Err    error
 	Status int
+	Code   string
 }
 
 // ServiceReturn describes the structure of a service's response, i.e. the status
@@ -73,14 +78,64 @@ func SendErrAbort(c *gin.Context, status int, err error) {
 	SendDataAbort(c, status, JMap{"err": err.Error()})
 }
 
+// Page is one page of a listing. SendSR sends the items under Key next to a "page" object with the
+// cursor of the following page, so every paginated listing has the same envelope:
+//
+//	{"data": {"items": [...], "page": {"limit": 20, "has_more": true, "next_cursor": "..."}}}
+type Page[T any] struct {
+	Key        string // Name the items are sent under, e.g. "items"
+	Items      []T
+	Limit      int32  // Page size asked for, zero for a listing sent whole
+	NextCursor string // Empty on the last page
+	Meta       JMap   // Sent next to the items, e.g. a correction for a search without results
+}
+
+// Enveloper is implemented by service data that is wrapped before SendSR sends it
+type Enveloper interface {
+	Envelope() JMap
+}
+
+// Envelope returns the page as it is sent to the client
+func (p Page[T]) Envelope() JMap {
+	page := JMap{
+		"has_more":    p.NextCursor != "",
+		"next_cursor": nil,
+	}
+	if p.NextCursor != "" {
+		page["next_cursor"] = p.NextCursor
+	}
+	// Listings sent whole in one page have no limit
+	if p.Limit > 0 {
+		page["limit"] = p.Limit
+	}
+
+	items := p.Items
+	if items == nil {
+		items = []T{}
+	}
+	envelope := JMap{p.Key: items, "page": page}
+	for k, v := range p.Meta {
+		envelope[k] = v
+	}
+	return envelope
+}
+
 // SendSR sends a ServiceReturn to the client accounting for errors if any
 func SendSR[T any](c *gin.Context, sr ServiceReturn[T]) {
 	// If there's an error, send it to the client
 	if sr.ServiceErr != nil {
+		if sr.ServiceErr.Code != "" {
+			SendData(c, sr.ServiceErr.Status, JMap{"err": sr.ServiceErr.Err.Error(), "code": sr.ServiceErr.Code})
+			return
+		}
 		SendErr(c, sr.ServiceErr.Status, sr.ServiceErr.Err)
 		return
 	}
 
+	if enveloper, ok := any(sr.Data).(Enveloper); ok {
+		SendData(c, sr.Status, enveloper.Envelope())
+		return
+	}
 	SendData(c, sr.Status, sr.Data)
 }
 
@@ -94,6 +149,17 @@ func MakeError(err error, status int) ServiceReturn[any] {
 	}
 }
 
+// MakeCodedError is like MakeError but also attaches a machine readable error code
+func MakeCodedError(err error, status int, code string) ServiceReturn[any] {
+	return ServiceReturn[any]{
+		ServiceErr: &ServiceError{
+			Err:    err,
+			Status: status,
+			Code:   code,
+		},
+	}
+}
+
 // Enver is an interface to abstract getting environment vars to make mocking easier
 type Enver interface {
 	// Env reads a key from the environment and returns its value as a string
@@ -118,6 +184,69 @@ func env(key string) string {
 	return v
 }
 
+// lookupEnv reads a key from the .env file, falling back to the process environment,
+// and reports whether it was set at all
+func lookupEnv(key string) (string, bool) {
+	viper.SetConfigFile(".env")
+	if err := viper.ReadInConfig(); err == nil {
+		if v, ok := viper.Get(key).(string); ok {
+			return v, true
+		}
+	}
+	return os.LookupEnv(key)
+}
+
+// EnvOr reads an optional key returning fallback when it is not set
+func EnvOr(key, fallback string) string {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	return v
+}
+
+// EnvDuration reads an optional duration key (e.g. "15m") returning fallback when it is not set or invalid
+func EnvDuration(key string, fallback time.Duration) time.Duration {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		logging.Warnf("Invalid duration for %s -> %v, using %v", key, err, fallback)
+		return fallback
+	}
+	return d
+}
+
+// EnvInt reads an optional integer key returning fallback when it is not set or invalid
+func EnvInt(key string, fallback int) int {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		logging.Warnf("Invalid integer for %s -> %v, using %v", key, err, fallback)
+		return fallback
+	}
+	return n
+}
+
+// EnvFloat reads an optional decimal number key returning fallback when it is not set or invalid
+func EnvFloat(key string, fallback float64) float64 {
+	v, ok := lookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		logging.Warnf("Invalid number for %s -> %v, using %v", key, err, fallback)
+		return fallback
+	}
+	return f
+}
+
 type DefaultEnv struct{}
 
 func (e DefaultEnv) Env(key string) string {
@@ -164,11 +293,9 @@ func MakePointer[T any](t T) *T {
 	return &t
 }
 
-func ParseJWT(tokenString string, claims jwt.MapClaims) (*jwt.Token, error) {
+func ParseJWT(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
 	wobearer := strings.TrimPrefix(tokenString, "Bearer ")
-	return jwt.ParseWithClaims(wobearer, claims, func(t *jwt.Token) (any, error) {
-		return []byte(DefaultEnv{}.Env("SECRET")), nil
-	})
+	return jwt.ParseWithClaims(wobearer, claims, keys.Default.Keyfunc, jwt.WithValidMethods(keys.Methods))
 }
 
 type UserType int
@@ -3,13 +3,23 @@ package main
 import (
 	"backend/config"
 	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/keys"
 	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/oidc"
+	"backend/internal/password"
+	"backend/internal/throttle"
+	"backend/internal/totp"
 	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/routes/admin"
 	"backend/routes/auth"
 	"backend/routes/buyers"
 	"backend/routes/items"
 	"backend/routes/vendors"
 	misc "backend/services"
+	authService "backend/services/auth"
 	"context"
 	"fmt"
 	"net/http"
@@ -49,6 +59,94 @@ func main() {
 
 	defer closeFunc()
 
+	// Hash new passwords with Argon2id, the cost can be raised over time and old hashes are upgraded on login
+	argon := config.DefaultArgon2()
+	argon.Memory = uint32(utils.EnvInt("ARGON2_MEMORY", int(argon.Memory)))
+	argon.Iterations = uint32(utils.EnvInt("ARGON2_ITERATIONS", int(argon.Iterations)))
+	argon.Parallelism = uint8(utils.EnvInt("ARGON2_PARALLELISM", int(argon.Parallelism)))
+	if !argon.IsValid() {
+		logging.Fatalf("Invalid Argon2 parameters %+v", argon)
+	}
+	authService.Hasher = hashing.Argon2idHash{Params: argon}
+
+	// Sign tokens with keys from the key directory, rotating them on schedule
+	keySet, err := keys.Load(utils.EnvOr("JWT_KEY_DIR", "keys"), keys.Rotation{
+		Algorithm: utils.EnvOr("JWT_ALG", keys.DefaultRotation.Algorithm),
+		Every:     utils.EnvDuration("JWT_ROTATE_EVERY", keys.DefaultRotation.Every),
+		Overlap:   keys.DefaultRotation.Overlap,
+		Retain:    utils.EnvDuration("JWT_KEY_RETAIN", keys.DefaultRotation.Retain),
+	})
+	if err != nil {
+		logging.Fatalf("Cannot load signing keys -> %v", err)
+	}
+	keys.Default = keySet
+	go keySet.Watch(ctx, time.Minute)
+
+	// Encrypt TOTP secrets at rest, without a key anyone reading the database could produce second factor codes.
+	// Plain text secrets are only allowed when asked for explicitly, for local development
+	if key := utils.EnvOr("TOTP_SECRET_KEY", ""); key != "" {
+		authService.TOTPSealer, err = totp.ParseSealer(key)
+		if err != nil {
+			logging.Fatalf("Invalid TOTP_SECRET_KEY -> %v", err)
+		}
+	} else if utils.EnvOr("TOTP_ALLOW_PLAINTEXT", "") == "true" {
+		logging.Warnf("TOTP_SECRET_KEY is not set, TOTP secrets are stored in plain text")
+	} else {
+		logging.Fatalf("TOTP_SECRET_KEY is not set, set TOTP_ALLOW_PLAINTEXT=\"true\" to store TOTP secrets in plain text")
+	}
+
+	// Configure token lifetimes, falling back to the service defaults
+	authService.AccessTTL = utils.EnvDuration("ACCESS_TOKEN_TTL", authService.AccessTTL)
+	authService.RefreshTTL = utils.EnvDuration("REFRESH_TOKEN_TTL", authService.RefreshTTL)
+	authService.ResetTTL = utils.EnvDuration("RESET_TOKEN_TTL", authService.ResetTTL)
+
+	// Configure the password policy and load the breached password list if there is one
+	authService.PasswordPolicy = password.Policy{
+		MinLength:  utils.EnvInt("PASSWORD_MIN_LENGTH", password.DefaultPolicy.MinLength),
+		MaxLength:  utils.EnvInt("PASSWORD_MAX_LENGTH", password.DefaultPolicy.MaxLength),
+		MinEntropy: utils.EnvFloat("PASSWORD_MIN_ENTROPY", password.DefaultPolicy.MinEntropy),
+	}
+	if path := utils.EnvOr("PASSWORD_BREACH_LIST", ""); path != "" {
+		authService.Breaches, err = password.Open(path)
+		if err != nil {
+			logging.Fatalf("Cannot load PASSWORD_BREACH_LIST -> %v", err)
+		}
+	}
+
+	// Anonymize deleted accounts once their grace period is over
+	authService.DeletionGracePeriod = utils.EnvDuration("ACCOUNT_DELETION_GRACE", authService.DeletionGracePeriod)
+	go authService.RunAccountPurge(ctx, pool, utils.EnvDuration("ACCOUNT_PURGE_EVERY", time.Hour))
+
+	// Configure how account emails are delivered and where their links point
+	authService.Mailer = mail.FromEnv(utils.EnvOr)
+	authService.AppURL = utils.EnvOr("APP_URL", authService.AppURL)
+
+	// Share failed login counters between instances through the database
+	authService.AccountThrottle = throttle.PgThrottler{Pool: pool, Policy: authService.AccountPolicy}
+	authService.IPThrottle = throttle.PgThrottler{Pool: pool, Policy: authService.IPPolicy}
+
+	// Keep the audit log of logins and credential changes in the database
+	audit.Default = audit.PgRecorder{Pool: pool}
+
+	// Restrict signups to the configured email domains, an empty list allows any domain
+	authService.Domains, err = authService.ParseDomainPolicy(utils.EnvOr("ALLOWED_EMAIL_DOMAINS", ""))
+	if err != nil {
+		logging.Fatalf("Invalid ALLOWED_EMAIL_DOMAINS -> %v", err)
+	}
+
+	// Turn on sign-in with an OpenID Connect provider when one is configured
+	if issuer := utils.EnvOr("OIDC_ISSUER", ""); issuer != "" {
+		authService.OIDC, err = oidc.Discover(ctx, oidc.Config{
+			Issuer:       issuer,
+			ClientID:     utils.EnvOr("OIDC_CLIENT_ID", ""),
+			ClientSecret: utils.EnvOr("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:  utils.EnvOr("OIDC_REDIRECT_URL", authService.AppURL+"/oidc/callback"),
+		}, &http.Client{Timeout: 10 * time.Second})
+		if err != nil {
+			logging.Fatalf("Cannot configure OIDC_ISSUER -> %v", err)
+		}
+	}
+
 	app := gin.Default()
 	// Apply CORS config only in debug mode
 	if Enver.Env("GIN_MODE") == "debug" {
@@ -84,6 +182,12 @@ func main() {
 		utils.SendMsg(c, http.StatusOK, statusText)
 	})
 
+	// Public keys other services can verify our tokens with
+	app.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.Default.JWKS())
+	})
+
 	// Route to test DB connection by returning DB version
 	app.GET("/db", func(c *gin.Context) {
 		version, err := misc.Health(ctx, pool)
@@ -94,12 +198,13 @@ func main() {
 		})
 	})
 
-	// Register all route groups for authentication, items, vendors, and buyers
+	// Register all route groups for authentication, items, vendors, buyers and admins
 	auth.AuthRoutes(ctx, pool, app)
 
 	items.ItemsRoute(ctx, pool, app)
 	vendors.VendorRoutes(ctx, pool, app)
 	buyers.BuyerRoutes(ctx, pool, app)
+	admin.AdminRoutes(ctx, pool, app)
 
 	// Start the server on the host and port from environment variables
 	app.Run(fmt.Sprintf("%s:%s", Enver.Env("HOST"), Enver.Env("PORT")))
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"backend/internal/logging"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware only lets platform administrators through. It is meant to sit behind AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.Get(c)
+		if !ok {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		// The admin flag is carried in the token, scoped callers never act as admins
+		if !p.Admin || len(p.Scopes) > 0 {
+			logging.Infof("Blocked non admin user %v", p.Uid)
+			utils.SendErrAbort(c, http.StatusForbidden, errors.New("admin access required"))
+			return
+		}
+
+		// User is an admin, continue
+		c.Next()
+	}
+}
@@ -1,10 +1,16 @@
 package middleware
 
 import (
+	"backend/db"
+	"backend/internal/audit"
 	"backend/internal/logging"
+	"backend/internal/principal"
 	"backend/internal/utils"
+	"backend/services/auth"
+	"context"
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -13,95 +19,91 @@ import (
 // DefaultEnv is a default implementation of environment variables or config access.
 var DefaultEnv utils.Enver = utils.DefaultEnv{}
 
-// AuthMiddleware checks if the request has a valid JWT token before allowing access.
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the request's JWT token, checks its session has not been revoked and
+// stores the caller as a principal.Principal in the context for the handlers after it.
+// A vendor API key is accepted in place of a token, the caller is then limited to the key's scopes.
+func AuthMiddleware(ctx context.Context, pool db.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Check if Authorization header is present
-		if authHeaders, ok := c.Request.Header["Authorization"]; ok {
-			logging.Infof("AuthHeaders: %v", authHeaders)
-
-			// Parse the JWT token
-			token, err := utils.ParseJWT(authHeaders[0], jwt.MapClaims{})
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
 
-			// Handle token parsing error
-			if err != nil {
-				// If the token is expired
-				if errors.Is(err, jwt.ErrTokenExpired) {
-					utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("token expired"))
-					return
-				}
-				// For any other error
-				utils.SendErrAbort(c, http.StatusInternalServerError, err)
+		// API keys carry a prefix no JWT starts with
+		if key := strings.TrimPrefix(authHeader, "Bearer "); strings.HasPrefix(key, auth.APIKeyPrefix) {
+			p, err := auth.AuthenticateAPIKey(ctx, pool, key)
+			rejected := audit.Event{Type: audit.APIKeyRejected, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+			switch {
+			case errors.Is(err, auth.ErrInvalidAPIKey):
+				rejected.Outcome = audit.Failure
+				audit.Record(ctx, rejected)
+				utils.SendErrAbort(c, http.StatusUnauthorized, err)
 				return
-			}
-
-			// If token is not valid
-			if !token.Valid {
-				utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("invalid token"))
+			case errors.Is(err, auth.ErrAccountSuspended):
+				rejected.Outcome, rejected.Detail = audit.Denied, err.Error()
+				audit.Record(ctx, rejected)
+				utils.SendSR(c, utils.MakeCodedError(err, http.StatusForbidden, auth.CodeAccountSuspended))
+				c.Abort()
+				return
+			case err != nil:
+				utils.SendErrAbort(c, http.StatusInternalServerError, err)
 				return
 			}
 
-			// Token is valid, continue to the next middleware or handler
-			logging.Infof("Token: %v", token)
+			p.IP, p.UserAgent = c.ClientIP(), c.Request.UserAgent()
+			principal.Set(c, p)
 			c.Next()
 			return
 		}
 
-		// No Authorization header found
-		utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
-	}
-}
-
-// CartAuthMiddleware ensures only the owner of the cart can access it.
-func CartAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Get the buyer ID from the URL parameter
-		bidStr := c.Param("bId")
-		bid, err := utils.ParseUUID(bidStr)
-		logging.Infof("Bid str: %s", bidStr)
-
+		// Parse the JWT token
+		claims := &principal.Claims{}
+		_, err := utils.ParseJWT(authHeader, claims)
 		if err != nil {
-			utils.SendErrAbort(c, http.StatusInternalServerError, err)
-			return
-		}
-
-		// Check if Authorization header is present
-		if authHeaders, ok := c.Request.Header["Authorization"]; ok {
-			logging.Infof("AuthHeaders: %v", authHeaders)
-
-			// Parse the JWT token
-			token, err := utils.ParseJWT(authHeaders[0], jwt.MapClaims{})
-
-			if err != nil {
-				utils.SendErrAbort(c, http.StatusInternalServerError, err)
-				return
-			}
-
-			// Extract user ID from token
-			uid, ok := (token.Claims).(jwt.MapClaims)["uid"]
-			if !ok {
-				utils.SendErrAbort(c, http.StatusBadRequest, errors.New("invalid token"))
-				return
-			}
-
-			// Convert the user ID to UUID
-			uid, err = utils.ParseUUID(uid.(string))
-			if err != nil {
-				utils.SendErrAbort(c, http.StatusBadRequest, errors.New("invalid token"))
+			// If the token is expired
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("token expired"))
 				return
 			}
+			// For any other error
+			logging.Infof("Invalid token -> %v", err)
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
 
-			logging.Infof("Bid: %s\nUid: %s", bid, uid)
+		// Make sure the token carries everything a principal needs
+		p, err := claims.Principal()
+		if err != nil {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("invalid token"))
+			return
+		}
 
-			// Ensure the user is accessing their own cart
-			if uid != bid {
-				utils.SendErrAbort(c, http.StatusBadRequest, errors.New("cannot access other users' carts"))
-				return
-			}
+		p.IP, p.UserAgent = c.ClientIP(), c.Request.UserAgent()
 
-			// All checks passed, continue
-			c.Next()
+		// Reject tokens belonging to a session that has been logged out or revoked, or to a suspended user
+		err = auth.CheckSession(ctx, pool, p.SessionID)
+		if errors.Is(err, auth.ErrSessionRevoked) || errors.Is(err, auth.ErrAccountSuspended) {
+			event := audit.By(p, audit.TokenRejected, audit.Denied)
+			event.Detail = err.Error()
+			audit.Record(ctx, event)
+		}
+		switch {
+		case errors.Is(err, auth.ErrSessionRevoked):
+			utils.SendErrAbort(c, http.StatusUnauthorized, err)
+			return
+		case errors.Is(err, auth.ErrAccountSuspended):
+			utils.SendSR(c, utils.MakeCodedError(err, http.StatusForbidden, auth.CodeAccountSuspended))
+			c.Abort()
+			return
+		case err != nil:
+			utils.SendErrAbort(c, http.StatusInternalServerError, err)
 			return
 		}
+
+		// Token is valid, continue to the next middleware or handler
+		principal.Set(c, p)
+		c.Next()
 	}
 }
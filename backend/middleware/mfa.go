@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"backend/db"
+	"backend/internal/logging"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/services/auth"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVendorMFA refuses sessions that did not pass a second factor, and API keys of vendors without an
+// authenticator, while the platform requires vendors to use two-factor authentication. It is meant to sit
+// behind AuthMiddleware on vendor routes.
+func RequireVendorMFA(ctx context.Context, pool db.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.Get(c)
+		if !ok {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		satisfied, err := auth.VendorMFASatisfied(ctx, pool, p)
+		if err != nil {
+			utils.SendErrAbort(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !satisfied {
+			logging.Infof("Blocked vendor %v without two-factor authentication", p.Uid)
+			utils.SendSR(c, utils.MakeCodedError(
+				errors.New("two-factor authentication is required for vendors"),
+				http.StatusForbidden,
+				auth.CodeMFARequired,
+			))
+			c.Abort()
+			return
+		}
+
+		// Two-factor authentication is optional or was presented, continue
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorize checks the caller may perform action on the resource owned by the user in the ownerParam
+// path parameter, e.g. Authorize(policy.CartRead, "bId"). It is meant to sit behind AuthMiddleware.
+func Authorize(action policy.Action, ownerParam string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.Get(c)
+		if !ok {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+
+		// Get the owner ID from the URL parameter
+		owner, err := utils.ParseUUID(c.Param(ownerParam))
+		if err != nil {
+			utils.SendErrAbort(c, http.StatusBadRequest, err)
+			return
+		}
+
+		if sr := policy.Authorize(p, action, policy.Resource{Owner: owner}); sr.ServiceErr != nil {
+			utils.SendSR(c, sr)
+			c.Abort()
+			return
+		}
+
+		// Caller is allowed, continue
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"backend/db"
+	"backend/internal/logging"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/services/auth"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail blocks accounts that have not yet confirmed their email address.
+// It is meant to be added to individual routes that sit behind AuthMiddleware.
+func RequireVerifiedEmail(ctx context.Context, pool db.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := principal.Get(c)
+		if !ok {
+			utils.SendErrAbort(c, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		uid := p.Uid
+
+		// Look up the current verification state, the token may predate the confirmation
+		verified, err := auth.IsEmailVerified(ctx, pool, uid)
+		if err != nil {
+			utils.SendErrAbort(c, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !verified {
+			logging.Infof("Blocked unverified user %v", uid)
+			utils.SendErrAbort(c, http.StatusForbidden, errors.New("email must be verified to access this route"))
+			return
+		}
+
+		// Email is verified, continue
+		c.Next()
+	}
+}
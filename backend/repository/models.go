@@ -53,55 +53,43 @@ func (ns NullAccType) Value() (driver.Value, error) {
 	return string(ns.AccType), nil
 }
 
-type Category string
-
-const (
-	CategoryFASHION       Category = "FASHION"
-	CategoryELECTRONICS   Category = "ELECTRONICS"
-	CategorySERVICES      Category = "SERVICES"
-	CategoryBOOKSSUPPLIES Category = "BOOKS_SUPPLIES"
-)
-
-func (e *Category) Scan(src interface{}) error {
-	switch s := src.(type) {
-	case []byte:
-		*e = Category(s)
-	case string:
-		*e = Category(s)
-	default:
-		return fmt.Errorf("unsupported scan type for Category: %T", src)
-	}
-	return nil
-}
-
-type NullCategory struct {
-	Category Category `json:"category"`
-	Valid    bool     `json:"valid"` // Valid is true if Category is not NULL
+type Account struct {
+	Uid          pgtype.UUID `json:"uid"`
+	Accounttype  AccType     `json:"accounttype"`
+	Bankname     *string     `json:"bankname"`
+	Momoprovider *string     `json:"momoprovider"`
 }
 
-// Scan implements the Scanner interface.
-func (ns *NullCategory) Scan(value interface{}) error {
-	if value == nil {
-		ns.Category, ns.Valid = "", false
-		return nil
-	}
-	ns.Valid = true
-	return ns.Category.Scan(value)
+type AccountDeletion struct {
+	Uid          pgtype.UUID      `json:"uid"`
+	RequestedAt  pgtype.Timestamp `json:"requested_at"`
+	PurgeAfter   pgtype.Timestamp `json:"purge_after"`
+	AnonymizedAt pgtype.Timestamp `json:"anonymized_at"`
 }
 
-// Value implements the driver Valuer interface.
-func (ns NullCategory) Value() (driver.Value, error) {
-	if !ns.Valid {
-		return nil, nil
-	}
-	return string(ns.Category), nil
+type ApiKey struct {
+	Kid        pgtype.UUID      `json:"kid"`
+	Uid        pgtype.UUID      `json:"uid"`
+	Name       string           `json:"name"`
+	KeyHash    string           `json:"key_hash"`
+	Prefix     string           `json:"prefix"`
+	Scopes     []string         `json:"scopes"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	LastUsedAt pgtype.Timestamp `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamp `json:"revoked_at"`
 }
 
-type Account struct {
-	Uid          pgtype.UUID `json:"uid"`
-	Accounttype  AccType     `json:"accounttype"`
-	Bankname     *string     `json:"bankname"`
-	Momoprovider *string     `json:"momoprovider"`
+type AuthEvent struct {
+	Eid       int64            `json:"eid"`
+	Uid       pgtype.UUID      `json:"uid"`
+	Actor     pgtype.UUID      `json:"actor"`
+	Event     string           `json:"event"`
+	Outcome   string           `json:"outcome"`
+	Email     *string          `json:"email"`
+	Ip        *string          `json:"ip"`
+	UserAgent *string          `json:"user_agent"`
+	Detail    *string          `json:"detail"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
 type Buyer struct {
@@ -115,17 +103,124 @@ type Cart struct {
 	Vid       pgtype.UUID      `json:"vid"`
 	Quantity  int32            `json:"quantity"`
 	AddedTime pgtype.Timestamp `json:"added_time"`
+	Vrid      pgtype.UUID      `json:"vrid"`
+}
+
+type Category struct {
+	Cid       pgtype.UUID      `json:"cid"`
+	ParentCid pgtype.UUID      `json:"parent_cid"`
+	Name      string           `json:"name"`
+	Slug      string           `json:"slug"`
+	Position  int32            `json:"position"`
+	Active    bool             `json:"active"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type EmailException struct {
+	Email     string           `json:"email"`
+	UserType  string           `json:"user_type"`
+	Note      *string          `json:"note"`
+	CreatedBy pgtype.UUID      `json:"created_by"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
 }
 
 type Item struct {
-	Iid         pgtype.UUID    `json:"iid"`
-	Vid         pgtype.UUID    `json:"vid"`
-	Name        string         `json:"name"`
-	Pictureurl  *string        `json:"pictureurl"`
-	Description *string        `json:"description"`
-	Category    Category       `json:"category"`
-	Quantity    int32          `json:"quantity"`
-	Cost        pgtype.Numeric `json:"cost"`
+	Iid         pgtype.UUID      `json:"iid"`
+	Vid         pgtype.UUID      `json:"vid"`
+	Name        string           `json:"name"`
+	Pictureurl  *string          `json:"pictureurl"`
+	Description *string          `json:"description"`
+	Category    string           `json:"category"`
+	Quantity    int32            `json:"quantity"`
+	Cost        pgtype.Numeric   `json:"cost"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+}
+
+type ItemOption struct {
+	Iid      pgtype.UUID `json:"iid"`
+	Name     string      `json:"name"`
+	Position int32       `json:"position"`
+	Choices  []string    `json:"choices"`
+}
+
+type ItemTakedown struct {
+	Iid         pgtype.UUID      `json:"iid"`
+	Reason      *string          `json:"reason"`
+	TakenDownBy pgtype.UUID      `json:"taken_down_by"`
+	TakenDownAt pgtype.Timestamp `json:"taken_down_at"`
+}
+
+type ItemVariant struct {
+	Vrid      pgtype.UUID      `json:"vrid"`
+	Iid       pgtype.UUID      `json:"iid"`
+	Sku       string           `json:"sku"`
+	Options   []string         `json:"options"`
+	Quantity  int32            `json:"quantity"`
+	Cost      pgtype.Numeric   `json:"cost"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Subject       string           `json:"subject"`
+	Failures      int32            `json:"failures"`
+	LastFailureAt pgtype.Timestamp `json:"last_failure_at"`
+	LockedUntil   pgtype.Timestamp `json:"locked_until"`
+}
+
+type MfaRecoveryCode struct {
+	CodeHash  string           `json:"code_hash"`
+	Uid       pgtype.UUID      `json:"uid"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type MfaTotp struct {
+	Uid          pgtype.UUID      `json:"uid"`
+	Secret       string           `json:"secret"`
+	EnabledAt    pgtype.Timestamp `json:"enabled_at"`
+	LastUsedStep int64            `json:"last_used_step"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+}
+
+type OidcLogin struct {
+	StateHash    string           `json:"state_hash"`
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+}
+
+type PasswordReset struct {
+	TokenHash string           `json:"token_hash"`
+	Uid       pgtype.UUID      `json:"uid"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type PlatformSetting struct {
+	Name      string           `json:"name"`
+	Value     string           `json:"value"`
+	UpdatedBy pgtype.UUID      `json:"updated_by"`
+	UpdatedAt pgtype.Timestamp `json:"updated_at"`
+}
+
+type RefreshToken struct {
+	TokenHash string           `json:"token_hash"`
+	Sid       pgtype.UUID      `json:"sid"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type Session struct {
+	Sid        pgtype.UUID      `json:"sid"`
+	Uid        pgtype.UUID      `json:"uid"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	RevokedAt  pgtype.Timestamp `json:"revoked_at"`
+	Mfa        bool             `json:"mfa"`
+	UserAgent  *string          `json:"user_agent"`
+	Ip         *string          `json:"ip"`
+	LastSeenAt pgtype.Timestamp `json:"last_seen_at"`
 }
 
 type Transaction struct {
@@ -136,13 +231,31 @@ type Transaction struct {
 	Amt       pgtype.Numeric   `json:"amt"`
 	QtyBought int32            `json:"qty_bought"`
 	TTime     pgtype.Timestamp `json:"t_time"`
+	Vrid      pgtype.UUID      `json:"vrid"`
 }
 
 type User struct {
-	Uid      pgtype.UUID `json:"uid"`
-	Email    string      `json:"email"`
-	Passhash string      `json:"passhash"`
-	Isadmin  *bool       `json:"isadmin"`
+	Uid           pgtype.UUID `json:"uid"`
+	Email         string      `json:"email"`
+	Passhash      string      `json:"passhash"`
+	Isadmin       *bool       `json:"isadmin"`
+	EmailVerified bool        `json:"email_verified"`
+}
+
+type UserIdentity struct {
+	Issuer      string           `json:"issuer"`
+	Subject     string           `json:"subject"`
+	Uid         pgtype.UUID      `json:"uid"`
+	Email       string           `json:"email"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	LastLoginAt pgtype.Timestamp `json:"last_login_at"`
+}
+
+type UserSuspension struct {
+	Uid         pgtype.UUID      `json:"uid"`
+	Reason      *string          `json:"reason"`
+	SuspendedBy pgtype.UUID      `json:"suspended_by"`
+	SuspendedAt pgtype.Timestamp `json:"suspended_at"`
 }
 
 type Vendor struct {
@@ -12,7 +12,7 @@ import (
 )
 
 const AddToCart = `-- name: AddToCart :exec
-insert into cart (bid, iid, vid, quantity) values($1, $2, $3, $4)
+insert into cart (bid, iid, vid, quantity, vrid) values($1, $2, $3, $4, $5)
 `
 
 type AddToCartParams struct {
@@ -20,6 +20,7 @@ type AddToCartParams struct {
 	Iid      pgtype.UUID `json:"iid"`
 	Vid      pgtype.UUID `json:"vid"`
 	Quantity int32       `json:"quantity"`
+	Vrid     pgtype.UUID `json:"vrid"`
 }
 
 func (q *Queries) AddToCart(ctx context.Context, arg AddToCartParams) error {
@@ -28,10 +29,125 @@ func (q *Queries) AddToCart(ctx context.Context, arg AddToCartParams) error {
 		arg.Iid,
 		arg.Vid,
 		arg.Quantity,
+		arg.Vrid,
 	)
 	return err
 }
 
+const AnonymizeUser = `-- name: AnonymizeUser :exec
+with anonymized_buyer as (
+    update buyer set name = 'deleted-' || buyer.uid::text where buyer.uid = $1
+), anonymized_vendor as (
+    update vendor set name = 'deleted-' || vendor.uid::text, logo = null where vendor.uid = $1
+), payout_accounts as (
+    delete from accounts where accounts.uid = $1
+), cart_items as (
+    delete from cart where cart.bid = $1
+), sessions as (
+    delete from session where session.uid = $1
+), password_resets as (
+    delete from password_reset where password_reset.uid = $1
+), totp as (
+    delete from mfa_totp where mfa_totp.uid = $1
+), recovery_codes as (
+    delete from mfa_recovery_code where mfa_recovery_code.uid = $1
+), api_keys as (
+    delete from api_key where api_key.uid = $1
+), identities as (
+    delete from user_identity where user_identity.uid = $1
+), auth_events as (
+    update auth_event set email = null, ip = null, user_agent = null where auth_event.uid = $1
+), login_attempts as (
+    delete from login_attempt
+    where login_attempt.subject = (select 'account:' || lower(u.email) from "user" u where u.uid = $1)
+)
+update "user"
+set
+    email = 'deleted-' || "user".uid::text || '@deleted.invalid',
+    passhash = '',
+    isadmin = false,
+    email_verified = false
+where "user".uid = $1
+`
+
+func (q *Queries) AnonymizeUser(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, AnonymizeUser, uid)
+	return err
+}
+
+const BuyerNameTaken = `-- name: BuyerNameTaken :one
+select exists(select 1 from buyer where name = $1)
+`
+
+func (q *Queries) BuyerNameTaken(ctx context.Context, name string) (bool, error) {
+	row := q.db.QueryRow(ctx, BuyerNameTaken, name)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const CancelAccountDeletion = `-- name: CancelAccountDeletion :execrows
+delete from account_deletion where uid = $1 and anonymized_at is null
+`
+
+func (q *Queries) CancelAccountDeletion(ctx context.Context, uid pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, CancelAccountDeletion, uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const ChangeUserEmail = `-- name: ChangeUserEmail :execrows
+update "user" set email = $1, email_verified = true
+where uid = $2 and email = $3
+`
+
+type ChangeUserEmailParams struct {
+	NewEmail string      `json:"new_email"`
+	Uid      pgtype.UUID `json:"uid"`
+	OldEmail string      `json:"old_email"`
+}
+
+func (q *Queries) ChangeUserEmail(ctx context.Context, arg ChangeUserEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, ChangeUserEmail, arg.NewEmail, arg.Uid, arg.OldEmail)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const ClaimAccountDeletion = `-- name: ClaimAccountDeletion :execrows
+update account_deletion set anonymized_at = now()
+where uid = $1 and anonymized_at is null and purge_after <= now()
+`
+
+func (q *Queries) ClaimAccountDeletion(ctx context.Context, uid pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, ClaimAccountDeletion, uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const ClaimOidcLogin = `-- name: ClaimOidcLogin :one
+delete from oidc_login where state_hash = $1
+returning nonce, code_verifier, expires_at
+`
+
+type ClaimOidcLoginRow struct {
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+}
+
+func (q *Queries) ClaimOidcLogin(ctx context.Context, stateHash string) (ClaimOidcLoginRow, error) {
+	row := q.db.QueryRow(ctx, ClaimOidcLogin, stateHash)
+	var i ClaimOidcLoginRow
+	err := row.Scan(&i.Nonce, &i.CodeVerifier, &i.ExpiresAt)
+	return i, err
+}
+
 const ClearCart = `-- name: ClearCart :exec
 delete from cart where bid = $1
 `
@@ -41,8 +157,173 @@ func (q *Queries) ClearCart(ctx context.Context, bid pgtype.UUID) error {
 	return err
 }
 
+const ClearLoginAttempts = `-- name: ClearLoginAttempts :execrows
+delete from login_attempt where subject = $1
+`
+
+func (q *Queries) ClearLoginAttempts(ctx context.Context, subject string) (int64, error) {
+	result, err := q.db.Exec(ctx, ClearLoginAttempts, subject)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const CountItemsByCategory = `-- name: CountItemsByCategory :many
+select category, count(*) as items from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and ($3::decimal is null or cost >= $3)
+    and ($4::decimal is null or cost <= $4)
+    and (not $5::boolean or quantity > 0)
+    and ($6::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $6)
+    ))
+group by category
+order by category
+`
+
+type CountItemsByCategoryParams struct {
+	Vid         pgtype.UUID    `json:"vid"`
+	VisibleOnly bool           `json:"visible_only"`
+	MinCost     pgtype.Numeric `json:"min_cost"`
+	MaxCost     pgtype.Numeric `json:"max_cost"`
+	InStock     bool           `json:"in_stock"`
+	Query       *string        `json:"query"`
+}
+
+type CountItemsByCategoryRow struct {
+	Category string `json:"category"`
+	Items    int64  `json:"items"`
+}
+
+func (q *Queries) CountItemsByCategory(ctx context.Context, arg CountItemsByCategoryParams) ([]CountItemsByCategoryRow, error) {
+	rows, err := q.db.Query(ctx, CountItemsByCategory,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountItemsByCategoryRow{}
+	for rows.Next() {
+		var i CountItemsByCategoryRow
+		if err := rows.Scan(&i.Category, &i.Items); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const CountItemsByPriceBucket = `-- name: CountItemsByPriceBucket :many
+select width_bucket(cost::float8, $1::float8[])::integer as bucket, count(*) as items from item
+where ($2::uuid is null or vid = $2)
+    and (not $3::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($4::text[]), 0) = 0 or category in (select category_subtree($4::text[])))
+    and (not $5::boolean or quantity > 0)
+    and ($6::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $6)
+    ))
+group by bucket
+order by bucket
+`
+
+type CountItemsByPriceBucketParams struct {
+	Bounds      []float64   `json:"bounds"`
+	Vid         pgtype.UUID `json:"vid"`
+	VisibleOnly bool        `json:"visible_only"`
+	Categories  []string    `json:"categories"`
+	InStock     bool        `json:"in_stock"`
+	Query       *string     `json:"query"`
+}
+
+type CountItemsByPriceBucketRow struct {
+	Bucket int32 `json:"bucket"`
+	Items  int64 `json:"items"`
+}
+
+func (q *Queries) CountItemsByPriceBucket(ctx context.Context, arg CountItemsByPriceBucketParams) ([]CountItemsByPriceBucketRow, error) {
+	rows, err := q.db.Query(ctx, CountItemsByPriceBucket,
+		arg.Bounds,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.InStock,
+		arg.Query,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CountItemsByPriceBucketRow{}
+	for rows.Next() {
+		var i CountItemsByPriceBucketRow
+		if err := rows.Scan(&i.Bucket, &i.Items); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const CountRecoveryCodes = `-- name: CountRecoveryCodes :one
+select count(*) from mfa_recovery_code where uid = $1 and used_at is null
+`
+
+func (q *Queries) CountRecoveryCodes(ctx context.Context, uid pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, CountRecoveryCodes, uid)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const CreateSession = `-- name: CreateSession :one
+insert into session (uid, mfa, user_agent, ip) values ($1, $2, $3, $4) returning sid
+`
+
+type CreateSessionParams struct {
+	Uid       pgtype.UUID `json:"uid"`
+	Mfa       bool        `json:"mfa"`
+	UserAgent *string     `json:"user_agent"`
+	Ip        *string     `json:"ip"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, CreateSession,
+		arg.Uid,
+		arg.Mfa,
+		arg.UserAgent,
+		arg.Ip,
+	)
+	var sid pgtype.UUID
+	err := row.Scan(&sid)
+	return sid, err
+}
+
 const CreateTransaction = `-- name: CreateTransaction :one
-insert into transaction (bid, vid, iid, amt, qty_bought, t_time) values($1, $2, $3, $4, $5, now()) returning tid
+insert into transaction (bid, vid, iid, amt, qty_bought, t_time, vrid) values($1, $2, $3, $4, $5, now(), $6) returning tid
 `
 
 type CreateTransactionParams struct {
@@ -51,6 +332,7 @@ type CreateTransactionParams struct {
 	Iid       pgtype.UUID    `json:"iid"`
 	Amt       pgtype.Numeric `json:"amt"`
 	QtyBought int32          `json:"qty_bought"`
+	Vrid      pgtype.UUID    `json:"vrid"`
 }
 
 func (q *Queries) CreateTransaction(ctx context.Context, arg CreateTransactionParams) (pgtype.UUID, error) {
@@ -60,6 +342,7 @@ func (q *Queries) CreateTransaction(ctx context.Context, arg CreateTransactionPa
 		arg.Iid,
 		arg.Amt,
 		arg.QtyBought,
+		arg.Vrid,
 	)
 	var tid pgtype.UUID
 	err := row.Scan(&tid)
@@ -78,17 +361,74 @@ func (q *Queries) DbVersion(ctx context.Context) (string, error) {
 }
 
 const DeleteCartItem = `-- name: DeleteCartItem :exec
-delete from cart where bid = $1 and iid = $2 and vid = $3
+delete from cart where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $4
 `
 
 type DeleteCartItemParams struct {
-	Bid pgtype.UUID `json:"bid"`
-	Iid pgtype.UUID `json:"iid"`
-	Vid pgtype.UUID `json:"vid"`
+	Bid  pgtype.UUID `json:"bid"`
+	Iid  pgtype.UUID `json:"iid"`
+	Vid  pgtype.UUID `json:"vid"`
+	Vrid pgtype.UUID `json:"vrid"`
 }
 
 func (q *Queries) DeleteCartItem(ctx context.Context, arg DeleteCartItemParams) error {
-	_, err := q.db.Exec(ctx, DeleteCartItem, arg.Bid, arg.Iid, arg.Vid)
+	_, err := q.db.Exec(ctx, DeleteCartItem,
+		arg.Bid,
+		arg.Iid,
+		arg.Vid,
+		arg.Vrid,
+	)
+	return err
+}
+
+const DeleteCartItemsForVendor = `-- name: DeleteCartItemsForVendor :exec
+delete from cart where vid = $1
+`
+
+func (q *Queries) DeleteCartItemsForVendor(ctx context.Context, vid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, DeleteCartItemsForVendor, vid)
+	return err
+}
+
+const DeleteCartItemsWithoutVariant = `-- name: DeleteCartItemsWithoutVariant :exec
+delete from cart where iid = $1 and vrid is null
+`
+
+func (q *Queries) DeleteCartItemsWithoutVariant(ctx context.Context, iid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, DeleteCartItemsWithoutVariant, iid)
+	return err
+}
+
+const DeleteCategory = `-- name: DeleteCategory :execrows
+delete from category where cid = $1
+`
+
+func (q *Queries) DeleteCategory(ctx context.Context, cid pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, DeleteCategory, cid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const DeleteEmailException = `-- name: DeleteEmailException :execrows
+delete from email_exception where email = $1
+`
+
+func (q *Queries) DeleteEmailException(ctx context.Context, email string) (int64, error) {
+	result, err := q.db.Exec(ctx, DeleteEmailException, email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const DeleteExpiredOidcLogins = `-- name: DeleteExpiredOidcLogins :exec
+delete from oidc_login where expires_at < now()
+`
+
+func (q *Queries) DeleteExpiredOidcLogins(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, DeleteExpiredOidcLogins)
 	return err
 }
 
@@ -101,6 +441,48 @@ func (q *Queries) DeleteItem(ctx context.Context, iid pgtype.UUID) error {
 	return err
 }
 
+const DeleteItemOptions = `-- name: DeleteItemOptions :exec
+delete from item_option where iid = $1
+`
+
+func (q *Queries) DeleteItemOptions(ctx context.Context, iid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, DeleteItemOptions, iid)
+	return err
+}
+
+const DeleteItemVariantsExcept = `-- name: DeleteItemVariantsExcept :exec
+delete from item_variant
+where iid = $1 and not (sku = any($2::text[]))
+`
+
+type DeleteItemVariantsExceptParams struct {
+	Iid  pgtype.UUID `json:"iid"`
+	Skus []string    `json:"skus"`
+}
+
+func (q *Queries) DeleteItemVariantsExcept(ctx context.Context, arg DeleteItemVariantsExceptParams) error {
+	_, err := q.db.Exec(ctx, DeleteItemVariantsExcept, arg.Iid, arg.Skus)
+	return err
+}
+
+const DeleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+delete from mfa_recovery_code where uid = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, DeleteRecoveryCodes, uid)
+	return err
+}
+
+const DeleteTotp = `-- name: DeleteTotp :exec
+delete from mfa_totp where uid = $1
+`
+
+func (q *Queries) DeleteTotp(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, DeleteTotp, uid)
+	return err
+}
+
 const DeleteUser = `-- name: DeleteUser :exec
 delete from "user" where uid = $1
 `
@@ -110,37 +492,65 @@ func (q *Queries) DeleteUser(ctx context.Context, uid pgtype.UUID) error {
 	return err
 }
 
-const GetAllItems = `-- name: GetAllItems :many
-select iid, vid, name, pictureurl, description, category, quantity, cost from "item"
+const EnableTotp = `-- name: EnableTotp :execrows
+update mfa_totp set enabled_at = now(), last_used_step = $2
+where uid = $1 and enabled_at is null
 `
 
-func (q *Queries) GetAllItems(ctx context.Context) ([]Item, error) {
-	rows, err := q.db.Query(ctx, GetAllItems)
+type EnableTotpParams struct {
+	Uid          pgtype.UUID `json:"uid"`
+	LastUsedStep int64       `json:"last_used_step"`
+}
+
+func (q *Queries) EnableTotp(ctx context.Context, arg EnableTotpParams) (int64, error) {
+	result, err := q.db.Exec(ctx, EnableTotp, arg.Uid, arg.LastUsedStep)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	items := []Item{}
-	for rows.Next() {
-		var i Item
-		if err := rows.Scan(
-			&i.Iid,
-			&i.Vid,
-			&i.Name,
-			&i.Pictureurl,
-			&i.Description,
-			&i.Category,
-			&i.Quantity,
-			&i.Cost,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected(), nil
+}
+
+const GetApiKeyByHash = `-- name: GetApiKeyByHash :one
+select
+    api_key.kid,
+    api_key.uid,
+    api_key.scopes,
+    "user".email,
+    user_suspension.suspended_at,
+    exists(select 1 from vendor where vendor.uid = api_key.uid) as is_vendor
+from
+    api_key
+inner join "user" on
+    "user".uid = api_key.uid
+left join user_suspension on
+    user_suspension.uid = api_key.uid
+where
+    api_key.key_hash = $1
+    and api_key.revoked_at is null
+limit 1
+`
+
+type GetApiKeyByHashRow struct {
+	Kid         pgtype.UUID      `json:"kid"`
+	Uid         pgtype.UUID      `json:"uid"`
+	Scopes      []string         `json:"scopes"`
+	Email       string           `json:"email"`
+	SuspendedAt pgtype.Timestamp `json:"suspended_at"`
+	IsVendor    bool             `json:"is_vendor"`
+}
+
+func (q *Queries) GetApiKeyByHash(ctx context.Context, keyHash string) (GetApiKeyByHashRow, error) {
+	row := q.db.QueryRow(ctx, GetApiKeyByHash, keyHash)
+	var i GetApiKeyByHashRow
+	err := row.Scan(
+		&i.Kid,
+		&i.Uid,
+		&i.Scopes,
+		&i.Email,
+		&i.SuspendedAt,
+		&i.IsVendor,
+	)
+	return i, err
 }
 
 const GetBuyerByEmail = `-- name: GetBuyerByEmail :one
@@ -213,13 +623,14 @@ func (q *Queries) GetBuyerById(ctx context.Context, uid pgtype.UUID) (GetBuyerBy
 
 const GetCartItem = `-- name: GetCartItem :one
 select bid, iid, vid from cart
-where bid = $1 and iid = $2 and vid = $3
+where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $4
 `
 
 type GetCartItemParams struct {
-	Bid pgtype.UUID `json:"bid"`
-	Iid pgtype.UUID `json:"iid"`
-	Vid pgtype.UUID `json:"vid"`
+	Bid  pgtype.UUID `json:"bid"`
+	Iid  pgtype.UUID `json:"iid"`
+	Vid  pgtype.UUID `json:"vid"`
+	Vrid pgtype.UUID `json:"vrid"`
 }
 
 type GetCartItemRow struct {
@@ -229,7 +640,12 @@ type GetCartItemRow struct {
 }
 
 func (q *Queries) GetCartItem(ctx context.Context, arg GetCartItemParams) (GetCartItemRow, error) {
-	row := q.db.QueryRow(ctx, GetCartItem, arg.Bid, arg.Iid, arg.Vid)
+	row := q.db.QueryRow(ctx, GetCartItem,
+		arg.Bid,
+		arg.Iid,
+		arg.Vid,
+		arg.Vrid,
+	)
 	var i GetCartItemRow
 	err := row.Scan(&i.Bid, &i.Iid, &i.Vid)
 	return i, err
@@ -239,18 +655,23 @@ const GetCartItemsForBuyer = `-- name: GetCartItemsForBuyer :many
 select
     vendor.name as vendor_name,
     item.name,
-    item.cost,
+    coalesce(item_variant.cost, item.cost)::decimal(12, 2) as cost,
     item.pictureurl,
     cart.quantity,
     cart.added_time,
     item.iid,
-    item.vid 
+    item.vid,
+    cart.vrid,
+    item_variant.sku,
+    item_variant.options
 from
     cart
 left join vendor on
     vendor.uid = cart.vid
 left join item on
     item.iid = cart.iid
+left join item_variant on
+    item_variant.vrid = cart.vrid
 where
     cart.bid = $1
 order by
@@ -266,6 +687,9 @@ type GetCartItemsForBuyerRow struct {
 	AddedTime  pgtype.Timestamp `json:"added_time"`
 	Iid        pgtype.UUID      `json:"iid"`
 	Vid        pgtype.UUID      `json:"vid"`
+	Vrid       pgtype.UUID      `json:"vrid"`
+	Sku        *string          `json:"sku"`
+	Options    []string         `json:"options"`
 }
 
 func (q *Queries) GetCartItemsForBuyer(ctx context.Context, bid pgtype.UUID) ([]GetCartItemsForBuyerRow, error) {
@@ -286,6 +710,9 @@ func (q *Queries) GetCartItemsForBuyer(ctx context.Context, bid pgtype.UUID) ([]
 			&i.AddedTime,
 			&i.Iid,
 			&i.Vid,
+			&i.Vrid,
+			&i.Sku,
+			&i.Options,
 		); err != nil {
 			return nil, err
 		}
@@ -297,8 +724,63 @@ func (q *Queries) GetCartItemsForBuyer(ctx context.Context, bid pgtype.UUID) ([]
 	return items, nil
 }
 
+const GetCategoryById = `-- name: GetCategoryById :one
+select cid, parent_cid, name, slug, position, active, created_at from category where cid = $1
+`
+
+func (q *Queries) GetCategoryById(ctx context.Context, cid pgtype.UUID) (Category, error) {
+	row := q.db.QueryRow(ctx, GetCategoryById, cid)
+	var i Category
+	err := row.Scan(
+		&i.Cid,
+		&i.ParentCid,
+		&i.Name,
+		&i.Slug,
+		&i.Position,
+		&i.Active,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const GetCategoryBySlug = `-- name: GetCategoryBySlug :one
+select cid, parent_cid, name, slug, position, active, created_at from category where slug = $1
+`
+
+func (q *Queries) GetCategoryBySlug(ctx context.Context, slug string) (Category, error) {
+	row := q.db.QueryRow(ctx, GetCategoryBySlug, slug)
+	var i Category
+	err := row.Scan(
+		&i.Cid,
+		&i.ParentCid,
+		&i.Name,
+		&i.Slug,
+		&i.Position,
+		&i.Active,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const GetEmailException = `-- name: GetEmailException :one
+select email, user_type, note, created_by, created_at from email_exception where email = $1 limit 1
+`
+
+func (q *Queries) GetEmailException(ctx context.Context, email string) (EmailException, error) {
+	row := q.db.QueryRow(ctx, GetEmailException, email)
+	var i EmailException
+	err := row.Scan(
+		&i.Email,
+		&i.UserType,
+		&i.Note,
+		&i.CreatedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const GetItemById = `-- name: GetItemById :one
-select iid, vid, name, pictureurl, description, category, quantity, cost from item where iid = $1
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item where iid = $1
 `
 
 func (q *Queries) GetItemById(ctx context.Context, iid pgtype.UUID) (Item, error) {
@@ -313,6 +795,7 @@ func (q *Queries) GetItemById(ctx context.Context, iid pgtype.UUID) (Item, error
 		&i.Category,
 		&i.Quantity,
 		&i.Cost,
+		&i.CreatedAt,
 	)
 	return i, err
 }
@@ -338,6 +821,9 @@ join "user" u on
     u.uid = v.uid
 where
     iid = $1
+    and not exists (select 1 from item_takedown t where t.iid = i.iid)
+    and not exists (select 1 from user_suspension s where s.uid = i.vid)
+    and not exists (select 1 from account_deletion d where d.uid = i.vid)
 `
 
 type GetItemByIdWithVendorInfoRow struct {
@@ -346,7 +832,7 @@ type GetItemByIdWithVendorInfoRow struct {
 	Name        string         `json:"name"`
 	Pictureurl  *string        `json:"pictureurl"`
 	Description *string        `json:"description"`
-	Category    Category       `json:"category"`
+	Category    string         `json:"category"`
 	Quantity    int32          `json:"quantity"`
 	Cost        pgtype.Numeric `json:"cost"`
 	VendorName  string         `json:"vendor_name"`
@@ -374,7 +860,7 @@ func (q *Queries) GetItemByIdWithVendorInfo(ctx context.Context, iid pgtype.UUID
 }
 
 const GetItemByName = `-- name: GetItemByName :one
-select iid, vid, name, pictureurl, description, category, quantity, cost from item where name like $1
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item where name like $1
 `
 
 func (q *Queries) GetItemByName(ctx context.Context, name string) (Item, error) {
@@ -389,43 +875,254 @@ func (q *Queries) GetItemByName(ctx context.Context, name string) (Item, error)
 		&i.Category,
 		&i.Quantity,
 		&i.Cost,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const GetItemsByVendorId = `-- name: GetItemsByVendorId :many
-select iid, vid, name, pictureurl, description, category, quantity, cost from "item" where vid = $1
+const GetItemVariant = `-- name: GetItemVariant :one
+select vrid, iid, sku, options, quantity, cost, created_at from item_variant where vrid = $1
 `
 
-func (q *Queries) GetItemsByVendorId(ctx context.Context, vid pgtype.UUID) ([]Item, error) {
-	rows, err := q.db.Query(ctx, GetItemsByVendorId, vid)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	items := []Item{}
-	for rows.Next() {
-		var i Item
-		if err := rows.Scan(
-			&i.Iid,
-			&i.Vid,
-			&i.Name,
-			&i.Pictureurl,
-			&i.Description,
-			&i.Category,
-			&i.Quantity,
-			&i.Cost,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
+func (q *Queries) GetItemVariant(ctx context.Context, vrid pgtype.UUID) (ItemVariant, error) {
+	row := q.db.QueryRow(ctx, GetItemVariant, vrid)
+	var i ItemVariant
+	err := row.Scan(
+		&i.Vrid,
+		&i.Iid,
+		&i.Sku,
+		&i.Options,
+		&i.Quantity,
+		&i.Cost,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const GetLoginAttempt = `-- name: GetLoginAttempt :one
+select subject, failures, last_failure_at, locked_until from login_attempt where subject = $1 limit 1
+`
+
+func (q *Queries) GetLoginAttempt(ctx context.Context, subject string) (LoginAttempt, error) {
+	row := q.db.QueryRow(ctx, GetLoginAttempt, subject)
+	var i LoginAttempt
+	err := row.Scan(
+		&i.Subject,
+		&i.Failures,
+		&i.LastFailureAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const GetPasswordReset = `-- name: GetPasswordReset :one
+select token_hash, uid, expires_at, used_at, created_at from password_reset where token_hash = $1 limit 1
+`
+
+func (q *Queries) GetPasswordReset(ctx context.Context, tokenHash string) (PasswordReset, error) {
+	row := q.db.QueryRow(ctx, GetPasswordReset, tokenHash)
+	var i PasswordReset
+	err := row.Scan(
+		&i.TokenHash,
+		&i.Uid,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const GetPlatformSales = `-- name: GetPlatformSales :one
+select
+    count(*) as transactions,
+    coalesce(sum(qty_bought), 0)::bigint as items_sold,
+    coalesce(sum(amt), 0)::decimal(12, 2) as total
+from
+    transaction
+where
+    ($1::timestamp is null or t_time >= $1)
+    and ($2::timestamp is null or t_time < $2)
+`
+
+type GetPlatformSalesParams struct {
+	Since pgtype.Timestamp `json:"since"`
+	Until pgtype.Timestamp `json:"until"`
+}
+
+type GetPlatformSalesRow struct {
+	Transactions int64          `json:"transactions"`
+	ItemsSold    int64          `json:"items_sold"`
+	Total        pgtype.Numeric `json:"total"`
+}
+
+func (q *Queries) GetPlatformSales(ctx context.Context, arg GetPlatformSalesParams) (GetPlatformSalesRow, error) {
+	row := q.db.QueryRow(ctx, GetPlatformSales, arg.Since, arg.Until)
+	var i GetPlatformSalesRow
+	err := row.Scan(&i.Transactions, &i.ItemsSold, &i.Total)
+	return i, err
+}
+
+const GetRefreshToken = `-- name: GetRefreshToken :one
+select
+    refresh_token.token_hash,
+    refresh_token.sid,
+    refresh_token.expires_at,
+    refresh_token.used_at,
+    session.uid,
+    session.revoked_at,
+    session.mfa
+from
+    refresh_token
+inner join session on
+    session.sid = refresh_token.sid
+where
+    refresh_token.token_hash = $1
+limit 1
+`
+
+type GetRefreshTokenRow struct {
+	TokenHash string           `json:"token_hash"`
+	Sid       pgtype.UUID      `json:"sid"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	Uid       pgtype.UUID      `json:"uid"`
+	RevokedAt pgtype.Timestamp `json:"revoked_at"`
+	Mfa       bool             `json:"mfa"`
+}
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (GetRefreshTokenRow, error) {
+	row := q.db.QueryRow(ctx, GetRefreshToken, tokenHash)
+	var i GetRefreshTokenRow
+	err := row.Scan(
+		&i.TokenHash,
+		&i.Sid,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.Uid,
+		&i.RevokedAt,
+		&i.Mfa,
+	)
+	return i, err
+}
+
+const GetSalesByVendor = `-- name: GetSalesByVendor :many
+select
+    transaction.vid,
+    vendor.name as vendor_name,
+    count(*) as transactions,
+    coalesce(sum(qty_bought), 0)::bigint as items_sold,
+    coalesce(sum(amt), 0)::decimal(12, 2) as total
+from
+    transaction
+inner join vendor on
+    vendor.uid = transaction.vid
+where
+    ($1::timestamp is null or t_time >= $1)
+    and ($2::timestamp is null or t_time < $2)
+group by
+    transaction.vid,
+    vendor.name
+order by
+    total desc
+`
+
+type GetSalesByVendorParams struct {
+	Since pgtype.Timestamp `json:"since"`
+	Until pgtype.Timestamp `json:"until"`
+}
+
+type GetSalesByVendorRow struct {
+	Vid          pgtype.UUID    `json:"vid"`
+	VendorName   string         `json:"vendor_name"`
+	Transactions int64          `json:"transactions"`
+	ItemsSold    int64          `json:"items_sold"`
+	Total        pgtype.Numeric `json:"total"`
+}
+
+func (q *Queries) GetSalesByVendor(ctx context.Context, arg GetSalesByVendorParams) ([]GetSalesByVendorRow, error) {
+	rows, err := q.db.Query(ctx, GetSalesByVendor, arg.Since, arg.Until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GetSalesByVendorRow{}
+	for rows.Next() {
+		var i GetSalesByVendorRow
+		if err := rows.Scan(
+			&i.Vid,
+			&i.VendorName,
+			&i.Transactions,
+			&i.ItemsSold,
+			&i.Total,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return items, nil
 }
 
+const GetSession = `-- name: GetSession :one
+select sid, uid, created_at, revoked_at, mfa, user_agent, ip, last_seen_at from session where sid = $1 limit 1
+`
+
+func (q *Queries) GetSession(ctx context.Context, sid pgtype.UUID) (Session, error) {
+	row := q.db.QueryRow(ctx, GetSession, sid)
+	var i Session
+	err := row.Scan(
+		&i.Sid,
+		&i.Uid,
+		&i.CreatedAt,
+		&i.RevokedAt,
+		&i.Mfa,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastSeenAt,
+	)
+	return i, err
+}
+
+const GetSessionStatus = `-- name: GetSessionStatus :one
+select
+    session.uid,
+    session.revoked_at,
+    user_suspension.suspended_at
+from
+    session
+left join user_suspension on
+    user_suspension.uid = session.uid
+where
+    session.sid = $1
+limit 1
+`
+
+type GetSessionStatusRow struct {
+	Uid         pgtype.UUID      `json:"uid"`
+	RevokedAt   pgtype.Timestamp `json:"revoked_at"`
+	SuspendedAt pgtype.Timestamp `json:"suspended_at"`
+}
+
+func (q *Queries) GetSessionStatus(ctx context.Context, sid pgtype.UUID) (GetSessionStatusRow, error) {
+	row := q.db.QueryRow(ctx, GetSessionStatus, sid)
+	var i GetSessionStatusRow
+	err := row.Scan(&i.Uid, &i.RevokedAt, &i.SuspendedAt)
+	return i, err
+}
+
+const GetSetting = `-- name: GetSetting :one
+select value from platform_setting where name = $1 limit 1
+`
+
+func (q *Queries) GetSetting(ctx context.Context, name string) (string, error) {
+	row := q.db.QueryRow(ctx, GetSetting, name)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
 const GetTotalSales = `-- name: GetTotalSales :one
 select coalesce(sum(amt)::decimal(12, 2), 0) from transaction
 where vid = $1
@@ -455,21 +1152,55 @@ func (q *Queries) GetTotalSalesForItem(ctx context.Context, arg GetTotalSalesFor
 	return coalesce, err
 }
 
+const GetTotp = `-- name: GetTotp :one
+select uid, secret, enabled_at, last_used_step, created_at from mfa_totp where uid = $1 limit 1
+`
+
+func (q *Queries) GetTotp(ctx context.Context, uid pgtype.UUID) (MfaTotp, error) {
+	row := q.db.QueryRow(ctx, GetTotp, uid)
+	var i MfaTotp
+	err := row.Scan(
+		&i.Uid,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const GetTransactionsForVendor = `-- name: GetTransactionsForVendor :many
-select item.name, amt, t_time from transaction 
+select transaction.tid, item.name, amt, t_time, item_variant.sku from transaction
 left join item on item.iid = transaction.iid
-where transaction.vid = $1 
-order by t_time desc
+left join item_variant on item_variant.vrid = transaction.vrid
+where transaction.vid = $1
+    and ($2::uuid is null or (t_time, tid) < ($3::timestamp, $2))
+order by t_time desc, tid desc
+limit $4
 `
 
+type GetTransactionsForVendorParams struct {
+	Vid        pgtype.UUID      `json:"vid"`
+	AfterTid   pgtype.UUID      `json:"after_tid"`
+	AfterTTime pgtype.Timestamp `json:"after_t_time"`
+	RowLimit   int32            `json:"row_limit"`
+}
+
 type GetTransactionsForVendorRow struct {
+	Tid   pgtype.UUID      `json:"tid"`
 	Name  *string          `json:"name"`
 	Amt   pgtype.Numeric   `json:"amt"`
 	TTime pgtype.Timestamp `json:"t_time"`
+	Sku   *string          `json:"sku"`
 }
 
-func (q *Queries) GetTransactionsForVendor(ctx context.Context, vid pgtype.UUID) ([]GetTransactionsForVendorRow, error) {
-	rows, err := q.db.Query(ctx, GetTransactionsForVendor, vid)
+func (q *Queries) GetTransactionsForVendor(ctx context.Context, arg GetTransactionsForVendorParams) ([]GetTransactionsForVendorRow, error) {
+	rows, err := q.db.Query(ctx, GetTransactionsForVendor,
+		arg.Vid,
+		arg.AfterTid,
+		arg.AfterTTime,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -477,7 +1208,13 @@ func (q *Queries) GetTransactionsForVendor(ctx context.Context, vid pgtype.UUID)
 	items := []GetTransactionsForVendorRow{}
 	for rows.Next() {
 		var i GetTransactionsForVendorRow
-		if err := rows.Scan(&i.Name, &i.Amt, &i.TTime); err != nil {
+		if err := rows.Scan(
+			&i.Tid,
+			&i.Name,
+			&i.Amt,
+			&i.TTime,
+			&i.Sku,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -489,7 +1226,7 @@ func (q *Queries) GetTransactionsForVendor(ctx context.Context, vid pgtype.UUID)
 }
 
 const GetUserByEmail = `-- name: GetUserByEmail :one
-select uid, email, passhash, isadmin from "user" where email like $1 limit 1
+select uid, email, passhash, isadmin, email_verified from "user" where email like $1 limit 1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -500,12 +1237,30 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.Passhash,
 		&i.Isadmin,
+		&i.EmailVerified,
+	)
+	return i, err
+}
+
+const GetUserByExactEmail = `-- name: GetUserByExactEmail :one
+select uid, email, passhash, isadmin, email_verified from "user" where lower(email) = lower($1) limit 1
+`
+
+func (q *Queries) GetUserByExactEmail(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRow(ctx, GetUserByExactEmail, lower)
+	var i User
+	err := row.Scan(
+		&i.Uid,
+		&i.Email,
+		&i.Passhash,
+		&i.Isadmin,
+		&i.EmailVerified,
 	)
 	return i, err
 }
 
 const GetUserById = `-- name: GetUserById :one
-select uid, email, passhash, isadmin from "user" where uid = $1 limit 1
+select uid, email, passhash, isadmin, email_verified from "user" where uid = $1 limit 1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, uid pgtype.UUID) (User, error) {
@@ -516,6 +1271,66 @@ func (q *Queries) GetUserById(ctx context.Context, uid pgtype.UUID) (User, error
 		&i.Email,
 		&i.Passhash,
 		&i.Isadmin,
+		&i.EmailVerified,
+	)
+	return i, err
+}
+
+const GetUserIdentity = `-- name: GetUserIdentity :one
+select uid from user_identity where issuer = $1 and subject = $2
+`
+
+type GetUserIdentityParams struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, GetUserIdentity, arg.Issuer, arg.Subject)
+	var uid pgtype.UUID
+	err := row.Scan(&uid)
+	return uid, err
+}
+
+const GetUserStatus = `-- name: GetUserStatus :one
+select
+    "user".email,
+    "user".isadmin,
+    user_suspension.suspended_at,
+    exists(select 1 from buyer where buyer.uid = "user".uid) as is_buyer,
+    exists(select 1 from vendor where vendor.uid = "user".uid) as is_vendor,
+    exists(select 1 from mfa_totp where mfa_totp.uid = "user".uid and mfa_totp.enabled_at is not null) as mfa_enabled,
+    exists(select 1 from account_deletion where account_deletion.uid = "user".uid) as is_deleted
+from
+    "user"
+left join user_suspension on
+    user_suspension.uid = "user".uid
+where
+    "user".uid = $1
+limit 1
+`
+
+type GetUserStatusRow struct {
+	Email       string           `json:"email"`
+	Isadmin     *bool            `json:"isadmin"`
+	SuspendedAt pgtype.Timestamp `json:"suspended_at"`
+	IsBuyer     bool             `json:"is_buyer"`
+	IsVendor    bool             `json:"is_vendor"`
+	MfaEnabled  bool             `json:"mfa_enabled"`
+	IsDeleted   bool             `json:"is_deleted"`
+}
+
+func (q *Queries) GetUserStatus(ctx context.Context, uid pgtype.UUID) (GetUserStatusRow, error) {
+	row := q.db.QueryRow(ctx, GetUserStatus, uid)
+	var i GetUserStatusRow
+	err := row.Scan(
+		&i.Email,
+		&i.Isadmin,
+		&i.SuspendedAt,
+		&i.IsBuyer,
+		&i.IsVendor,
+		&i.MfaEnabled,
+		&i.IsDeleted,
 	)
 	return i, err
 }
@@ -594,6 +1409,103 @@ func (q *Queries) GetVendorById(ctx context.Context, uid pgtype.UUID) (GetVendor
 	return i, err
 }
 
+const GetVisibleItemById = `-- name: GetVisibleItemById :one
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where iid = $1
+    and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+    and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+    and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+`
+
+func (q *Queries) GetVisibleItemById(ctx context.Context, iid pgtype.UUID) (Item, error) {
+	row := q.db.QueryRow(ctx, GetVisibleItemById, iid)
+	var i Item
+	err := row.Scan(
+		&i.Iid,
+		&i.Vid,
+		&i.Name,
+		&i.Pictureurl,
+		&i.Description,
+		&i.Category,
+		&i.Quantity,
+		&i.Cost,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const InsertApiKey = `-- name: InsertApiKey :one
+insert into api_key (uid, name, key_hash, prefix, scopes) values ($1, $2, $3, $4, $5)
+returning kid, name, prefix, scopes, created_at, last_used_at
+`
+
+type InsertApiKeyParams struct {
+	Uid     pgtype.UUID `json:"uid"`
+	Name    string      `json:"name"`
+	KeyHash string      `json:"key_hash"`
+	Prefix  string      `json:"prefix"`
+	Scopes  []string    `json:"scopes"`
+}
+
+type InsertApiKeyRow struct {
+	Kid        pgtype.UUID      `json:"kid"`
+	Name       string           `json:"name"`
+	Prefix     string           `json:"prefix"`
+	Scopes     []string         `json:"scopes"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	LastUsedAt pgtype.Timestamp `json:"last_used_at"`
+}
+
+func (q *Queries) InsertApiKey(ctx context.Context, arg InsertApiKeyParams) (InsertApiKeyRow, error) {
+	row := q.db.QueryRow(ctx, InsertApiKey,
+		arg.Uid,
+		arg.Name,
+		arg.KeyHash,
+		arg.Prefix,
+		arg.Scopes,
+	)
+	var i InsertApiKeyRow
+	err := row.Scan(
+		&i.Kid,
+		&i.Name,
+		&i.Prefix,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const InsertAuthEvent = `-- name: InsertAuthEvent :exec
+insert into auth_event (uid, actor, event, outcome, email, ip, user_agent, detail)
+values ($1, $2, $3, $4, $5, $6, $7, $8)
+`
+
+type InsertAuthEventParams struct {
+	Uid       pgtype.UUID `json:"uid"`
+	Actor     pgtype.UUID `json:"actor"`
+	Event     string      `json:"event"`
+	Outcome   string      `json:"outcome"`
+	Email     *string     `json:"email"`
+	Ip        *string     `json:"ip"`
+	UserAgent *string     `json:"user_agent"`
+	Detail    *string     `json:"detail"`
+}
+
+func (q *Queries) InsertAuthEvent(ctx context.Context, arg InsertAuthEventParams) error {
+	_, err := q.db.Exec(ctx, InsertAuthEvent,
+		arg.Uid,
+		arg.Actor,
+		arg.Event,
+		arg.Outcome,
+		arg.Email,
+		arg.Ip,
+		arg.UserAgent,
+		arg.Detail,
+	)
+	return err
+}
+
 const InsertBuyer = `-- name: InsertBuyer :exec
 insert into buyer (uid, name) values ($1, $2)
 `
@@ -608,6 +1520,40 @@ func (q *Queries) InsertBuyer(ctx context.Context, arg InsertBuyerParams) error
 	return err
 }
 
+const InsertCategory = `-- name: InsertCategory :one
+insert into category (parent_cid, name, slug, position, active) values ($1, $2, $3, $4, $5)
+returning cid, parent_cid, name, slug, position, active, created_at
+`
+
+type InsertCategoryParams struct {
+	ParentCid pgtype.UUID `json:"parent_cid"`
+	Name      string      `json:"name"`
+	Slug      string      `json:"slug"`
+	Position  int32       `json:"position"`
+	Active    bool        `json:"active"`
+}
+
+func (q *Queries) InsertCategory(ctx context.Context, arg InsertCategoryParams) (Category, error) {
+	row := q.db.QueryRow(ctx, InsertCategory,
+		arg.ParentCid,
+		arg.Name,
+		arg.Slug,
+		arg.Position,
+		arg.Active,
+	)
+	var i Category
+	err := row.Scan(
+		&i.Cid,
+		&i.ParentCid,
+		&i.Name,
+		&i.Slug,
+		&i.Position,
+		&i.Active,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const InsertItem = `-- name: InsertItem :one
 insert into item (vid, name, pictureurl, description, category, quantity, cost) values ($1, $2, $3, $4, $5, $6, $7) returning iid
 `
@@ -617,7 +1563,7 @@ type InsertItemParams struct {
 	Name        string         `json:"name"`
 	Pictureurl  *string        `json:"pictureurl"`
 	Description *string        `json:"description"`
-	Category    Category       `json:"category"`
+	Category    string         `json:"category"`
 	Quantity    int32          `json:"quantity"`
 	Cost        pgtype.Numeric `json:"cost"`
 }
@@ -637,70 +1583,1808 @@ func (q *Queries) InsertItem(ctx context.Context, arg InsertItemParams) (pgtype.
 	return iid, err
 }
 
-const InsertUser = `-- name: InsertUser :one
-insert into "user" (email, passhash) values ($1, $2) returning uid
+const InsertItemOption = `-- name: InsertItemOption :exec
+insert into item_option (iid, name, position, choices) values ($1, $2, $3, $4)
 `
 
-type InsertUserParams struct {
-	Email    string `json:"email"`
-	Passhash string `json:"passhash"`
+type InsertItemOptionParams struct {
+	Iid      pgtype.UUID `json:"iid"`
+	Name     string      `json:"name"`
+	Position int32       `json:"position"`
+	Choices  []string    `json:"choices"`
 }
 
-func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (pgtype.UUID, error) {
-	row := q.db.QueryRow(ctx, InsertUser, arg.Email, arg.Passhash)
-	var uid pgtype.UUID
-	err := row.Scan(&uid)
-	return uid, err
+func (q *Queries) InsertItemOption(ctx context.Context, arg InsertItemOptionParams) error {
+	_, err := q.db.Exec(ctx, InsertItemOption,
+		arg.Iid,
+		arg.Name,
+		arg.Position,
+		arg.Choices,
+	)
+	return err
 }
 
-const InsertVendor = `-- name: InsertVendor :exec
-insert into vendor (uid, name) values ($1, $2)
+const InsertOidcLogin = `-- name: InsertOidcLogin :exec
+insert into oidc_login (state_hash, nonce, code_verifier, expires_at) values ($1, $2, $3, $4)
 `
 
-type InsertVendorParams struct {
-	Uid  pgtype.UUID `json:"uid"`
-	Name string      `json:"name"`
+type InsertOidcLoginParams struct {
+	StateHash    string           `json:"state_hash"`
+	Nonce        string           `json:"nonce"`
+	CodeVerifier string           `json:"code_verifier"`
+	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
 }
 
-func (q *Queries) InsertVendor(ctx context.Context, arg InsertVendorParams) error {
-	_, err := q.db.Exec(ctx, InsertVendor, arg.Uid, arg.Name)
+func (q *Queries) InsertOidcLogin(ctx context.Context, arg InsertOidcLoginParams) error {
+	_, err := q.db.Exec(ctx, InsertOidcLogin,
+		arg.StateHash,
+		arg.Nonce,
+		arg.CodeVerifier,
+		arg.ExpiresAt,
+	)
 	return err
 }
 
-const ReduceQuantityOfItem = `-- name: ReduceQuantityOfItem :exec
-update item set quantity = quantity - $3
-where iid = $1
-and vid = $2
+const InsertPasswordReset = `-- name: InsertPasswordReset :exec
+insert into password_reset (token_hash, uid, expires_at) values ($1, $2, $3)
 `
 
-type ReduceQuantityOfItemParams struct {
-	Iid      pgtype.UUID `json:"iid"`
-	Vid      pgtype.UUID `json:"vid"`
-	Quantity int32       `json:"quantity"`
+type InsertPasswordResetParams struct {
+	TokenHash string           `json:"token_hash"`
+	Uid       pgtype.UUID      `json:"uid"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
 }
 
-func (q *Queries) ReduceQuantityOfItem(ctx context.Context, arg ReduceQuantityOfItemParams) error {
-	_, err := q.db.Exec(ctx, ReduceQuantityOfItem, arg.Iid, arg.Vid, arg.Quantity)
+func (q *Queries) InsertPasswordReset(ctx context.Context, arg InsertPasswordResetParams) error {
+	_, err := q.db.Exec(ctx, InsertPasswordReset, arg.TokenHash, arg.Uid, arg.ExpiresAt)
 	return err
 }
 
-const UpdateBuyer = `-- name: UpdateBuyer :exec
-with updated_user as (
-    update "user"
-    set 
-    email = $2
-    where "user".uid = $3
-    returning uid
-)
-update buyer
-set
-name = $1
-where uid in (select uid from updated_user)
+const InsertRecoveryCode = `-- name: InsertRecoveryCode :exec
+insert into mfa_recovery_code (code_hash, uid) values ($1, $2)
 `
 
-type UpdateBuyerParams struct {
-	Name  string      `json:"name"`
-	Email string      `json:"email"`
+type InsertRecoveryCodeParams struct {
+	CodeHash string      `json:"code_hash"`
+	Uid      pgtype.UUID `json:"uid"`
+}
+
+func (q *Queries) InsertRecoveryCode(ctx context.Context, arg InsertRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, InsertRecoveryCode, arg.CodeHash, arg.Uid)
+	return err
+}
+
+const InsertRefreshToken = `-- name: InsertRefreshToken :exec
+insert into refresh_token (token_hash, sid, expires_at) values ($1, $2, $3)
+`
+
+type InsertRefreshTokenParams struct {
+	TokenHash string           `json:"token_hash"`
+	Sid       pgtype.UUID      `json:"sid"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+}
+
+func (q *Queries) InsertRefreshToken(ctx context.Context, arg InsertRefreshTokenParams) error {
+	_, err := q.db.Exec(ctx, InsertRefreshToken, arg.TokenHash, arg.Sid, arg.ExpiresAt)
+	return err
+}
+
+const InsertUser = `-- name: InsertUser :one
+insert into "user" (email, passhash) values ($1, $2) returning uid
+`
+
+type InsertUserParams struct {
+	Email    string `json:"email"`
+	Passhash string `json:"passhash"`
+}
+
+func (q *Queries) InsertUser(ctx context.Context, arg InsertUserParams) (pgtype.UUID, error) {
+	row := q.db.QueryRow(ctx, InsertUser, arg.Email, arg.Passhash)
+	var uid pgtype.UUID
+	err := row.Scan(&uid)
+	return uid, err
+}
+
+const InsertUserIdentity = `-- name: InsertUserIdentity :exec
+insert into user_identity (issuer, subject, uid, email, last_login_at) values ($1, $2, $3, $4, now())
+`
+
+type InsertUserIdentityParams struct {
+	Issuer  string      `json:"issuer"`
+	Subject string      `json:"subject"`
+	Uid     pgtype.UUID `json:"uid"`
+	Email   string      `json:"email"`
+}
+
+func (q *Queries) InsertUserIdentity(ctx context.Context, arg InsertUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, InsertUserIdentity,
+		arg.Issuer,
+		arg.Subject,
+		arg.Uid,
+		arg.Email,
+	)
+	return err
+}
+
+const InsertVendor = `-- name: InsertVendor :exec
+insert into vendor (uid, name) values ($1, $2)
+`
+
+type InsertVendorParams struct {
+	Uid  pgtype.UUID `json:"uid"`
+	Name string      `json:"name"`
+}
+
+func (q *Queries) InsertVendor(ctx context.Context, arg InsertVendorParams) error {
+	_, err := q.db.Exec(ctx, InsertVendor, arg.Uid, arg.Name)
+	return err
+}
+
+const InvalidatePasswordResetsForUser = `-- name: InvalidatePasswordResetsForUser :exec
+update password_reset set used_at = now()
+where uid = $1 and used_at is null
+`
+
+func (q *Queries) InvalidatePasswordResetsForUser(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, InvalidatePasswordResetsForUser, uid)
+	return err
+}
+
+const IsCategoryInSubtree = `-- name: IsCategoryInSubtree :one
+with recursive tree as (
+    select category.cid from category where category.cid = $1
+    union
+    select child.cid from category child join tree on child.parent_cid = tree.cid
+)
+select exists (select 1 from tree where tree.cid = $2)
+`
+
+type IsCategoryInSubtreeParams struct {
+	Root pgtype.UUID `json:"root"`
+	Cid  pgtype.UUID `json:"cid"`
+}
+
+func (q *Queries) IsCategoryInSubtree(ctx context.Context, arg IsCategoryInSubtreeParams) (bool, error) {
+	row := q.db.QueryRow(ctx, IsCategoryInSubtree, arg.Root, arg.Cid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const ItemHasVariants = `-- name: ItemHasVariants :one
+select exists (select 1 from item_variant where iid = $1)
+`
+
+func (q *Queries) ItemHasVariants(ctx context.Context, iid pgtype.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, ItemHasVariants, iid)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const ListActiveSessions = `-- name: ListActiveSessions :many
+select sid, created_at, last_seen_at, user_agent, ip, mfa from session
+where
+    uid = $1
+    and revoked_at is null
+    and exists(
+        select 1 from refresh_token
+        where refresh_token.sid = session.sid and used_at is null and expires_at > now()
+    )
+order by coalesce(last_seen_at, created_at) desc
+`
+
+type ListActiveSessionsRow struct {
+	Sid        pgtype.UUID      `json:"sid"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	LastSeenAt pgtype.Timestamp `json:"last_seen_at"`
+	UserAgent  *string          `json:"user_agent"`
+	Ip         *string          `json:"ip"`
+	Mfa        bool             `json:"mfa"`
+}
+
+func (q *Queries) ListActiveSessions(ctx context.Context, uid pgtype.UUID) ([]ListActiveSessionsRow, error) {
+	rows, err := q.db.Query(ctx, ListActiveSessions, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListActiveSessionsRow{}
+	for rows.Next() {
+		var i ListActiveSessionsRow
+		if err := rows.Scan(
+			&i.Sid,
+			&i.CreatedAt,
+			&i.LastSeenAt,
+			&i.UserAgent,
+			&i.Ip,
+			&i.Mfa,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListApiKeys = `-- name: ListApiKeys :many
+select kid, name, prefix, scopes, created_at, last_used_at from api_key
+where uid = $1 and revoked_at is null
+order by created_at desc
+`
+
+type ListApiKeysRow struct {
+	Kid        pgtype.UUID      `json:"kid"`
+	Name       string           `json:"name"`
+	Prefix     string           `json:"prefix"`
+	Scopes     []string         `json:"scopes"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+	LastUsedAt pgtype.Timestamp `json:"last_used_at"`
+}
+
+func (q *Queries) ListApiKeys(ctx context.Context, uid pgtype.UUID) ([]ListApiKeysRow, error) {
+	rows, err := q.db.Query(ctx, ListApiKeys, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListApiKeysRow{}
+	for rows.Next() {
+		var i ListApiKeysRow
+		if err := rows.Scan(
+			&i.Kid,
+			&i.Name,
+			&i.Prefix,
+			&i.Scopes,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListCategories = `-- name: ListCategories :many
+select cid, parent_cid, name, slug, position, active, created_at from category
+order by position, name
+`
+
+func (q *Queries) ListCategories(ctx context.Context) ([]Category, error) {
+	rows, err := q.db.Query(ctx, ListCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Category{}
+	for rows.Next() {
+		var i Category
+		if err := rows.Scan(
+			&i.Cid,
+			&i.ParentCid,
+			&i.Name,
+			&i.Slug,
+			&i.Position,
+			&i.Active,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListDueAccountDeletions = `-- name: ListDueAccountDeletions :many
+select uid from account_deletion
+where anonymized_at is null and purge_after <= now()
+order by purge_after
+limit $1
+`
+
+func (q *Queries) ListDueAccountDeletions(ctx context.Context, limit int32) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, ListDueAccountDeletions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var uid pgtype.UUID
+		if err := rows.Scan(&uid); err != nil {
+			return nil, err
+		}
+		items = append(items, uid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListEmailExceptions = `-- name: ListEmailExceptions :many
+select email, user_type, note, created_by, created_at from email_exception order by created_at desc
+`
+
+func (q *Queries) ListEmailExceptions(ctx context.Context) ([]EmailException, error) {
+	rows, err := q.db.Query(ctx, ListEmailExceptions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []EmailException{}
+	for rows.Next() {
+		var i EmailException
+		if err := rows.Scan(
+			&i.Email,
+			&i.UserType,
+			&i.Note,
+			&i.CreatedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemOptions = `-- name: ListItemOptions :many
+select iid, name, position, choices from item_option
+where iid = $1
+order by position
+`
+
+func (q *Queries) ListItemOptions(ctx context.Context, iid pgtype.UUID) ([]ItemOption, error) {
+	rows, err := q.db.Query(ctx, ListItemOptions, iid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ItemOption{}
+	for rows.Next() {
+		var i ItemOption
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Name,
+			&i.Position,
+			&i.Choices,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemVariants = `-- name: ListItemVariants :many
+select vrid, iid, sku, options, quantity, cost, created_at from item_variant
+where iid = $1
+order by created_at, sku
+`
+
+func (q *Queries) ListItemVariants(ctx context.Context, iid pgtype.UUID) ([]ItemVariant, error) {
+	rows, err := q.db.Query(ctx, ListItemVariants, iid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ItemVariant{}
+	for rows.Next() {
+		var i ItemVariant
+		if err := rows.Scan(
+			&i.Vrid,
+			&i.Iid,
+			&i.Sku,
+			&i.Options,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemsByNameAsc = `-- name: ListItemsByNameAsc :many
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($3::text[]), 0) = 0 or category in (select category_subtree($3::text[])))
+    and ($4::decimal is null or cost >= $4)
+    and ($5::decimal is null or cost <= $5)
+    and (not $6::boolean or quantity > 0)
+    and ($7::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $7)
+    ))
+    and ($8::uuid is null or (name, iid) > ($9::text, $8))
+order by name, iid
+limit $10
+`
+
+type ListItemsByNameAscParams struct {
+	Vid         pgtype.UUID    `json:"vid"`
+	VisibleOnly bool           `json:"visible_only"`
+	Categories  []string       `json:"categories"`
+	MinCost     pgtype.Numeric `json:"min_cost"`
+	MaxCost     pgtype.Numeric `json:"max_cost"`
+	InStock     bool           `json:"in_stock"`
+	Query       *string        `json:"query"`
+	AfterIid    pgtype.UUID    `json:"after_iid"`
+	AfterName   *string        `json:"after_name"`
+	RowLimit    int32          `json:"row_limit"`
+}
+
+func (q *Queries) ListItemsByNameAsc(ctx context.Context, arg ListItemsByNameAscParams) ([]Item, error) {
+	rows, err := q.db.Query(ctx, ListItemsByNameAsc,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterName,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemsByNameDesc = `-- name: ListItemsByNameDesc :many
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($3::text[]), 0) = 0 or category in (select category_subtree($3::text[])))
+    and ($4::decimal is null or cost >= $4)
+    and ($5::decimal is null or cost <= $5)
+    and (not $6::boolean or quantity > 0)
+    and ($7::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $7)
+    ))
+    and ($8::uuid is null or (name, iid) < ($9::text, $8))
+order by name desc, iid desc
+limit $10
+`
+
+type ListItemsByNameDescParams struct {
+	Vid         pgtype.UUID    `json:"vid"`
+	VisibleOnly bool           `json:"visible_only"`
+	Categories  []string       `json:"categories"`
+	MinCost     pgtype.Numeric `json:"min_cost"`
+	MaxCost     pgtype.Numeric `json:"max_cost"`
+	InStock     bool           `json:"in_stock"`
+	Query       *string        `json:"query"`
+	AfterIid    pgtype.UUID    `json:"after_iid"`
+	AfterName   *string        `json:"after_name"`
+	RowLimit    int32          `json:"row_limit"`
+}
+
+func (q *Queries) ListItemsByNameDesc(ctx context.Context, arg ListItemsByNameDescParams) ([]Item, error) {
+	rows, err := q.db.Query(ctx, ListItemsByNameDesc,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterName,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemsByPriceAsc = `-- name: ListItemsByPriceAsc :many
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($3::text[]), 0) = 0 or category in (select category_subtree($3::text[])))
+    and ($4::decimal is null or cost >= $4)
+    and ($5::decimal is null or cost <= $5)
+    and (not $6::boolean or quantity > 0)
+    and ($7::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $7)
+    ))
+    and ($8::uuid is null or (cost, iid) > ($9::decimal, $8))
+order by cost, iid
+limit $10
+`
+
+type ListItemsByPriceAscParams struct {
+	Vid         pgtype.UUID    `json:"vid"`
+	VisibleOnly bool           `json:"visible_only"`
+	Categories  []string       `json:"categories"`
+	MinCost     pgtype.Numeric `json:"min_cost"`
+	MaxCost     pgtype.Numeric `json:"max_cost"`
+	InStock     bool           `json:"in_stock"`
+	Query       *string        `json:"query"`
+	AfterIid    pgtype.UUID    `json:"after_iid"`
+	AfterCost   pgtype.Numeric `json:"after_cost"`
+	RowLimit    int32          `json:"row_limit"`
+}
+
+func (q *Queries) ListItemsByPriceAsc(ctx context.Context, arg ListItemsByPriceAscParams) ([]Item, error) {
+	rows, err := q.db.Query(ctx, ListItemsByPriceAsc,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterCost,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemsByPriceDesc = `-- name: ListItemsByPriceDesc :many
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($3::text[]), 0) = 0 or category in (select category_subtree($3::text[])))
+    and ($4::decimal is null or cost >= $4)
+    and ($5::decimal is null or cost <= $5)
+    and (not $6::boolean or quantity > 0)
+    and ($7::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $7)
+    ))
+    and ($8::uuid is null or (cost, iid) < ($9::decimal, $8))
+order by cost desc, iid desc
+limit $10
+`
+
+type ListItemsByPriceDescParams struct {
+	Vid         pgtype.UUID    `json:"vid"`
+	VisibleOnly bool           `json:"visible_only"`
+	Categories  []string       `json:"categories"`
+	MinCost     pgtype.Numeric `json:"min_cost"`
+	MaxCost     pgtype.Numeric `json:"max_cost"`
+	InStock     bool           `json:"in_stock"`
+	Query       *string        `json:"query"`
+	AfterIid    pgtype.UUID    `json:"after_iid"`
+	AfterCost   pgtype.Numeric `json:"after_cost"`
+	RowLimit    int32          `json:"row_limit"`
+}
+
+func (q *Queries) ListItemsByPriceDesc(ctx context.Context, arg ListItemsByPriceDescParams) ([]Item, error) {
+	rows, err := q.db.Query(ctx, ListItemsByPriceDesc,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterCost,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListItemsNewest = `-- name: ListItemsNewest :many
+select iid, vid, name, pictureurl, description, category, quantity, cost, created_at from item
+where ($1::uuid is null or vid = $1)
+    and (not $2::boolean or (
+        not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    ))
+    and (coalesce(cardinality($3::text[]), 0) = 0 or category in (select category_subtree($3::text[])))
+    and ($4::decimal is null or cost >= $4)
+    and ($5::decimal is null or cost <= $5)
+    and (not $6::boolean or quantity > 0)
+    and ($7::text is null or exists (
+        select 1 from item_search
+        where item_search.iid = item.iid and item_search.document @@ websearch_to_tsquery('english', $7)
+    ))
+    and ($8::uuid is null or (created_at, iid) < ($9::timestamp, $8))
+order by created_at desc, iid desc
+limit $10
+`
+
+type ListItemsNewestParams struct {
+	Vid            pgtype.UUID      `json:"vid"`
+	VisibleOnly    bool             `json:"visible_only"`
+	Categories     []string         `json:"categories"`
+	MinCost        pgtype.Numeric   `json:"min_cost"`
+	MaxCost        pgtype.Numeric   `json:"max_cost"`
+	InStock        bool             `json:"in_stock"`
+	Query          *string          `json:"query"`
+	AfterIid       pgtype.UUID      `json:"after_iid"`
+	AfterCreatedAt pgtype.Timestamp `json:"after_created_at"`
+	RowLimit       int32            `json:"row_limit"`
+}
+
+func (q *Queries) ListItemsNewest(ctx context.Context, arg ListItemsNewestParams) ([]Item, error) {
+	rows, err := q.db.Query(ctx, ListItemsNewest,
+		arg.Vid,
+		arg.VisibleOnly,
+		arg.Categories,
+		arg.MinCost,
+		arg.MaxCost,
+		arg.InStock,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterCreatedAt,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListPurchasesForBuyer = `-- name: ListPurchasesForBuyer :many
+select
+    transaction.tid,
+    vendor.name as vendor_name,
+    item.name as item_name,
+    item_variant.sku,
+    transaction.amt,
+    transaction.qty_bought,
+    transaction.t_time
+from
+    transaction
+left join vendor on
+    vendor.uid = transaction.vid
+left join item on
+    item.iid = transaction.iid
+left join item_variant on
+    item_variant.vrid = transaction.vrid
+where
+    transaction.bid = $1
+order by
+    transaction.t_time desc
+`
+
+type ListPurchasesForBuyerRow struct {
+	Tid        pgtype.UUID      `json:"tid"`
+	VendorName *string          `json:"vendor_name"`
+	ItemName   *string          `json:"item_name"`
+	Sku        *string          `json:"sku"`
+	Amt        pgtype.Numeric   `json:"amt"`
+	QtyBought  int32            `json:"qty_bought"`
+	TTime      pgtype.Timestamp `json:"t_time"`
+}
+
+func (q *Queries) ListPurchasesForBuyer(ctx context.Context, bid pgtype.UUID) ([]ListPurchasesForBuyerRow, error) {
+	rows, err := q.db.Query(ctx, ListPurchasesForBuyer, bid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListPurchasesForBuyerRow{}
+	for rows.Next() {
+		var i ListPurchasesForBuyerRow
+		if err := rows.Scan(
+			&i.Tid,
+			&i.VendorName,
+			&i.ItemName,
+			&i.Sku,
+			&i.Amt,
+			&i.QtyBought,
+			&i.TTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListRecentAuthEvents = `-- name: ListRecentAuthEvents :many
+select eid, event, outcome, ip, user_agent, detail, created_at from auth_event
+where uid = $1
+order by created_at desc, eid desc
+limit $2
+`
+
+type ListRecentAuthEventsParams struct {
+	Uid   pgtype.UUID `json:"uid"`
+	Limit int32       `json:"limit"`
+}
+
+type ListRecentAuthEventsRow struct {
+	Eid       int64            `json:"eid"`
+	Event     string           `json:"event"`
+	Outcome   string           `json:"outcome"`
+	Ip        *string          `json:"ip"`
+	UserAgent *string          `json:"user_agent"`
+	Detail    *string          `json:"detail"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) ListRecentAuthEvents(ctx context.Context, arg ListRecentAuthEventsParams) ([]ListRecentAuthEventsRow, error) {
+	rows, err := q.db.Query(ctx, ListRecentAuthEvents, arg.Uid, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListRecentAuthEventsRow{}
+	for rows.Next() {
+		var i ListRecentAuthEventsRow
+		if err := rows.Scan(
+			&i.Eid,
+			&i.Event,
+			&i.Outcome,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Detail,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListSalesForVendor = `-- name: ListSalesForVendor :many
+select
+    transaction.tid,
+    item.name as item_name,
+    item_variant.sku,
+    transaction.amt,
+    transaction.qty_bought,
+    transaction.t_time
+from
+    transaction
+left join item on
+    item.iid = transaction.iid
+left join item_variant on
+    item_variant.vrid = transaction.vrid
+where
+    transaction.vid = $1
+order by
+    transaction.t_time desc
+`
+
+type ListSalesForVendorRow struct {
+	Tid       pgtype.UUID      `json:"tid"`
+	ItemName  *string          `json:"item_name"`
+	Sku       *string          `json:"sku"`
+	Amt       pgtype.Numeric   `json:"amt"`
+	QtyBought int32            `json:"qty_bought"`
+	TTime     pgtype.Timestamp `json:"t_time"`
+}
+
+func (q *Queries) ListSalesForVendor(ctx context.Context, vid pgtype.UUID) ([]ListSalesForVendorRow, error) {
+	rows, err := q.db.Query(ctx, ListSalesForVendor, vid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListSalesForVendorRow{}
+	for rows.Next() {
+		var i ListSalesForVendorRow
+		if err := rows.Scan(
+			&i.Tid,
+			&i.ItemName,
+			&i.Sku,
+			&i.Amt,
+			&i.QtyBought,
+			&i.TTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const ListUserIdentities = `-- name: ListUserIdentities :many
+select issuer, subject, email, created_at, last_login_at from user_identity
+where uid = $1
+order by created_at
+`
+
+type ListUserIdentitiesRow struct {
+	Issuer      string           `json:"issuer"`
+	Subject     string           `json:"subject"`
+	Email       string           `json:"email"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+	LastLoginAt pgtype.Timestamp `json:"last_login_at"`
+}
+
+func (q *Queries) ListUserIdentities(ctx context.Context, uid pgtype.UUID) ([]ListUserIdentitiesRow, error) {
+	rows, err := q.db.Query(ctx, ListUserIdentities, uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListUserIdentitiesRow{}
+	for rows.Next() {
+		var i ListUserIdentitiesRow
+		if err := rows.Scan(
+			&i.Issuer,
+			&i.Subject,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const LockLoginSubject = `-- name: LockLoginSubject :exec
+update login_attempt set locked_until = $2 where subject = $1
+`
+
+type LockLoginSubjectParams struct {
+	Subject     string           `json:"subject"`
+	LockedUntil pgtype.Timestamp `json:"locked_until"`
+}
+
+func (q *Queries) LockLoginSubject(ctx context.Context, arg LockLoginSubjectParams) error {
+	_, err := q.db.Exec(ctx, LockLoginSubject, arg.Subject, arg.LockedUntil)
+	return err
+}
+
+const MarkSessionMfa = `-- name: MarkSessionMfa :exec
+update session set mfa = true where sid = $1
+`
+
+func (q *Queries) MarkSessionMfa(ctx context.Context, sid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, MarkSessionMfa, sid)
+	return err
+}
+
+const RecordLoginFailure = `-- name: RecordLoginFailure :one
+insert into login_attempt (subject, failures, last_failure_at) values ($1, 1, $2)
+on conflict (subject) do update set
+    failures = case when login_attempt.last_failure_at < $3 then 1 else login_attempt.failures + 1 end,
+    last_failure_at = $2
+returning failures
+`
+
+type RecordLoginFailureParams struct {
+	Subject     string           `json:"subject"`
+	Now         pgtype.Timestamp `json:"now"`
+	ResetBefore pgtype.Timestamp `json:"reset_before"`
+}
+
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error) {
+	row := q.db.QueryRow(ctx, RecordLoginFailure, arg.Subject, arg.Now, arg.ResetBefore)
+	var failures int32
+	err := row.Scan(&failures)
+	return failures, err
+}
+
+const ReduceQuantityOfItem = `-- name: ReduceQuantityOfItem :exec
+update item set quantity = quantity - $3
+where iid = $1
+and vid = $2
+`
+
+type ReduceQuantityOfItemParams struct {
+	Iid      pgtype.UUID `json:"iid"`
+	Vid      pgtype.UUID `json:"vid"`
+	Quantity int32       `json:"quantity"`
+}
+
+func (q *Queries) ReduceQuantityOfItem(ctx context.Context, arg ReduceQuantityOfItemParams) error {
+	_, err := q.db.Exec(ctx, ReduceQuantityOfItem, arg.Iid, arg.Vid, arg.Quantity)
+	return err
+}
+
+const ReduceQuantityOfVariant = `-- name: ReduceQuantityOfVariant :exec
+update item_variant set quantity = quantity - $2
+where vrid = $1
+`
+
+type ReduceQuantityOfVariantParams struct {
+	Vrid     pgtype.UUID `json:"vrid"`
+	Quantity int32       `json:"quantity"`
+}
+
+func (q *Queries) ReduceQuantityOfVariant(ctx context.Context, arg ReduceQuantityOfVariantParams) error {
+	_, err := q.db.Exec(ctx, ReduceQuantityOfVariant, arg.Vrid, arg.Quantity)
+	return err
+}
+
+const ReinstateUser = `-- name: ReinstateUser :execrows
+delete from user_suspension where uid = $1
+`
+
+func (q *Queries) ReinstateUser(ctx context.Context, uid pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, ReinstateUser, uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const RestoreItem = `-- name: RestoreItem :execrows
+delete from item_takedown where iid = $1
+`
+
+func (q *Queries) RestoreItem(ctx context.Context, iid pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, RestoreItem, iid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const RevokeApiKey = `-- name: RevokeApiKey :execrows
+update api_key set revoked_at = now()
+where kid = $1 and uid = $2 and revoked_at is null
+`
+
+type RevokeApiKeyParams struct {
+	Kid pgtype.UUID `json:"kid"`
+	Uid pgtype.UUID `json:"uid"`
+}
+
+func (q *Queries) RevokeApiKey(ctx context.Context, arg RevokeApiKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, RevokeApiKey, arg.Kid, arg.Uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const RevokeApiKeysForUser = `-- name: RevokeApiKeysForUser :exec
+update api_key set revoked_at = now()
+where uid = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeApiKeysForUser(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, RevokeApiKeysForUser, uid)
+	return err
+}
+
+const RevokeOtherSessions = `-- name: RevokeOtherSessions :execrows
+update session set revoked_at = now()
+where uid = $1 and sid <> $2 and revoked_at is null
+`
+
+type RevokeOtherSessionsParams struct {
+	Uid pgtype.UUID `json:"uid"`
+	Sid pgtype.UUID `json:"sid"`
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, RevokeOtherSessions, arg.Uid, arg.Sid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const RevokeSession = `-- name: RevokeSession :exec
+update session set revoked_at = now()
+where sid = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeSession(ctx context.Context, sid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, RevokeSession, sid)
+	return err
+}
+
+const RevokeSessionsForUser = `-- name: RevokeSessionsForUser :exec
+update session set revoked_at = now()
+where uid = $1 and revoked_at is null
+`
+
+func (q *Queries) RevokeSessionsForUser(ctx context.Context, uid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, RevokeSessionsForUser, uid)
+	return err
+}
+
+const RevokeUserSession = `-- name: RevokeUserSession :execrows
+update session set revoked_at = now()
+where sid = $1 and uid = $2 and revoked_at is null
+`
+
+type RevokeUserSessionParams struct {
+	Sid pgtype.UUID `json:"sid"`
+	Uid pgtype.UUID `json:"uid"`
+}
+
+func (q *Queries) RevokeUserSession(ctx context.Context, arg RevokeUserSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, RevokeUserSession, arg.Sid, arg.Uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const ScheduleAccountDeletion = `-- name: ScheduleAccountDeletion :execrows
+insert into account_deletion (uid, purge_after) values ($1, $2)
+on conflict (uid) do nothing
+`
+
+type ScheduleAccountDeletionParams struct {
+	Uid        pgtype.UUID      `json:"uid"`
+	PurgeAfter pgtype.Timestamp `json:"purge_after"`
+}
+
+func (q *Queries) ScheduleAccountDeletion(ctx context.Context, arg ScheduleAccountDeletionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, ScheduleAccountDeletion, arg.Uid, arg.PurgeAfter)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const SearchAuthEvents = `-- name: SearchAuthEvents :many
+select eid, uid, actor, event, outcome, email, ip, user_agent, detail, created_at from auth_event
+where
+    ($1::uuid is null or uid = $1)
+    and ($2::uuid is null or actor = $2)
+    and ($3::text is null or event = $3)
+    and ($4::text is null or outcome = $4)
+    and ($5::text is null or email = lower($5))
+    and ($6::text is null or ip = $6)
+    and ($7::timestamp is null or created_at >= $7)
+    and ($8::timestamp is null or created_at < $8)
+order by
+    created_at desc, eid desc
+limit $9 offset $10
+`
+
+type SearchAuthEventsParams struct {
+	Uid       pgtype.UUID      `json:"uid"`
+	Actor     pgtype.UUID      `json:"actor"`
+	Event     *string          `json:"event"`
+	Outcome   *string          `json:"outcome"`
+	Email     *string          `json:"email"`
+	Ip        *string          `json:"ip"`
+	Since     pgtype.Timestamp `json:"since"`
+	Until     pgtype.Timestamp `json:"until"`
+	RowLimit  int32            `json:"row_limit"`
+	RowOffset int32            `json:"row_offset"`
+}
+
+func (q *Queries) SearchAuthEvents(ctx context.Context, arg SearchAuthEventsParams) ([]AuthEvent, error) {
+	rows, err := q.db.Query(ctx, SearchAuthEvents,
+		arg.Uid,
+		arg.Actor,
+		arg.Event,
+		arg.Outcome,
+		arg.Email,
+		arg.Ip,
+		arg.Since,
+		arg.Until,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuthEvent{}
+	for rows.Next() {
+		var i AuthEvent
+		if err := rows.Scan(
+			&i.Eid,
+			&i.Uid,
+			&i.Actor,
+			&i.Event,
+			&i.Outcome,
+			&i.Email,
+			&i.Ip,
+			&i.UserAgent,
+			&i.Detail,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SearchCatalog = `-- name: SearchCatalog :many
+with search as (
+    select websearch_to_tsquery('english', $1::text) as query
+), matches as (
+    select item.iid, item.vid, item.name, item.pictureurl, item.description, item.category, item.quantity, item.cost, item.created_at, ts_rank_cd(item_search.document, search.query)::real as rank
+    from item_search
+    join item on item.iid = item_search.iid
+    cross join search
+    where item_search.document @@ search.query
+        and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+        and ($2::uuid is null
+            or (ts_rank_cd(item_search.document, search.query)::real, item.iid) < ($3::real, $2))
+    order by rank desc, item.iid desc
+    limit $4
+)
+select matches.iid, matches.vid, matches.name, matches.pictureurl, matches.description, matches.category,
+    matches.quantity, matches.cost, matches.created_at, vendor.name as vendor_name, matches.rank,
+    ts_headline('english', html_escape(matches.name), search.query,
+        'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text as name_snippet,
+    ts_headline('english', html_escape(coalesce(matches.description, '')), search.query,
+        'StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=10, MaxFragments=2')::text as description_snippet
+from matches
+join vendor on vendor.uid = matches.vid
+cross join search
+order by matches.rank desc, matches.iid desc
+`
+
+type SearchCatalogParams struct {
+	Query     string        `json:"query"`
+	AfterIid  pgtype.UUID   `json:"after_iid"`
+	AfterRank pgtype.Float4 `json:"after_rank"`
+	RowLimit  int32         `json:"row_limit"`
+}
+
+type SearchCatalogRow struct {
+	Iid                pgtype.UUID      `json:"iid"`
+	Vid                pgtype.UUID      `json:"vid"`
+	Name               string           `json:"name"`
+	Pictureurl         *string          `json:"pictureurl"`
+	Description        *string          `json:"description"`
+	Category           string           `json:"category"`
+	Quantity           int32            `json:"quantity"`
+	Cost               pgtype.Numeric   `json:"cost"`
+	CreatedAt          pgtype.Timestamp `json:"created_at"`
+	VendorName         string           `json:"vendor_name"`
+	Rank               float32          `json:"rank"`
+	NameSnippet        string           `json:"name_snippet"`
+	DescriptionSnippet string           `json:"description_snippet"`
+}
+
+func (q *Queries) SearchCatalog(ctx context.Context, arg SearchCatalogParams) ([]SearchCatalogRow, error) {
+	rows, err := q.db.Query(ctx, SearchCatalog,
+		arg.Query,
+		arg.AfterIid,
+		arg.AfterRank,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchCatalogRow{}
+	for rows.Next() {
+		var i SearchCatalogRow
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Pictureurl,
+			&i.Description,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.CreatedAt,
+			&i.VendorName,
+			&i.Rank,
+			&i.NameSnippet,
+			&i.DescriptionSnippet,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SearchItems = `-- name: SearchItems :many
+select
+    item.iid,
+    item.vid,
+    item.name,
+    item.category,
+    item.quantity,
+    item.cost,
+    vendor.name as vendor_name,
+    item_takedown.taken_down_at,
+    item_takedown.reason as takedown_reason
+from
+    item
+inner join vendor on
+    vendor.uid = item.vid
+left join item_takedown on
+    item_takedown.iid = item.iid
+where
+    ($1::text = ''
+    or item.name ilike '%' || $1 || '%'
+    or item.description ilike '%' || $1 || '%'
+    or vendor.name ilike '%' || $1 || '%')
+    and (not $2::boolean or item_takedown.iid is not null)
+order by
+    item.name
+limit $3 offset $4
+`
+
+type SearchItemsParams struct {
+	Query         string `json:"query"`
+	TakenDownOnly bool   `json:"taken_down_only"`
+	RowLimit      int32  `json:"row_limit"`
+	RowOffset     int32  `json:"row_offset"`
+}
+
+type SearchItemsRow struct {
+	Iid            pgtype.UUID      `json:"iid"`
+	Vid            pgtype.UUID      `json:"vid"`
+	Name           string           `json:"name"`
+	Category       string           `json:"category"`
+	Quantity       int32            `json:"quantity"`
+	Cost           pgtype.Numeric   `json:"cost"`
+	VendorName     string           `json:"vendor_name"`
+	TakenDownAt    pgtype.Timestamp `json:"taken_down_at"`
+	TakedownReason *string          `json:"takedown_reason"`
+}
+
+func (q *Queries) SearchItems(ctx context.Context, arg SearchItemsParams) ([]SearchItemsRow, error) {
+	rows, err := q.db.Query(ctx, SearchItems,
+		arg.Query,
+		arg.TakenDownOnly,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchItemsRow{}
+	for rows.Next() {
+		var i SearchItemsRow
+		if err := rows.Scan(
+			&i.Iid,
+			&i.Vid,
+			&i.Name,
+			&i.Category,
+			&i.Quantity,
+			&i.Cost,
+			&i.VendorName,
+			&i.TakenDownAt,
+			&i.TakedownReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SearchUsers = `-- name: SearchUsers :many
+select
+    "user".uid,
+    "user".email,
+    "user".isadmin,
+    "user".email_verified,
+    coalesce(buyer.name, vendor.name, '')::varchar as name,
+    (case when buyer.uid is not null then 'buyer' else 'vendor' end)::varchar as user_type,
+    user_suspension.suspended_at,
+    user_suspension.reason as suspension_reason
+from
+    "user"
+left join buyer on
+    buyer.uid = "user".uid
+left join vendor on
+    vendor.uid = "user".uid
+left join user_suspension on
+    user_suspension.uid = "user".uid
+where
+    ($1::text = ''
+    or "user".email ilike '%' || $1 || '%'
+    or buyer.name ilike '%' || $1 || '%'
+    or vendor.name ilike '%' || $1 || '%')
+    and (not $2::boolean or user_suspension.uid is not null)
+order by
+    "user".email
+limit $3 offset $4
+`
+
+type SearchUsersParams struct {
+	Query         string `json:"query"`
+	SuspendedOnly bool   `json:"suspended_only"`
+	RowLimit      int32  `json:"row_limit"`
+	RowOffset     int32  `json:"row_offset"`
+}
+
+type SearchUsersRow struct {
+	Uid              pgtype.UUID      `json:"uid"`
+	Email            string           `json:"email"`
+	Isadmin          *bool            `json:"isadmin"`
+	EmailVerified    bool             `json:"email_verified"`
+	Name             string           `json:"name"`
+	UserType         string           `json:"user_type"`
+	SuspendedAt      pgtype.Timestamp `json:"suspended_at"`
+	SuspensionReason *string          `json:"suspension_reason"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.Query(ctx, SearchUsers,
+		arg.Query,
+		arg.SuspendedOnly,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchUsersRow{}
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.Uid,
+			&i.Email,
+			&i.Isadmin,
+			&i.EmailVerified,
+			&i.Name,
+			&i.UserType,
+			&i.SuspendedAt,
+			&i.SuspensionReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SearchVendors = `-- name: SearchVendors :many
+select
+    vendor.uid,
+    "user".email,
+    vendor.name,
+    vendor.logo,
+    user_suspension.suspended_at,
+    (select count(*) from item where item.vid = vendor.uid) as item_count,
+    (select coalesce(sum(amt), 0)::decimal(12, 2) from transaction where transaction.vid = vendor.uid) as total_sales
+from
+    vendor
+inner join "user" on
+    "user".uid = vendor.uid
+left join user_suspension on
+    user_suspension.uid = vendor.uid
+where
+    ($1::text = ''
+    or "user".email ilike '%' || $1 || '%'
+    or vendor.name ilike '%' || $1 || '%')
+    and (not $2::boolean or user_suspension.uid is not null)
+order by
+    vendor.name
+limit $3 offset $4
+`
+
+type SearchVendorsParams struct {
+	Query         string `json:"query"`
+	SuspendedOnly bool   `json:"suspended_only"`
+	RowLimit      int32  `json:"row_limit"`
+	RowOffset     int32  `json:"row_offset"`
+}
+
+type SearchVendorsRow struct {
+	Uid         pgtype.UUID      `json:"uid"`
+	Email       string           `json:"email"`
+	Name        string           `json:"name"`
+	Logo        *string          `json:"logo"`
+	SuspendedAt pgtype.Timestamp `json:"suspended_at"`
+	ItemCount   int64            `json:"item_count"`
+	TotalSales  pgtype.Numeric   `json:"total_sales"`
+}
+
+func (q *Queries) SearchVendors(ctx context.Context, arg SearchVendorsParams) ([]SearchVendorsRow, error) {
+	rows, err := q.db.Query(ctx, SearchVendors,
+		arg.Query,
+		arg.SuspendedOnly,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SearchVendorsRow{}
+	for rows.Next() {
+		var i SearchVendorsRow
+		if err := rows.Scan(
+			&i.Uid,
+			&i.Email,
+			&i.Name,
+			&i.Logo,
+			&i.SuspendedAt,
+			&i.ItemCount,
+			&i.TotalSales,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SuggestNames = `-- name: SuggestNames :many
+select suggestion.name, suggestion.kind, suggestion.score::real as score from (
+    select item.name, 'item'::text as kind, word_similarity($1::text, item.name) as score
+    from item
+    where (item.name ilike $2::text or $1::text <% item.name)
+        and not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    union all
+    select vendor.name, 'vendor'::text as kind, word_similarity($1::text, vendor.name) as score
+    from vendor
+    where (vendor.name ilike $2::text or $1::text <% vendor.name)
+        and not exists (select 1 from user_suspension where user_suspension.uid = vendor.uid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = vendor.uid)
+) as suggestion
+order by suggestion.name ilike $2::text desc, suggestion.score desc, suggestion.name
+limit $3
+`
+
+type SuggestNamesParams struct {
+	Term     string `json:"term"`
+	Prefix   string `json:"prefix"`
+	RowLimit int32  `json:"row_limit"`
+}
+
+type SuggestNamesRow struct {
+	Name  string  `json:"name"`
+	Kind  string  `json:"kind"`
+	Score float32 `json:"score"`
+}
+
+func (q *Queries) SuggestNames(ctx context.Context, arg SuggestNamesParams) ([]SuggestNamesRow, error) {
+	rows, err := q.db.Query(ctx, SuggestNames, arg.Term, arg.Prefix, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SuggestNamesRow{}
+	for rows.Next() {
+		var i SuggestNamesRow
+		if err := rows.Scan(&i.Name, &i.Kind, &i.Score); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SuggestNamesByDistance = `-- name: SuggestNamesByDistance :many
+select suggestion.name, suggestion.kind, suggestion.distance::integer as distance from (
+    select item.name, 'item'::text as kind,
+        levenshtein_less_equal(lower($1::text), lower(left(item.name, length($1::text))), $2::integer) as distance
+    from item
+    where not exists (select 1 from item_takedown where item_takedown.iid = item.iid)
+        and not exists (select 1 from user_suspension where user_suspension.uid = item.vid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = item.vid)
+    union all
+    select vendor.name, 'vendor'::text as kind,
+        levenshtein_less_equal(lower($1::text), lower(left(vendor.name, length($1::text))), $2::integer) as distance
+    from vendor
+    where not exists (select 1 from user_suspension where user_suspension.uid = vendor.uid)
+        and not exists (select 1 from account_deletion where account_deletion.uid = vendor.uid)
+) as suggestion
+where suggestion.distance <= $2::integer
+order by suggestion.distance, suggestion.name
+limit $3
+`
+
+type SuggestNamesByDistanceParams struct {
+	Term        string `json:"term"`
+	MaxDistance int32  `json:"max_distance"`
+	RowLimit    int32  `json:"row_limit"`
+}
+
+type SuggestNamesByDistanceRow struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Distance int32  `json:"distance"`
+}
+
+func (q *Queries) SuggestNamesByDistance(ctx context.Context, arg SuggestNamesByDistanceParams) ([]SuggestNamesByDistanceRow, error) {
+	rows, err := q.db.Query(ctx, SuggestNamesByDistance, arg.Term, arg.MaxDistance, arg.RowLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SuggestNamesByDistanceRow{}
+	for rows.Next() {
+		var i SuggestNamesByDistanceRow
+		if err := rows.Scan(&i.Name, &i.Kind, &i.Distance); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const SuspendUser = `-- name: SuspendUser :execrows
+insert into user_suspension (uid, reason, suspended_by) values ($1, $2, $3)
+on conflict (uid) do nothing
+`
+
+type SuspendUserParams struct {
+	Uid         pgtype.UUID `json:"uid"`
+	Reason      *string     `json:"reason"`
+	SuspendedBy pgtype.UUID `json:"suspended_by"`
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (int64, error) {
+	result, err := q.db.Exec(ctx, SuspendUser, arg.Uid, arg.Reason, arg.SuspendedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const TakeDownItem = `-- name: TakeDownItem :execrows
+insert into item_takedown (iid, reason, taken_down_by) values ($1, $2, $3)
+on conflict (iid) do nothing
+`
+
+type TakeDownItemParams struct {
+	Iid         pgtype.UUID `json:"iid"`
+	Reason      *string     `json:"reason"`
+	TakenDownBy pgtype.UUID `json:"taken_down_by"`
+}
+
+func (q *Queries) TakeDownItem(ctx context.Context, arg TakeDownItemParams) (int64, error) {
+	result, err := q.db.Exec(ctx, TakeDownItem, arg.Iid, arg.Reason, arg.TakenDownBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const TouchApiKey = `-- name: TouchApiKey :exec
+update api_key set last_used_at = now()
+where kid = $1 and (last_used_at is null or last_used_at < now() - interval '1 minute')
+`
+
+func (q *Queries) TouchApiKey(ctx context.Context, kid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, TouchApiKey, kid)
+	return err
+}
+
+const TouchSession = `-- name: TouchSession :exec
+update session set last_seen_at = now() where sid = $1
+`
+
+func (q *Queries) TouchSession(ctx context.Context, sid pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, TouchSession, sid)
+	return err
+}
+
+const TouchUserIdentity = `-- name: TouchUserIdentity :exec
+update user_identity set email = $3, last_login_at = now()
+where issuer = $1 and subject = $2
+`
+
+type TouchUserIdentityParams struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+	Email   string `json:"email"`
+}
+
+func (q *Queries) TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, TouchUserIdentity, arg.Issuer, arg.Subject, arg.Email)
+	return err
+}
+
+const UpdateBuyer = `-- name: UpdateBuyer :exec
+with updated_user as (
+    update "user"
+    set 
+    email = $2,
+    email_verified = email_verified and email = $2
+    where "user".uid = $3
+    returning uid
+)
+update buyer
+set
+name = $1
+where uid in (select uid from updated_user)
+`
+
+type UpdateBuyerParams struct {
+	Name  string      `json:"name"`
+	Email string      `json:"email"`
 	Uid   pgtype.UUID `json:"uid"`
 }
 
@@ -709,8 +3393,47 @@ func (q *Queries) UpdateBuyer(ctx context.Context, arg UpdateBuyerParams) error
 	return err
 }
 
+const UpdateCategory = `-- name: UpdateCategory :one
+update category set parent_cid = $1, name = $2, slug = $3, position = $4, active = $5
+where cid = $6
+returning cid, parent_cid, name, slug, position, active, created_at
+`
+
+type UpdateCategoryParams struct {
+	ParentCid pgtype.UUID `json:"parent_cid"`
+	Name      string      `json:"name"`
+	Slug      string      `json:"slug"`
+	Position  int32       `json:"position"`
+	Active    bool        `json:"active"`
+	Cid       pgtype.UUID `json:"cid"`
+}
+
+func (q *Queries) UpdateCategory(ctx context.Context, arg UpdateCategoryParams) (Category, error) {
+	row := q.db.QueryRow(ctx, UpdateCategory,
+		arg.ParentCid,
+		arg.Name,
+		arg.Slug,
+		arg.Position,
+		arg.Active,
+		arg.Cid,
+	)
+	var i Category
+	err := row.Scan(
+		&i.Cid,
+		&i.ParentCid,
+		&i.Name,
+		&i.Slug,
+		&i.Position,
+		&i.Active,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const UpdateItem = `-- name: UpdateItem :exec
-update item set name = $1,  description = $2, cost = $3, pictureurl = $4, category = $5, quantity = $6 
+update item set name = $1,  description = $2, cost = $3, pictureurl = $4, category = $5,
+    -- The stock of an item with variants is theirs, kept in item.quantity by item_variant_stock_changed
+    quantity = case when exists (select 1 from item_variant where item_variant.iid = item.iid) then item.quantity else $6 end
 where iid = $7
 and vid = $8
 `
@@ -720,7 +3443,7 @@ type UpdateItemParams struct {
 	Description *string        `json:"description"`
 	Cost        pgtype.Numeric `json:"cost"`
 	Pictureurl  *string        `json:"pictureurl"`
-	Category    Category       `json:"category"`
+	Category    string         `json:"category"`
 	Quantity    int32          `json:"quantity"`
 	Iid         pgtype.UUID    `json:"iid"`
 	Vid         pgtype.UUID    `json:"vid"`
@@ -740,9 +3463,23 @@ func (q *Queries) UpdateItem(ctx context.Context, arg UpdateItemParams) error {
 	return err
 }
 
+const UpdatePasshash = `-- name: UpdatePasshash :exec
+update "user" set passhash = $1 where uid = $2
+`
+
+type UpdatePasshashParams struct {
+	Passhash string      `json:"passhash"`
+	Uid      pgtype.UUID `json:"uid"`
+}
+
+func (q *Queries) UpdatePasshash(ctx context.Context, arg UpdatePasshashParams) error {
+	_, err := q.db.Exec(ctx, UpdatePasshash, arg.Passhash, arg.Uid)
+	return err
+}
+
 const UpdateQuantityOfCartItem = `-- name: UpdateQuantityOfCartItem :exec
 update cart set quantity = $4
-where bid = $1 and iid = $2 and vid = $3
+where bid = $1 and iid = $2 and vid = $3 and vrid is not distinct from $5
 `
 
 type UpdateQuantityOfCartItemParams struct {
@@ -750,6 +3487,7 @@ type UpdateQuantityOfCartItemParams struct {
 	Iid      pgtype.UUID `json:"iid"`
 	Vid      pgtype.UUID `json:"vid"`
 	Quantity int32       `json:"quantity"`
+	Vrid     pgtype.UUID `json:"vrid"`
 }
 
 func (q *Queries) UpdateQuantityOfCartItem(ctx context.Context, arg UpdateQuantityOfCartItemParams) error {
@@ -758,6 +3496,7 @@ func (q *Queries) UpdateQuantityOfCartItem(ctx context.Context, arg UpdateQuanti
 		arg.Iid,
 		arg.Vid,
 		arg.Quantity,
+		arg.Vrid,
 	)
 	return err
 }
@@ -766,7 +3505,8 @@ const UpdateVendor = `-- name: UpdateVendor :exec
 with updated_user as (
     update "user"
     set 
-    email = $3
+    email = $3,
+    email_verified = email_verified and email = $3
     where "user".uid = $4
     returning uid
 )
@@ -793,3 +3533,175 @@ func (q *Queries) UpdateVendor(ctx context.Context, arg UpdateVendorParams) erro
 	)
 	return err
 }
+
+const UpsertEmailException = `-- name: UpsertEmailException :exec
+insert into email_exception (email, user_type, note, created_by) values ($1, $2, $3, $4)
+on conflict (email) do update set user_type = excluded.user_type, note = excluded.note, created_by = excluded.created_by
+`
+
+type UpsertEmailExceptionParams struct {
+	Email     string      `json:"email"`
+	UserType  string      `json:"user_type"`
+	Note      *string     `json:"note"`
+	CreatedBy pgtype.UUID `json:"created_by"`
+}
+
+func (q *Queries) UpsertEmailException(ctx context.Context, arg UpsertEmailExceptionParams) error {
+	_, err := q.db.Exec(ctx, UpsertEmailException,
+		arg.Email,
+		arg.UserType,
+		arg.Note,
+		arg.CreatedBy,
+	)
+	return err
+}
+
+const UpsertItemVariant = `-- name: UpsertItemVariant :one
+insert into item_variant (iid, sku, options, quantity, cost) values ($1, $2, $3, $4, $5)
+on conflict (iid, sku) do update set options = excluded.options, quantity = excluded.quantity, cost = excluded.cost
+returning vrid, iid, sku, options, quantity, cost, created_at
+`
+
+type UpsertItemVariantParams struct {
+	Iid      pgtype.UUID    `json:"iid"`
+	Sku      string         `json:"sku"`
+	Options  []string       `json:"options"`
+	Quantity int32          `json:"quantity"`
+	Cost     pgtype.Numeric `json:"cost"`
+}
+
+func (q *Queries) UpsertItemVariant(ctx context.Context, arg UpsertItemVariantParams) (ItemVariant, error) {
+	row := q.db.QueryRow(ctx, UpsertItemVariant,
+		arg.Iid,
+		arg.Sku,
+		arg.Options,
+		arg.Quantity,
+		arg.Cost,
+	)
+	var i ItemVariant
+	err := row.Scan(
+		&i.Vrid,
+		&i.Iid,
+		&i.Sku,
+		&i.Options,
+		&i.Quantity,
+		&i.Cost,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const UpsertSetting = `-- name: UpsertSetting :exec
+insert into platform_setting (name, value, updated_by) values ($1, $2, $3)
+on conflict (name) do update set value = excluded.value, updated_by = excluded.updated_by, updated_at = now()
+`
+
+type UpsertSettingParams struct {
+	Name      string      `json:"name"`
+	Value     string      `json:"value"`
+	UpdatedBy pgtype.UUID `json:"updated_by"`
+}
+
+func (q *Queries) UpsertSetting(ctx context.Context, arg UpsertSettingParams) error {
+	_, err := q.db.Exec(ctx, UpsertSetting, arg.Name, arg.Value, arg.UpdatedBy)
+	return err
+}
+
+const UpsertTotpSecret = `-- name: UpsertTotpSecret :execrows
+insert into mfa_totp (uid, secret) values ($1, $2)
+on conflict (uid) do update set secret = excluded.secret, created_at = now()
+where mfa_totp.enabled_at is null
+`
+
+type UpsertTotpSecretParams struct {
+	Uid    pgtype.UUID `json:"uid"`
+	Secret string      `json:"secret"`
+}
+
+func (q *Queries) UpsertTotpSecret(ctx context.Context, arg UpsertTotpSecretParams) (int64, error) {
+	result, err := q.db.Exec(ctx, UpsertTotpSecret, arg.Uid, arg.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const UsePasswordReset = `-- name: UsePasswordReset :execrows
+update password_reset set used_at = now()
+where token_hash = $1 and used_at is null
+`
+
+func (q *Queries) UsePasswordReset(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.Exec(ctx, UsePasswordReset, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const UseRecoveryCode = `-- name: UseRecoveryCode :execrows
+update mfa_recovery_code set used_at = now()
+where code_hash = $1 and uid = $2 and used_at is null
+`
+
+type UseRecoveryCodeParams struct {
+	CodeHash string      `json:"code_hash"`
+	Uid      pgtype.UUID `json:"uid"`
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, UseRecoveryCode, arg.CodeHash, arg.Uid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const UseRefreshToken = `-- name: UseRefreshToken :execrows
+update refresh_token set used_at = now()
+where token_hash = $1 and used_at is null
+`
+
+func (q *Queries) UseRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.Exec(ctx, UseRefreshToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const UseTotpStep = `-- name: UseTotpStep :execrows
+update mfa_totp set last_used_step = $2
+where uid = $1 and enabled_at is not null and last_used_step < $2
+`
+
+type UseTotpStepParams struct {
+	Uid          pgtype.UUID `json:"uid"`
+	LastUsedStep int64       `json:"last_used_step"`
+}
+
+func (q *Queries) UseTotpStep(ctx context.Context, arg UseTotpStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, UseTotpStep, arg.Uid, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const VerifyUserEmail = `-- name: VerifyUserEmail :execrows
+update "user" set email_verified = true
+where uid = $1 and email = $2
+`
+
+type VerifyUserEmailParams struct {
+	Uid   pgtype.UUID `json:"uid"`
+	Email string      `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.Exec(ctx, VerifyUserEmail, arg.Uid, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,334 @@
+package admin
+
+import (
+	"backend/db"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/middleware"
+	adminService "backend/services/admin"
+	"backend/services/auth"
+	"backend/services/category"
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRoutes sets up the routes for platform administrators
+func AdminRoutes(ctx context.Context, pool db.Pool, rg *gin.Engine) {
+	// Group routes under "/admin"
+	admin := rg.Group("/admin")
+	// Apply authentication middleware for all routes under "/admin"
+	admin.Use(middleware.AuthMiddleware(ctx, pool))
+	// Apply admin middleware to ensure the user is an administrator
+	admin.Use(middleware.AdminMiddleware())
+
+	// GET /admin/info — A simple route that returns a message confirming it's the admin route
+	admin.GET("/info", func(c *gin.Context) {
+		utils.SendMsg(c, http.StatusOK, "Admin Route")
+	})
+
+	// GET /admin/email-exceptions — lists emails allowed to sign up outside the domain allowlist
+	admin.GET("/email-exceptions", func(c *gin.Context) {
+		// Call list exceptions service
+		sr := auth.ListEmailExceptions(ctx, pool)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/email-exceptions — invites an email from outside the allowed domains
+	admin.POST("/email-exceptions", func(c *gin.Context) {
+		var body auth.EmailException
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call add exception service
+		sr := auth.AddEmailException(ctx, pool, principal.MustGet(c).Uid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /admin/email-exceptions/:email — removes an exception
+	admin.DELETE("/email-exceptions/:email", func(c *gin.Context) {
+		// Call remove exception service
+		sr := auth.RemoveEmailException(ctx, pool, c.Param("email"))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/login/unlock — lifts the login lockout of an account or client address
+	admin.POST("/login/unlock", func(c *gin.Context) {
+		var body auth.UnlockRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call unlock service
+		sr := auth.Unlock(ctx, pool, principal.MustGet(c).Uid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/mfa-policy — returns whether vendors must use two-factor authentication
+	admin.GET("/mfa-policy", func(c *gin.Context) {
+		// Call get policy service
+		sr := auth.GetMFAPolicy(ctx, pool)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// PUT /admin/mfa-policy — requires or stops requiring two-factor authentication for vendors
+	admin.PUT("/mfa-policy", func(c *gin.Context) {
+		var body auth.MFAPolicy
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call set policy service
+		sr := auth.SetMFAPolicy(ctx, pool, principal.MustGet(c).Uid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/users — lists and searches users, ?q= searches emails and names, ?only=true lists suspended users
+	admin.GET("/users", func(c *gin.Context) {
+		var query adminService.ListQuery
+
+		// Parse the query string
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call list users service
+		sr := adminService.Users(ctx, pool, query)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/vendors — lists and searches vendors with their item counts and total sales
+	admin.GET("/vendors", func(c *gin.Context) {
+		var query adminService.ListQuery
+
+		// Parse the query string
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call list vendors service
+		sr := adminService.Vendors(ctx, pool, query)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/items — lists and searches every item, ?only=true lists taken down items
+	admin.GET("/items", func(c *gin.Context) {
+		var query adminService.ListQuery
+
+		// Parse the query string
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call list items service
+		sr := adminService.Items(ctx, pool, query)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/users/:uid/suspend — suspends an account and logs it out everywhere
+	admin.POST("/users/:uid/suspend", func(c *gin.Context) {
+		var body adminService.Moderation
+
+		uid, err := utils.ParseUUID(c.Param("uid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Parse and validate request body
+		err = utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call suspend service
+		sr := adminService.Suspend(ctx, pool, principal.MustGet(c).Uid, uid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/users/:uid/reinstate — lifts the suspension of an account
+	admin.POST("/users/:uid/reinstate", func(c *gin.Context) {
+		uid, err := utils.ParseUUID(c.Param("uid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call reinstate service
+		sr := adminService.Reinstate(ctx, pool, principal.MustGet(c).Uid, uid)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/items/:iid/takedown — hides an item from buyers
+	admin.POST("/items/:iid/takedown", func(c *gin.Context) {
+		var body adminService.Moderation
+
+		iid, err := utils.ParseUUID(c.Param("iid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Parse and validate request body
+		err = utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call take down service
+		sr := adminService.TakeDown(ctx, pool, principal.MustGet(c).Uid, iid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /admin/items/:iid/takedown — restores a taken down item
+	admin.DELETE("/items/:iid/takedown", func(c *gin.Context) {
+		iid, err := utils.ParseUUID(c.Param("iid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call restore service
+		sr := adminService.Restore(ctx, pool, iid)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/sales — platform wide sales, optionally between ?since= and ?until= (YYYY-MM-DD)
+	admin.GET("/sales", func(c *gin.Context) {
+		var query adminService.SalesQuery
+
+		// Parse the query string
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call sales service
+		sr := adminService.Sales(ctx, pool, query)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/auth-events — searches the auth audit log by ?uid=, ?actor=, ?event=, ?outcome=, ?email=, ?ip=
+	// and a ?since= and ?until= time range (RFC 3339)
+	admin.GET("/auth-events", func(c *gin.Context) {
+		var query adminService.AuthEventQuery
+
+		// Parse the query string
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call auth events service
+		sr := adminService.AuthEvents(ctx, pool, query)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /admin/categories — the tree of every category, inactive ones included
+	admin.GET("/categories", func(c *gin.Context) {
+		// Call list categories service
+		sr := category.All(ctx, pool)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /admin/categories — adds a category, under parent_cid when given
+	admin.POST("/categories", func(c *gin.Context) {
+		var body category.Category
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call create category service
+		sr := category.Create(ctx, pool, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// PUT /admin/categories/:cid — renames, moves, reorders, activates or deactivates a category
+	admin.PUT("/categories/:cid", func(c *gin.Context) {
+		var body category.Category
+
+		cid, err := utils.ParseUUID(c.Param("cid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Parse and validate request body
+		err = utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call update category service
+		sr := category.Update(ctx, pool, cid, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /admin/categories/:cid — removes a category with no items and no subcategories
+	admin.DELETE("/categories/:cid", func(c *gin.Context) {
+		cid, err := utils.ParseUUID(c.Param("cid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call delete category service
+		sr := category.Delete(ctx, pool, cid)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+}
@@ -22,7 +22,7 @@ func AuthRoutes(ctx context.Context, pool db.Pool, rg *gin.Engine) {
 	})
 
 	// GET /auth/ping — protected route to verify JWT authentication
-	auth.GET("/ping", middleware.AuthMiddleware(), func(c *gin.Context) {
+	auth.GET("/ping", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
 		utils.SendMsg(c, http.StatusOK, "pong")
 	})
 
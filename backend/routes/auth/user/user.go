@@ -2,7 +2,9 @@ package user
 
 import (
 	"backend/db"
+	"backend/internal/principal"
 	"backend/internal/utils"
+	"backend/middleware"
 	"backend/services/auth"
 	"context"
 	"net/http"
@@ -30,8 +32,8 @@ func UserAuthRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		// Call signup service with `isVendor = false`
-		sr := auth.SignUp(ctx, pool, body, false)
+		// Call signup service
+		sr := auth.SignUp(ctx, pool, body)
 
 		// Send service response back to client
 		utils.SendSR(c, sr)
@@ -48,14 +50,336 @@ func UserAuthRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Call login service
-		sr := auth.Login(ctx, pool, body)
+		sr := auth.Login(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
 
 		// Send service response
 		utils.SendSR(c, sr)
 	})
 
-	// PUT /user/update — handles user profile updates
-	user.PUT("/update", func(c *gin.Context) {
+	// POST /user/login/mfa — finishes a login with a TOTP or recovery code
+	user.POST("/login/mfa", func(c *gin.Context) {
+		var body auth.MFALoginRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call two-factor login service
+		sr := auth.VerifyMFALogin(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /user/oidc/start — returns the identity provider url to send the user to
+	user.GET("/oidc/start", func(c *gin.Context) {
+		sr := auth.StartOIDCLogin(ctx, pool)
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/oidc/callback — finishes a login with the code and state the identity provider sent back
+	user.POST("/oidc/callback", func(c *gin.Context) {
+		var body auth.OIDCCallbackRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call identity provider login service
+		sr := auth.OIDCLogin(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/refresh — rotates a refresh token for a new access token
+	user.POST("/refresh", func(c *gin.Context) {
+		var body auth.RefreshRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call refresh service
+		sr := auth.Refresh(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/logout — revokes the session the refresh token belongs to
+	user.POST("/logout", func(c *gin.Context) {
+		var body auth.RefreshRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call logout service
+		sr := auth.Logout(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/reset/request — emails a password reset link
+	user.POST("/reset/request", func(c *gin.Context) {
+		var body auth.ResetRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call password reset request service
+		sr := auth.RequestPasswordReset(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/reset/confirm — sets a new password using a reset token
+	user.POST("/reset/confirm", func(c *gin.Context) {
+		var body auth.ResetConfirm
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call password reset confirm service
+		sr := auth.ConfirmPasswordReset(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/verify — confirms email ownership using the emailed token
+	user.POST("/verify", func(c *gin.Context) {
+		var body auth.VerifyEmailRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call email confirmation service
+		sr := auth.ConfirmEmail(ctx, pool, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/verify/resend — emails a new confirmation link
+	user.POST("/verify/resend", func(c *gin.Context) {
+		var body auth.ResendVerificationRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call resend confirmation service
+		sr := auth.ResendVerification(ctx, pool, body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// PUT /user/password — changes the password after checking the current one
+	user.PUT("/password", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
+		var body auth.ChangePasswordRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call change password service
+		sr := auth.ChangePassword(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/email — emails a confirmation link to a new address after checking the password
+	user.POST("/email", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
+		var body auth.EmailChangeRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call email change request service
+		sr := auth.RequestEmailChange(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/email/confirm — moves the account to the new email using the emailed token
+	user.POST("/email/confirm", func(c *gin.Context) {
+		var body auth.VerifyEmailRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call email change confirm service
+		sr := auth.ConfirmEmailChange(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/vendor — opens a vendor storefront on the logged in account
+	user.POST("/vendor", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
+		var body auth.ActivateVendorRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call activate vendor service
+		sr := auth.ActivateVendor(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// Users can see where they are signed in and sign other devices out
+	sessions := user.Group("/sessions")
+	sessions.Use(middleware.AuthMiddleware(ctx, pool))
+
+	// GET /user/sessions — lists the caller's active sessions
+	sessions.GET("", func(c *gin.Context) {
+		// Call list sessions service
+		sr := auth.ListSessions(ctx, pool, principal.MustGet(c))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /user/sessions — signs out every session except the current one
+	sessions.DELETE("", func(c *gin.Context) {
+		// Call revoke other sessions service
+		sr := auth.RevokeOtherSessions(ctx, pool, principal.MustGet(c))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /user/sessions/:sid — signs out one session
+	sessions.DELETE("/:sid", func(c *gin.Context) {
+		// Parse session ID string into UUID
+		sid, err := utils.ParseUUID(c.Param("sid"))
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call revoke session service
+		sr := auth.RevokeSession(ctx, pool, principal.MustGet(c), sid)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// Two-factor authentication is offered to vendors
+	mfa := user.Group("/mfa")
+	mfa.Use(middleware.AuthMiddleware(ctx, pool))
+	mfa.Use(middleware.UserTypeMiddleware(utils.VENDOR))
+
+	// GET /user/mfa — reports whether two-factor authentication is enabled or required
+	mfa.GET("", func(c *gin.Context) {
+		// Call two-factor status service
+		sr := auth.MFAStatus(ctx, pool, principal.MustGet(c))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/mfa/totp — starts enrolling an authenticator app
+	mfa.POST("/totp", func(c *gin.Context) {
+		// Call enroll service
+		sr := auth.EnrollTOTP(ctx, pool, principal.MustGet(c))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/mfa/totp/confirm — enables the authenticator with a first code and returns recovery codes
+	mfa.POST("/totp/confirm", func(c *gin.Context) {
+		var body auth.MFACodeRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call confirm enrollment service
+		sr := auth.ConfirmTOTP(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /user/mfa/totp — turns two-factor authentication off
+	mfa.DELETE("/totp", func(c *gin.Context) {
+		var body auth.MFACodeRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call disable service
+		sr := auth.DisableTOTP(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/mfa/recovery-codes — replaces the recovery codes
+	mfa.POST("/recovery-codes", func(c *gin.Context) {
+		var body auth.MFACodeRequest
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call regenerate recovery codes service
+		sr := auth.RegenerateRecoveryCodes(ctx, pool, principal.MustGet(c), body)
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// PUT /user/update — handles user profile updates (owner only)
+	user.PUT("/update", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
 		var body auth.UpdateUser
 
 		// Parse and validate request body
@@ -65,14 +389,54 @@ func UserAuthRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Call update service
-		sr := auth.Update(ctx, pool, body)
+		sr := auth.Update(ctx, pool, principal.MustGet(c), body)
 
 		// Send response
 		utils.SendSR(c, sr)
 	})
 
-	// DELETE /user/delete/:uid — deletes a user by UID
-	user.DELETE("/delete/:uid", func(c *gin.Context) {
+	// GET /user/security-events — lists the caller's recent logins, credential changes and other auth events
+	user.GET("/security-events", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
+		// Call security events service
+		sr := auth.ListSecurityEvents(ctx, pool, principal.MustGet(c))
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// GET /user/export — downloads everything stored about the caller as a JSON file
+	user.GET("/export", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
+		// Call export service
+		sr := auth.ExportData(ctx, pool, principal.MustGet(c))
+
+		// Offer the export as a file rather than showing it inline
+		if sr.ServiceErr == nil {
+			c.Header("Content-Disposition", `attachment; filename="ashesi-dwa-data.json"`)
+		}
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// POST /user/restore — cancels a pending account deletion using the account's credentials
+	user.POST("/restore", func(c *gin.Context) {
+		var body auth.LoginUser
+
+		// Parse and validate request body
+		err := utils.ParseBody(c, &body)
+		if err != nil {
+			return
+		}
+
+		// Call restore service
+		sr := auth.RestoreAccount(ctx, pool, body, auth.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()})
+
+		// Send service response
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /user/delete/:uid — schedules a user's account for deletion by UID (owner only)
+	user.DELETE("/delete/:uid", middleware.AuthMiddleware(ctx, pool), func(c *gin.Context) {
 		// Extract user ID from path
 		uid := c.Params.ByName("uid")
 
@@ -84,7 +448,7 @@ func UserAuthRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Call delete service
-		sr := auth.Delete(ctx, pool, uidUUID)
+		sr := auth.Delete(ctx, pool, principal.MustGet(c), uidUUID)
 
 		// Send response
 		utils.SendSR(c, sr)
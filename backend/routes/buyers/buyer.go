@@ -18,7 +18,7 @@ func BuyerRoutes(ctx context.Context, pool db.Pool, rg *gin.Engine) {
 	buyer := rg.Group("/buyer")
 
 	// Apply authentication middleware to ensure the user is authenticated
-	buyer.Use(middleware.AuthMiddleware())
+	buyer.Use(middleware.AuthMiddleware(ctx, pool))
 
 	// Apply user type middleware to ensure the user is a BUYER
 	buyer.Use(middleware.UserTypeMiddleware(utils.BUYER))
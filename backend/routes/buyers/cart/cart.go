@@ -2,6 +2,8 @@ package cart
 
 import (
 	"backend/db"
+	"backend/internal/policy"
+	"backend/internal/principal"
 	"backend/internal/utils"
 	"backend/middleware"
 	"backend/repository"
@@ -17,7 +19,7 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	// Group routes under "/cart"
 	cartRoute := rg.Group("/cart")
 
-	// POST /cart/add — Add an item to the cart
+	// POST /cart/add — Add an item to the cart (own cart only)
 	cartRoute.POST("/add", func(c *gin.Context) {
 		var body repository.AddToCartParams
 		err := utils.ParseBody(c, &body)
@@ -26,12 +28,12 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		sr := cart.AddToCart(ctx, pool, body)
+		sr := cart.AddToCart(ctx, pool, principal.MustGet(c), body)
 		utils.SendSR(c, sr)
 	})
 
 	// POST /cart/:bId/clear — Clear all items from a buyer's cart (with auth)
-	cartRoute.POST("/:bId/clear", middleware.CartAuthMiddleware(), func(c *gin.Context) {
+	cartRoute.POST("/:bId/clear", middleware.Authorize(policy.CartWrite, "bId"), func(c *gin.Context) {
 		bId := c.Param("bId")
 		bIdUUID, err := utils.ParseUUID(bId)
 
@@ -45,7 +47,7 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	})
 
 	// GET /cart/:bId — Get all items in a buyer's cart (with auth)
-	cartRoute.GET("/:bId", middleware.CartAuthMiddleware(), func(c *gin.Context) {
+	cartRoute.GET("/:bId", middleware.Authorize(policy.CartRead, "bId"), func(c *gin.Context) {
 		bId := c.Param("bId")
 		bIdUUID, err := utils.ParseUUID(bId)
 
@@ -58,7 +60,7 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		utils.SendSR(c, sr)
 	})
 
-	// POST /cart/remove — Remove an item from the cart
+	// POST /cart/remove — Remove an item from the cart (own cart only)
 	cartRoute.POST("/remove", func(c *gin.Context) {
 		var body repository.DeleteCartItemParams
 		err := utils.ParseBody(c, &body)
@@ -66,12 +68,12 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		if err != nil {
 			return
 		}
-		sr := cart.RemoveFromCart(ctx, pool, body)
+		sr := cart.RemoveFromCart(ctx, pool, principal.MustGet(c), body)
 		utils.SendSR(c, sr)
 
 	})
 
-	// PUT /cart/update — Update the quantity of a cart item
+	// PUT /cart/update — Update the quantity of a cart item (own cart only)
 	cartRoute.PUT("/update", func(c *gin.Context) {
 		var body repository.UpdateQuantityOfCartItemParams
 		err := utils.ParseBody(c, &body)
@@ -80,7 +82,7 @@ func CartRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		sr := cart.UpdateCartItemQuantity(ctx, pool, body)
+		sr := cart.UpdateCartItemQuantity(ctx, pool, principal.MustGet(c), body)
 		utils.SendSR(c, sr)
 	})
 }
@@ -2,7 +2,9 @@ package payment
 
 import (
 	"backend/db"
+	"backend/internal/principal"
 	"backend/internal/utils"
+	"backend/middleware"
 	"backend/repository"
 	"backend/services/payment"
 	"context"
@@ -15,8 +17,8 @@ func PaymentRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	// Group routes under "/pay"
 	payRoute := rg.Group("/pay")
 
-	// POST /pay/initialize — Initialize a payment transaction
-	payRoute.POST("/initialize", func(c *gin.Context) {
+	// POST /pay/initialize — Initialize a payment transaction (verified emails only)
+	payRoute.POST("/initialize", middleware.RequireVerifiedEmail(ctx, pool), func(c *gin.Context) {
 		var body repository.CreateTransactionParams
 		err := utils.ParseBody(c, &body)
 
@@ -24,7 +26,7 @@ func PaymentRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		sr := payment.CreateTransactionRecord(ctx, pool, body)
+		sr := payment.CreateTransactionRecord(ctx, pool, principal.MustGet(c), body)
 		utils.SendSR(c, sr)
 	})
 }
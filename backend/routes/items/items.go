@@ -3,6 +3,7 @@ package items
 import (
 	"backend/db"
 	"backend/internal/utils"
+	"backend/services/category"
 	"backend/services/vendor"
 	"context"
 	"net/http"
@@ -15,10 +16,55 @@ func ItemsRoute(ctx context.Context, pool db.Pool, rg *gin.Engine) {
 	// Group routes under "/items"
 	items := rg.Group("/items")
 
-	// GET /items/all — Fetches all items from the vendor service and responds with the result
+	// GET /items/all — Fetches a page of all items, see vendor.ItemQuery for the query parameters
 	items.GET("/all", func(c *gin.Context) {
-		// Call the vendor service to get all items
-		sr := vendor.All(ctx, pool)
+		// Bind the cursor, page size, sort and fields from the query string
+		var query vendor.ItemQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call the vendor service to get a page of items
+		sr := vendor.All(ctx, pool, query)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// GET /items/search — Searches the catalog by relevance, see vendor.SearchQuery for the query parameters
+	items.GET("/search", func(c *gin.Context) {
+		// Bind the search words, cursor and page size from the query string
+		var query vendor.SearchQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call the vendor service to get a page of search results
+		sr := vendor.Search(ctx, pool, query)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// GET /items/suggest — Suggests item and vendor names for what has been typed into the search box so far
+	items.GET("/suggest", func(c *gin.Context) {
+		// Bind the typed text and number of suggestions from the query string
+		var query vendor.SuggestQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Call the vendor service to get the suggestions
+		sr := vendor.Suggest(ctx, pool, query)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// GET /items/categories — Fetches the tree of active categories items can be listed under
+	items.GET("/categories", func(c *gin.Context) {
+		// Call the category service to get the active categories
+		sr := category.Active(ctx, pool)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
@@ -41,4 +87,21 @@ func ItemsRoute(ctx context.Context, pool db.Pool, rg *gin.Engine) {
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
+
+	// GET /items/:iid/variants — Fetches the options of an item and the variants buyers choose from
+	items.GET("/:iid/variants", func(c *gin.Context) {
+		// Parse the item ID from the URL parameters to UUID format
+		iidUUID, err := utils.ParseUUID(c.Params.ByName("iid"))
+
+		// If there is an error parsing the item ID, return an error response
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Fetch the options and variants of the item from the vendor service
+		sr := vendor.VariantsOf(ctx, pool, iidUUID)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
 }
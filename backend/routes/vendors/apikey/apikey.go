@@ -0,0 +1,60 @@
+package apikey
+
+import (
+	"backend/db"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/services/auth"
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyRoutes sets up the routes vendors manage their API keys with
+func APIKeyRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
+	// Group routes under "/api-keys"
+	apiKeys := rg.Group("/api-keys")
+
+	// GET /api-keys — Lists the vendor's active API keys
+	apiKeys.GET("", func(c *gin.Context) {
+		// Fetch the keys from the auth service
+		sr := auth.ListAPIKeys(ctx, pool, principal.MustGet(c))
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// POST /api-keys — Creates an API key, the key is only shown in this response
+	apiKeys.POST("", func(c *gin.Context) {
+		// Parse the request body into CreateAPIKeyRequest structure
+		var body auth.CreateAPIKeyRequest
+		err := utils.ParseBody(c, &body)
+
+		// If there is an error parsing the body, return early
+		if err != nil {
+			return
+		}
+
+		// Create the key using the auth service
+		sr := auth.CreateAPIKey(ctx, pool, principal.MustGet(c), body)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// DELETE /api-keys/:kId — Revokes an API key by its ID (kId)
+	apiKeys.DELETE("/:kId", func(c *gin.Context) {
+		// Parse the key ID to UUID format
+		kIdUUID, err := utils.ParseUUID(c.Param("kId"))
+
+		// If there is an error parsing the key ID, return an error response
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Revoke the key using the auth service
+		sr := auth.RevokeAPIKey(ctx, pool, principal.MustGet(c), kIdUUID)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+}
@@ -2,7 +2,10 @@ package item
 
 import (
 	"backend/db"
+	"backend/internal/policy"
+	"backend/internal/principal"
 	"backend/internal/utils"
+	"backend/middleware"
 	"backend/repository"
 	"backend/services/vendor"
 	"context"
@@ -16,8 +19,8 @@ func ItemRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	// Group routes under "/item"
 	item := rg.Group("/item")
 
-	// GET /item/:vId — Fetches items by vendor ID (vId)
-	item.GET("/:vId", func(c *gin.Context) {
+	// GET /item/:vId — Fetches items by vendor ID (vId), vendors can only list their own inventory here
+	item.GET("/:vId", middleware.Authorize(policy.ItemRead, "vId"), func(c *gin.Context) {
 		// Retrieve the vendor ID from the URL parameters
 		vId := c.Param("vId")
 		// Parse the vendor ID to UUID format
@@ -29,14 +32,21 @@ func ItemRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		// Fetch the items associated with the vendor from the vendor service
-		sr := vendor.ByVid(ctx, pool, vIdUUID)
+		// Bind the cursor, page size, sort and fields from the query string
+		var query vendor.ItemQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Fetch a page of the items associated with the vendor from the vendor service
+		sr := vendor.ByVid(ctx, pool, vIdUUID, query)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
 
-	// POST /item/add — Adds a new item to the vendor's inventory
-	item.POST("/add", func(c *gin.Context) {
+	// POST /item/add — Adds a new item to the vendor's inventory (verified emails only)
+	item.POST("/add", middleware.RequireVerifiedEmail(ctx, pool), func(c *gin.Context) {
 		// Parse the request body into InsertItemParams structure
 		var body repository.InsertItemParams
 		err := utils.ParseBody(c, &body)
@@ -47,7 +57,7 @@ func ItemRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Add the new item using the vendor service
-		sr := vendor.Add(ctx, pool, body)
+		sr := vendor.Add(ctx, pool, principal.MustGet(c), body)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
@@ -64,7 +74,33 @@ func ItemRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Update the item using the vendor service
-		sr := vendor.Update(c, pool, body)
+		sr := vendor.Update(ctx, pool, principal.MustGet(c), body)
+		// Send the service response back to the client
+		utils.SendSR(c, sr)
+	})
+
+	// PUT /item/:iId/variants — Replaces the options and variants of an item, see vendor.Variants for the body
+	item.PUT("/:iId/variants", func(c *gin.Context) {
+		// Parse the item ID from the URL parameters to UUID format
+		iIdUUID, err := utils.ParseUUID(c.Param("iId"))
+
+		// If there is an error parsing the item ID, return an error response
+		if err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Parse the request body into the Variants structure
+		var body vendor.Variants
+		err = utils.ParseBody(c, &body)
+
+		// If there is an error parsing the body, return early
+		if err != nil {
+			return
+		}
+
+		// Replace the variants using the vendor service
+		sr := vendor.SetVariants(ctx, pool, principal.MustGet(c), iIdUUID, body)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
@@ -83,7 +119,7 @@ func ItemRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 		}
 
 		// Delete the item using the vendor service
-		sr := vendor.Delete(c, pool, iIdUUID)
+		sr := vendor.Delete(ctx, pool, principal.MustGet(c), iIdUUID)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
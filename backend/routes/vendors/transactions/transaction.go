@@ -2,7 +2,10 @@ package transaction
 
 import (
 	"backend/db"
+	"backend/internal/pagination"
+	"backend/internal/policy"
 	"backend/internal/utils"
+	"backend/middleware"
 	"backend/services/transaction"
 	"context"
 	"net/http"
@@ -15,8 +18,8 @@ func TransactionRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	// Group routes under "/transactions"
 	transactionRoute := rg.Group("/transactions")
 
-	// GET /transactions/:vId — Fetches transactions by vendor ID (vId)
-	transactionRoute.GET("/:vId", func(c *gin.Context) {
+	// GET /transactions/:vId — Fetches transactions by vendor ID (vId), vendors only see their own sales
+	transactionRoute.GET("/:vId", middleware.Authorize(policy.TransactionRead, "vId"), func(c *gin.Context) {
 		// Retrieve the vendor ID from the URL parameters
 		vId := c.Param("vId")
 		// Parse the vendor ID to UUID format
@@ -28,14 +31,21 @@ func TransactionRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 			return
 		}
 
-		// Fetch the transactions associated with the vendor from the transaction service
-		sr := transaction.GetTransactionsByVendorId(ctx, pool, vIdUUID)
+		// Bind the cursor and page size from the query string
+		var query pagination.Query
+		if err := c.ShouldBindQuery(&query); err != nil {
+			utils.SendErr(c, http.StatusBadRequest, err)
+			return
+		}
+
+		// Fetch a page of the transactions associated with the vendor, newest first, from the transaction service
+		sr := transaction.GetTransactionsByVendorId(ctx, pool, vIdUUID, query)
 		// Send the service response back to the client
 		utils.SendSR(c, sr)
 	})
 
 	// GET /transactions/total/:vId — Fetches total sales by vendor ID (vId)
-	transactionRoute.GET("total/:vId", func(c *gin.Context) {
+	transactionRoute.GET("total/:vId", middleware.Authorize(policy.TransactionRead, "vId"), func(c *gin.Context) {
 		// Retrieve the vendor ID from the URL parameters
 		vId := c.Param("vId")
 		// Parse the vendor ID to UUID format
@@ -54,7 +64,7 @@ func TransactionRoutes(ctx context.Context, pool db.Pool, rg *gin.RouterGroup) {
 	})
 
 	// GET /transactions/total/:vId/:iId — Fetches total sales for a specific item by vendor ID (vId) and item ID (iId)
-	transactionRoute.GET("total/:vId/:iId", func(c *gin.Context) {
+	transactionRoute.GET("total/:vId/:iId", middleware.Authorize(policy.TransactionRead, "vId"), func(c *gin.Context) {
 		// Retrieve the vendor ID and item ID from the URL parameters
 		vId, iId := c.Param("vId"), c.Param("iId")
 
@@ -4,6 +4,7 @@ import (
 	"backend/db"
 	"backend/internal/utils"
 	"backend/middleware"
+	"backend/routes/vendors/apikey"
 	"backend/routes/vendors/item"
 	transaction "backend/routes/vendors/transactions"
 	"context"
@@ -17,15 +18,20 @@ func VendorRoutes(ctx context.Context, pool db.Pool, rg *gin.Engine) {
 	// Group routes under "/vendor"
 	vendor := rg.Group("/vendor")
 	// Apply authentication middleware for all routes under "/vendor"
-	vendor.Use(middleware.AuthMiddleware())
+	vendor.Use(middleware.AuthMiddleware(ctx, pool))
 	// Apply user type middleware to ensure the user is a vendor
 	vendor.Use(middleware.UserTypeMiddleware(utils.VENDOR))
+	// Apply MFA middleware so vendors enroll an authenticator when the platform requires it
+	vendor.Use(middleware.RequireVendorMFA(ctx, pool))
 
 	// GET /vendor/info — A simple route that returns a message confirming it's the vendor route
 	vendor.GET("/info", func(c *gin.Context) {
 		utils.SendMsg(c, http.StatusOK, "Vendor Route")
 	})
 
+	// Set up the API key routes for vendors
+	apikey.APIKeyRoutes(ctx, pool, vendor)
+
 	// Set up the item-related routes for vendors
 	item.ItemRoutes(ctx, pool, vendor)
 
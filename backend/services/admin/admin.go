@@ -0,0 +1,256 @@
+// Package admin holds the platform moderation services behind the /admin routes
+package admin
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ListQuery is the search and paging of an admin listing, bound from the query string
+type ListQuery struct {
+	Query  string `form:"q" validate:"max=255"`
+	Only   bool   `form:"only"` // Only list suspended accounts or taken down items
+	Limit  int32  `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int32  `form:"offset" validate:"omitempty,min=0"`
+}
+
+// DefaultLimit is the page size used when a listing does not ask for one
+const DefaultLimit = 25
+
+// page validates the query and fills in the default page size
+func (lq *ListQuery) page() error {
+	if err := validation.ValidateStruct(lq); err != nil {
+		return err
+	}
+	if lq.Limit == 0 {
+		lq.Limit = DefaultLimit
+	}
+	return nil
+}
+
+// Moderation is the reason an admin gives for suspending an account or taking down an item
+type Moderation struct {
+	Reason *string `json:"reason" validate:"omitempty,max=255"`
+}
+
+// Users lists and searches every account by email or name
+func Users(ctx context.Context, pool db.Pool, lq ListQuery) utils.ServiceReturn[any] {
+	if err := lq.page(); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	users, err := q.SearchUsers(ctx, repository.SearchUsersParams{
+		Query:         lq.Query,
+		SuspendedOnly: lq.Only,
+		RowLimit:      lq.Limit,
+		RowOffset:     lq.Offset,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"users": users,
+		},
+	}
+}
+
+// Vendors lists and searches vendors by email or name along with their item count and total sales
+func Vendors(ctx context.Context, pool db.Pool, lq ListQuery) utils.ServiceReturn[any] {
+	if err := lq.page(); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	vendors, err := q.SearchVendors(ctx, repository.SearchVendorsParams{
+		Query:         lq.Query,
+		SuspendedOnly: lq.Only,
+		RowLimit:      lq.Limit,
+		RowOffset:     lq.Offset,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"vendors": vendors,
+		},
+	}
+}
+
+// Items lists and searches every item, including the ones taken down, by name, description or vendor
+func Items(ctx context.Context, pool db.Pool, lq ListQuery) utils.ServiceReturn[any] {
+	if err := lq.page(); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	items, err := q.SearchItems(ctx, repository.SearchItemsParams{
+		Query:         lq.Query,
+		TakenDownOnly: lq.Only,
+		RowLimit:      lq.Limit,
+		RowOffset:     lq.Offset,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"items": items,
+		},
+	}
+}
+
+// Suspend blocks an account from logging in and revokes all of its sessions. Admins cannot be suspended,
+// an admin has to be demoted in the database first.
+func Suspend(ctx context.Context, pool db.Pool, adminUid, uid pgtype.UUID, mod Moderation) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(mod)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	user, err := q.GetUserById(ctx, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errors.New("user does not exist"), http.StatusNotFound)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if user.Isadmin != nil && *user.Isadmin {
+		return utils.MakeError(errors.New("admins cannot be suspended"), http.StatusForbidden)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+	suspended, err := qtx.SuspendUser(ctx, repository.SuspendUserParams{
+		Uid:         uid,
+		Reason:      mod.Reason,
+		SuspendedBy: adminUid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if suspended == 0 {
+		return utils.MakeError(errors.New("user is already suspended"), http.StatusConflict)
+	}
+
+	// Log the user out everywhere, their refresh tokens stop working with their sessions
+	if err = qtx.RevokeSessionsForUser(ctx, uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := audit.Event{Uid: uid, Actor: adminUid, Type: audit.AccountSuspend, Outcome: audit.Success}
+	if mod.Reason != nil {
+		event.Detail = *mod.Reason
+	}
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "User suspended",
+		},
+	}
+}
+
+// Reinstate lifts the suspension of an account, the user has to log in again
+func Reinstate(ctx context.Context, pool db.Pool, adminUid, uid pgtype.UUID) utils.ServiceReturn[any] {
+	q := repository.New(pool)
+	reinstated, err := q.ReinstateUser(ctx, uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if reinstated == 0 {
+		return utils.MakeError(errors.New("user is not suspended"), http.StatusNotFound)
+	}
+
+	audit.Record(ctx, audit.Event{Uid: uid, Actor: adminUid, Type: audit.AccountReinstate, Outcome: audit.Success})
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "User reinstated",
+		},
+	}
+}
+
+// TakeDown hides an item from buyers, the vendor's past transactions for it are kept
+func TakeDown(ctx context.Context, pool db.Pool, adminUid, iid pgtype.UUID, mod Moderation) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(mod)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	_, err = q.GetItemById(ctx, iid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errors.New("item does not exist"), http.StatusNotFound)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	takenDown, err := q.TakeDownItem(ctx, repository.TakeDownItemParams{
+		Iid:         iid,
+		Reason:      mod.Reason,
+		TakenDownBy: adminUid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if takenDown == 0 {
+		return utils.MakeError(errors.New("item is already taken down"), http.StatusConflict)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Item taken down",
+		},
+	}
+}
+
+// Restore makes a taken down item visible to buyers again
+func Restore(ctx context.Context, pool db.Pool, iid pgtype.UUID) utils.ServiceReturn[any] {
+	q := repository.New(pool)
+	restored, err := q.RestoreItem(ctx, iid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if restored == 0 {
+		return utils.MakeError(errors.New("item is not taken down"), http.StatusNotFound)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Item restored",
+		},
+	}
+}
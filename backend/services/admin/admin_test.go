@@ -0,0 +1,181 @@
+package admin
+
+import (
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// userScan sets up the mock row to scan a user row with the given admin flag
+func userScan(mockRow *it.MockRow, isAdmin bool) *mock.Call {
+	return it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+		*args.Get(3).(**bool) = &isAdmin
+	})
+}
+
+func TestSuspend(t *testing.T) {
+	ctx := context.Background()
+	adminUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testUid := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+	reason := utils.MakePointer("Selling counterfeit goods")
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		userRow := &it.MockRow{}
+
+		userScan(userRow, false)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.SuspendUser, ctx, []any{testUid, reason, adminUid}, pgconn.NewCommandTag("INSERT 0 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeSessionsForUser, ctx, []any{testUid}, pgconn.NewCommandTag("UPDATE 2"), nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := Suspend(ctx, mockPool, adminUid, testUid, Moderation{Reason: reason})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("Admins cannot be suspended", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+
+		userScan(userRow, true)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+
+		result := Suspend(ctx, mockPool, adminUid, testUid, Moderation{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Already suspended", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		userRow := &it.MockRow{}
+
+		userScan(userRow, false)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.SuspendUser, ctx, []any{testUid, (*string)(nil), adminUid}, pgconn.NewCommandTag("INSERT 0 0"), nil)
+		mockTx.On("Rollback", ctx).Return(nil)
+
+		result := Suspend(ctx, mockPool, adminUid, testUid, Moderation{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		mockTx.AssertNotCalled(t, "Commit", ctx)
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+
+		it.UserScanNotExists(userRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+
+		result := Suspend(ctx, mockPool, adminUid, testUid, Moderation{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+}
+
+func TestReinstate(t *testing.T) {
+	ctx := context.Background()
+	adminUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testUid := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+
+	t.Run("Not suspended", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.ReinstateUser, ctx, []any{testUid}, pgconn.NewCommandTag("DELETE 0"), nil)
+
+		result := Reinstate(ctx, mockPool, adminUid, testUid)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.ReinstateUser, ctx, []any{testUid}, pgconn.NewCommandTag("DELETE 1"), nil)
+
+		result := Reinstate(ctx, mockPool, adminUid, testUid)
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+	})
+}
+
+func TestTakeDown(t *testing.T) {
+	ctx := context.Background()
+	adminUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testIid := pgtype.UUID{Bytes: [16]byte{3}, Valid: true}
+
+	t.Run("Unknown item", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+
+		it.ItemScanNotExists(itemRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+
+		result := TakeDown(ctx, mockPool, adminUid, testIid, Moderation{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+
+		it.ItemScanExists(itemRow)
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.TakeDownItem, ctx, []any{testIid, (*string)(nil), adminUid}, pgconn.NewCommandTag("INSERT 0 1"), nil)
+
+		result := TakeDown(ctx, mockPool, adminUid, testIid, Moderation{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestListQuery(t *testing.T) {
+	t.Run("Defaults the page size", func(t *testing.T) {
+		lq := ListQuery{}
+		assert.NoError(t, lq.page())
+		assert.Equal(t, int32(DefaultLimit), lq.Limit)
+	})
+
+	t.Run("Rejects large pages", func(t *testing.T) {
+		lq := ListQuery{Limit: 1000}
+		assert.Error(t, lq.page())
+	})
+}
+
+func TestSalesRange(t *testing.T) {
+	mockPool := &it.MockPool{}
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	result := Sales(context.Background(), mockPool, SalesQuery{Since: since, Until: since})
+
+	assert.NotNil(t, result.ServiceErr)
+	assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	mockPool.AssertExpectations(t)
+}
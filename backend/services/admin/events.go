@@ -0,0 +1,90 @@
+package admin
+
+import (
+	"backend/db"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// AuthEventQuery filters the auth audit log, bound from the query string. Every filter is optional.
+type AuthEventQuery struct {
+	Uid     string    `form:"uid" validate:"omitempty,uuid"`
+	Actor   string    `form:"actor" validate:"omitempty,uuid"`
+	Event   string    `form:"event" validate:"max=40"`
+	Outcome string    `form:"outcome" validate:"omitempty,oneof=success failure denied"`
+	Email   string    `form:"email" validate:"max=255"`
+	IP      string    `form:"ip" validate:"omitempty,ip"`
+	Since   time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until   time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"` // Exclusive
+	Limit   int32     `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset  int32     `form:"offset" validate:"omitempty,min=0"`
+}
+
+// filter returns nil for an empty filter so the query ignores it
+func filter(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// optionalUUID parses an optional id filter
+func optionalUUID(s string) (pgtype.UUID, error) {
+	if s == "" {
+		return pgtype.UUID{}, nil
+	}
+	return utils.ParseUUID(s)
+}
+
+// AuthEvents searches the auth audit log, newest event first
+func AuthEvents(ctx context.Context, pool db.Pool, eq AuthEventQuery) utils.ServiceReturn[any] {
+	if err := validation.ValidateStruct(eq); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+	if !eq.Since.IsZero() && !eq.Until.IsZero() && !eq.Until.After(eq.Since) {
+		return utils.MakeError(errors.New("until must be after since"), http.StatusBadRequest)
+	}
+	if eq.Limit == 0 {
+		eq.Limit = DefaultLimit
+	}
+
+	uid, err := optionalUUID(eq.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+	actor, err := optionalUUID(eq.Actor)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	events, err := q.SearchAuthEvents(ctx, repository.SearchAuthEventsParams{
+		Uid:       uid,
+		Actor:     actor,
+		Event:     filter(eq.Event),
+		Outcome:   filter(eq.Outcome),
+		Email:     filter(eq.Email),
+		Ip:        filter(eq.IP),
+		Since:     timestamp(eq.Since),
+		Until:     timestamp(eq.Until),
+		RowLimit:  eq.Limit,
+		RowOffset: eq.Offset,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"events": events,
+		},
+	}
+}
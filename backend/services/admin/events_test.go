@@ -0,0 +1,49 @@
+package admin
+
+import (
+	it "backend/internal/testing"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthEvents(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Invalid filters", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+
+		result := AuthEvents(ctx, mockPool, AuthEventQuery{Outcome: "maybe"})
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+
+		result = AuthEvents(ctx, mockPool, AuthEventQuery{Uid: "not-a-uuid"})
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Passes filters to the query", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRows := &it.MockRows{}
+		since := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		event, outcome := "login", "failure"
+
+		it.SetupMock(mockRows, "Close", []any{}, nil)
+		it.SetupMock(mockRows, "Next", []any{}, false)
+		it.SetupMock(mockRows, "Err", []any{}, nil)
+		it.SetupPoolOnRet(mockPool, "Query", repository.SearchAuthEvents, ctx, []any{
+			pgtype.UUID{}, pgtype.UUID{}, &event, &outcome, (*string)(nil), (*string)(nil),
+			pgtype.Timestamp{Time: since, Valid: true}, pgtype.Timestamp{}, int32(DefaultLimit), int32(0),
+		}, mockRows, nil)
+
+		result := AuthEvents(ctx, mockPool, AuthEventQuery{Event: event, Outcome: outcome, Since: since})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
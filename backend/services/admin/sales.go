@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"backend/db"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// SalesQuery limits the platform sales to a date range, bound from the query string. Either end may be left out.
+type SalesQuery struct {
+	Since time.Time `form:"since" time_format:"2006-01-02"`
+	Until time.Time `form:"until" time_format:"2006-01-02"` // Exclusive
+}
+
+// timestamp converts an optional bound to a nullable timestamp
+func timestamp(t time.Time) pgtype.Timestamp {
+	return pgtype.Timestamp{Time: t, Valid: !t.IsZero()}
+}
+
+// Sales returns the platform wide totals from the transaction table and the same totals per vendor,
+// best selling vendor first
+func Sales(ctx context.Context, pool db.Pool, sq SalesQuery) utils.ServiceReturn[any] {
+	if !sq.Since.IsZero() && !sq.Until.IsZero() && !sq.Until.After(sq.Since) {
+		return utils.MakeError(errors.New("until must be after since"), http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	totals, err := q.GetPlatformSales(ctx, repository.GetPlatformSalesParams{
+		Since: timestamp(sq.Since),
+		Until: timestamp(sq.Until),
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	vendors, err := q.GetSalesByVendor(ctx, repository.GetSalesByVendorParams{
+		Since: timestamp(sq.Since),
+		Until: timestamp(sq.Until),
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"transactions": totals.Transactions,
+			"items_sold":   totals.ItemsSold,
+			"total_sales":  totals.Total,
+			"vendors":      vendors,
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/logging"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// APIKeyPrefix starts every API key so the auth middleware can tell keys from access tokens
+const APIKeyPrefix = "dwa_"
+
+// apiKeyDisplayLen is how much of a key is kept in the clear to tell keys apart
+const apiKeyDisplayLen = len(APIKeyPrefix) + 8
+
+// ErrInvalidAPIKey is returned for unknown or revoked keys and keys whose account lost its vendor profile
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// CreateAPIKeyRequest names a new key and the scopes it is limited to
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=items:read items:write transactions:read"`
+}
+
+// CreateAPIKey creates a key for the calling vendor. The key itself is only returned here, just its hash is stored.
+func CreateAPIKey(ctx context.Context, pool db.Pool, p principal.Principal, req CreateAPIKeyRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	// Keys are managed from an interactive session, a key cannot create more keys
+	if sr := policy.Authorize(p, policy.APIKeyManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	token, err := hashing.GenerateToken()
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	key := APIKeyPrefix + token
+
+	q := repository.New(pool)
+	created, err := q.InsertApiKey(ctx, repository.InsertApiKeyParams{
+		Uid:     p.Uid,
+		Name:    req.Name,
+		KeyHash: hashing.HashToken(key),
+		Prefix:  key[:apiKeyDisplayLen],
+		Scopes:  req.Scopes,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := audit.By(p, audit.APIKeyCreate, audit.Success)
+	event.Detail = key[:apiKeyDisplayLen] + " " + req.Name
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusCreated,
+		Data: utils.JMap{
+			"msg":     "API key created, copy it now as it will not be shown again",
+			"key":     key,
+			"api_key": created,
+		},
+	}
+}
+
+// ListAPIKeys returns the calling vendor's active keys without the keys themselves, newest first
+func ListAPIKeys(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.APIKeyManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	keys, err := q.ListApiKeys(ctx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   keys,
+	}
+}
+
+// RevokeAPIKey revokes one of the calling vendor's keys, requests made with it are refused from then on
+func RevokeAPIKey(ctx context.Context, pool db.Pool, p principal.Principal, kid pgtype.UUID) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.APIKeyManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	revoked, err := q.RevokeApiKey(ctx, repository.RevokeApiKeyParams{
+		Kid: kid,
+		Uid: p.Uid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// Keys of other vendors are reported as missing so their ids cannot be probed
+	if revoked == 0 {
+		return utils.MakeError(errors.New("API key does not exist"), http.StatusNotFound)
+	}
+
+	event := audit.By(p, audit.APIKeyRevoke, audit.Success)
+	event.Detail = "key " + kid.String()
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "API key revoked",
+		},
+	}
+}
+
+// AuthenticateAPIKey returns the caller an API key acts for, a vendor limited to the key's scopes.
+// It returns ErrInvalidAPIKey or ErrAccountSuspended when the key cannot be used.
+func AuthenticateAPIKey(ctx context.Context, pool db.Pool, key string) (principal.Principal, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return principal.Principal{}, ErrInvalidAPIKey
+	}
+
+	q := repository.New(pool)
+	row, err := q.GetApiKeyByHash(ctx, hashing.HashToken(key))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return principal.Principal{}, ErrInvalidAPIKey
+		}
+		return principal.Principal{}, err
+	}
+
+	if row.SuspendedAt.Valid {
+		return principal.Principal{}, ErrAccountSuspended
+	}
+	if !row.IsVendor || len(row.Scopes) == 0 {
+		return principal.Principal{}, ErrInvalidAPIKey
+	}
+
+	// Last use is only recorded about once a minute, failing to record it does not fail the request
+	if err = q.TouchApiKey(ctx, row.Kid); err != nil {
+		logging.Errorf("Error recording API key use -> %v", err)
+	}
+
+	return principal.Principal{
+		Uid:    row.Uid,
+		Email:  row.Email,
+		Roles:  []string{utils.StringifyUserType(utils.VENDOR)},
+		Scopes: row.Scopes,
+	}, nil
+}
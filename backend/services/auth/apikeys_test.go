@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// apiKeyScan sets up the mock row to scan the given API key lookup row
+func apiKeyScan(mockRow *it.MockRow, row repository.GetApiKeyByHashRow) *mock.Call {
+	return it.SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = row.Kid
+			*args.Get(1).(*pgtype.UUID) = row.Uid
+			*args.Get(2).(*[]string) = row.Scopes
+			*args.Get(3).(*string) = row.Email
+			*args.Get(4).(*pgtype.Timestamp) = row.SuspendedAt
+			*args.Get(5).(*bool) = row.IsVendor
+		})
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	vendor := principal.Principal{Uid: testUid, Email: "vendor@test.com", Roles: []string{"vendor"}}
+	req := CreateAPIKeyRequest{Name: "Stock sheet", Scopes: []string{"items:read", "items:write"}}
+
+	t.Run("Unknown scope", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+
+		result := CreateAPIKey(ctx, mockPool, vendor, CreateAPIKeyRequest{Name: "Stock sheet", Scopes: []string{"cart:write"}})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Created with a key", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		keyScope := vendor
+		keyScope.Scopes = []string{"items:write"}
+
+		result := CreateAPIKey(ctx, mockPool, keyScope, req)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+	})
+
+	t.Run("Buyer", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		buyer := principal.Principal{Uid: testUid, Email: "buyer@test.com", Roles: []string{"buyer"}}
+
+		result := CreateAPIKey(ctx, mockPool, buyer, req)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupMock(mockPool, "QueryRow", []any{ctx, repository.InsertApiKey, mock.Anything}, mockRow)
+
+		result := CreateAPIKey(ctx, mockPool, vendor, req)
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusCreated, result.Status)
+		key := result.Data.(utils.JMap)["key"].(string)
+		assert.True(t, strings.HasPrefix(key, APIKeyPrefix))
+
+		// Only the hash and a short prefix of the key are stored
+		mockPool.AssertCalled(t, "QueryRow", ctx, repository.InsertApiKey,
+			[]any{testUid, "Stock sheet", hashing.HashToken(key), key[:apiKeyDisplayLen], req.Scopes})
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testKid := pgtype.UUID{Bytes: [16]byte{5}, Valid: true}
+	vendor := principal.Principal{Uid: testUid, Email: "vendor@test.com", Roles: []string{"vendor"}}
+
+	t.Run("Not found", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeApiKey, ctx, []any{testKid, testUid}, pgconn.NewCommandTag("UPDATE 0"), nil)
+
+		result := RevokeAPIKey(ctx, mockPool, vendor, testKid)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeApiKey, ctx, []any{testKid, testUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+
+		result := RevokeAPIKey(ctx, mockPool, vendor, testKid)
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testKid := pgtype.UUID{Bytes: [16]byte{5}, Valid: true}
+	key := APIKeyPrefix + "secret"
+
+	t.Run("Unknown key", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(mockRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetApiKeyByHash, ctx, []any{hashing.HashToken(key)})
+
+		_, err := AuthenticateAPIKey(ctx, mockPool, key)
+
+		assert.ErrorIs(t, err, ErrInvalidAPIKey)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Suspended vendor", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		apiKeyScan(mockRow, repository.GetApiKeyByHashRow{
+			Kid:         testKid,
+			Uid:         testUid,
+			Scopes:      []string{"items:read"},
+			SuspendedAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+			IsVendor:    true,
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetApiKeyByHash, ctx, []any{hashing.HashToken(key)})
+
+		_, err := AuthenticateAPIKey(ctx, mockPool, key)
+
+		assert.ErrorIs(t, err, ErrAccountSuspended)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		apiKeyScan(mockRow, repository.GetApiKeyByHashRow{
+			Kid:      testKid,
+			Uid:      testUid,
+			Scopes:   []string{"items:read"},
+			Email:    "vendor@test.com",
+			IsVendor: true,
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetApiKeyByHash, ctx, []any{hashing.HashToken(key)})
+		// Recording the last use failing does not fail the request
+		it.SetupPoolOnRet(mockPool, "Exec", repository.TouchApiKey, ctx, []any{testKid}, pgconn.CommandTag{}, errors.New("e"))
+
+		p, err := AuthenticateAPIKey(ctx, mockPool, key)
+
+		assert.NoError(t, err)
+		assert.Equal(t, testUid, p.Uid)
+		assert.Equal(t, []string{"vendor"}, p.Roles)
+		assert.Equal(t, []string{"items:read"}, p.Scopes)
+		assert.False(t, p.HasScope("items:write"))
+		mockPool.AssertExpectations(t)
+	})
+}
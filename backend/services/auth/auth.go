@@ -2,8 +2,14 @@ package auth
 
 import (
 	// Project-specific packages
+	"backend/config"
 	"backend/db"
+	"backend/internal/audit"
 	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/totp"
 	"backend/internal/utils"
 	"backend/internal/utils/hashing"
 	"backend/internal/utils/validation"
@@ -18,8 +24,6 @@ import (
 	"time"
 
 	// External libraries
-	emailverifier "github.com/AfterShip/email-verifier"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
@@ -27,7 +31,7 @@ import (
 // SignupUser defines the required fields for signing up
 type SignupUser struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+	Password string `json:"password" validate:"required"` // Checked against PasswordPolicy
 	Name     string `json:"name" validate:"required"`
 	IsVendor bool   `json:"isVendor"`
 }
@@ -45,10 +49,18 @@ type LoginUser struct {
 
 // Global variables
 var (
-	Hasher   hashing.Hasher         = hashing.BcryptHash{}                         // Password hasher
-	Enver    utils.Enver            = utils.DefaultEnv{}                           // Environment variable getter
-	verifier                        = emailverifier.NewVerifier().EnableSMTPCheck().DisableCatchAllCheck() // Email verifier
-	TTL                             = time.Hour * 5                                // Token time-to-live
+	Hasher              hashing.Hasher = hashing.Argon2idHash{Params: config.DefaultArgon2()} // Password hasher
+	AccessTTL                          = time.Minute * 15                                     // Access token time-to-live
+	RefreshTTL                         = time.Hour * 24 * 30                                  // Refresh token time-to-live
+	ResetTTL                           = time.Hour                                            // Password reset token time-to-live
+	MFAChallengeTTL                    = time.Minute * 5                                      // Time given to enter the second factor after the password
+	VerifyTTL                          = time.Hour * 48                                       // Email confirmation link time-to-live
+	EmailChangeTTL                     = time.Hour * 24                                       // Email change confirmation link time-to-live
+	DeletionGracePeriod                = time.Hour * 24 * 30                                  // Time a deleted account can be restored before it is anonymized
+	Mailer              mail.Mailer    = &mail.MemoryMailer{}                                 // Delivers account emails
+	AppURL                             = "http://localhost:5173"                              // Frontend base url used in email links
+	MFAIssuer                          = "Ashesi Dwa"                                         // Name authenticator apps list codes under
+	TOTPSealer          *totp.Sealer                                                          // Encrypts TOTP secrets at rest, nil stores them in plain text
 )
 
 // Checks if a user exists based on email
@@ -91,12 +103,24 @@ func doesUserExistById(ctx context.Context, pool db.Pool, uid pgtype.UUID) (bool
 }
 
 // Handles user sign-up
-func SignUp(ctx context.Context, pool db.Pool, user SignupUser, verify bool) utils.ServiceReturn[any] {
+func SignUp(ctx context.Context, pool db.Pool, user SignupUser) utils.ServiceReturn[any] {
 	// Validate input
 	err := validation.ValidateStruct(user)
 	if err != nil {
 		return utils.MakeError(err, http.StatusBadRequest)
 	}
+	if sr := checkPassword(ctx, "Password", user.Password, user.Email, user.Name); sr.ServiceErr != nil {
+		return sr
+	}
+
+	// Only allowlisted domains and invited emails may sign up
+	userType := "buyer"
+	if user.IsVendor {
+		userType = "vendor"
+	}
+	if sr := checkEmailAllowed(ctx, pool, user.Email, userType); sr.ServiceErr != nil {
+		return sr
+	}
 
 	// Check if user already exists
 	exists, err := doesUserExistByEmail(ctx, pool, user.Email)
@@ -114,24 +138,6 @@ func SignUp(ctx context.Context, pool db.Pool, user SignupUser, verify bool) uti
 	}
 	defer tx.Rollback(ctx)
 
-	// Optionally verify email
-	if verify {
-		ret, err := verifier.Verify(user.Email)
-		if err != nil {
-			return utils.MakeError(err, http.StatusInternalServerError)
-		}
-		if !ret.Syntax.Valid {
-			return utils.MakeError(errors.New("invalid email syntax"), http.StatusBadRequest)
-		}
-		smtpRes, err := verifier.CheckSMTP(ret.Syntax.Domain, ret.Syntax.Username)
-		if err != nil {
-			return utils.MakeError(err, http.StatusInternalServerError)
-		}
-		if !smtpRes.Deliverable {
-			return utils.MakeError(errors.New("email not deliverable"), http.StatusBadRequest)
-		}
-	}
-
 	q := repository.New(pool)
 	qtx := q.WithTx(tx)
 
@@ -170,6 +176,11 @@ func SignUp(ctx context.Context, pool db.Pool, user SignupUser, verify bool) uti
 	// Commit transaction
 	tx.Commit(ctx)
 
+	// Ask the user to confirm they own the email, a failed send can be retried through the resend endpoint
+	if err = sendVerification(ctx, uid, user.Email); err != nil {
+		logging.Errorf("Error sending confirmation email -> %v", err)
+	}
+
 	// Return success response
 	var msg string
 	if user.IsVendor {
@@ -192,101 +203,172 @@ type UserInfo struct {
 	Email    string      `json:"email" validate:"required,email"`
 	Name     string      `json:"name"`
 	UserType string      `json:"user_type" validate:"required,oneof=buyer vendor"`
+	Roles    []string    `json:"roles"` // Every profile the account holds
 	Passhash string      `json:"-"`
 }
 
-// InfoWToken embeds UserInfo and adds a JWT token
+// InfoWToken embeds UserInfo and adds the session's access and refresh tokens
 type InfoWToken struct {
 	UserInfo
-	Token string `json:"token"`
+	TokenPair
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"` // Vendor routes are refused until an authenticator is enrolled
 }
 
-// Handles user login
-func Login(ctx context.Context, pool db.Pool, user LoginUser) utils.ServiceReturn[any] {
+// Handles user login. Failed attempts are throttled per account and per client address, and an
+// unknown email gets the same response as a wrong password so accounts cannot be discovered.
+func Login(ctx context.Context, pool db.Pool, user LoginUser, client ClientInfo) utils.ServiceReturn[any] {
 	// Validate credentials
 	err := validation.ValidateStruct(user)
 	if err != nil {
 		return utils.MakeError(err, http.StatusBadRequest)
 	}
 
+	// Refuse locked out accounts and addresses before doing any password work
+	wait, err := checkLockout(ctx, user.Email, client)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		event := client.event(pgtype.UUID{}, audit.Login, audit.Denied)
+		event.Email, event.Detail = user.Email, "locked out"
+		audit.Record(ctx, event)
+		return tooManyAttempts(wait)
+	}
+
 	// Check user existence
 	exists, err := doesUserExistByEmail(ctx, pool, user.Email)
 	if err != nil {
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
 	if !exists {
-		return utils.MakeError(errors.New("user does not exist"), http.StatusBadRequest)
+		// Spend as long as a real comparison would
+		Hasher.Compare(user.Password, dummyHash())
+		if err = recordFailedLogin(ctx, user.Email, client); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		event := client.event(pgtype.UUID{}, audit.Login, audit.Failure)
+		event.Email, event.Detail = user.Email, "unknown account"
+		audit.Record(ctx, event)
+		return invalidCredentials()
 	}
 
+	info, err := getLoginInfo(ctx, pool, user.Email)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	uid, passhash := info.Uid, info.Passhash
+
+	// Validate password
+	if !Hasher.Compare(user.Password, passhash) {
+		if err = recordFailedLogin(ctx, user.Email, client); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		event := client.event(uid, audit.Login, audit.Failure)
+		event.Email, event.Detail = user.Email, "wrong password"
+		audit.Record(ctx, event)
+		return invalidCredentials()
+	}
+
+	// Upgrade hashes made with an older algorithm or cost now that the password is known
+	if rehasher, ok := Hasher.(hashing.Rehasher); ok && rehasher.NeedsRehash(passhash) {
+		rehashPassword(ctx, pool, uid, user.Password)
+	}
+
+	// Suspended and deleted accounts are refused before a second factor is asked for
 	q := repository.New(pool)
-	isBuyer, err := IsUserBuyer(ctx, pool, user.Email)
+	acc, err := loadAccount(ctx, q, uid)
 	if err != nil {
+		if err == ErrAccountSuspended || err == ErrAccountDeleted {
+			event := client.event(uid, audit.Login, audit.Denied)
+			event.Email, event.Detail = user.Email, err.Error()
+			audit.Record(ctx, event)
+		}
+		if err == ErrAccountSuspended {
+			return accountSuspended()
+		}
+		if err == ErrAccountDeleted {
+			return accountDeleted()
+		}
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
 
-	// Determine user type
-	userType := "vendor"
-	if isBuyer {
-		userType = "buyer"
+	// Accounts with an authenticator finish logging in through VerifyMFALogin. The account's failures are
+	// only forgiven once the second factor is presented so the password cannot be used to reset them.
+	if acc.MFAEnabled {
+		return mfaChallenge(uid)
+	}
+
+	// The account's failures are forgiven on success, the address keeps its count so one valid
+	// account cannot be used to reset it
+	if err = AccountThrottle.Reset(ctx, accountSubject(user.Email)); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	sr := finishLogin(ctx, pool, info, acc, client)
+	if sr.ServiceErr == nil {
+		audit.Record(ctx, client.event(uid, audit.Login, audit.Success))
+	}
+	return sr
+}
+
+// getLoginInfo reads the profile an account logs in with, an account with both profiles starts as a buyer
+func getLoginInfo(ctx context.Context, pool db.Pool, email string) (UserInfo, error) {
+	q := repository.New(pool)
+	isBuyer, err := IsUserBuyer(ctx, pool, email)
+	if err != nil {
+		return UserInfo{}, err
 	}
-	logging.Infof("User is %s", userType)
 
-	var uid pgtype.UUID
-	var name, passhash string
+	info := UserInfo{Email: email, UserType: "vendor"}
+	if isBuyer {
+		info.UserType = "buyer"
+	}
+	logging.Infof("User is %s", info.UserType)
 
 	// Fetch user info by role
 	if isBuyer {
-		info, err := q.GetBuyerByEmail(ctx, user.Email)
+		buyer, err := q.GetBuyerByEmail(ctx, email)
 		if err != nil {
-			return utils.MakeError(err, http.StatusInternalServerError)
+			return UserInfo{}, err
 		}
-		uid, name, passhash = info.Uid, info.Name, info.Passhash
+		info.Uid, info.Name, info.Passhash = buyer.Uid, buyer.Name, buyer.Passhash
 	} else {
-		info, err := q.GetVendorByEmail(ctx, user.Email)
+		vendor, err := q.GetVendorByEmail(ctx, email)
 		if err != nil {
-			return utils.MakeError(err, http.StatusInternalServerError)
+			return UserInfo{}, err
 		}
-		uid, name, passhash = info.Uid, info.Name, info.Passhash
+		info.Uid, info.Name, info.Passhash = vendor.Uid, vendor.Name, vendor.Passhash
 	}
+	return info, nil
+}
 
-	// Validate password
-	if !Hasher.Compare(user.Password, passhash) {
-		return utils.ServiceReturn[any]{
-			Status: http.StatusUnauthorized,
-			Data: utils.JMap{
-				"err": "Incorrect password",
-			},
-		}
-	}
-
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"uid":      uid,
-		"email":    user.Email,
-		"userType": userType,
-		"exp":      time.Now().Add(TTL).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(Enver.Env("SECRET")))
+// finishLogin starts the session of a user who has presented every factor their account needs
+func finishLogin(ctx context.Context, pool db.Pool, info UserInfo, acc account, client ClientInfo) utils.ServiceReturn[any] {
+	// Start a new session and issue its access and refresh tokens
+	p, tokens, err := startSession(ctx, pool, acc.Principal, client)
 	if err != nil {
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
+	info.Roles = p.Roles
 
-	// Return user info with token
-	infoWToken := InfoWToken{
-		UserInfo: UserInfo{
-			Uid:      uid,
-			Email:    user.Email,
-			Name:     name,
-			Passhash: passhash,
-			UserType: userType,
-		},
-		Token: tokenString,
+	// Vendors who must use two-factor authentication but have not enrolled are told to do so,
+	// vendor routes refuse them until they have
+	enroll := false
+	if p.HasRole(utils.VENDOR) && !p.MFA {
+		enroll, err = VendorMFARequired(ctx, pool)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
 	}
 
+	// Return user info with tokens
 	return utils.ServiceReturn[any]{
 		Status: http.StatusOK,
-		Data:   infoWToken,
+		Data: InfoWToken{
+			UserInfo:              info,
+			TokenPair:             tokens,
+			MFAEnrollmentRequired: enroll,
+		},
 	}
 }
 
@@ -322,8 +404,8 @@ func (uu *UpdateUser) Validate() error {
 	return nil
 }
 
-// Update handles user profile updates
-func Update(ctx context.Context, pool db.Pool, user UpdateUser) utils.ServiceReturn[any] {
+// Update handles user profile updates, users can only update their own profile
+func Update(ctx context.Context, pool db.Pool, p principal.Principal, user UpdateUser) utils.ServiceReturn[any] {
 	// Validate user type and structure
 	err := user.Validate()
 	if err != nil {
@@ -351,6 +433,10 @@ func Update(ctx context.Context, pool db.Pool, user UpdateUser) utils.ServiceRet
 		entity = "Buyer"
 	}
 
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	// Check if user exists
 	exists, err := doesUserExistById(ctx, pool, uid)
 	if err != nil {
@@ -366,22 +452,27 @@ func Update(ctx context.Context, pool db.Pool, user UpdateUser) utils.ServiceRet
 	}
 	oldEmail := u.Email
 
+	// Email changes need the password and a confirmed new address, see RequestEmailChange
+	if !strings.EqualFold(user.User.Email, oldEmail) {
+		return utils.MakeError(errEmailChangeNotAllowed, http.StatusBadRequest)
+	}
+
 	switch uType {
 	case utils.VENDOR:
 		{
 			vendor := user.UserTypes.Vendor
 
-			exists, err = IsUserBuyer(ctx, pool, oldEmail)
+			exists, err = hasVendorProfile(ctx, pool, uid)
 			if err != nil {
 				return utils.MakeError(err, http.StatusInternalServerError)
 			}
-			if exists {
+			if !exists {
 				return utils.MakeError(errors.New("user is not a vendor"), http.StatusBadRequest)
 			}
 
 			err = q.UpdateVendor(ctx, repository.UpdateVendorParams{
 				Name:  vendor.Name,
-				Email: user.User.Email,
+				Email: oldEmail,
 				Logo:  vendor.Logo,
 				Uid:   uid,
 			})
@@ -406,7 +497,7 @@ func Update(ctx context.Context, pool db.Pool, user UpdateUser) utils.ServiceRet
 
 			err = q.UpdateBuyer(ctx, repository.UpdateBuyerParams{
 				Name:  buyer.Name,
-				Email: user.User.Email,
+				Email: oldEmail,
 				Uid:   uid,
 			})
 
@@ -425,12 +516,19 @@ func Update(ctx context.Context, pool db.Pool, user UpdateUser) utils.ServiceRet
 	}
 }
 
-func Delete(ctx context.Context, pool db.Pool, uid pgtype.UUID) utils.ServiceReturn[any] {
+// Delete schedules a user's account for deletion, users can only delete their own account.
+// The account is deactivated at once and its personal data anonymized once DeletionGracePeriod has
+// passed, see PurgeDeletedAccounts. Transactions are kept for both parties.
+func Delete(ctx context.Context, pool db.Pool, p principal.Principal, uid pgtype.UUID) utils.ServiceReturn[any] {
 	err := validation.ValidateVar(uid, "required,uuid4")
 	if err != nil {
 		return utils.MakeError(err, http.StatusBadRequest)
 	}
 
+	if sr := policy.Authorize(p, policy.UserDelete, policy.Resource{Owner: uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	exists, err := doesUserExistById(ctx, pool, uid)
 	if err != nil {
 		return utils.MakeError(err, http.StatusInternalServerError)
@@ -440,18 +538,53 @@ func Delete(ctx context.Context, pool db.Pool, uid pgtype.UUID) utils.ServiceRet
 		return utils.MakeError(errors.New("user does not exist"), http.StatusNotFound)
 	}
 
-	q := repository.New(pool)
-	err = q.DeleteUser(ctx, uid)
+	purgeAfter := time.Now().UTC().Add(DeletionGracePeriod)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := repository.New(pool).WithTx(tx)
 
+	scheduled, err := qtx.ScheduleAccountDeletion(ctx, repository.ScheduleAccountDeletionParams{
+		Uid:        uid,
+		PurgeAfter: pgtype.Timestamp{Time: purgeAfter, Valid: true},
+	})
 	if err != nil {
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
+	if scheduled == 0 {
+		return utils.MakeError(errors.New("account is already scheduled for deletion"), http.StatusConflict)
+	}
+
+	// Sign the account out everywhere, including the scripts using its API keys
+	if err = qtx.RevokeSessionsForUser(ctx, uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if err = qtx.RevokeApiKeysForUser(ctx, uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// The vendor's items are hidden from now on, so buyers can no longer add them to carts or check them out
+	if err = qtx.DeleteCartItemsForVendor(ctx, uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := audit.By(p, audit.AccountDelete, audit.Success)
+	event.Uid = uid
+	audit.Record(ctx, event)
 
 	return utils.ServiceReturn[any]{
 		Status: http.StatusOK,
 		Data: utils.JMap{
-			"msg": "User deleted",
+			"msg":         "User deleted",
+			"purge_after": purgeAfter,
 		},
 	}
-
 }
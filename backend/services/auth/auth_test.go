@@ -1,12 +1,14 @@
 package auth
 
 import (
+	"backend/internal/audit"
 	it "backend/internal/testing"
 	"backend/repository"
 	"context"
 	"errors"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -27,12 +29,44 @@ func (m MockHasher) Compare(password, hash string) bool {
 	return password == "correct"
 }
 
-type MockEnver struct{}
+// statusScan sets up the mock row to scan the given account status row
+func statusScan(mockRow *it.MockRow, row repository.GetUserStatusRow) *mock.Call {
+	return it.SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*string) = row.Email
+			*args.Get(1).(**bool) = row.Isadmin
+			*args.Get(2).(*pgtype.Timestamp) = row.SuspendedAt
+			*args.Get(3).(*bool) = row.IsBuyer
+			*args.Get(4).(*bool) = row.IsVendor
+			*args.Get(5).(*bool) = row.MfaEnabled
+			*args.Get(6).(*bool) = row.IsDeleted
+		})
+}
+
+// setupSession mocks the account status lookup and the transaction that creates a session and its
+// first refresh token on login
+func setupSession(mockPool *it.MockPool, ctx context.Context) *it.MockTx {
+	statusRow := &it.MockRow{}
 
-var originalEnver = Enver
+	statusScan(statusRow, repository.GetUserStatusRow{Email: "user@test.com", IsBuyer: true})
+	it.SetupMock(mockPool, "QueryRow", []any{ctx, repository.GetUserStatus, mock.Anything}, statusRow).Once()
 
-func (m MockEnver) Env(key string) string {
-	return "SHADOW WIZARD MONEY GANG"
+	return setupSessionTx(mockPool, ctx)
+}
+
+// setupSessionTx mocks the transaction that creates a session and its first refresh token
+func setupSessionTx(mockPool *it.MockPool, ctx context.Context) *it.MockTx {
+	mockTx := &it.MockTx{}
+	sessionRow := &it.MockRow{}
+
+	it.SetupScanWithUUID(sessionRow, pgtype.UUID{Bytes: [16]byte{9}, Valid: true})
+	it.SetupMock(mockTx, "QueryRow", []any{ctx, repository.CreateSession, mock.Anything}, sessionRow)
+	it.SetupMock(mockTx, "Exec", []any{ctx, repository.InsertRefreshToken, mock.Anything}, pgconn.CommandTag{}, nil)
+	mockPool.On("Begin", ctx).Return(mockTx, nil).Once()
+	mockTx.On("Commit", ctx).Return(nil)
+	mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+	return mockTx
 }
 
 func TestDoesUserExistByEmail(t *testing.T) {
@@ -47,7 +81,7 @@ func TestDoesUserExistByEmail(t *testing.T) {
 
 		// Setup the scan method to return a nil error indicating rows exist therefore the
 		// user exists
-		it.SetupScanExists(mockRow)
+		it.UserScanExists(mockRow)
 		// Setup the mock pool to return the mock row when the query is executed
 		// this mock row calls the scan method
 		it.SetupPoolQueryRow(mockPool, mockRow, sqlCmd, ctx, []any{"exists@test.com"})
@@ -69,7 +103,7 @@ func TestDoesUserExistByEmail(t *testing.T) {
 
 		// Setup the scan method to return a non-nil error, pgx.ErrNoRows
 		// indicating the rows do not exist therefore the user does not exist
-		it.SetupScanNotExists(mockRow, pgx.ErrNoRows)
+		it.UserScanNotExists(mockRow, pgx.ErrNoRows)
 		it.SetupPoolQueryRow(mockPool, mockRow, sqlCmd, ctx, []any{"nonexistent@test.com"})
 
 		exists, err := doesUserExistByEmail(ctx, mockPool, "nonexistent@test.com")
@@ -87,7 +121,7 @@ func TestDoesUserExistByEmail(t *testing.T) {
 
 		// Setup the scan method to return a non-nil error, errors.New("e")
 		// meaning an error occurred while executing the query
-		it.SetupScanNotExists(mockRow, errors.New("e"))
+		it.UserScanNotExists(mockRow, errors.New("e"))
 		it.SetupPoolQueryRow(mockPool, mockRow, sqlCmd, ctx, []any{"error@test.com"})
 
 		_, err := doesUserExistByEmail(ctx, mockPool, "error@test.com")
@@ -108,7 +142,7 @@ func TestDoesUserExistById(t *testing.T) {
 	t.Run("User exists", func(t *testing.T) {
 		mockRow := &it.MockRow{}
 
-		it.SetupScanExists(mockRow)
+		it.UserScanExists(mockRow)
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUUID})
 
 		exists, err := doesUserExistById(ctx, mockPool, testUUID)
@@ -123,7 +157,7 @@ func TestDoesUserExistById(t *testing.T) {
 		testUUID = pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
 		mockRow := &it.MockRow{}
 
-		it.SetupScanNotExists(mockRow, pgx.ErrNoRows)
+		it.UserScanNotExists(mockRow, pgx.ErrNoRows)
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUUID})
 
 		exists, err := doesUserExistById(ctx, mockPool, testUUID)
@@ -137,7 +171,7 @@ func TestDoesUserExistById(t *testing.T) {
 		testUUID = pgtype.UUID{Bytes: [16]byte{3}, Valid: true}
 		mockRow := &it.MockRow{}
 
-		it.SetupScanNotExists(mockRow, errors.New("e"))
+		it.UserScanNotExists(mockRow, errors.New("e"))
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUUID})
 
 		_, err := doesUserExistById(ctx, mockPool, testUUID)
@@ -203,7 +237,7 @@ func TestSignUp(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"new@test.com"})
-		it.SetupScanNotExists(mockRow, pgx.ErrNoRows)
+		it.UserScanNotExists(mockRow, pgx.ErrNoRows)
 		it.SetupScanExists(mockTransRow)
 		it.SetupTxQueryRow(mockTx, mockTransRow, repository.InsertUser, ctx, []any{"new@test.com", "hashed"})
 		it.SetupTxOnRet(mockTx, "Exec", repository.InsertBuyer, ctx, []any{pgtype.UUID{}, "Test Buyer"}, pgconn.CommandTag{}, nil)
@@ -219,10 +253,10 @@ func TestSignUp(t *testing.T) {
 
 		result := SignUp(ctx, mockPool, SignupUser{
 			Email:    "new@test.com",
-			Password: "password",
+			Password: "kente weaving 2024",
 			Name:     "Test Buyer",
 			IsVendor: false,
-		}, false)
+		})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -235,16 +269,16 @@ func TestSignUp(t *testing.T) {
 
 	t.Run("User exists", func(t *testing.T) {
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"exists@test.com"})
-		it.SetupScanExists(mockRow)
+		it.UserScanExists(mockRow)
 		existingUser := repository.User{Uid: pgtype.UUID{Bytes: [16]byte{1}, Valid: true}, Email: "exists@test.com"}
 		mockQueries.On("GetUserByEmail", ctx, "exists@test.com").Return(existingUser, nil).Once()
 
 		result := SignUp(ctx, mockPool, SignupUser{
 			Email:    "exists@test.com",
-			Password: "password",
+			Password: "kente weaving 2024",
 			Name:     "Existing User",
 			IsVendor: false,
-		}, false)
+		})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -277,7 +311,7 @@ func TestLogin(t *testing.T) {
 			Name:  "Test Buyer",
 		}
 
-		it.SetupScanExists(mockRow).Run(func(args mock.Arguments) {
+		it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
 			if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 				*dest = userRow.Uid
 			}
@@ -292,17 +326,16 @@ func TestLogin(t *testing.T) {
 			}
 		})
 
-		Enver = MockEnver{}
+		setupSession(mockPool, ctx)
 		Hasher = MockHasher{}
 		defer func() {
 			Hasher = originalHasher
-			Enver = originalEnver
 		}()
 
 		result := Login(ctx, mockPool, LoginUser{
 			Email:    "buyer@test.com",
 			Password: "correct",
-		})
+		}, ClientInfo{})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -349,17 +382,16 @@ func TestLogin(t *testing.T) {
 			}
 		})
 
-		Enver = MockEnver{}
+		setupSession(mockPool, ctx)
 		Hasher = MockHasher{}
 		defer func() {
 			Hasher = originalHasher
-			Enver = originalEnver
 		}()
 
 		result := Login(ctx, mockPool, LoginUser{
 			Email:    "vendor@test.com",
 			Password: "correct",
-		})
+		}, ClientInfo{})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -376,17 +408,15 @@ func TestLogin(t *testing.T) {
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
 		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetBuyerByEmail, ctx, []any{"buyer@test.com"})
 
-		Enver = MockEnver{}
 		Hasher = MockHasher{}
 		defer func() {
 			Hasher = originalHasher
-			Enver = originalEnver
 		}()
 
 		result := Login(ctx, mockPool, LoginUser{
 			Email:    "buyer@test.com",
 			Password: "wrong",
-		})
+		}, ClientInfo{})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -405,17 +435,16 @@ func TestLogin(t *testing.T) {
 
 		it.SetupScanNotExists(mockBuyerRow, errors.New("e"))
 
-		Enver = MockEnver{}
+		setupSession(mockPool, ctx)
 		Hasher = MockHasher{}
 		defer func() {
 			Hasher = originalHasher
-			Enver = originalEnver
 		}()
 
 		result := Login(ctx, mockPool, LoginUser{
 			Email:    "vendor@test.com",
 			Password: "correct",
-		})
+		}, ClientInfo{})
 
 		if result.ServiceErr != nil {
 			t.Logf("Result: %+v", result)
@@ -428,6 +457,53 @@ func TestLogin(t *testing.T) {
 		assert.NotEmpty(t, data.Token)
 	})
 
+	t.Run("Suspended account", func(t *testing.T) {
+		suspendedPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+		buyerRow := &it.MockRow{}
+		statusRow := &it.MockRow{}
+		testUUID := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+
+		it.UserScanExists(userRow)
+		it.SetupPoolQueryRow(suspendedPool, userRow, repository.GetUserByEmail, ctx, []any{"banned@test.com"})
+		it.SetupScanReturnArgs(buyerRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testUUID
+		})
+		it.SetupPoolQueryRow(suspendedPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{"banned@test.com"})
+		statusScan(statusRow, repository.GetUserStatusRow{
+			Email:       "banned@test.com",
+			SuspendedAt: pgtype.Timestamp{Time: time.Now(), Valid: true},
+			IsBuyer:     true,
+		})
+		it.SetupPoolQueryRow(suspendedPool, statusRow, repository.GetUserStatus, ctx, []any{testUUID})
+
+		Hasher = MockHasher{}
+		recorder := &audit.MemoryRecorder{}
+		audit.Default = recorder
+		defer func() {
+			Hasher = originalHasher
+			audit.Default = &audit.MemoryRecorder{}
+		}()
+
+		result := Login(ctx, suspendedPool, LoginUser{
+			Email:    "banned@test.com",
+			Password: "correct",
+		}, ClientInfo{IP: "10.0.0.1", UserAgent: "test"})
+
+		// No session is started for a suspended account
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeAccountSuspended, result.ServiceErr.Code)
+		suspendedPool.AssertExpectations(t)
+
+		// The refusal is audited against the account with the client it came from
+		event, ok := recorder.Last(audit.Login)
+		assert.True(t, ok)
+		assert.Equal(t, audit.Denied, event.Outcome)
+		assert.Equal(t, testUUID, event.Uid)
+		assert.Equal(t, "10.0.0.1", event.IP)
+	})
+
 	mockPool.AssertExpectations(t)
 	mockRow.AssertExpectations(t)
 }
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/keys"
+	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ChangePasswordRequest defines the fields needed to change the password of a signed in user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"` // Checked against PasswordPolicy
+}
+
+// EmailChangeRequest defines the fields needed to start moving an account to a new email
+type EmailChangeRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// emailChangePurpose marks email change tokens so they cannot be used for anything else
+const emailChangePurpose = "change_email"
+
+var (
+	errWrongPassword           = errors.New("current password is incorrect")
+	errInvalidEmailChangeToken = errors.New("invalid or expired email change link")
+	errEmailChangeNotAllowed   = errors.New("email changes must be requested through POST /user/email")
+	errEmailAlreadyInUse       = errors.New("email is already in use")
+	errSameEmail               = errors.New("new email is the same as the current one")
+	errEmailChangeNeedsSession = errors.New("email changes must be made from a signed in session")
+)
+
+// confirmPassword re-authenticates a signed in user before a sensitive change. Wrong passwords count
+// against the same lockout as failed logins so a stolen session cannot be used to guess the password.
+// Refusals are audited as eventType.
+func confirmPassword(ctx context.Context, q *repository.Queries, p principal.Principal, password, eventType string) (repository.User, utils.ServiceReturn[any]) {
+	u, err := q.GetUserById(ctx, p.Uid)
+	if err != nil {
+		return repository.User{}, utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	subject := accountSubject(u.Email)
+	wait, err := AccountThrottle.Check(ctx, subject)
+	if err != nil {
+		return repository.User{}, utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		audit.Record(ctx, audit.By(p, eventType, audit.Denied))
+		return repository.User{}, tooManyAttempts(wait)
+	}
+
+	if !Hasher.Compare(password, u.Passhash) {
+		if _, err = AccountThrottle.Fail(ctx, subject); err != nil {
+			logging.Errorf("Error recording failed password confirmation -> %v", err)
+		}
+		audit.Record(ctx, audit.By(p, eventType, audit.Failure))
+		return repository.User{}, utils.MakeCodedError(errWrongPassword, http.StatusForbidden, CodeInvalidCredentials)
+	}
+	return u, utils.ServiceReturn[any]{}
+}
+
+// ChangePassword replaces the caller's password after checking the current one and signs out every other session
+func ChangePassword(ctx context.Context, pool db.Pool, p principal.Principal, req ChangePasswordRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	u, sr := confirmPassword(ctx, q, p, req.CurrentPassword, audit.PasswordChange)
+	if sr.ServiceErr != nil {
+		return sr
+	}
+
+	names, err := accountNames(ctx, q, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if sr := checkPassword(ctx, "NewPassword", req.NewPassword, append(names, u.Email)...); sr.ServiceErr != nil {
+		return sr
+	}
+
+	passhash, err := Hasher.Hash(req.NewPassword)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	err = qtx.UpdatePasshash(ctx, repository.UpdatePasshashParams{
+		Passhash: passhash,
+		Uid:      p.Uid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// The session making the change stays signed in, every other device has to log in again
+	_, err = qtx.RevokeOtherSessions(ctx, repository.RevokeOtherSessionsParams{
+		Uid: p.Uid,
+		Sid: p.SessionID,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, audit.By(p, audit.PasswordChange, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Password changed",
+		},
+	}
+}
+
+// signEmailChangeToken creates a signed token moving the account from one email to another.
+// The old email is part of the token so the link stops working once the email has changed.
+func signEmailChangeToken(uid, sid pgtype.UUID, from, to string) (string, error) {
+	return keys.Default.Sign(jwt.MapClaims{
+		"uid":     uid,
+		"sid":     sid,
+		"from":    from,
+		"email":   to,
+		"purpose": emailChangePurpose,
+		"exp":     time.Now().Add(EmailChangeTTL).Unix(),
+	})
+}
+
+// emailChangeEmail builds the email sent to the new address carrying the confirmation link
+func emailChangeEmail(email, token string) mail.Message {
+	link := fmt.Sprintf("%s/auth/email/confirm?token=%s", AppURL, url.QueryEscape(token))
+
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your new Ashesi Dwa email",
+		Body: fmt.Sprintf(
+			"Someone asked to move an Ashesi Dwa account to this email address.\n\n"+
+				"Follow this link within %v to confirm the change:\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			EmailChangeTTL, link,
+		),
+	}
+}
+
+// emailChangeNotice builds the email warning the current address that a change was requested
+func emailChangeNotice(email, newEmail string) mail.Message {
+	return mail.Message{
+		To:      email,
+		Subject: "Your Ashesi Dwa email is being changed",
+		Body: fmt.Sprintf(
+			"Someone asked to change the email of your Ashesi Dwa account to %s.\n\n"+
+				"The change only happens once the new address is confirmed.\n"+
+				"If this wasn't you, change your password and sign out your other sessions.\n",
+			newEmail,
+		),
+	}
+}
+
+// RequestEmailChange checks the caller's password and emails a confirmation link to the new address.
+// The account keeps its current email until the link is followed.
+func RequestEmailChange(ctx context.Context, pool db.Pool, p principal.Principal, req EmailChangeRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+	if !p.SessionID.Valid {
+		return utils.MakeError(errEmailChangeNeedsSession, http.StatusForbidden)
+	}
+
+	q := repository.New(pool)
+	u, sr := confirmPassword(ctx, q, p, req.Password, audit.EmailChangeRequest)
+	if sr.ServiceErr != nil {
+		return sr
+	}
+
+	if strings.EqualFold(req.Email, u.Email) {
+		return utils.MakeError(errSameEmail, http.StatusBadRequest)
+	}
+
+	exists, err := doesUserExistByEmail(ctx, pool, req.Email)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if exists {
+		return utils.MakeError(errEmailAlreadyInUse, http.StatusConflict)
+	}
+
+	// The new email has to pass the domain policy for every profile on the account
+	for _, role := range p.Roles {
+		if sr := checkEmailAllowed(ctx, pool, req.Email, role); sr.ServiceErr != nil {
+			return sr
+		}
+	}
+
+	token, err := signEmailChangeToken(p.Uid, p.SessionID, u.Email, req.Email)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	err = Mailer.Send(ctx, emailChangeEmail(req.Email, token))
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = Mailer.Send(ctx, emailChangeNotice(u.Email, req.Email)); err != nil {
+		logging.Errorf("Error sending email change notice -> %v", err)
+	}
+
+	event := audit.By(p, audit.EmailChangeRequest, audit.Success)
+	event.Email = req.Email
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusAccepted,
+		Data: utils.JMap{
+			"msg": "Confirmation link sent to " + req.Email,
+		},
+	}
+}
+
+// ConfirmEmailChange moves the account to the new email using the token from the confirmation link
+// and signs out every session except the one that requested the change
+func ConfirmEmailChange(ctx context.Context, pool db.Pool, req VerifyEmailRequest, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(req.Token, claims, keys.Default.Keyfunc, jwt.WithValidMethods(keys.Methods))
+	if err != nil {
+		logging.Infof("Invalid email change token -> %v", err)
+		return utils.MakeError(errInvalidEmailChangeToken, http.StatusBadRequest)
+	}
+
+	purpose, _ := claims["purpose"].(string)
+	uidStr, _ := claims["uid"].(string)
+	sidStr, _ := claims["sid"].(string)
+	from, _ := claims["from"].(string)
+	email, _ := claims["email"].(string)
+	if purpose != emailChangePurpose || from == "" || email == "" {
+		return utils.MakeError(errInvalidEmailChangeToken, http.StatusBadRequest)
+	}
+
+	uid, err := utils.ParseUUID(uidStr)
+	if err != nil {
+		return utils.MakeError(errInvalidEmailChangeToken, http.StatusBadRequest)
+	}
+	sid, err := utils.ParseUUID(sidStr)
+	if err != nil {
+		return utils.MakeError(errInvalidEmailChangeToken, http.StatusBadRequest)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := repository.New(pool).WithTx(tx)
+
+	changed, err := qtx.ChangeUserEmail(ctx, repository.ChangeUserEmailParams{
+		NewEmail: email,
+		Uid:      uid,
+		OldEmail: from,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return utils.MakeError(errEmailAlreadyInUse, http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// No row matched, the account is gone or its email already changed since the link was sent
+	if changed == 0 {
+		return utils.MakeError(errInvalidEmailChangeToken, http.StatusBadRequest)
+	}
+
+	_, err = qtx.RevokeOtherSessions(ctx, repository.RevokeOtherSessionsParams{
+		Uid: uid,
+		Sid: sid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := client.event(uid, audit.EmailChange, audit.Success)
+	event.Email = email
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Email changed",
+		},
+	}
+}
@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"backend/internal/audit"
+	"backend/internal/mail"
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/throttle"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// userByIdScan sets up the mock row to scan a user with the given email
+func userByIdScan(mockRow *it.MockRow, uid pgtype.UUID, email string) *mock.Call {
+	return it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+		*args.Get(0).(*pgtype.UUID) = uid
+		*args.Get(1).(*string) = email
+		*args.Get(2).(*string) = "stored-hash"
+	})
+}
+
+func TestChangePassword(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	p := principal.Principal{Uid: testUid, Email: "user@test.com", Roles: []string{"buyer"}, SessionID: testSid}
+
+	Hasher = MockHasher{}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	t.Run("Wrong current password", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		AccountThrottle = &throttle.MemoryThrottler{Policy: throttle.Policy{Threshold: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}}
+		recorder := &audit.MemoryRecorder{}
+		audit.Default = recorder
+		defer func() {
+			AccountThrottle = &throttle.MemoryThrottler{Policy: AccountPolicy}
+			audit.Default = &audit.MemoryRecorder{}
+		}()
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUid})
+
+		result := ChangePassword(ctx, mockPool, p, ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "new-password"})
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeInvalidCredentials, result.ServiceErr.Code)
+
+		// The failure counts towards the account lockout
+		wait, _ := AccountThrottle.Check(ctx, accountSubject("user@test.com"))
+		assert.Greater(t, wait, time.Duration(0))
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+
+		event, ok := recorder.Last(audit.PasswordChange)
+		assert.True(t, ok)
+		assert.Equal(t, audit.Failure, event.Outcome)
+	})
+
+	t.Run("Weak new password", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUid})
+		buyerProfileScan(mockPool, testUid, "Test Buyer")
+
+		result := ChangePassword(ctx, mockPool, p, ChangePasswordRequest{CurrentPassword: "correct", NewPassword: "user-test-2024"})
+
+		var errs *validation.ValidationErrorList
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		assert.ErrorAs(t, result.ServiceErr.Err, &errs)
+		assert.Equal(t, []string{"Field 'NewPassword' must not contain your email or name"}, errs.Errors)
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+	})
+
+	t.Run("API keys cannot change passwords", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		keyPrincipal := principal.Principal{Uid: testUid, Roles: []string{"vendor"}, Scopes: []string{"items:write"}}
+
+		result := ChangePassword(ctx, mockPool, keyPrincipal, ChangePasswordRequest{CurrentPassword: "correct", NewPassword: "new-password"})
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Changes password and signs out other sessions", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUid})
+		buyerProfileScan(mockPool, testUid, "Test Buyer")
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.UpdatePasshash, ctx, []any{"hashed", testUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeOtherSessions, ctx, []any{testUid, testSid}, pgconn.NewCommandTag("UPDATE 2"), nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+		recorder := &audit.MemoryRecorder{}
+		audit.Default = recorder
+		defer func() {
+			audit.Default = &audit.MemoryRecorder{}
+		}()
+
+		result := ChangePassword(ctx, mockPool, p, ChangePasswordRequest{CurrentPassword: "correct", NewPassword: "new-password"})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockTx.AssertExpectations(t)
+
+		event, ok := recorder.Last(audit.PasswordChange)
+		assert.True(t, ok)
+		assert.Equal(t, audit.Success, event.Outcome)
+		assert.Equal(t, testUid, event.Actor)
+	})
+}
+
+func TestRequestEmailChange(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	p := principal.Principal{Uid: testUid, Email: "old@test.com", Roles: []string{"buyer"}, SessionID: testSid}
+
+	Hasher = MockHasher{}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	t.Run("Email already in use", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+		existsRow := &it.MockRow{}
+		mailer := &mail.MemoryMailer{}
+		Mailer = mailer
+		defer func() {
+			Mailer = originalMailer
+		}()
+
+		userByIdScan(userRow, testUid, "old@test.com")
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		it.UserScanExists(existsRow)
+		it.SetupPoolQueryRow(mockPool, existsRow, repository.GetUserByEmail, ctx, []any{"taken@test.com"})
+
+		result := RequestEmailChange(ctx, mockPool, p, EmailChangeRequest{Email: "taken@test.com", Password: "correct"})
+
+		assert.Equal(t, errEmailAlreadyInUse, result.ServiceErr.Err)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		assert.Empty(t, mailer.Sent())
+	})
+
+	t.Run("Sends confirmation to the new email", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+		existsRow := &it.MockRow{}
+		mailer := &mail.MemoryMailer{}
+		Mailer = mailer
+		defer func() {
+			Mailer = originalMailer
+		}()
+
+		userByIdScan(userRow, testUid, "old@test.com")
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		it.UserScanNotExists(existsRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, existsRow, repository.GetUserByEmail, ctx, []any{"new@test.com"})
+
+		result := RequestEmailChange(ctx, mockPool, p, EmailChangeRequest{Email: "new@test.com", Password: "correct"})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusAccepted, result.Status)
+
+		msg, ok := mailer.Last("new@test.com")
+		assert.True(t, ok)
+		assert.Contains(t, msg.Body, AppURL+"/auth/email/confirm?token=")
+
+		_, ok = mailer.Last("old@test.com")
+		assert.True(t, ok)
+		mockPool.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+
+	t.Run("Rejects other tokens", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		token, err := signVerificationToken(testUid, "new@test.com")
+		assert.Nil(t, err)
+
+		result := ConfirmEmailChange(ctx, mockPool, VerifyEmailRequest{Token: token}, ClientInfo{})
+
+		assert.Equal(t, errInvalidEmailChangeToken, result.ServiceErr.Err)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Email changed since the link was sent", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		token, err := signEmailChangeToken(testUid, testSid, "old@test.com", "new@test.com")
+		assert.Nil(t, err)
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.ChangeUserEmail, ctx, []any{"new@test.com", testUid, "old@test.com"}, pgconn.NewCommandTag("UPDATE 0"), nil)
+		mockTx.On("Rollback", ctx).Return(nil)
+
+		result := ConfirmEmailChange(ctx, mockPool, VerifyEmailRequest{Token: token}, ClientInfo{})
+
+		assert.Equal(t, errInvalidEmailChangeToken, result.ServiceErr.Err)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockTx.AssertNotCalled(t, "Commit", ctx)
+	})
+
+	t.Run("Email taken in the meantime", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		token, err := signEmailChangeToken(testUid, testSid, "old@test.com", "new@test.com")
+		assert.Nil(t, err)
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.ChangeUserEmail, ctx, []any{"new@test.com", testUid, "old@test.com"}, pgconn.CommandTag{}, &pgconn.PgError{Code: pgUniqueViolation})
+		mockTx.On("Rollback", ctx).Return(nil)
+
+		result := ConfirmEmailChange(ctx, mockPool, VerifyEmailRequest{Token: token}, ClientInfo{})
+
+		assert.Equal(t, errEmailAlreadyInUse, result.ServiceErr.Err)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+	})
+
+	t.Run("Changes email and signs out other sessions", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		token, err := signEmailChangeToken(testUid, testSid, "old@test.com", "new@test.com")
+		assert.Nil(t, err)
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.ChangeUserEmail, ctx, []any{"new@test.com", testUid, "old@test.com"}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeOtherSessions, ctx, []any{testUid, testSid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := ConfirmEmailChange(ctx, mockPool, VerifyEmailRequest{Token: token}, ClientInfo{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockTx.AssertExpectations(t)
+	})
+}
+
+func TestUpdateRefusesEmailChange(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	p := principal.Principal{Uid: testUid, Email: "old@test.com", Roles: []string{"buyer"}, SessionID: testUid}
+
+	mockPool := &it.MockPool{}
+	existsRow := &it.MockRow{}
+	userRow := &it.MockRow{}
+
+	it.UserScanExists(existsRow)
+	it.SetupPoolQueryRow(mockPool, existsRow, repository.GetUserById, ctx, []any{testUid}).Once()
+	userByIdScan(userRow, testUid, "old@test.com")
+	it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid}).Once()
+
+	var user UpdateUser
+	user.User.Email = "new@test.com"
+	user.User.UserType = "buyer"
+	user.UserTypes.Buyer = &repository.Buyer{Uid: testUid, Name: "Buyer"}
+
+	result := Update(ctx, mockPool, p, user)
+
+	assert.Equal(t, errEmailChangeNotAllowed, result.ServiceErr.Err)
+	assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	mockPool.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/logging"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// purgeBatchSize is the number of accounts anonymized per database round trip
+const purgeBatchSize = 100
+
+// RestoreAccount cancels the deletion of an account that is still within its grace period.
+// The owner proves who they are with their password since a deleted account cannot log in.
+func RestoreAccount(ctx context.Context, pool db.Pool, user LoginUser, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(user)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	wait, err := checkLockout(ctx, user.Email, client)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		event := client.event(pgtype.UUID{}, audit.AccountRestore, audit.Denied)
+		event.Email, event.Detail = user.Email, "locked out"
+		audit.Record(ctx, event)
+		return tooManyAttempts(wait)
+	}
+
+	q := repository.New(pool)
+	u, err := q.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		if err != pgx.ErrNoRows {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		// Unknown accounts get the same response and take as long as a wrong password
+		Hasher.Compare(user.Password, dummyHash())
+		if err = recordFailedLogin(ctx, user.Email, client); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		return invalidCredentials()
+	}
+
+	if !Hasher.Compare(user.Password, u.Passhash) {
+		if err = recordFailedLogin(ctx, user.Email, client); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		audit.Record(ctx, client.event(u.Uid, audit.AccountRestore, audit.Failure))
+		return invalidCredentials()
+	}
+
+	restored, err := q.CancelAccountDeletion(ctx, u.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if restored == 0 {
+		return utils.MakeError(errors.New("account is not scheduled for deletion"), http.StatusConflict)
+	}
+
+	audit.Record(ctx, client.event(u.Uid, audit.AccountRestore, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Account restored, log in to continue",
+		},
+	}
+}
+
+// anonymizeAccount removes the personal data of one account whose grace period is over. The buyer and
+// vendor rows are kept under placeholder names so the account's transactions stay intact.
+// It reports false when another instance got to the account first or it was restored in the meantime.
+func anonymizeAccount(ctx context.Context, pool db.Pool, uid pgtype.UUID) (bool, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := repository.New(pool).WithTx(tx)
+
+	claimed, err := qtx.ClaimAccountDeletion(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	if claimed == 0 {
+		return false, nil
+	}
+
+	if err = qtx.AnonymizeUser(ctx, uid); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	audit.Record(ctx, audit.Event{Uid: uid, Type: audit.AccountAnonymize, Outcome: audit.Success})
+	return true, nil
+}
+
+// PurgeDeletedAccounts anonymizes every account whose deletion grace period is over and returns how many it anonymized
+func PurgeDeletedAccounts(ctx context.Context, pool db.Pool) (int, error) {
+	q := repository.New(pool)
+	purged := 0
+	for {
+		uids, err := q.ListDueAccountDeletions(ctx, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, uid := range uids {
+			ok, err := anonymizeAccount(ctx, pool, uid)
+			if err != nil {
+				return purged, err
+			}
+			if ok {
+				purged++
+			}
+		}
+
+		if len(uids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// RunAccountPurge anonymizes deleted accounts every interval until ctx is done, main runs it in the background
+func RunAccountPurge(ctx context.Context, pool db.Pool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := PurgeDeletedAccounts(ctx, pool)
+			if err != nil {
+				logging.Errorf("Error anonymizing deleted accounts -> %v", err)
+			}
+			if purged > 0 {
+				logging.Infof("Anonymized %d deleted accounts", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	testUid, _ := utils.ParseUUID("4b1a6f3e-2c8d-4e5f-9a7b-1c2d3e4f5a6b")
+	p := principal.Principal{Uid: testUid, Email: "user@test.com", Roles: []string{"vendor"}, SessionID: testUid}
+
+	t.Run("Schedules deletion and signs out everywhere", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+
+		it.UserScanExists(mockRow)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUid})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.ScheduleAccountDeletion, mock.Anything}, pgconn.NewCommandTag("INSERT 0 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeSessionsForUser, ctx, []any{testUid}, pgconn.NewCommandTag("UPDATE 2"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeApiKeysForUser, ctx, []any{testUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.DeleteCartItemsForVendor, ctx, []any{testUid}, pgconn.NewCommandTag("DELETE 3"), nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := Delete(ctx, mockPool, p, testUid)
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockTx.AssertExpectations(t)
+		mockPool.AssertNotCalled(t, "Exec", ctx, repository.DeleteUser, mock.Anything)
+	})
+
+	t.Run("Already scheduled", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+
+		it.UserScanExists(mockRow)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserById, ctx, []any{testUid})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.ScheduleAccountDeletion, mock.Anything}, pgconn.NewCommandTag("INSERT 0 0"), nil)
+		mockTx.On("Rollback", ctx).Return(nil)
+
+		result := Delete(ctx, mockPool, p, testUid)
+
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		mockTx.AssertNotCalled(t, "Commit", ctx)
+	})
+}
+
+func TestLoadAccountDeleted(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	mockPool := &it.MockPool{}
+	statusRow := &it.MockRow{}
+
+	statusScan(statusRow, repository.GetUserStatusRow{Email: "user@test.com", IsBuyer: true, IsDeleted: true})
+	it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+
+	_, err := loadAccount(ctx, repository.New(mockPool), testUid)
+
+	assert.Equal(t, ErrAccountDeleted, err)
+}
+
+func TestRestoreAccount(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	Hasher = MockHasher{}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	t.Run("Wrong password", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"user@test.com"})
+
+		result := RestoreAccount(ctx, mockPool, LoginUser{Email: "user@test.com", Password: "wrong"}, ClientInfo{})
+
+		assert.Equal(t, http.StatusUnauthorized, result.Status)
+		mockPool.AssertNotCalled(t, "Exec", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Not scheduled for deletion", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"user@test.com"})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.CancelAccountDeletion, ctx, []any{testUid}, pgconn.NewCommandTag("DELETE 0"), nil)
+
+		result := RestoreAccount(ctx, mockPool, LoginUser{Email: "user@test.com", Password: "correct"}, ClientInfo{})
+
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+	})
+
+	t.Run("Restores account", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		userByIdScan(mockRow, testUid, "user@test.com")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"user@test.com"})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.CancelAccountDeletion, ctx, []any{testUid}, pgconn.NewCommandTag("DELETE 1"), nil)
+
+		result := RestoreAccount(ctx, mockPool, LoginUser{Email: "user@test.com", Password: "correct"}, ClientInfo{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	ctx := context.Background()
+	dueUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	restoredUid := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+
+	mockPool := &it.MockPool{}
+	mockRows := &it.MockRows{}
+	dueTx := &it.MockTx{}
+	restoredTx := &it.MockTx{}
+
+	it.SetupPoolOnRet(mockPool, "Query", repository.ListDueAccountDeletions, ctx, []any{int32(purgeBatchSize)}, mockRows, nil)
+	it.SetupMock(mockRows, "Close", []any{}, nil)
+	it.SetupMock(mockRows, "Next", []any{}, true).Twice()
+	it.SetupMock(mockRows, "Next", []any{}, false).Once()
+	it.SetupMock(mockRows, "Err", []any{}, nil)
+	uids := []pgtype.UUID{dueUid, restoredUid}
+	it.SetupMock(mockRows, "Scan", []any{mock.Anything}, nil).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = uids[0]
+			uids = uids[1:]
+		})
+
+	// The first account is anonymized
+	mockPool.On("Begin", ctx).Return(dueTx, nil).Once()
+	it.SetupTxOnRet(dueTx, "Exec", repository.ClaimAccountDeletion, ctx, []any{dueUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+	it.SetupTxOnRet(dueTx, "Exec", repository.AnonymizeUser, ctx, []any{dueUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+	dueTx.On("Commit", ctx).Return(nil)
+	dueTx.On("Rollback", ctx).Return(nil).Maybe()
+
+	// The second was restored after being listed and is left alone
+	mockPool.On("Begin", ctx).Return(restoredTx, nil).Once()
+	it.SetupTxOnRet(restoredTx, "Exec", repository.ClaimAccountDeletion, ctx, []any{restoredUid}, pgconn.NewCommandTag("UPDATE 0"), nil)
+	restoredTx.On("Rollback", ctx).Return(nil)
+
+	purged, err := PurgeDeletedAccounts(ctx, mockPool)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, purged)
+	dueTx.AssertExpectations(t)
+	restoredTx.AssertNotCalled(t, "Exec", ctx, repository.AnonymizeUser, mock.Anything)
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Error codes returned when an email is refused by the domain policy
+const (
+	CodeEmailDomainNotAllowed = "email_domain_not_allowed"
+	CodeEmailDomainRole       = "email_domain_role_not_allowed"
+)
+
+// DomainRule allows signups from a single email domain, optionally restricted to one user type
+type DomainRule struct {
+	Domain     string // Lowercase domain, e.g. ashesi.edu.gh
+	Subdomains bool   // Also match any subdomain of Domain
+	UserType   string // buyer or vendor, empty allows both
+}
+
+// matches reports whether the rule covers the given lowercase domain
+func (r DomainRule) matches(domain string) bool {
+	if domain == r.Domain {
+		return true
+	}
+	return r.Subdomains && strings.HasSuffix(domain, "."+r.Domain)
+}
+
+// DomainPolicy is the set of email domains accounts may be created with.
+// An empty policy allows every domain.
+type DomainPolicy struct {
+	Rules []DomainRule
+}
+
+// ParseDomainPolicy reads a comma separated list of domain rules such as
+// "ashesi.edu.gh, *.ashesi.edu.gh:buyer". A leading "*." also matches subdomains and
+// a ":buyer" or ":vendor" suffix limits the domain to that user type.
+func ParseDomainPolicy(spec string) (DomainPolicy, error) {
+	var policy DomainPolicy
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		var rule DomainRule
+		domain, userType, hasType := strings.Cut(entry, ":")
+		if hasType {
+			if userType != "buyer" && userType != "vendor" {
+				return DomainPolicy{}, fmt.Errorf("invalid user type %q for domain %s", userType, domain)
+			}
+			rule.UserType = userType
+		}
+
+		if after, ok := strings.CutPrefix(domain, "*."); ok {
+			domain = after
+			rule.Subdomains = true
+		}
+		if domain == "" || strings.ContainsAny(domain, "@* ") {
+			return DomainPolicy{}, fmt.Errorf("invalid email domain %q", entry)
+		}
+		rule.Domain = domain
+
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// emailDomain returns the lowercase domain part of an email
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// Check decides whether email may be used by an account of userType, returning the error code on refusal
+func (p DomainPolicy) Check(email, userType string) (string, error) {
+	if len(p.Rules) == 0 {
+		return "", nil
+	}
+
+	domain := emailDomain(email)
+	matched := false
+	for _, rule := range p.Rules {
+		if !rule.matches(domain) {
+			continue
+		}
+		if rule.UserType == "" || rule.UserType == userType {
+			return "", nil
+		}
+		matched = true
+	}
+
+	if matched {
+		return CodeEmailDomainRole, fmt.Errorf("%s accounts cannot be created with %s emails", userType, domain)
+	}
+	return CodeEmailDomainNotAllowed, fmt.Errorf("emails from %s are not allowed", domain)
+}
+
+// Domains restricts which emails can sign up, set from ALLOWED_EMAIL_DOMAINS at startup
+var Domains DomainPolicy
+
+// checkEmailAllowed applies the domain policy to an email, letting through addresses an admin has
+// added to the exception list for the same user type
+func checkEmailAllowed(ctx context.Context, pool db.Pool, email, userType string) utils.ServiceReturn[any] {
+	code, err := Domains.Check(email, userType)
+	if err == nil {
+		return utils.ServiceReturn[any]{}
+	}
+
+	q := repository.New(pool)
+	exception, qErr := q.GetEmailException(ctx, strings.ToLower(email))
+	if qErr != nil {
+		if qErr == pgx.ErrNoRows {
+			return utils.MakeCodedError(err, http.StatusForbidden, code)
+		}
+		return utils.MakeError(qErr, http.StatusInternalServerError)
+	}
+
+	if exception.UserType != userType {
+		return utils.MakeCodedError(
+			fmt.Errorf("%s is only invited as a %s", email, exception.UserType),
+			http.StatusForbidden,
+			CodeEmailDomainRole,
+		)
+	}
+	return utils.ServiceReturn[any]{}
+}
+
+// EmailException defines the fields needed to let an email outside the allowed domains sign up
+type EmailException struct {
+	Email    string  `json:"email" validate:"required,email"`
+	UserType string  `json:"user_type" validate:"required,oneof=buyer vendor"`
+	Note     *string `json:"note" validate:"omitempty,max=255"`
+}
+
+// AddEmailException adds or replaces an exception to the domain policy, createdBy is the admin adding it
+func AddEmailException(ctx context.Context, pool db.Pool, createdBy pgtype.UUID, exception EmailException) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(exception)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	err = q.UpsertEmailException(ctx, repository.UpsertEmailExceptionParams{
+		Email:     strings.ToLower(exception.Email),
+		UserType:  exception.UserType,
+		Note:      exception.Note,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusCreated,
+		Data: utils.JMap{
+			"msg": "Exception added",
+		},
+	}
+}
+
+// ListEmailExceptions returns every exception to the domain policy, newest first
+func ListEmailExceptions(ctx context.Context, pool db.Pool) utils.ServiceReturn[any] {
+	q := repository.New(pool)
+	exceptions, err := q.ListEmailExceptions(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   exceptions,
+	}
+}
+
+// RemoveEmailException deletes the exception for an email, accounts already created are kept
+func RemoveEmailException(ctx context.Context, pool db.Pool, email string) utils.ServiceReturn[any] {
+	err := validation.ValidateVar(email, "required,email")
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	deleted, err := q.DeleteEmailException(ctx, strings.ToLower(email))
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return utils.MakeError(errors.New("exception does not exist"), http.StatusNotFound)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Exception removed",
+		},
+	}
+}
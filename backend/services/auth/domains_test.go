@@ -0,0 +1,142 @@
+package auth
+
+import (
+	it "backend/internal/testing"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestParseDomainPolicy(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		policy, err := ParseDomainPolicy(" Ashesi.edu.gh, *.ashesi.edu.gh:buyer,, ")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []DomainRule{
+			{Domain: "ashesi.edu.gh"},
+			{Domain: "ashesi.edu.gh", Subdomains: true, UserType: "buyer"},
+		}, policy.Rules)
+	})
+
+	t.Run("Invalid user type", func(t *testing.T) {
+		_, err := ParseDomainPolicy("ashesi.edu.gh:admin")
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid domain", func(t *testing.T) {
+		_, err := ParseDomainPolicy("*.")
+		assert.Error(t, err)
+	})
+}
+
+func TestDomainPolicyCheck(t *testing.T) {
+	policy, err := ParseDomainPolicy("ashesi.edu.gh,*.alumni.ashesi.edu.gh:buyer")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		policy   DomainPolicy
+		email    string
+		userType string
+		code     string
+	}{
+		{"Empty policy allows all", DomainPolicy{}, "someone@gmail.com", "vendor", ""},
+		{"Allowed domain", policy, "student@ashesi.edu.gh", "vendor", ""},
+		{"Domain is case insensitive", policy, "student@ASHESI.edu.gh", "buyer", ""},
+		{"Subdomain not allowed without wildcard", policy, "student@mail.ashesi.edu.gh", "buyer", CodeEmailDomainNotAllowed},
+		{"Allowed subdomain", policy, "grad@class.alumni.ashesi.edu.gh", "buyer", ""},
+		{"Subdomain restricted to buyers", policy, "grad@class.alumni.ashesi.edu.gh", "vendor", CodeEmailDomainRole},
+		{"Lookalike domain", policy, "student@notashesi.edu.gh", "buyer", CodeEmailDomainNotAllowed},
+		{"Other domain", policy, "someone@gmail.com", "buyer", CodeEmailDomainNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := tt.policy.Check(tt.email, tt.userType)
+
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.code != "", err != nil)
+		})
+	}
+}
+
+func TestSignUpDomainPolicy(t *testing.T) {
+	ctx := context.Background()
+	originalDomains := Domains
+	Domains = DomainPolicy{Rules: []DomainRule{{Domain: "ashesi.edu.gh"}}}
+	defer func() {
+		Domains = originalDomains
+	}()
+
+	exceptionScan := func(mockRow *it.MockRow, err error, userType string) {
+		it.SetupScanReturnArgs(mockRow, err, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(1).(*string) = userType
+			})
+	}
+
+	t.Run("Domain not allowed", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		exceptionScan(mockRow, pgx.ErrNoRows, "")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetEmailException, ctx, []any{"vendor@gmail.com"})
+
+		result := SignUp(ctx, mockPool, SignupUser{
+			Email:    "Vendor@gmail.com",
+			Password: "kente weaving 2024",
+			Name:     "Vendor",
+			IsVendor: true,
+		})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeEmailDomainNotAllowed, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Exception for another user type", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		exceptionScan(mockRow, nil, "vendor")
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetEmailException, ctx, []any{"invited@gmail.com"})
+
+		result := SignUp(ctx, mockPool, SignupUser{
+			Email:    "invited@gmail.com",
+			Password: "kente weaving 2024",
+			Name:     "Buyer",
+		})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeEmailDomainRole, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Invited vendor passes the policy", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		exceptionRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		exceptionScan(exceptionRow, nil, "vendor")
+		it.SetupPoolQueryRow(mockPool, exceptionRow, repository.GetEmailException, ctx, []any{"invited@gmail.com"})
+		it.UserScanExists(userRow)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"invited@gmail.com"})
+
+		result := SignUp(ctx, mockPool, SignupUser{
+			Email:    "invited@gmail.com",
+			Password: "kente weaving 2024",
+			Name:     "Vendor",
+			IsVendor: true,
+		})
+
+		// Gets as far as the duplicate account check
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		assert.Empty(t, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ExportBuyer is the buyer profile of an account in a data export
+type ExportBuyer struct {
+	Name string `json:"name"`
+}
+
+// ExportVendor is the vendor storefront of an account in a data export
+type ExportVendor struct {
+	Name string  `json:"name"`
+	Logo *string `json:"logo"`
+}
+
+// ExportProfile is the account itself in a data export, profiles the account does not hold are null
+type ExportProfile struct {
+	Uid           pgtype.UUID   `json:"uid"`
+	Email         string        `json:"email"`
+	EmailVerified bool          `json:"email_verified"`
+	Buyer         *ExportBuyer  `json:"buyer"`
+	Vendor        *ExportVendor `json:"vendor"`
+}
+
+// DataExport is the personal data the platform holds about an account
+type DataExport struct {
+	ExportedAt time.Time                             `json:"exported_at"`
+	Profile    ExportProfile                         `json:"profile"`
+	Cart       []repository.GetCartItemsForBuyerRow  `json:"cart"`
+	Purchases  []repository.ListPurchasesForBuyerRow `json:"purchases"`
+	Sales      []repository.ListSalesForVendorRow    `json:"sales"`
+	Identities []repository.ListUserIdentitiesRow    `json:"identities"` // Identity provider accounts linked for sign-in
+}
+
+// ExportData collects the caller's profile, cart, purchases, sales and linked identities into a single document
+func ExportData(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.UserExport, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	u, err := q.GetUserById(ctx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	export := DataExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: ExportProfile{
+			Uid:           u.Uid,
+			Email:         u.Email,
+			EmailVerified: u.EmailVerified,
+		},
+		Cart:      []repository.GetCartItemsForBuyerRow{},
+		Purchases: []repository.ListPurchasesForBuyerRow{},
+		Sales:     []repository.ListSalesForVendorRow{},
+	}
+
+	export.Identities, err = q.ListUserIdentities(ctx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	buyer, err := q.GetBuyerById(ctx, p.Uid)
+	switch {
+	case err == nil:
+		export.Profile.Buyer = &ExportBuyer{Name: buyer.Name}
+
+		export.Cart, err = q.GetCartItemsForBuyer(ctx, p.Uid)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		export.Purchases, err = q.ListPurchasesForBuyer(ctx, p.Uid)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+	case err != pgx.ErrNoRows:
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	vendor, err := q.GetVendorById(ctx, p.Uid)
+	switch {
+	case err == nil:
+		export.Profile.Vendor = &ExportVendor{Name: vendor.Name, Logo: vendor.Logo}
+
+		export.Sales, err = q.ListSalesForVendor(ctx, p.Uid)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+	case err != pgx.ErrNoRows:
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   export,
+	}
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// emptyRows sets up mock rows for a query returning nothing
+func emptyRows() *it.MockRows {
+	mockRows := &it.MockRows{}
+	it.SetupMock(mockRows, "Close", []any{}, nil)
+	it.SetupMock(mockRows, "Next", []any{}, false)
+	it.SetupMock(mockRows, "Err", []any{}, nil)
+	return mockRows
+}
+
+func TestExportData(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	p := principal.Principal{Uid: testUid, Email: "buyer@test.com", Roles: []string{"buyer"}, SessionID: testUid}
+
+	t.Run("Buyer without a storefront", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+		buyerRow := &it.MockRow{}
+		vendorRow := &it.MockRow{}
+
+		userByIdScan(userRow, testUid, "buyer@test.com")
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		it.SetupPoolOnRet(mockPool, "Query", repository.ListUserIdentities, ctx, []any{testUid}, emptyRows(), nil)
+		it.SetupScanReturnArgs(buyerRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(2).(*string) = "Kofi"
+			})
+		it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerById, ctx, []any{testUid})
+		it.SetupPoolOnRet(mockPool, "Query", repository.GetCartItemsForBuyer, ctx, []any{testUid}, emptyRows(), nil)
+		it.SetupPoolOnRet(mockPool, "Query", repository.ListPurchasesForBuyer, ctx, []any{testUid}, emptyRows(), nil)
+		it.SetupScanReturnArgs(vendorRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, vendorRow, repository.GetVendorById, ctx, []any{testUid})
+
+		result := ExportData(ctx, mockPool, p)
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		export := result.Data.(DataExport)
+		assert.Equal(t, "buyer@test.com", export.Profile.Email)
+		assert.Equal(t, &ExportBuyer{Name: "Kofi"}, export.Profile.Buyer)
+		assert.Nil(t, export.Profile.Vendor)
+		assert.NotNil(t, export.Sales)
+		assert.NotNil(t, export.Identities)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("API keys cannot export", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		keyPrincipal := principal.Principal{Uid: testUid, Roles: []string{"vendor"}, Scopes: []string{"items:read"}}
+
+		result := ExportData(ctx, mockPool, keyPrincipal)
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
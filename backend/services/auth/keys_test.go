@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"backend/internal/keys"
+	"backend/internal/utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySet(t *testing.T) {
+	rotation := keys.Rotation{Algorithm: keys.EdDSA, Every: time.Hour * 24, Overlap: time.Minute * 10, Retain: time.Hour}
+
+	originalKeys := keys.Default
+	defer func() {
+		keys.Default = originalKeys
+	}()
+
+	dir := t.TempDir()
+	ks, err := keys.Load(dir, rotation)
+	assert.NoError(t, err)
+	now := time.Now()
+	ks.Now = func() time.Time { return now }
+	keys.Default = ks
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+	assert.Len(t, paths, 1)
+
+	first, err := ks.Sign(jwt.MapClaims{"uid": "first"})
+	assert.NoError(t, err)
+
+	t.Run("Tokens carry a kid and verify", func(t *testing.T) {
+		token, err := utils.ParseJWT("Bearer "+first, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "EdDSA", token.Method.Alg())
+		assert.Equal(t, filepath.Base(paths[0]), token.Header["kid"].(string)+".pem")
+	})
+
+	t.Run("Rejects symmetric tokens", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"uid": "forged"})
+		token.Header["kid"] = ks.JWKS().Keys[0].Kid
+		forged, _ := token.SignedString([]byte("secret"))
+
+		_, err := utils.ParseJWT(forged, jwt.MapClaims{})
+		assert.Error(t, err)
+	})
+
+	t.Run("Rotation", func(t *testing.T) {
+		// A new key is published but only signs once the overlap has passed
+		now = now.Add(rotation.Every)
+		assert.NoError(t, ks.Rotate())
+		assert.Len(t, ks.JWKS().Keys, 2)
+
+		token, _ := ks.Sign(jwt.MapClaims{})
+		assert.Equal(t, ks.JWKS().Keys[0].Kid, kidOf(t, token))
+
+		now = now.Add(rotation.Overlap)
+		second, _ := ks.Sign(jwt.MapClaims{})
+		assert.Equal(t, ks.JWKS().Keys[1].Kid, kidOf(t, second))
+
+		// Tokens from the old key still verify until it is retired
+		_, err := utils.ParseJWT(first, jwt.MapClaims{})
+		assert.NoError(t, err)
+
+		now = now.Add(rotation.Retain + time.Minute)
+		_, err = utils.ParseJWT(first, jwt.MapClaims{})
+		assert.Error(t, err)
+		assert.Len(t, ks.JWKS().Keys, 1)
+	})
+
+	t.Run("Other instances load the directory", func(t *testing.T) {
+		other, err := keys.Load(dir, rotation)
+		assert.NoError(t, err)
+		other.Now = ks.Now
+
+		token, _ := other.Sign(jwt.MapClaims{})
+		_, err = utils.ParseJWT(token, jwt.MapClaims{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("RS256 keys", func(t *testing.T) {
+		rsaDir := t.TempDir()
+		rs, err := keys.Load(rsaDir, keys.Rotation{Algorithm: keys.RS256})
+		assert.NoError(t, err)
+		keys.Default = rs
+
+		token, _ := rs.Sign(jwt.MapClaims{})
+		parsed, err := utils.ParseJWT(token, jwt.MapClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "RS256", parsed.Method.Alg())
+		assert.Equal(t, "RSA", rs.JWKS().Keys[0].Kty)
+	})
+
+	t.Run("Invalid key file", func(t *testing.T) {
+		badDir := t.TempDir()
+		os.WriteFile(filepath.Join(badDir, "bad.pem"), []byte("not a key"), 0o600)
+
+		_, err := keys.Load(badDir, rotation)
+		assert.Error(t, err)
+	})
+}
+
+// kidOf returns the kid header of a signed token without verifying it
+func kidOf(t *testing.T, token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	assert.NoError(t, err)
+	return parsed.Header["kid"].(string)
+}
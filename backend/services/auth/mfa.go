@@ -0,0 +1,681 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/keys"
+	"backend/internal/logging"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/totp"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Error codes returned by the two-factor endpoints and the vendor MFA check
+const (
+	CodeMFARequired    = "mfa_required"
+	CodeInvalidMFACode = "invalid_mfa_code"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at a time
+const RecoveryCodeCount = 10
+
+// mfaPurpose marks challenge tokens so they cannot be used as access tokens and vice versa
+const mfaPurpose = "mfa_challenge"
+
+// settingRequireVendorMFA names the platform setting holding the vendor MFA policy
+const settingRequireVendorMFA = "require_vendor_mfa"
+
+// totpSkew is how many time steps either side of now a code is accepted for, to allow for clock drift
+const totpSkew = 1
+
+var (
+	errInvalidMFAToken = errors.New("invalid or expired two-factor challenge")
+	errInvalidMFACode  = errors.New("invalid two-factor code")
+	errMFANotEnabled   = errors.New("two-factor authentication is not enabled")
+	errMFAEnabled      = errors.New("two-factor authentication is already enabled")
+)
+
+// recoveryEncoding writes recovery codes in lowercase base32, which avoids look-alike characters such as 0 and 1
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// MFALoginRequest carries the challenge token returned by Login and a TOTP or recovery code
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+}
+
+// MFACodeRequest carries a code proving the caller holds their authenticator
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+// MFAPolicy is the platform wide two-factor policy set by admins
+type MFAPolicy struct {
+	RequireVendorMFA *bool `json:"require_vendor_mfa" validate:"required"`
+}
+
+// mfaChallenge is the response to a correct password on an account with an authenticator
+func mfaChallenge(uid pgtype.UUID) utils.ServiceReturn[any] {
+	token, err := keys.Default.Sign(jwt.MapClaims{
+		"uid":     uid,
+		"purpose": mfaPurpose,
+		"exp":     time.Now().Add(MFAChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"mfa_required": true,
+			"mfa_token":    token,
+		},
+	}
+}
+
+// parseMFAChallenge returns the user a challenge token was issued to
+func parseMFAChallenge(token string) (pgtype.UUID, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, keys.Default.Keyfunc, jwt.WithValidMethods(keys.Methods))
+	if err != nil {
+		logging.Infof("Invalid two-factor challenge -> %v", err)
+		return pgtype.UUID{}, errInvalidMFAToken
+	}
+
+	purpose, _ := claims["purpose"].(string)
+	uidStr, _ := claims["uid"].(string)
+	if purpose != mfaPurpose {
+		return pgtype.UUID{}, errInvalidMFAToken
+	}
+
+	uid, err := utils.ParseUUID(uidStr)
+	if err != nil {
+		return pgtype.UUID{}, errInvalidMFAToken
+	}
+	return uid, nil
+}
+
+// normalizeCode strips the spaces and dashes users type into codes
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// isTOTPCode reports whether a normalized code has the shape of a TOTP code rather than a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+// hasTOTP reports whether the user has a confirmed authenticator
+func hasTOTP(ctx context.Context, q *repository.Queries, uid pgtype.UUID) (bool, error) {
+	authenticator, err := q.GetTotp(ctx, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return authenticator.EnabledAt.Valid, nil
+}
+
+// checkTOTP validates a TOTP code against the user's enabled authenticator. A code is only accepted once,
+// later codes from the same or an earlier time step are refused.
+func checkTOTP(ctx context.Context, q *repository.Queries, uid pgtype.UUID, code string) (bool, error) {
+	authenticator, err := q.GetTotp(ctx, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if !authenticator.EnabledAt.Valid {
+		return false, nil
+	}
+
+	secret, err := TOTPSealer.Open(authenticator.Secret)
+	if err != nil {
+		return false, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, nil
+	}
+
+	used, err := q.UseTotpStep(ctx, repository.UseTotpStepParams{
+		Uid:          uid,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+// checkSecondFactor validates a TOTP code or, when allowed, an unused recovery code which is then spent
+func checkSecondFactor(ctx context.Context, q *repository.Queries, uid pgtype.UUID, code string, allowRecovery bool) (bool, error) {
+	code = normalizeCode(code)
+	if isTOTPCode(code) {
+		return checkTOTP(ctx, q, uid, code)
+	}
+	if !allowRecovery {
+		return false, nil
+	}
+
+	used, err := q.UseRecoveryCode(ctx, repository.UseRecoveryCodeParams{
+		CodeHash: hashing.HashToken(code),
+		Uid:      uid,
+	})
+	if err != nil {
+		return false, err
+	}
+	return used == 1, nil
+}
+
+// verifyFactor checks a code presented by a logged in user. Wrong codes count against the account like
+// failed logins so a stolen access token cannot be used to guess them. Refusals are audited as eventType.
+func verifyFactor(ctx context.Context, q *repository.Queries, p principal.Principal, code string, allowRecovery bool, eventType string) utils.ServiceReturn[any] {
+	wait, err := AccountThrottle.Check(ctx, accountSubject(p.Email))
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		audit.Record(ctx, audit.By(p, eventType, audit.Denied))
+		return tooManyAttempts(wait)
+	}
+
+	ok, err := checkSecondFactor(ctx, q, p.Uid, code, allowRecovery)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if !ok {
+		if _, err = AccountThrottle.Fail(ctx, accountSubject(p.Email)); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		audit.Record(ctx, audit.By(p, eventType, audit.Failure))
+		return utils.MakeCodedError(errInvalidMFACode, http.StatusBadRequest, CodeInvalidMFACode)
+	}
+	return utils.ServiceReturn[any]{}
+}
+
+// replaceRecoveryCodes discards the user's recovery codes and stores the hashes of a new set,
+// the codes themselves are returned to be shown once
+func replaceRecoveryCodes(ctx context.Context, q *repository.Queries, uid pgtype.UUID) ([]string, error) {
+	if err := q.DeleteRecoveryCodes(ctx, uid); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	buf := make([]byte, 5)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		code := recoveryEncoding.EncodeToString(buf)
+
+		err := q.InsertRecoveryCode(ctx, repository.InsertRecoveryCodeParams{
+			CodeHash: hashing.HashToken(code),
+			Uid:      uid,
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// VerifyMFALogin finishes a login started by Login using the challenge token and a TOTP or recovery code.
+// Wrong codes are throttled together with wrong passwords.
+func VerifyMFALogin(ctx context.Context, pool db.Pool, req MFALoginRequest, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	uid, err := parseMFAChallenge(req.MFAToken)
+	if err != nil {
+		return utils.MakeError(err, http.StatusUnauthorized)
+	}
+
+	q := repository.New(pool)
+	acc, err := loadAccount(ctx, q, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errInvalidMFAToken, http.StatusUnauthorized)
+		}
+		if err == ErrAccountSuspended || err == ErrAccountDeleted {
+			event := client.event(uid, audit.LoginMFA, audit.Denied)
+			event.Detail = err.Error()
+			audit.Record(ctx, event)
+		}
+		if err == ErrAccountSuspended {
+			return accountSuspended()
+		}
+		if err == ErrAccountDeleted {
+			return accountDeleted()
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	wait, err := checkLockout(ctx, acc.Email, client)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		event := client.event(uid, audit.LoginMFA, audit.Denied)
+		event.Detail = "locked out"
+		audit.Record(ctx, event)
+		return tooManyAttempts(wait)
+	}
+
+	ok, err := checkSecondFactor(ctx, q, uid, req.Code, true)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if !ok {
+		if err = recordFailedLogin(ctx, acc.Email, client); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		audit.Record(ctx, client.event(uid, audit.LoginMFA, audit.Failure))
+		return utils.MakeCodedError(errInvalidMFACode, http.StatusUnauthorized, CodeInvalidMFACode)
+	}
+
+	if err = AccountThrottle.Reset(ctx, accountSubject(acc.Email)); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	info, err := getLoginInfo(ctx, pool, acc.Email)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	acc.MFA = true
+	sr := finishLogin(ctx, pool, info, acc, client)
+	if sr.ServiceErr == nil {
+		audit.Record(ctx, client.event(uid, audit.LoginMFA, audit.Success))
+	}
+	return sr
+}
+
+// MFAStatus reports whether the caller has an authenticator, how many recovery codes are left and
+// whether the platform requires vendors to use one
+func MFAStatus(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	enabled, err := hasTOTP(ctx, q, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	remaining, err := q.CountRecoveryCodes(ctx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	required, err := VendorMFARequired(ctx, pool)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"enabled":             enabled,
+			"recovery_codes_left": remaining,
+			"required":            required && p.HasRole(utils.VENDOR),
+		},
+	}
+}
+
+// EnrollTOTP starts enrolling an authenticator, returning its secret and the otpauth:// URI to show as a QR code.
+// Starting again before confirming replaces the secret.
+func EnrollTOTP(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	// Only the account holder may change its second factor, API keys may not
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	sealed, err := TOTPSealer.Seal(secret)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	q := repository.New(pool)
+	stored, err := q.UpsertTotpSecret(ctx, repository.UpsertTotpSecretParams{
+		Uid:    p.Uid,
+		Secret: sealed,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if stored == 0 {
+		return utils.MakeError(errMFAEnabled, http.StatusConflict)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusCreated,
+		Data: utils.JMap{
+			"secret": secret,
+			"uri":    totp.ProvisioningURI(secret, MFAIssuer, p.Email),
+		},
+	}
+}
+
+// ConfirmTOTP enables the authenticator being enrolled once it produces a valid code. It returns the recovery
+// codes, which are never shown again, and a new access token for the current session carrying the mfa claim.
+func ConfirmTOTP(ctx context.Context, pool db.Pool, p principal.Principal, req MFACodeRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	authenticator, err := q.GetTotp(ctx, p.Uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errors.New("two-factor enrollment has not been started"), http.StatusNotFound)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if authenticator.EnabledAt.Valid {
+		return utils.MakeError(errMFAEnabled, http.StatusConflict)
+	}
+
+	wait, err := AccountThrottle.Check(ctx, accountSubject(p.Email))
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if wait > 0 {
+		audit.Record(ctx, audit.By(p, audit.MFAEnable, audit.Denied))
+		return tooManyAttempts(wait)
+	}
+
+	secret, err := TOTPSealer.Open(authenticator.Secret)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	step, ok := totp.Validate(secret, normalizeCode(req.Code), time.Now(), totpSkew)
+	if !ok {
+		if _, err = AccountThrottle.Fail(ctx, accountSubject(p.Email)); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		audit.Record(ctx, audit.By(p, audit.MFAEnable, audit.Failure))
+		return utils.MakeCodedError(errInvalidMFACode, http.StatusBadRequest, CodeInvalidMFACode)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	// Losing a race with a concurrent confirmation leaves the other one in charge of the recovery codes
+	enabled, err := qtx.EnableTotp(ctx, repository.EnableTotpParams{
+		Uid:          p.Uid,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if enabled == 0 {
+		return utils.MakeError(errMFAEnabled, http.StatusConflict)
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, qtx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// The code just entered counts as the current session's second factor
+	if err = qtx.MarkSessionMfa(ctx, p.SessionID); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	p.MFA = true
+	token, err := signAccessToken(p)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, audit.By(p, audit.MFAEnable, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg":            "Two-factor authentication enabled",
+			"recovery_codes": codes,
+			"token":          token,
+		},
+	}
+}
+
+// DisableTOTP removes the caller's authenticator and recovery codes after checking a TOTP or recovery code.
+// Vendors cannot turn two-factor authentication off while the platform requires it.
+func DisableTOTP(ctx context.Context, pool db.Pool, p principal.Principal, req MFACodeRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	if p.HasRole(utils.VENDOR) {
+		required, err := VendorMFARequired(ctx, pool)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		if required {
+			return utils.MakeCodedError(
+				errors.New("two-factor authentication is required for vendors"),
+				http.StatusForbidden,
+				CodeMFARequired,
+			)
+		}
+	}
+
+	q := repository.New(pool)
+	enabled, err := hasTOTP(ctx, q, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if !enabled {
+		return utils.MakeError(errMFANotEnabled, http.StatusConflict)
+	}
+
+	if sr := verifyFactor(ctx, q, p, req.Code, true, audit.MFADisable); sr.ServiceErr != nil {
+		return sr
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+	if err = qtx.DeleteTotp(ctx, p.Uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if err = qtx.DeleteRecoveryCodes(ctx, p.Uid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, audit.By(p, audit.MFADisable, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Two-factor authentication disabled",
+		},
+	}
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a TOTP code,
+// the new codes are only shown in this response
+func RegenerateRecoveryCodes(ctx context.Context, pool db.Pool, p principal.Principal, req MFACodeRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	enabled, err := hasTOTP(ctx, q, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if !enabled {
+		return utils.MakeError(errMFANotEnabled, http.StatusConflict)
+	}
+
+	// A recovery code cannot be used to mint new ones
+	if sr := verifyFactor(ctx, q, p, req.Code, false, audit.RecoveryCodesReplaced); sr.ServiceErr != nil {
+		return sr
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := replaceRecoveryCodes(ctx, q.WithTx(tx), p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, audit.By(p, audit.RecoveryCodesReplaced, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg":            "Recovery codes regenerated",
+			"recovery_codes": codes,
+		},
+	}
+}
+
+// VendorMFARequired reports whether the platform requires vendors to use two-factor authentication
+func VendorMFARequired(ctx context.Context, pool db.Pool) (bool, error) {
+	q := repository.New(pool)
+	value, err := q.GetSetting(ctx, settingRequireVendorMFA)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return strconv.ParseBool(value)
+}
+
+// VendorMFASatisfied reports whether the caller meets the vendor two-factor policy. Sessions pass once they
+// presented a second factor. API keys pass only while the account they act for has an authenticator enabled,
+// since a key may predate the policy or belong to a vendor who never enrolled.
+func VendorMFASatisfied(ctx context.Context, pool db.Pool, p principal.Principal) (bool, error) {
+	if p.MFA {
+		return true, nil
+	}
+
+	required, err := VendorMFARequired(ctx, pool)
+	if err != nil {
+		return false, err
+	}
+	if !required {
+		return true, nil
+	}
+
+	if len(p.Scopes) > 0 {
+		return hasTOTP(ctx, repository.New(pool), p.Uid)
+	}
+	return false, nil
+}
+
+// GetMFAPolicy returns the platform's two-factor policy
+func GetMFAPolicy(ctx context.Context, pool db.Pool) utils.ServiceReturn[any] {
+	required, err := VendorMFARequired(ctx, pool)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   MFAPolicy{RequireVendorMFA: &required},
+	}
+}
+
+// SetMFAPolicy changes the platform's two-factor policy, updatedBy is the admin changing it. Vendors without an
+// authenticator are refused on vendor routes from their next request and told to enroll when they log in.
+func SetMFAPolicy(ctx context.Context, pool db.Pool, updatedBy pgtype.UUID, mfaPolicy MFAPolicy) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(mfaPolicy)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	err = q.UpsertSetting(ctx, repository.UpsertSettingParams{
+		Name:      settingRequireVendorMFA,
+		Value:     strconv.FormatBool(*mfaPolicy.RequireVendorMFA),
+		UpdatedBy: updatedBy,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Two-factor policy updated",
+		},
+	}
+}
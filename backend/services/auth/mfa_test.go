@@ -0,0 +1,462 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/throttle"
+	"backend/internal/totp"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// totpScan sets up the mock row to scan the given authenticator row
+func totpScan(mockRow *it.MockRow, row repository.MfaTotp) *mock.Call {
+	return it.SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = row.Uid
+			*args.Get(1).(*string) = row.Secret
+			*args.Get(2).(*pgtype.Timestamp) = row.EnabledAt
+			*args.Get(3).(*int64) = row.LastUsedStep
+		})
+}
+
+// vendorLoginScan sets up the rows read by a vendor logging in with email
+func vendorLoginScan(mockPool *it.MockPool, ctx context.Context, uid pgtype.UUID, email string) {
+	buyerRow := &it.MockRow{}
+	vendorRow := &it.MockRow{}
+
+	it.SetupScanNotExists(buyerRow, pgx.ErrNoRows)
+	it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{email})
+	it.UserScanExists(vendorRow).Run(func(args mock.Arguments) {
+		*args.Get(0).(*pgtype.UUID) = uid
+		*args.Get(1).(*string) = email
+		*args.Get(2).(*string) = "Test Vendor"
+	})
+	it.SetupPoolQueryRow(mockPool, vendorRow, repository.GetVendorByEmail, ctx, []any{email})
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	vendor := principal.Principal{Uid: testUid, Email: "vendor@test.com", Roles: []string{"vendor"}}
+
+	key := make([]byte, totp.KeySize)
+	rand.Read(key)
+	TOTPSealer, _ = totp.NewSealer(key)
+	defer func() {
+		TOTPSealer = nil
+	}()
+
+	t.Run("Secret is stored encrypted", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		var stored string
+		it.SetupMock(mockPool, "Exec", []any{ctx, repository.UpsertTotpSecret, mock.Anything}, pgconn.NewCommandTag("INSERT 0 1"), nil).
+			Run(func(args mock.Arguments) {
+				stored = args.Get(2).([]any)[1].(string)
+			})
+
+		result := EnrollTOTP(ctx, mockPool, vendor)
+
+		assert.Equal(t, http.StatusCreated, result.Status)
+		secret := result.Data.(utils.JMap)["secret"].(string)
+		assert.NotContains(t, stored, secret)
+		opened, err := TOTPSealer.Open(stored)
+		assert.NoError(t, err)
+		assert.Equal(t, secret, opened)
+	})
+}
+
+func TestLoginMFAChallenge(t *testing.T) {
+	ctx := context.Background()
+	mockPool := &it.MockPool{}
+	userRow := &it.MockRow{}
+	statusRow := &it.MockRow{}
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	it.UserScanExists(userRow)
+	it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"vendor@test.com"})
+	vendorLoginScan(mockPool, ctx, testUid, "vendor@test.com")
+	statusScan(statusRow, repository.GetUserStatusRow{Email: "vendor@test.com", IsVendor: true, MfaEnabled: true})
+	it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+
+	Hasher = MockHasher{}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	result := Login(ctx, mockPool, LoginUser{
+		Email:    "vendor@test.com",
+		Password: "correct",
+	}, ClientInfo{})
+
+	// No session is started until the second factor is presented
+	assert.Equal(t, http.StatusOK, result.Status)
+	data := result.Data.(utils.JMap)
+	assert.Equal(t, true, data["mfa_required"])
+	uid, err := parseMFAChallenge(data["mfa_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, testUid, uid)
+	mockPool.AssertNotCalled(t, "Begin", ctx)
+	mockPool.AssertExpectations(t)
+}
+
+func TestVerifyMFALogin(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	secret, _ := totp.GenerateSecret()
+	enabled := pgtype.Timestamp{Time: time.Now().Add(-time.Hour), Valid: true}
+
+	challenge := mfaChallenge(testUid).Data.(utils.JMap)["mfa_token"].(string)
+
+	// setupChallenge mocks the account the challenge token was issued to and its authenticator
+	setupChallenge := func(mockPool *it.MockPool) {
+		statusRow := &it.MockRow{}
+		totpRow := &it.MockRow{}
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: "vendor@test.com", IsVendor: true, MfaEnabled: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid, Secret: secret, EnabledAt: enabled})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+	}
+
+	t.Run("Invalid challenge", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		verifyToken, _ := signVerificationToken(testUid, "vendor@test.com")
+
+		result := VerifyMFALogin(ctx, mockPool, MFALoginRequest{MFAToken: verifyToken, Code: "123456"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Wrong code", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupChallenge(mockPool)
+
+		AccountThrottle = &throttle.MemoryThrottler{Policy: throttle.Policy{Threshold: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}}
+		defer func() {
+			AccountThrottle = &throttle.MemoryThrottler{Policy: AccountPolicy}
+		}()
+
+		code, _ := totp.Code(secret, time.Now().Add(-time.Hour))
+		result := VerifyMFALogin(ctx, mockPool, MFALoginRequest{MFAToken: challenge, Code: code}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		assert.Equal(t, CodeInvalidMFACode, result.ServiceErr.Code)
+
+		// The wrong code counts as a failed login
+		wait, err := AccountThrottle.Check(ctx, accountSubject("vendor@test.com"))
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute, wait.Round(time.Minute))
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Replayed code", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupChallenge(mockPool)
+		it.SetupMock(mockPool, "Exec", []any{ctx, repository.UseTotpStep, mock.Anything}, pgconn.NewCommandTag("UPDATE 0"), nil)
+
+		code, _ := totp.Code(secret, time.Now())
+		result := VerifyMFALogin(ctx, mockPool, MFALoginRequest{MFAToken: challenge, Code: code}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, CodeInvalidMFACode, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("TOTP success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupChallenge(mockPool)
+		it.SetupMock(mockPool, "Exec", []any{ctx, repository.UseTotpStep, mock.Anything}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		vendorLoginScan(mockPool, ctx, testUid, "vendor@test.com")
+		mockTx := setupSessionTx(mockPool, ctx)
+
+		code, _ := totp.Code(secret, time.Now())
+		client := ClientInfo{IP: "10.0.0.1", UserAgent: "Mozilla/5.0"}
+		result := VerifyMFALogin(ctx, mockPool, MFALoginRequest{MFAToken: challenge, Code: code}, client)
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status)
+		data := result.Data.(InfoWToken)
+		assert.Equal(t, "vendor", data.UserType)
+		assert.False(t, data.MFAEnrollmentRequired)
+
+		// The session and its access token record the second factor, the session also records the client
+		mockTx.AssertCalled(t, "QueryRow", ctx, repository.CreateSession, []any{testUid, true, &client.UserAgent, &client.IP})
+		claims := &principal.Claims{}
+		_, err := utils.ParseJWT(data.Token, claims)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFA)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Recovery code success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		statusRow := &it.MockRow{}
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: "vendor@test.com", IsVendor: true, MfaEnabled: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.UseRecoveryCode, ctx,
+			[]any{hashing.HashToken("abcdefgh"), testUid},
+			pgconn.NewCommandTag("UPDATE 1"), nil)
+		vendorLoginScan(mockPool, ctx, testUid, "vendor@test.com")
+		setupSessionTx(mockPool, ctx)
+
+		result := VerifyMFALogin(ctx, mockPool, MFALoginRequest{MFAToken: challenge, Code: "ABCD EFGH"}, ClientInfo{})
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	vendor := principal.Principal{Uid: testUid, Email: "vendor@test.com", Roles: []string{"vendor"}, SessionID: testSid}
+	secret, _ := totp.GenerateSecret()
+
+	t.Run("Wrong code", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		totpRow := &it.MockRow{}
+
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid, Secret: secret})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		code, _ := totp.Code(secret, time.Now().Add(-time.Hour))
+		result := ConfirmTOTP(ctx, mockPool, vendor, MFACodeRequest{Code: code})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		assert.Equal(t, CodeInvalidMFACode, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Already enabled", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		totpRow := &it.MockRow{}
+
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid, Secret: secret, EnabledAt: pgtype.Timestamp{Time: time.Now(), Valid: true}})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		result := ConfirmTOTP(ctx, mockPool, vendor, MFACodeRequest{Code: "123456"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		totpRow := &it.MockRow{}
+
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid, Secret: secret})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.EnableTotp, mock.Anything}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.DeleteRecoveryCodes, ctx, []any{testUid}, pgconn.CommandTag{}, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.InsertRecoveryCode, mock.Anything}, pgconn.CommandTag{}, nil).Times(RecoveryCodeCount)
+		it.SetupTxOnRet(mockTx, "Exec", repository.MarkSessionMfa, ctx, []any{testSid}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		code, _ := totp.Code(secret, time.Now())
+		result := ConfirmTOTP(ctx, mockPool, vendor, MFACodeRequest{Code: code})
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status)
+		data := result.Data.(utils.JMap)
+		codes := data["recovery_codes"].([]string)
+		assert.Len(t, codes, RecoveryCodeCount)
+		assert.NotEqual(t, codes[0], codes[1])
+
+		// Only hashes of the codes are stored
+		mockTx.AssertCalled(t, "Exec", ctx, repository.InsertRecoveryCode, []any{hashing.HashToken(normalizeCode(codes[0])), testUid})
+
+		claims := &principal.Claims{}
+		_, err := utils.ParseJWT(data["token"].(string), claims)
+		assert.NoError(t, err)
+		assert.True(t, claims.MFA)
+		assert.Equal(t, testSid, claims.Sid)
+		mockPool.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
+	})
+}
+
+func TestDisableTOTP(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	vendor := principal.Principal{Uid: testUid, Email: "vendor@test.com", Roles: []string{"vendor"}, MFA: true}
+
+	t.Run("Required for vendors", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		settingRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(settingRow, nil, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*string) = "true"
+		})
+		it.SetupPoolQueryRow(mockPool, settingRow, repository.GetSetting, ctx, []any{settingRequireVendorMFA})
+
+		result := DisableTOTP(ctx, mockPool, vendor, MFACodeRequest{Code: "123456"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeMFARequired, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Not enabled", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		settingRow := &it.MockRow{}
+		totpRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(settingRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, settingRow, repository.GetSetting, ctx, []any{settingRequireVendorMFA})
+		it.SetupScanReturnArgs(totpRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		result := DisableTOTP(ctx, mockPool, vendor, MFACodeRequest{Code: "123456"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestSetMFAPolicy(t *testing.T) {
+	ctx := context.Background()
+	adminUid := pgtype.UUID{Bytes: [16]byte{7}, Valid: true}
+
+	t.Run("Missing value", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+
+		result := SetMFAPolicy(ctx, mockPool, adminUid, MFAPolicy{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		required := true
+
+		it.SetupPoolOnRet(mockPool, "Exec", repository.UpsertSetting, ctx, []any{settingRequireVendorMFA, "true", adminUid}, pgconn.CommandTag{}, nil)
+
+		result := SetMFAPolicy(ctx, mockPool, adminUid, MFAPolicy{RequireVendorMFA: &required})
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestVendorMFASatisfied(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	session := principal.Principal{Uid: testUid, Roles: []string{"vendor"}}
+	apiKey := principal.Principal{Uid: testUid, Roles: []string{"vendor"}, Scopes: []string{"items:read"}}
+	enabled := pgtype.Timestamp{Time: time.Now(), Valid: true}
+
+	// setupPolicy mocks the platform's vendor MFA setting
+	setupPolicy := func(mockPool *it.MockPool, required string) {
+		settingRow := &it.MockRow{}
+		it.SetupScanReturnArgs(settingRow, nil, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*string) = required
+		})
+		it.SetupPoolQueryRow(mockPool, settingRow, repository.GetSetting, ctx, []any{settingRequireVendorMFA})
+	}
+
+	t.Run("Not required", func(t *testing.T) {
+		for _, p := range []principal.Principal{session, apiKey} {
+			mockPool := &it.MockPool{}
+			setupPolicy(mockPool, "false")
+
+			satisfied, err := VendorMFASatisfied(ctx, mockPool, p)
+
+			assert.NoError(t, err)
+			assert.True(t, satisfied)
+			mockPool.AssertNotCalled(t, "QueryRow", ctx, repository.GetTotp, mock.Anything)
+		}
+	})
+
+	t.Run("Session with a second factor", func(t *testing.T) {
+		mfa := session
+		mfa.MFA = true
+
+		satisfied, err := VendorMFASatisfied(ctx, &it.MockPool{}, mfa)
+
+		assert.NoError(t, err)
+		assert.True(t, satisfied)
+	})
+
+	t.Run("Session without a second factor", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupPolicy(mockPool, "true")
+
+		satisfied, err := VendorMFASatisfied(ctx, mockPool, session)
+
+		assert.NoError(t, err)
+		assert.False(t, satisfied)
+	})
+
+	t.Run("API key of an enrolled vendor", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		totpRow := &it.MockRow{}
+		setupPolicy(mockPool, "true")
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid, EnabledAt: enabled})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		satisfied, err := VendorMFASatisfied(ctx, mockPool, apiKey)
+
+		assert.NoError(t, err)
+		assert.True(t, satisfied)
+	})
+
+	t.Run("API key of a vendor who never enrolled", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		totpRow := &it.MockRow{}
+		setupPolicy(mockPool, "true")
+		it.SetupScanReturnArgs(totpRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		satisfied, err := VendorMFASatisfied(ctx, mockPool, apiKey)
+
+		assert.NoError(t, err)
+		assert.False(t, satisfied)
+	})
+
+	t.Run("API key of a vendor still enrolling", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		totpRow := &it.MockRow{}
+		setupPolicy(mockPool, "true")
+		totpScan(totpRow, repository.MfaTotp{Uid: testUid})
+		it.SetupPoolQueryRow(mockPool, totpRow, repository.GetTotp, ctx, []any{testUid})
+
+		satisfied, err := VendorMFASatisfied(ctx, mockPool, apiKey)
+
+		assert.NoError(t, err)
+		assert.False(t, satisfied)
+	})
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/logging"
+	"backend/internal/oidc"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// OpenID Connect sign-in, main configures the provider from the environment
+var (
+	OIDC         *oidc.Provider     // The identity provider, nil when sign-in with a provider is turned off
+	OIDCLoginTTL = time.Minute * 10 // How long a user has to log in at the provider
+)
+
+// Error codes sent when a provider login cannot be matched to an account
+const (
+	CodeOIDCEmailUnverified = "oidc_email_unverified"
+	CodeOIDCAccountConflict = "oidc_account_conflict"
+)
+
+var (
+	errOIDCDisabled         = errors.New("sign-in with an identity provider is not enabled")
+	errInvalidOIDCState     = errors.New("invalid or expired login, start again")
+	errOIDCLoginFailed      = errors.New("the identity provider login could not be verified")
+	errOIDCEmailUnverified  = errors.New("the identity provider has not verified your email")
+	errOIDCAccountConflict  = errors.New("an account with this email exists but its email is not confirmed, log in with your password to confirm it first")
+	errOIDCIdentityConflict = errors.New("this identity was linked to an account by another login, try again")
+)
+
+// OIDCCallbackRequest carries what the identity provider redirected the user back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required,max=2048"`
+	State string `json:"state" validate:"required,max=128"`
+}
+
+// StartOIDCLogin returns the url to send the user to at the identity provider. The state, nonce and PKCE
+// verifier of the login are kept until the provider sends the user back to OIDCLogin.
+func StartOIDCLogin(ctx context.Context, pool db.Pool) utils.ServiceReturn[any] {
+	if OIDC == nil {
+		return utils.MakeError(errOIDCDisabled, http.StatusNotFound)
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := oidc.RandomString()
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	q := repository.New(pool)
+	// Abandoned logins are cleared out as new ones start
+	if err := q.DeleteExpiredOidcLogins(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	err := q.InsertOidcLogin(ctx, repository.InsertOidcLoginParams{
+		StateHash:    hashing.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    pgtype.Timestamp{Time: time.Now().UTC().Add(OIDCLoginTTL), Valid: true},
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"url": OIDC.AuthURL(state, nonce, verifier),
+		},
+	}
+}
+
+// OIDCLogin finishes a login at the identity provider. The provider's identity signs in to the account it is
+// linked to, is linked to the account with the same verified email, or gets a new buyer account.
+func OIDCLogin(ctx context.Context, pool db.Pool, req OIDCCallbackRequest, client ClientInfo) utils.ServiceReturn[any] {
+	if OIDC == nil {
+		return utils.MakeError(errOIDCDisabled, http.StatusNotFound)
+	}
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	// Each login can be finished once, a replayed callback finds nothing
+	q := repository.New(pool)
+	login, err := q.ClaimOidcLogin(ctx, hashing.HashToken(req.State))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errInvalidOIDCState, http.StatusBadRequest)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if time.Now().UTC().After(login.ExpiresAt.Time) {
+		return utils.MakeError(errInvalidOIDCState, http.StatusBadRequest)
+	}
+
+	claims, err := OIDC.Login(ctx, req.Code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		logging.Infof("Identity provider login failed -> %v", err)
+		event := client.event(pgtype.UUID{}, audit.Login, audit.Failure)
+		event.Detail = "oidc"
+		audit.Record(ctx, event)
+		return utils.MakeError(errOIDCLoginFailed, http.StatusUnauthorized)
+	}
+
+	uid, sr := oidcAccount(ctx, pool, claims, client)
+	if sr.ServiceErr != nil {
+		return sr
+	}
+
+	acc, err := loadAccount(ctx, q, uid)
+	if err != nil {
+		if err == ErrAccountSuspended || err == ErrAccountDeleted {
+			event := client.event(uid, audit.Login, audit.Denied)
+			event.Detail = "oidc: " + err.Error()
+			audit.Record(ctx, event)
+		}
+		if err == ErrAccountSuspended {
+			return accountSuspended()
+		}
+		if err == ErrAccountDeleted {
+			return accountDeleted()
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// The provider stands in for the password, an enrolled authenticator is still asked for
+	if acc.MFAEnabled {
+		return mfaChallenge(uid)
+	}
+
+	info, err := getLoginInfo(ctx, pool, acc.Email)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	sr = finishLogin(ctx, pool, info, acc, client)
+	if sr.ServiceErr == nil {
+		event := client.event(uid, audit.Login, audit.Success)
+		event.Detail = "oidc"
+		audit.Record(ctx, event)
+	}
+	return sr
+}
+
+// oidcAccount returns the account a provider identity signs in to, linking or creating one on its first login.
+// Only emails the provider has verified are matched, and only to accounts whose email is confirmed, so an
+// account made with someone else's email cannot be taken over through the provider or the other way round.
+// Emails are compared exactly, ignoring case, since a LIKE pattern would let "_" and "%" match other accounts.
+func oidcAccount(ctx context.Context, pool db.Pool, claims *oidc.Claims, client ClientInfo) (pgtype.UUID, utils.ServiceReturn[any]) {
+	q := repository.New(pool)
+	issuer := OIDC.Metadata.Issuer
+
+	uid, err := q.GetUserIdentity(ctx, repository.GetUserIdentityParams{Issuer: issuer, Subject: claims.Subject})
+	if err == nil {
+		err = q.TouchUserIdentity(ctx, repository.TouchUserIdentityParams{Issuer: issuer, Subject: claims.Subject, Email: claims.Email})
+		if err != nil {
+			return uid, utils.MakeError(err, http.StatusInternalServerError)
+		}
+		return uid, utils.ServiceReturn[any]{}
+	}
+	if err != pgx.ErrNoRows {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return uid, utils.MakeCodedError(errOIDCEmailUnverified, http.StatusForbidden, CodeOIDCEmailUnverified)
+	}
+
+	user, err := q.GetUserByExactEmail(ctx, claims.Email)
+	if err == nil {
+		if !user.EmailVerified {
+			event := client.event(user.Uid, audit.IdentityLink, audit.Denied)
+			event.Detail = "email not confirmed"
+			audit.Record(ctx, event)
+			return uid, utils.MakeCodedError(errOIDCAccountConflict, http.StatusConflict, CodeOIDCAccountConflict)
+		}
+		sr := linkIdentity(ctx, q, issuer, claims, user.Uid)
+		if sr.ServiceErr == nil {
+			audit.Record(ctx, client.event(user.Uid, audit.IdentityLink, audit.Success))
+		}
+		return user.Uid, sr
+	}
+	if err != pgx.ErrNoRows {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return createOIDCBuyer(ctx, pool, issuer, claims, client)
+}
+
+// linkIdentity records the account a provider identity belongs to
+func linkIdentity(ctx context.Context, q *repository.Queries, issuer string, claims *oidc.Claims, uid pgtype.UUID) utils.ServiceReturn[any] {
+	err := q.InsertUserIdentity(ctx, repository.InsertUserIdentityParams{
+		Issuer:  issuer,
+		Subject: claims.Subject,
+		Uid:     uid,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return utils.MakeError(errOIDCIdentityConflict, http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	return utils.ServiceReturn[any]{}
+}
+
+// createOIDCBuyer signs a provider identity up as a buyer. The account has no password, one can be set
+// through a password reset, and its email counts as confirmed since the provider verified it.
+func createOIDCBuyer(ctx context.Context, pool db.Pool, issuer string, claims *oidc.Claims, client ClientInfo) (pgtype.UUID, utils.ServiceReturn[any]) {
+	var uid pgtype.UUID
+	if sr := checkEmailAllowed(ctx, pool, claims.Email, "buyer"); sr.ServiceErr != nil {
+		return uid, sr
+	}
+
+	q := repository.New(pool)
+	name, err := oidcBuyerName(ctx, q, claims)
+	if err != nil {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	uid, err = qtx.InsertUser(ctx, repository.InsertUserParams{Email: claims.Email})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return uid, utils.MakeError(errOIDCIdentityConflict, http.StatusConflict)
+		}
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if _, err = qtx.VerifyUserEmail(ctx, repository.VerifyUserEmailParams{Uid: uid, Email: claims.Email}); err != nil {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if err = qtx.InsertBuyer(ctx, repository.InsertBuyerParams{Name: name, Uid: uid}); err != nil {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if sr := linkIdentity(ctx, qtx, issuer, claims, uid); sr.ServiceErr != nil {
+		return uid, sr
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return uid, utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := client.event(uid, audit.IdentityLink, audit.Success)
+	event.Detail = "new account"
+	audit.Record(ctx, event)
+	return uid, utils.ServiceReturn[any]{}
+}
+
+// oidcBuyerName picks the buyer name of a new account, the provider's name for the user or their email's
+// local part, with the email added when another buyer already has the name
+func oidcBuyerName(ctx context.Context, q *repository.Queries, claims *oidc.Claims) (string, error) {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	taken, err := q.BuyerNameTaken(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		name = fmt.Sprintf("%s (%s)", name, claims.Email)
+	}
+	return name, nil
+}
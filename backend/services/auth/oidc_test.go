@@ -0,0 +1,426 @@
+package auth
+
+import (
+	"backend/internal/audit"
+	"backend/internal/oidc"
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	oidcRedirectURL = "http://localhost:5173/oidc/callback"
+	oidcVerifier    = "test-verifier-that-is-long-enough-for-pkce-0123"
+)
+
+// setupOIDC starts a mock identity provider and configures sign-in with it for the rest of the test
+func setupOIDC(t *testing.T) *it.MockOIDCProvider {
+	provider := it.NewMockOIDCProvider("dwa", "secret")
+	t.Cleanup(provider.Close)
+
+	var err error
+	OIDC, err = oidc.Discover(context.Background(), provider.Config(oidcRedirectURL), provider.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { OIDC = nil })
+	return provider
+}
+
+// oidcCallback logs in at the mock provider with the given ID token claims and mocks the stored login the
+// callback claims, returning the request the provider redirects back with
+func oidcCallback(t *testing.T, provider *it.MockOIDCProvider, mockPool *it.MockPool, claims jwt.MapClaims) OIDCCallbackRequest {
+	state, nonce, verifier := "test-state", "test-nonce", oidcVerifier
+	code, returnedState, err := provider.Authorize(OIDC.AuthURL(state, nonce, verifier), claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loginRow := &it.MockRow{}
+	it.SetupScanReturnArgs(loginRow, nil, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*string) = nonce
+		*args.Get(1).(*string) = verifier
+		*args.Get(2).(*pgtype.Timestamp) = pgtype.Timestamp{Time: time.Now().UTC().Add(time.Minute), Valid: true}
+	})
+	it.SetupPoolQueryRow(mockPool, loginRow, repository.ClaimOidcLogin, context.Background(), []any{hashing.HashToken(state)})
+
+	return OIDCCallbackRequest{Code: code, State: returnedState}
+}
+
+// userByEmailScan sets up the mock row to scan a "user" row with the given email confirmation state
+func userByEmailScan(mockRow *it.MockRow, uid pgtype.UUID, email string, verified bool) *mock.Call {
+	return it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+		*args.Get(0).(*pgtype.UUID) = uid
+		*args.Get(1).(*string) = email
+		*args.Get(4).(*bool) = verified
+	})
+}
+
+// buyerLoginScan sets up the rows read by getLoginInfo for a buyer
+func buyerLoginScan(mockPool *it.MockPool, ctx context.Context, uid pgtype.UUID, email string) {
+	buyerRow := &it.MockRow{}
+	it.UserScanExists(buyerRow).Run(func(args mock.Arguments) {
+		*args.Get(0).(*pgtype.UUID) = uid
+		*args.Get(1).(*string) = email
+		*args.Get(2).(*string) = "Test Buyer"
+	})
+	it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{email})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	provider := setupOIDC(t)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   provider.URL,
+			"aud":   "dwa",
+			"sub":   "subject",
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "nonce",
+			"email": "buyer@test.com",
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		token, _ := provider.Sign(valid())
+		claims, err := OIDC.Verify(ctx, token, "nonce")
+		assert.NoError(t, err)
+		assert.Equal(t, "subject", claims.Subject)
+		assert.Equal(t, "buyer@test.com", claims.Email)
+	})
+
+	cases := map[string]func(jwt.MapClaims){
+		"Wrong Issuer":     func(c jwt.MapClaims) { c["iss"] = "https://evil.test" },
+		"Wrong Audience":   func(c jwt.MapClaims) { c["aud"] = "another-client" },
+		"Other Party":      func(c jwt.MapClaims) { c["aud"] = []string{"dwa", "another-client"}; c["azp"] = "another-client" },
+		"Expired":          func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"No Expiry":        func(c jwt.MapClaims) { delete(c, "exp") },
+		"No Subject":       func(c jwt.MapClaims) { delete(c, "sub") },
+		"Nonce Mismatch":   func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"Nonce Missing":    func(c jwt.MapClaims) { delete(c, "nonce") },
+		"Issued In Future": func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+	}
+	for name, change := range cases {
+		t.Run(name, func(t *testing.T) {
+			claims := valid()
+			change(claims)
+			token, _ := provider.Sign(claims)
+			_, err := OIDC.Verify(ctx, token, "nonce")
+			assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+		})
+	}
+
+	t.Run("Unsigned", func(t *testing.T) {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		_, err := OIDC.Verify(ctx, token, "nonce")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+
+	t.Run("Other Key", func(t *testing.T) {
+		other := it.NewMockOIDCProvider("dwa", "secret")
+		defer other.Close()
+		token, _ := other.Sign(valid())
+		_, err := OIDC.Verify(ctx, token, "nonce")
+		assert.ErrorIs(t, err, oidc.ErrInvalidIDToken)
+	})
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	provider := it.NewMockOIDCProvider("dwa", "secret")
+	defer provider.Close()
+
+	cfg := provider.Config(oidcRedirectURL)
+	cfg.Issuer += "/"
+	_, err := oidc.Discover(context.Background(), cfg, provider.Client())
+	assert.ErrorContains(t, err, "does not match")
+}
+
+func TestStartOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Disabled", func(t *testing.T) {
+		result := StartOIDCLogin(ctx, &it.MockPool{})
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		setupOIDC(t)
+		mockPool := &it.MockPool{}
+
+		var stored repository.InsertOidcLoginParams
+		it.SetupPoolOnRet(mockPool, "Exec", repository.DeleteExpiredOidcLogins, ctx, nil, pgconn.CommandTag{}, nil)
+		mockPool.On("Exec", ctx, repository.InsertOidcLogin, mock.Anything).Return(pgconn.CommandTag{}, nil).Run(func(args mock.Arguments) {
+			extra := args.Get(2).([]any)
+			stored = repository.InsertOidcLoginParams{
+				StateHash:    extra[0].(string),
+				Nonce:        extra[1].(string),
+				CodeVerifier: extra[2].(string),
+			}
+		})
+
+		result := StartOIDCLogin(ctx, mockPool)
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		u, err := url.Parse(result.Data.(utils.JMap)["url"].(string))
+		assert.NoError(t, err)
+		query := u.Query()
+
+		// Only the state's hash is stored, the verifier never leaves the server
+		assert.Equal(t, hashing.HashToken(query.Get("state")), stored.StateHash)
+		assert.Equal(t, stored.Nonce, query.Get("nonce"))
+		assert.Equal(t, oidc.Challenge(stored.CodeVerifier), query.Get("code_challenge"))
+		assert.Equal(t, "S256", query.Get("code_challenge_method"))
+		assert.Empty(t, query.Get("code_verifier"))
+		assert.Equal(t, "openid email profile", query.Get("scope"))
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	provider := setupOIDC(t)
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	identity := []any{provider.URL, "mock-subject"}
+
+	recorder := &audit.MemoryRecorder{}
+	audit.Default = recorder
+	defer func() { audit.Default = &audit.MemoryRecorder{} }()
+
+	verified := jwt.MapClaims{"email": "buyer@test.com", "email_verified": true, "name": "Ama Mensah"}
+
+	t.Run("Unknown State", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		loginRow := &it.MockRow{}
+		it.SetupScanReturnArgs(loginRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, loginRow, repository.ClaimOidcLogin, ctx, []any{hashing.HashToken("forged")})
+
+		result := OIDCLogin(ctx, mockPool, OIDCCallbackRequest{Code: "code", State: "forged"}, ClientInfo{})
+
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		assert.Equal(t, errInvalidOIDCState, result.ServiceErr.Err)
+	})
+
+	t.Run("Expired State", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		loginRow := &it.MockRow{}
+		it.SetupScanReturnArgs(loginRow, nil, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(2).(*pgtype.Timestamp) = pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Minute), Valid: true}
+		})
+		it.SetupPoolQueryRow(mockPool, loginRow, repository.ClaimOidcLogin, ctx, []any{hashing.HashToken("old")})
+
+		result := OIDCLogin(ctx, mockPool, OIDCCallbackRequest{Code: "code", State: "old"}, ClientInfo{})
+
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Code Replayed", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, verified)
+
+		// The provider has already exchanged the code once
+		_, err := OIDC.Exchange(ctx, req.Code, oidcVerifier)
+		assert.NoError(t, err)
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{IP: "10.0.0.1"})
+
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		assert.Equal(t, errOIDCLoginFailed, result.ServiceErr.Err)
+		event, _ := recorder.Last(audit.Login)
+		assert.Equal(t, audit.Failure, event.Outcome)
+		assert.Equal(t, "oidc", event.Detail)
+	})
+
+	t.Run("Linked Identity", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, verified)
+
+		identityRow := &it.MockRow{}
+		it.SetupScanWithUUID(identityRow, testUid)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		it.SetupPoolOnRet(mockPool, "Exec", repository.TouchUserIdentity, ctx, []any{provider.URL, "mock-subject", "buyer@test.com"}, pgconn.CommandTag{}, nil)
+		setupSession(mockPool, ctx)
+		buyerLoginScan(mockPool, ctx, testUid, "user@test.com")
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		data := result.Data.(InfoWToken)
+		assert.Equal(t, testUid, data.Uid)
+		assert.NotEmpty(t, data.Token)
+		event, _ := recorder.Last(audit.Login)
+		assert.Equal(t, audit.Success, event.Outcome)
+		assert.Equal(t, "oidc", event.Detail)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Unverified Provider Email", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, jwt.MapClaims{"email": "buyer@test.com", "email_verified": false})
+
+		identityRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeOIDCEmailUnverified, result.ServiceErr.Code)
+	})
+
+	t.Run("Account Email Unconfirmed", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, verified)
+
+		identityRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		userByEmailScan(userRow, testUid, "buyer@test.com", false)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByExactEmail, ctx, []any{"buyer@test.com"})
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		// Whoever made the account may not own the email, linking it would hand them the provider's user
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		assert.Equal(t, CodeOIDCAccountConflict, result.ServiceErr.Code)
+		mockPool.AssertNotCalled(t, "Exec", ctx, repository.InsertUserIdentity, mock.Anything)
+		event, _ := recorder.Last(audit.IdentityLink)
+		assert.Equal(t, audit.Denied, event.Outcome)
+	})
+
+	t.Run("Links Existing Account", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, verified)
+
+		identityRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		userByEmailScan(userRow, testUid, "buyer@test.com", true)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByExactEmail, ctx, []any{"buyer@test.com"})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.InsertUserIdentity, ctx, []any{provider.URL, "mock-subject", testUid, "buyer@test.com"}, pgconn.CommandTag{}, nil)
+		setupSession(mockPool, ctx)
+		buyerLoginScan(mockPool, ctx, testUid, "user@test.com")
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		assert.Equal(t, testUid, result.Data.(InfoWToken).Uid)
+		event, _ := recorder.Last(audit.IdentityLink)
+		assert.Equal(t, audit.Success, event.Outcome)
+		assert.Equal(t, testUid, event.Uid)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Wildcards In Email Match Literally", func(t *testing.T) {
+		Domains = DomainPolicy{Rules: []DomainRule{{Domain: "ashesi.edu.gh"}}}
+		defer func() { Domains = DomainPolicy{} }()
+
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, jwt.MapClaims{"email": "j_doe%@test.com", "email_verified": true})
+
+		identityRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		exceptionRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		it.UserScanNotExists(userRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByExactEmail, ctx, []any{"j_doe%@test.com"})
+		it.UserScanNotExists(exceptionRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, exceptionRow, repository.GetEmailException, ctx, []any{"j_doe%@test.com"})
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		// An account like jxdoe@test.com is never looked up through a pattern, so it cannot be linked
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "QueryRow", ctx, repository.GetUserByEmail, mock.Anything)
+		mockPool.AssertNotCalled(t, "Exec", ctx, repository.InsertUserIdentity, mock.Anything)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Creates Buyer", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		req := oidcCallback(t, provider, mockPool, jwt.MapClaims{"email": "new@test.com", "email_verified": true, "name": "Ama Mensah"})
+
+		identityRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		takenRow := &it.MockRow{}
+		uidRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		it.UserScanNotExists(userRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByExactEmail, ctx, []any{"new@test.com"})
+		it.SetupScanReturnArgs(takenRow, nil, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*bool) = true
+		})
+		it.SetupPoolQueryRow(mockPool, takenRow, repository.BuyerNameTaken, ctx, []any{"Ama Mensah"})
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil).Once()
+		it.SetupScanWithUUID(uidRow, testUid)
+		it.SetupTxQueryRow(mockTx, uidRow, repository.InsertUser, ctx, []any{"new@test.com", ""})
+		it.SetupTxOnRet(mockTx, "Exec", repository.VerifyUserEmail, ctx, []any{testUid, "new@test.com"}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.InsertBuyer, ctx, []any{testUid, "Ama Mensah (new@test.com)"}, pgconn.CommandTag{}, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.InsertUserIdentity, ctx, []any{provider.URL, "mock-subject", testUid, "new@test.com"}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil)
+
+		setupSession(mockPool, ctx)
+		buyerLoginScan(mockPool, ctx, testUid, "user@test.com")
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		event, _ := recorder.Last(audit.IdentityLink)
+		assert.Equal(t, "new account", event.Detail)
+		mockPool.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("Creation Refused By Domain Policy", func(t *testing.T) {
+		Domains = DomainPolicy{Rules: []DomainRule{{Domain: "ashesi.edu.gh"}}}
+		defer func() { Domains = DomainPolicy{} }()
+
+		mockPool := &it.MockPool{}
+		req := oidcCallback(t, provider, mockPool, jwt.MapClaims{"email": "new@test.com", "email_verified": true})
+
+		identityRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		exceptionRow := &it.MockRow{}
+		it.SetupScanReturnArgs(identityRow, pgx.ErrNoRows, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, identityRow, repository.GetUserIdentity, ctx, identity)
+		it.UserScanNotExists(userRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByExactEmail, ctx, []any{"new@test.com"})
+		it.UserScanNotExists(exceptionRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, exceptionRow, repository.GetEmailException, ctx, []any{"new@test.com"})
+
+		result := OIDCLogin(ctx, mockPool, req, ClientInfo{})
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeEmailDomainNotAllowed, result.ServiceErr.Code)
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		OIDC = nil
+		result := OIDCLogin(ctx, &it.MockPool{}, OIDCCallbackRequest{Code: "code", State: "state"}, ClientInfo{})
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+		assert.True(t, errors.Is(result.ServiceErr.Err, errOIDCDisabled))
+	})
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"backend/internal/password"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Password rules, main loads them from the environment
+var (
+	PasswordPolicy                     = password.DefaultPolicy  // Length and strength required of new passwords
+	Breaches       password.BreachList = password.NoBreachList{} // Passwords known from data breaches, refused for new passwords
+)
+
+// checkPassword applies PasswordPolicy and the breach list to a new password. Problems are reported against
+// field as a validation.ValidationErrorList, like the struct validation errors. personal holds the
+// account's email and names.
+func checkPassword(ctx context.Context, field, newPassword string, personal ...string) utils.ServiceReturn[any] {
+	var problems []string
+	for _, problem := range PasswordPolicy.Check(newPassword, personal...) {
+		problems = append(problems, fmt.Sprintf("Field '%s' %s", field, problem))
+	}
+
+	breached, err := password.Breached(ctx, Breaches, newPassword)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if breached {
+		problems = append(problems, fmt.Sprintf("Field '%s' appears in a known data breach, choose another password", field))
+	}
+
+	if len(problems) > 0 {
+		return utils.MakeError(&validation.ValidationErrorList{Errors: problems}, http.StatusBadRequest)
+	}
+	return utils.ServiceReturn[any]{}
+}
+
+// accountNames returns the buyer and vendor names of an account, the names a new password may not contain
+func accountNames(ctx context.Context, q *repository.Queries, uid pgtype.UUID) ([]string, error) {
+	var names []string
+
+	buyer, err := q.GetBuyerById(ctx, uid)
+	if err == nil {
+		names = append(names, buyer.Name)
+	} else if err != pgx.ErrNoRows {
+		return nil, err
+	}
+
+	vendor, err := q.GetVendorById(ctx, uid)
+	if err == nil {
+		names = append(names, vendor.Name)
+	} else if err != pgx.ErrNoRows {
+		return nil, err
+	}
+	return names, nil
+}
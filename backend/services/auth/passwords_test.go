@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"backend/internal/password"
+	it "backend/internal/testing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// buyerProfileScan sets up the mock pool to find a buyer profile with the given name and no vendor profile
+func buyerProfileScan(mockPool *it.MockPool, uid pgtype.UUID, name string) {
+	buyerRow := &it.MockRow{}
+	vendorRow := &it.MockRow{}
+
+	it.SetupScanExists(buyerRow).Run(func(args mock.Arguments) {
+		*args.Get(2).(*string) = name
+	})
+	it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerById, context.Background(), []any{uid})
+	it.SetupScanReturnArgs(vendorRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	it.SetupPoolQueryRow(mockPool, vendorRow, repository.GetVendorById, context.Background(), []any{uid})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := password.DefaultPolicy
+
+	tests := []struct {
+		name     string
+		password string
+		problems int
+	}{
+		{"Strong", "kente weaving 2024", 0},
+		{"Too short", "aB3$", 1},
+		{"Too long", strings.Repeat("kente weaving 2024 ", 8), 1},
+		{"Only lower case letters", "password", 1},
+		{"Runs and repeats", "abcdefghijklmnopqrstu", 1},
+		{"Repeats the name", "ama-mensah-2024!", 1},
+		{"Repeats the email", "Kofi.Boateng_77", 1},
+		{"Repeats the email domain", "Ashesi-rocks-1!", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := policy.Check(tt.password, "kofi.boateng@ashesi.edu.gh", "Ama Mensah")
+			assert.Len(t, problems, tt.problems, "%v", problems)
+		})
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	ctx := context.Background()
+	prefix, suffix := password.HashRange("kente weaving 2024")
+	list, err := password.LoadList(strings.NewReader(fmt.Sprintf("%s%s:12\n", prefix, strings.ToLower(suffix))))
+	assert.Nil(t, err)
+
+	breached, err := password.Breached(ctx, list, "kente weaving 2024")
+	assert.Nil(t, err)
+	assert.True(t, breached)
+
+	breached, err = password.Breached(ctx, list, "kente weaving 2025")
+	assert.Nil(t, err)
+	assert.False(t, breached)
+
+	_, err = password.LoadList(strings.NewReader("not a hash\n"))
+	assert.Error(t, err)
+}
+
+func TestCheckPassword(t *testing.T) {
+	ctx := context.Background()
+	prefix, suffix := password.HashRange("kente weaving 2024")
+	list, _ := password.LoadList(strings.NewReader(prefix + suffix))
+	Breaches = list
+	defer func() {
+		Breaches = password.NoBreachList{}
+	}()
+
+	result := checkPassword(ctx, "Password", "kente weaving 2024", "new@test.com")
+
+	var errs *validation.ValidationErrorList
+	assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	assert.ErrorAs(t, result.ServiceErr.Err, &errs)
+	assert.Equal(t, []string{"Field 'Password' appears in a known data breach, choose another password"}, errs.Errors)
+
+	result = checkPassword(ctx, "Password", "adinkra symbols 1957", "new@test.com")
+	assert.Nil(t, result.ServiceErr)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// pgUniqueViolation is the Postgres error code for a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// ActivateVendorRequest holds the storefront details of an account opening a vendor profile
+type ActivateVendorRequest struct {
+	Name string `json:"name" validate:"required,max=255"`
+}
+
+// hasVendorProfile reports whether the user has a vendor profile
+func hasVendorProfile(ctx context.Context, pool db.Pool, uid pgtype.UUID) (bool, error) {
+	q := repository.New(pool)
+	_, err := q.GetVendorById(ctx, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ActivateVendor opens a vendor storefront on the caller's existing account so one email can both buy and sell.
+// It returns a new access token for the current session carrying the vendor role.
+func ActivateVendor(ctx context.Context, pool db.Pool, p principal.Principal, req ActivateVendorRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	// Only the account holder may add a profile, API keys may not
+	if sr := policy.Authorize(p, policy.UserUpdate, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	// The token may predate a profile change, so the account is read again
+	q := repository.New(pool)
+	acc, err := loadAccount(ctx, q, p.Uid)
+	if err != nil {
+		if err == ErrAccountSuspended {
+			return accountSuspended()
+		}
+		if err == ErrAccountDeleted {
+			return accountDeleted()
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if acc.HasRole(utils.VENDOR) {
+		return utils.MakeError(errors.New("account already has a vendor storefront"), http.StatusConflict)
+	}
+
+	// Selling is subject to the same domain policy as signing up as a vendor
+	if sr := checkEmailAllowed(ctx, pool, acc.Email, utils.StringifyUserType(utils.VENDOR)); sr.ServiceErr != nil {
+		return sr
+	}
+
+	err = q.InsertVendor(ctx, repository.InsertVendorParams{
+		Uid:  p.Uid,
+		Name: req.Name,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return utils.MakeError(errors.New("vendor name is already taken"), http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	account := acc.Principal
+	account.Roles = append(account.Roles, utils.StringifyUserType(utils.VENDOR))
+	account.SessionID = p.SessionID
+	account.MFA = p.MFA
+	token, err := signAccessToken(account)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := audit.By(p, audit.RoleGrant, audit.Success)
+	event.Detail = utils.StringifyUserType(utils.VENDOR)
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusCreated,
+		Data: utils.JMap{
+			"msg":   "Vendor storefront activated",
+			"token": token,
+			"roles": account.Roles,
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestActivateVendor(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	buyer := principal.Principal{
+		Uid:       testUid,
+		Email:     "student@ashesi.edu.gh",
+		Roles:     []string{"buyer"},
+		SessionID: pgtype.UUID{Bytes: [16]byte{9}, Valid: true},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		statusRow := &it.MockRow{}
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: buyer.Email, IsBuyer: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.InsertVendor, ctx, []any{testUid, "Kente Corner"}, pgconn.CommandTag{}, nil)
+
+		result := ActivateVendor(ctx, mockPool, buyer, ActivateVendorRequest{Name: "Kente Corner"})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusCreated, result.Status)
+		data := result.Data.(utils.JMap)
+		assert.Equal(t, []string{"buyer", "vendor"}, data["roles"])
+
+		// The new token for the same session can reach both buyer and vendor routes
+		claims := &principal.Claims{}
+		_, err := utils.ParseJWT(data["token"].(string), claims)
+		assert.NoError(t, err)
+		p, err := claims.Principal()
+		assert.NoError(t, err)
+		assert.True(t, p.HasRole(utils.BUYER))
+		assert.True(t, p.HasRole(utils.VENDOR))
+		assert.Equal(t, buyer.SessionID, p.SessionID)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Already a vendor", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		statusRow := &it.MockRow{}
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: buyer.Email, IsBuyer: true, IsVendor: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+
+		result := ActivateVendor(ctx, mockPool, buyer, ActivateVendorRequest{Name: "Kente Corner"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Name taken", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		statusRow := &it.MockRow{}
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: buyer.Email, IsBuyer: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.InsertVendor, ctx, []any{testUid, "Kente Corner"},
+			pgconn.CommandTag{}, &pgconn.PgError{Code: pgUniqueViolation})
+
+		result := ActivateVendor(ctx, mockPool, buyer, ActivateVendorRequest{Name: "Kente Corner"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+	})
+
+	t.Run("Vendor domain policy", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		statusRow := &it.MockRow{}
+
+		Domains = DomainPolicy{Rules: []DomainRule{{Domain: "ashesi.edu.gh", UserType: "buyer"}}}
+		defer func() {
+			Domains = DomainPolicy{}
+		}()
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: buyer.Email, IsBuyer: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+		exceptionRow := &it.MockRow{}
+		it.SetupScanReturnArgs(exceptionRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, exceptionRow, repository.GetEmailException, ctx, []any{buyer.Email})
+
+		result := ActivateVendor(ctx, mockPool, buyer, ActivateVendorRequest{Name: "Kente Corner"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		assert.Equal(t, CodeEmailDomainRole, result.ServiceErr.Code)
+		mockPool.AssertExpectations(t)
+	})
+}
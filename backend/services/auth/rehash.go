@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/logging"
+	"backend/repository"
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// rehashPassword replaces the user's stored hash with one from the current Hasher.
+// Failing only costs the upgrade, the old hash keeps working so the error is logged rather than returned.
+func rehashPassword(ctx context.Context, pool db.Pool, uid pgtype.UUID, password string) {
+	passhash, err := Hasher.Hash(password)
+	if err != nil {
+		logging.Errorf("Error rehashing password -> %v", err)
+		return
+	}
+
+	q := repository.New(pool)
+	err = q.UpdatePasshash(ctx, repository.UpdatePasshashParams{
+		Passhash: passhash,
+		Uid:      uid,
+	})
+	if err != nil {
+		logging.Errorf("Error storing rehashed password -> %v", err)
+		return
+	}
+	logging.Infof("Upgraded password hash for %v", uid)
+}
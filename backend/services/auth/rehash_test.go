@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"backend/config"
+	it "backend/internal/testing"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// cheapArgon2 keeps the tests fast
+var cheapArgon2 = config.Argon2{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHash(t *testing.T) {
+	hasher := hashing.Argon2idHash{Params: cheapArgon2}
+
+	hash, err := hasher.Hash("password")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	t.Run("Compare", func(t *testing.T) {
+		assert.True(t, hasher.Compare("password", hash))
+		assert.False(t, hasher.Compare("wrong", hash))
+		assert.False(t, hasher.Compare("password", "$argon2id$v=19$m=64,t=1,p=1$bad"))
+	})
+
+	t.Run("Salts differ", func(t *testing.T) {
+		other, err := hasher.Hash("password")
+		assert.NoError(t, err)
+		assert.NotEqual(t, hash, other)
+	})
+
+	t.Run("Compares bcrypt hashes", func(t *testing.T) {
+		bcrypt, err := hashing.BcryptHash{}.Hash("password")
+		assert.NoError(t, err)
+		assert.True(t, hasher.Compare("password", bcrypt))
+		assert.False(t, hasher.Compare("wrong", bcrypt))
+	})
+
+	t.Run("NeedsRehash", func(t *testing.T) {
+		stronger := cheapArgon2
+		stronger.Iterations = 2
+		bcrypt, _ := hashing.BcryptHash{}.Hash("password")
+
+		assert.False(t, hasher.NeedsRehash(hash))
+		assert.True(t, hashing.Argon2idHash{Params: stronger}.NeedsRehash(hash))
+		assert.True(t, hasher.NeedsRehash(bcrypt))
+		assert.False(t, hashing.BcryptHash{}.NeedsRehash(bcrypt))
+	})
+}
+
+func TestLoginRehash(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	bcrypt, err := hashing.BcryptHash{}.Hash("password")
+	assert.NoError(t, err)
+
+	Hasher = hashing.Argon2idHash{Params: cheapArgon2}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	mockPool := &it.MockPool{}
+	userRow := &it.MockRow{}
+	buyerRow := &it.MockRow{}
+
+	it.UserScanExists(userRow)
+	it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+	it.SetupScanReturnArgs(buyerRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testUid
+			*args.Get(3).(*string) = bcrypt
+		})
+	it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{"buyer@test.com"})
+
+	// The bcrypt hash is replaced with an Argon2id one
+	it.SetupMock(mockPool, "Exec", []any{ctx, repository.UpdatePasshash, mock.MatchedBy(func(args []any) bool {
+		hash, _ := args[0].(string)
+		return strings.HasPrefix(hash, "$argon2id$") && args[1] == testUid
+	})}, pgconn.CommandTag{}, nil)
+	setupSession(mockPool, ctx)
+
+	result := Login(ctx, mockPool, LoginUser{Email: "buyer@test.com", Password: "password"}, ClientInfo{})
+
+	if result.ServiceErr != nil {
+		t.Logf("%+v", result.ServiceErr.Err)
+	}
+	assert.Equal(t, http.StatusOK, result.Status)
+	mockPool.AssertExpectations(t)
+}
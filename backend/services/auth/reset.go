@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ResetRequest defines the fields needed to request a password reset
+type ResetRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetConfirm defines the fields needed to set a new password with a reset token
+type ResetConfirm struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"` // Checked against PasswordPolicy
+}
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// resetEmail builds the email carrying the reset link
+func resetEmail(email, token string) mail.Message {
+	link := fmt.Sprintf("%s/auth/reset?token=%s", AppURL, url.QueryEscape(token))
+
+	return mail.Message{
+		To:      email,
+		Subject: "Reset your Ashesi Dwa password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password for your Ashesi Dwa account.\n\n"+
+				"Follow this link within %v to choose a new password:\n%s\n\n"+
+				"If this wasn't you, you can ignore this email, your password has not changed.\n",
+			ResetTTL, link,
+		),
+	}
+}
+
+// RequestPasswordReset emails a single-use reset link to the account holder.
+// The response is the same whether or not the account exists so it cannot be used to discover accounts.
+func RequestPasswordReset(ctx context.Context, pool db.Pool, req ResetRequest, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	sent := utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "If an account exists for this email a reset link has been sent",
+		},
+	}
+
+	q := repository.New(pool)
+	user, err := q.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			logging.Infof("Password reset requested for unknown email")
+			return sent
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	token, err := hashing.GenerateToken()
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	// Only the most recently requested link stays valid
+	err = qtx.InvalidatePasswordResetsForUser(ctx, user.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	err = qtx.InsertPasswordReset(ctx, repository.InsertPasswordResetParams{
+		TokenHash: hashing.HashToken(token),
+		Uid:       user.Uid,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(ResetTTL), Valid: true},
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// A failed send answers like any other request, an error here would only happen for existing accounts
+	err = Mailer.Send(ctx, resetEmail(user.Email, token))
+	if err != nil {
+		logging.Errorf("Error sending password reset email -> %v", err)
+		event := client.event(user.Uid, audit.PasswordResetRequest, audit.Failure)
+		event.Detail = "email not sent"
+		audit.Record(ctx, event)
+		return sent
+	}
+
+	audit.Record(ctx, client.event(user.Uid, audit.PasswordResetRequest, audit.Success))
+	return sent
+}
+
+// ConfirmPasswordReset sets a new password using a reset token and signs the user out everywhere
+func ConfirmPasswordReset(ctx context.Context, pool db.Pool, req ResetConfirm, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	reset, err := q.GetPasswordReset(ctx, hashing.HashToken(req.Token))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errInvalidResetToken, http.StatusBadRequest)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if reset.UsedAt.Valid || time.Now().UTC().After(reset.ExpiresAt.Time) {
+		return utils.MakeError(errInvalidResetToken, http.StatusBadRequest)
+	}
+
+	// The token stays usable when the new password is refused
+	user, err := q.GetUserById(ctx, reset.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	names, err := accountNames(ctx, q, reset.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if sr := checkPassword(ctx, "Password", req.Password, append(names, user.Email)...); sr.ServiceErr != nil {
+		return sr
+	}
+
+	passhash, err := Hasher.Hash(req.Password)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	// Claim the token, a concurrent reset with the same token loses here
+	used, err := qtx.UsePasswordReset(ctx, reset.TokenHash)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if used == 0 {
+		return utils.MakeError(errInvalidResetToken, http.StatusBadRequest)
+	}
+
+	err = qtx.UpdatePasshash(ctx, repository.UpdatePasshashParams{
+		Passhash: passhash,
+		Uid:      reset.Uid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// Whoever knew the old password must not stay signed in
+	err = qtx.RevokeSessionsForUser(ctx, reset.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, client.event(reset.Uid, audit.PasswordReset, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Password reset",
+		},
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"backend/internal/audit"
+	"backend/internal/mail"
+	it "backend/internal/testing"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var originalMailer = Mailer
+
+// failingMailer refuses every message, like an unreachable mail server
+type failingMailer struct{}
+
+func (failingMailer) Send(ctx context.Context, msg mail.Message) error {
+	return errors.New("mail server unreachable")
+}
+
+// unknownEmailPool mocks a database holding no account for nobody@test.com
+func unknownEmailPool(ctx context.Context) *it.MockPool {
+	mockPool := &it.MockPool{}
+	mockRow := &it.MockRow{}
+	it.UserScanNotExists(mockRow, pgx.ErrNoRows)
+	it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"nobody@test.com"})
+	return mockPool
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	t.Run("Unknown email", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mailer := &mail.MemoryMailer{}
+		Mailer = mailer
+		defer func() {
+			Mailer = originalMailer
+		}()
+
+		it.UserScanNotExists(mockRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"nobody@test.com"})
+
+		result := RequestPasswordReset(ctx, mockPool, ResetRequest{Email: "nobody@test.com"}, ClientInfo{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		assert.Empty(t, mailer.Sent())
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Sends reset link", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+		mailer := &mail.MemoryMailer{}
+		Mailer = mailer
+		defer func() {
+			Mailer = originalMailer
+		}()
+
+		it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testUid
+			*args.Get(1).(*string) = "buyer@test.com"
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.InvalidatePasswordResetsForUser, ctx, []any{testUid}, pgconn.CommandTag{}, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.InsertPasswordReset, mock.Anything}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := RequestPasswordReset(ctx, mockPool, ResetRequest{Email: "buyer@test.com"}, ClientInfo{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		msg, ok := mailer.Last("buyer@test.com")
+		assert.True(t, ok)
+		assert.Contains(t, msg.Body, AppURL+"/auth/reset?token=")
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("Mail failure answers like an unknown email", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+		recorder := &audit.MemoryRecorder{}
+		Mailer = failingMailer{}
+		audit.Default = recorder
+		defer func() {
+			Mailer = originalMailer
+			audit.Default = &audit.MemoryRecorder{}
+		}()
+
+		it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testUid
+			*args.Get(1).(*string) = "buyer@test.com"
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.InvalidatePasswordResetsForUser, ctx, []any{testUid}, pgconn.CommandTag{}, nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.InsertPasswordReset, mock.Anything}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := RequestPasswordReset(ctx, mockPool, ResetRequest{Email: "buyer@test.com"}, ClientInfo{})
+		unknown := RequestPasswordReset(ctx, unknownEmailPool(ctx), ResetRequest{Email: "nobody@test.com"}, ClientInfo{})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, unknown, result)
+		event, ok := recorder.Last(audit.PasswordResetRequest)
+		assert.True(t, ok)
+		assert.Equal(t, audit.Failure, event.Outcome)
+	})
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	resetScan := func(mockRow *it.MockRow, reset repository.PasswordReset) {
+		it.SetupScanReturnArgs(mockRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				*args.Get(0).(*string) = reset.TokenHash
+				*args.Get(1).(*pgtype.UUID) = reset.Uid
+				*args.Get(2).(*pgtype.Timestamp) = reset.ExpiresAt
+				*args.Get(3).(*pgtype.Timestamp) = reset.UsedAt
+			})
+	}
+
+	Hasher = MockHasher{}
+	defer func() {
+		Hasher = originalHasher
+	}()
+
+	t.Run("Expired token", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		tokenHash := hashing.HashToken("expired")
+
+		resetScan(mockRow, repository.PasswordReset{
+			TokenHash: tokenHash,
+			Uid:       testUid,
+			ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetPasswordReset, ctx, []any{tokenHash})
+
+		result := ConfirmPasswordReset(ctx, mockPool, ResetConfirm{Token: "expired", Password: "new password"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Already used token", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		tokenHash := hashing.HashToken("used")
+
+		resetScan(mockRow, repository.PasswordReset{
+			TokenHash: tokenHash,
+			Uid:       testUid,
+			ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(time.Minute), Valid: true},
+			UsedAt:    pgtype.Timestamp{Time: time.Now().UTC(), Valid: true},
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetPasswordReset, ctx, []any{tokenHash})
+
+		result := ConfirmPasswordReset(ctx, mockPool, ResetConfirm{Token: "used", Password: "new password"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+		tokenHash := hashing.HashToken("valid")
+
+		resetScan(mockRow, repository.PasswordReset{
+			TokenHash: tokenHash,
+			Uid:       testUid,
+			ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(time.Minute), Valid: true},
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetPasswordReset, ctx, []any{tokenHash})
+		userByIdScan(userRow, testUid, "buyer@test.com")
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserById, ctx, []any{testUid})
+		buyerProfileScan(mockPool, testUid, "Test Buyer")
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.UsePasswordReset, ctx, []any{tokenHash}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.UpdatePasshash, ctx, []any{"hashed", testUid}, pgconn.CommandTag{}, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.RevokeSessionsForUser, ctx, []any{testUid}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := ConfirmPasswordReset(ctx, mockPool, ResetConfirm{Token: "valid", Password: "new password"}, ClientInfo{})
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockTx.AssertExpectations(t)
+	})
+}
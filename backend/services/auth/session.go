@@ -0,0 +1,389 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/keys"
+	"backend/internal/logging"
+	"backend/internal/policy"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// RefreshRequest carries a refresh token presented for rotation or logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// TokenPair is the short-lived access token and the refresh token used to renew it
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// signAccessToken creates a signed access token for the caller, bound to its session
+func signAccessToken(p principal.Principal) (string, error) {
+	return keys.Default.Sign(&principal.Claims{
+		Uid:   p.Uid,
+		Email: p.Email,
+		Roles: p.Roles,
+		Admin: p.Admin,
+		Sid:   p.SessionID,
+		MFA:   p.MFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTTL)),
+		},
+	})
+}
+
+// insertRefreshToken generates a new refresh token for the session and stores its hash
+func insertRefreshToken(ctx context.Context, q *repository.Queries, sid pgtype.UUID) (string, error) {
+	refreshToken, err := hashing.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = q.InsertRefreshToken(ctx, repository.InsertRefreshTokenParams{
+		TokenHash: hashing.HashToken(refreshToken),
+		Sid:       sid,
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().UTC().Add(RefreshTTL), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// maxUserAgentLen is the longest user agent stored with a session
+const maxUserAgentLen = 512
+
+// clientDetails returns the user agent and address stored with a session, nil when unknown
+func clientDetails(client ClientInfo) (userAgent, ip *string) {
+	if client.UserAgent != "" {
+		ua := client.UserAgent
+		if len(ua) > maxUserAgentLen {
+			ua = ua[:maxUserAgentLen]
+		}
+		userAgent = &ua
+	}
+	if client.IP != "" {
+		addr := client.IP
+		ip = &addr
+	}
+	return userAgent, ip
+}
+
+// startSession creates a new session for a caller read by loadAccount and issues its first token pair.
+// The session is marked as having passed a second factor when p.MFA is set and records the client it was started from.
+func startSession(ctx context.Context, pool db.Pool, p principal.Principal, client ClientInfo) (principal.Principal, TokenPair, error) {
+	q := repository.New(pool)
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return p, TokenPair{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	userAgent, ip := clientDetails(client)
+	p.SessionID, err = qtx.CreateSession(ctx, repository.CreateSessionParams{
+		Uid:       p.Uid,
+		Mfa:       p.MFA,
+		UserAgent: userAgent,
+		Ip:        ip,
+	})
+	if err != nil {
+		return p, TokenPair{}, err
+	}
+
+	refreshToken, err := insertRefreshToken(ctx, qtx, p.SessionID)
+	if err != nil {
+		return p, TokenPair{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return p, TokenPair{}, err
+	}
+
+	token, err := signAccessToken(p)
+	if err != nil {
+		return p, TokenPair{}, err
+	}
+
+	return p, TokenPair{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// getRefreshToken looks up a presented refresh token by its hash
+func getRefreshToken(ctx context.Context, pool db.Pool, refreshToken string) (repository.GetRefreshTokenRow, error) {
+	q := repository.New(pool)
+	row, err := q.GetRefreshToken(ctx, hashing.HashToken(refreshToken))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return row, errInvalidRefreshToken
+		}
+		return row, err
+	}
+	return row, nil
+}
+
+// revokeForReuse revokes the whole session after a refresh token was presented twice
+func revokeForReuse(ctx context.Context, pool db.Pool, row repository.GetRefreshTokenRow, client ClientInfo) utils.ServiceReturn[any] {
+	logging.Warnf("Refresh token reuse detected, revoking session %v", row.Sid)
+
+	q := repository.New(pool)
+	if err := q.RevokeSession(ctx, row.Sid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	audit.Record(ctx, client.event(row.Uid, audit.RefreshTokenReuse, audit.Denied))
+
+	return utils.MakeError(errors.New("refresh token reuse detected, session revoked"), http.StatusUnauthorized)
+}
+
+// Refresh rotates a refresh token, returning a new access token and refresh token for the same session.
+// Presenting an already used refresh token revokes the session it belongs to.
+func Refresh(ctx context.Context, pool db.Pool, req RefreshRequest, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	row, err := getRefreshToken(ctx, pool, req.RefreshToken)
+	if err != nil {
+		if err == errInvalidRefreshToken {
+			return utils.MakeError(err, http.StatusUnauthorized)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if row.RevokedAt.Valid {
+		return utils.MakeError(errors.New("session revoked"), http.StatusUnauthorized)
+	}
+
+	if row.UsedAt.Valid {
+		return revokeForReuse(ctx, pool, row, client)
+	}
+
+	if time.Now().UTC().After(row.ExpiresAt.Time) {
+		return utils.MakeError(errors.New("refresh token expired"), http.StatusUnauthorized)
+	}
+
+	// Roles are read again so a newly activated profile is picked up on the next refresh
+	q := repository.New(pool)
+	acc, err := loadAccount(ctx, q, row.Uid)
+	if err != nil {
+		if err == ErrAccountSuspended {
+			return accountSuspended()
+		}
+		if err == ErrAccountDeleted {
+			return accountDeleted()
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	p := acc.Principal
+	p.SessionID = row.Sid
+	p.MFA = row.Mfa
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := q.WithTx(tx)
+
+	// Mark the presented token as used, losing a race with a concurrent refresh counts as reuse
+	used, err := qtx.UseRefreshToken(ctx, row.TokenHash)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if used == 0 {
+		tx.Rollback(ctx)
+		return revokeForReuse(ctx, pool, row, client)
+	}
+
+	refreshToken, err := insertRefreshToken(ctx, qtx, row.Sid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// Refreshing is the last sign of activity the session list shows
+	if err = qtx.TouchSession(ctx, row.Sid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	token, err := signAccessToken(p)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   TokenPair{Token: token, RefreshToken: refreshToken},
+	}
+}
+
+// Logout revokes the session the refresh token belongs to, invalidating every token issued for it
+func Logout(ctx context.Context, pool db.Pool, req RefreshRequest, client ClientInfo) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	row, err := getRefreshToken(ctx, pool, req.RefreshToken)
+	if err != nil {
+		if err == errInvalidRefreshToken {
+			return utils.MakeError(err, http.StatusUnauthorized)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	q := repository.New(pool)
+	if err = q.RevokeSession(ctx, row.Sid); err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	audit.Record(ctx, client.event(row.Uid, audit.Logout, audit.Success))
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Logged out",
+		},
+	}
+}
+
+// SessionInfo describes an active session in the session list
+type SessionInfo struct {
+	repository.ListActiveSessionsRow
+	Current bool `json:"current"` // The session the request was made from
+}
+
+// ListSessions returns the caller's sessions that have not been revoked or expired, most recently used first
+func ListSessions(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.SessionManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	rows, err := q.ListActiveSessions(ctx, p.Uid)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	sessions := make([]SessionInfo, len(rows))
+	for i, row := range rows {
+		sessions[i] = SessionInfo{
+			ListActiveSessionsRow: row,
+			Current:               row.Sid == p.SessionID,
+		}
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   sessions,
+	}
+}
+
+// RevokeSession signs one of the caller's sessions out, revoking the current session logs the caller out
+func RevokeSession(ctx context.Context, pool db.Pool, p principal.Principal, sid pgtype.UUID) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.SessionManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	revoked, err := q.RevokeUserSession(ctx, repository.RevokeUserSessionParams{
+		Sid: sid,
+		Uid: p.Uid,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// Sessions of other users are reported as missing so their ids cannot be probed
+	if revoked == 0 {
+		return utils.MakeError(errors.New("session does not exist"), http.StatusNotFound)
+	}
+
+	event := audit.By(p, audit.SessionRevoke, audit.Success)
+	event.Detail = "session " + sid.String()
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Session revoked",
+		},
+	}
+}
+
+// RevokeOtherSessions signs the caller out everywhere except the session the request was made from
+func RevokeOtherSessions(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.SessionManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	revoked, err := q.RevokeOtherSessions(ctx, repository.RevokeOtherSessionsParams{
+		Uid: p.Uid,
+		Sid: p.SessionID,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	event := audit.By(p, audit.SessionRevoke, audit.Success)
+	event.Detail = fmt.Sprintf("%d other sessions", revoked)
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg":     "Other sessions revoked",
+			"revoked": revoked,
+		},
+	}
+}
+
+// securityEventLimit is how many of their most recent auth events users are shown
+const securityEventLimit = 50
+
+// ListSecurityEvents returns the caller's most recent logins, credential changes and other auth events,
+// newest first, so they can spot activity that was not theirs
+func ListSecurityEvents(ctx context.Context, pool db.Pool, p principal.Principal) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.SessionManage, policy.Resource{Owner: p.Uid}); sr.ServiceErr != nil {
+		return sr
+	}
+
+	q := repository.New(pool)
+	events, err := q.ListRecentAuthEvents(ctx, repository.ListRecentAuthEventsParams{
+		Uid:   p.Uid,
+		Limit: securityEventLimit,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   events,
+	}
+}
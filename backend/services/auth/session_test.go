@@ -0,0 +1,399 @@
+package auth
+
+import (
+	"backend/internal/keys"
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/internal/utils/hashing"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// refreshTokenScan sets up the mock row to scan the given refresh token row
+func refreshTokenScan(mockRow *it.MockRow, row repository.GetRefreshTokenRow) *mock.Call {
+	return it.SetupScanReturnArgs(mockRow, nil,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+	).Run(func(args mock.Arguments) {
+		*args.Get(0).(*string) = row.TokenHash
+		*args.Get(1).(*pgtype.UUID) = row.Sid
+		*args.Get(2).(*pgtype.Timestamp) = row.ExpiresAt
+		*args.Get(3).(*pgtype.Timestamp) = row.UsedAt
+		*args.Get(4).(*pgtype.UUID) = row.Uid
+		*args.Get(5).(*pgtype.Timestamp) = row.RevokedAt
+		*args.Get(6).(*bool) = row.Mfa
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	future := pgtype.Timestamp{Time: time.Now().UTC().Add(time.Hour), Valid: true}
+	past := pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Hour), Valid: true}
+
+	t.Run("Unknown token", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(mockRow, pgx.ErrNoRows,
+			mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetRefreshToken, ctx, []any{hashing.HashToken("unknown")})
+
+		result := Refresh(ctx, mockPool, RefreshRequest{RefreshToken: "unknown"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Reused token revokes session", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		tokenHash := hashing.HashToken("reused")
+
+		refreshTokenScan(mockRow, repository.GetRefreshTokenRow{
+			TokenHash: tokenHash,
+			Sid:       testSid,
+			ExpiresAt: future,
+			UsedAt:    past,
+			Uid:       testUid,
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetRefreshToken, ctx, []any{tokenHash})
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeSession, ctx, []any{testSid}, pgconn.CommandTag{}, nil)
+
+		result := Refresh(ctx, mockPool, RefreshRequest{RefreshToken: "reused"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		tokenHash := hashing.HashToken("expired")
+
+		refreshTokenScan(mockRow, repository.GetRefreshTokenRow{
+			TokenHash: tokenHash,
+			Sid:       testSid,
+			ExpiresAt: past,
+			Uid:       testUid,
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetRefreshToken, ctx, []any{tokenHash})
+
+		result := Refresh(ctx, mockPool, RefreshRequest{RefreshToken: "expired"}, ClientInfo{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusUnauthorized, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockTx := &it.MockTx{}
+		tokenRow := &it.MockRow{}
+		statusRow := &it.MockRow{}
+		tokenHash := hashing.HashToken("valid")
+
+		refreshTokenScan(tokenRow, repository.GetRefreshTokenRow{
+			TokenHash: tokenHash,
+			Sid:       testSid,
+			ExpiresAt: future,
+			Uid:       testUid,
+			Mfa:       true,
+		})
+		it.SetupPoolQueryRow(mockPool, tokenRow, repository.GetRefreshToken, ctx, []any{tokenHash})
+
+		statusScan(statusRow, repository.GetUserStatusRow{Email: "buyer@test.com", IsBuyer: true, IsVendor: true})
+		it.SetupPoolQueryRow(mockPool, statusRow, repository.GetUserStatus, ctx, []any{testUid})
+
+		mockPool.On("Begin", ctx).Return(mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.UseRefreshToken, ctx, []any{tokenHash}, pgconn.NewCommandTag("UPDATE 1"), nil)
+		it.SetupMock(mockTx, "Exec", []any{ctx, repository.InsertRefreshToken, mock.Anything}, pgconn.CommandTag{}, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.TouchSession, ctx, []any{testSid}, pgconn.CommandTag{}, nil)
+		mockTx.On("Commit", ctx).Return(nil)
+		mockTx.On("Rollback", ctx).Return(nil).Maybe()
+
+		result := Refresh(ctx, mockPool, RefreshRequest{RefreshToken: "valid"}, ClientInfo{})
+
+		if result.ServiceErr != nil {
+			t.Logf("%+v", result.ServiceErr.Err)
+		}
+		assert.Equal(t, http.StatusOK, result.Status)
+		tokens := result.Data.(TokenPair)
+		assert.NotEmpty(t, tokens.Token)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		assert.NotEqual(t, "valid", tokens.RefreshToken)
+
+		// Both profiles of the account are carried by the new access token
+		claims := &principal.Claims{}
+		_, err := utils.ParseJWT(tokens.Token, claims)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"buyer", "vendor"}, claims.Roles)
+		// A session started with a second factor keeps the mfa claim
+		assert.True(t, claims.MFA)
+		mockPool.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
+	})
+}
+
+func TestCheckSession(t *testing.T) {
+	ctx := context.Background()
+	mockPool := &it.MockPool{}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+
+	sessionScan := func(mockRow *it.MockRow, err error, revokedAt, suspendedAt pgtype.Timestamp) {
+		it.SetupScanReturnArgs(mockRow, err, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(1).(*pgtype.Timestamp) = revokedAt
+			*args.Get(2).(*pgtype.Timestamp) = suspendedAt
+		})
+	}
+	now := pgtype.Timestamp{Time: time.Now(), Valid: true}
+
+	t.Run("Active", func(t *testing.T) {
+		mockRow := &it.MockRow{}
+		sessionScan(mockRow, nil, pgtype.Timestamp{}, pgtype.Timestamp{})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetSessionStatus, ctx, []any{testSid})
+
+		assert.NoError(t, CheckSession(ctx, mockPool, testSid))
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		testSid = pgtype.UUID{Bytes: [16]byte{10}, Valid: true}
+		mockRow := &it.MockRow{}
+		sessionScan(mockRow, nil, now, pgtype.Timestamp{})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetSessionStatus, ctx, []any{testSid})
+
+		assert.ErrorIs(t, CheckSession(ctx, mockPool, testSid), ErrSessionRevoked)
+	})
+
+	t.Run("Unknown session", func(t *testing.T) {
+		testSid = pgtype.UUID{Bytes: [16]byte{11}, Valid: true}
+		mockRow := &it.MockRow{}
+		sessionScan(mockRow, pgx.ErrNoRows, pgtype.Timestamp{}, pgtype.Timestamp{})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetSessionStatus, ctx, []any{testSid})
+
+		assert.ErrorIs(t, CheckSession(ctx, mockPool, testSid), ErrSessionRevoked)
+	})
+
+	t.Run("Suspended user", func(t *testing.T) {
+		testSid = pgtype.UUID{Bytes: [16]byte{12}, Valid: true}
+		mockRow := &it.MockRow{}
+		sessionScan(mockRow, nil, pgtype.Timestamp{}, now)
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetSessionStatus, ctx, []any{testSid})
+
+		assert.ErrorIs(t, CheckSession(ctx, mockPool, testSid), ErrAccountSuspended)
+	})
+
+	t.Run("Database error", func(t *testing.T) {
+		testSid = pgtype.UUID{Bytes: [16]byte{13}, Valid: true}
+		mockRow := &it.MockRow{}
+		sessionScan(mockRow, errors.New("e"), pgtype.Timestamp{}, pgtype.Timestamp{})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetSessionStatus, ctx, []any{testSid})
+
+		err := CheckSession(ctx, mockPool, testSid)
+
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSessionRevoked)
+	})
+
+	mockPool.AssertExpectations(t)
+}
+
+func TestAccessTokenPrincipal(t *testing.T) {
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+
+	t.Run("Round trip", func(t *testing.T) {
+		token, err := signAccessToken(principal.Principal{
+			Uid:       testUid,
+			Email:     "vendor@test.com",
+			Roles:     []string{"vendor"},
+			SessionID: testSid,
+		})
+		assert.NoError(t, err)
+
+		claims := &principal.Claims{}
+		_, err = utils.ParseJWT("Bearer "+token, claims)
+		assert.NoError(t, err)
+
+		p, err := claims.Principal()
+		assert.NoError(t, err)
+		assert.Equal(t, principal.Principal{
+			Uid:       testUid,
+			Email:     "vendor@test.com",
+			Roles:     []string{"vendor"},
+			SessionID: testSid,
+		}, p)
+		assert.True(t, p.HasRole(utils.VENDOR))
+		assert.False(t, p.HasRole(utils.BUYER))
+		assert.True(t, p.HasScope("items:write"))
+	})
+
+	t.Run("Admin claim", func(t *testing.T) {
+		token, err := signAccessToken(principal.Principal{
+			Uid:       testUid,
+			Email:     "admin@test.com",
+			Roles:     []string{"buyer"},
+			Admin:     true,
+			SessionID: testSid,
+		})
+		assert.NoError(t, err)
+
+		claims := &principal.Claims{}
+		_, err = utils.ParseJWT(token, claims)
+		assert.NoError(t, err)
+
+		p, err := claims.Principal()
+		assert.NoError(t, err)
+		assert.True(t, p.Admin)
+	})
+
+	t.Run("Incomplete claims", func(t *testing.T) {
+		token, err := keys.Default.Sign(jwt.MapClaims{"uid": testUid, "userType": "vendor"})
+		assert.NoError(t, err)
+
+		claims := &principal.Claims{}
+		_, err = utils.ParseJWT(token, claims)
+		assert.NoError(t, err)
+
+		_, err = claims.Principal()
+		assert.Error(t, err)
+	})
+
+	t.Run("Unknown role", func(t *testing.T) {
+		claims := &principal.Claims{Uid: testUid, Sid: testSid, Roles: []string{"root"}}
+		_, err := claims.Principal()
+		assert.Error(t, err)
+	})
+}
+
+func TestListSessions(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	otherSid := pgtype.UUID{Bytes: [16]byte{10}, Valid: true}
+	user := principal.Principal{Uid: testUid, Roles: []string{"buyer"}, SessionID: testSid}
+
+	mockPool := &it.MockPool{}
+	mockRows := &it.MockRows{}
+
+	it.SetupPoolOnRet(mockPool, "Query", repository.ListActiveSessions, ctx, []any{testUid}, mockRows, nil)
+	it.SetupMock(mockRows, "Close", []any{}, nil)
+	it.SetupMock(mockRows, "Next", []any{}, true).Twice()
+	it.SetupMock(mockRows, "Next", []any{}, false).Once()
+	it.SetupMock(mockRows, "Err", []any{}, nil)
+	sids := []pgtype.UUID{otherSid, testSid}
+	it.SetupMock(mockRows, "Scan", []any{mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything}, nil).
+		Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = sids[0]
+			sids = sids[1:]
+		})
+
+	result := ListSessions(ctx, mockPool, user)
+
+	assert.Equal(t, http.StatusOK, result.Status)
+	sessions := result.Data.([]SessionInfo)
+	assert.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+	mockPool.AssertExpectations(t)
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+	otherSid := pgtype.UUID{Bytes: [16]byte{10}, Valid: true}
+	user := principal.Principal{Uid: testUid, Roles: []string{"buyer"}, SessionID: testSid}
+
+	t.Run("Other user's session", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeUserSession, ctx, []any{otherSid, testUid}, pgconn.NewCommandTag("UPDATE 0"), nil)
+
+		result := RevokeSession(ctx, mockPool, user, otherSid)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeUserSession, ctx, []any{otherSid, testUid}, pgconn.NewCommandTag("UPDATE 1"), nil)
+
+		result := RevokeSession(ctx, mockPool, user, otherSid)
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	testSid := pgtype.UUID{Bytes: [16]byte{9}, Valid: true}
+
+	t.Run("API key", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		key := principal.Principal{Uid: testUid, Roles: []string{"vendor"}, Scopes: []string{"items:read"}}
+
+		result := RevokeOtherSessions(ctx, mockPool, key)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		user := principal.Principal{Uid: testUid, Roles: []string{"buyer"}, SessionID: testSid}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.RevokeOtherSessions, ctx, []any{testUid, testSid}, pgconn.NewCommandTag("UPDATE 3"), nil)
+
+		result := RevokeOtherSessions(ctx, mockPool, user)
+
+		assert.Equal(t, http.StatusOK, result.Status)
+		assert.Equal(t, int64(3), result.Data.(utils.JMap)["revoked"])
+		mockPool.AssertExpectations(t)
+	})
+}
+
+func TestListSecurityEvents(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	t.Run("API keys cannot read the audit log", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		keyPrincipal := principal.Principal{Uid: testUid, Roles: []string{"vendor"}, Scopes: []string{"items:read"}}
+
+		result := ListSecurityEvents(ctx, mockPool, keyPrincipal)
+
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Lists the caller's events", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		user := principal.Principal{Uid: testUid, Roles: []string{"buyer"}, SessionID: testUid}
+
+		it.SetupPoolOnRet(mockPool, "Query", repository.ListRecentAuthEvents, ctx, []any{testUid, int32(securityEventLimit)}, emptyRows(), nil)
+
+		result := ListSecurityEvents(ctx, mockPool, user)
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		assert.Empty(t, result.Data)
+		mockPool.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/principal"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Error codes sent when a suspended or deleted user logs in or uses a token
+const (
+	CodeAccountSuspended = "account_suspended"
+	CodeAccountDeleted   = "account_deleted"
+)
+
+// Errors returned by CheckSession and startSession
+var (
+	ErrSessionRevoked   = errors.New("session revoked")
+	ErrAccountSuspended = errors.New("account suspended")
+	ErrAccountDeleted   = errors.New("account scheduled for deletion")
+)
+
+// accountSuspended is the response for a suspended user
+func accountSuspended() utils.ServiceReturn[any] {
+	return utils.MakeCodedError(ErrAccountSuspended, http.StatusForbidden, CodeAccountSuspended)
+}
+
+// accountDeleted is the response for a user whose account is scheduled for deletion
+func accountDeleted() utils.ServiceReturn[any] {
+	return utils.MakeCodedError(ErrAccountDeleted, http.StatusForbidden, CodeAccountDeleted)
+}
+
+// account is a caller read from the database along with the account state tokens do not carry
+type account struct {
+	principal.Principal
+	MFAEnabled bool // A TOTP authenticator is enrolled, logging in takes a second factor
+}
+
+// loadAccount returns the caller a token is issued to, with its roles and admin flag read from the database.
+// It returns ErrAccountSuspended when the account is suspended and ErrAccountDeleted when it is scheduled for deletion.
+func loadAccount(ctx context.Context, q *repository.Queries, uid pgtype.UUID) (account, error) {
+	status, err := q.GetUserStatus(ctx, uid)
+	if err != nil {
+		return account{}, err
+	}
+	if status.SuspendedAt.Valid {
+		return account{}, ErrAccountSuspended
+	}
+	if status.IsDeleted {
+		return account{}, ErrAccountDeleted
+	}
+
+	var roles []string
+	if status.IsBuyer {
+		roles = append(roles, utils.StringifyUserType(utils.BUYER))
+	}
+	if status.IsVendor {
+		roles = append(roles, utils.StringifyUserType(utils.VENDOR))
+	}
+
+	return account{
+		Principal: principal.Principal{
+			Uid:   uid,
+			Email: status.Email,
+			Roles: roles,
+			Admin: status.Isadmin != nil && *status.Isadmin,
+		},
+		MFAEnabled: status.MfaEnabled,
+	}, nil
+}
+
+// CheckSession returns nil when the session exists, has not been revoked and belongs to a user who is not
+// suspended. It returns ErrSessionRevoked or ErrAccountSuspended otherwise.
+func CheckSession(ctx context.Context, pool db.Pool, sid pgtype.UUID) error {
+	q := repository.New(pool)
+	status, err := q.GetSessionStatus(ctx, sid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	if status.RevokedAt.Valid {
+		return ErrSessionRevoked
+	}
+	if status.SuspendedAt.Valid {
+		return ErrAccountSuspended
+	}
+	return nil
+}
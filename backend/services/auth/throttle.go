@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/audit"
+	"backend/internal/logging"
+	"backend/internal/throttle"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Error codes returned by Login
+const (
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeTooManyAttempts    = "too_many_attempts"
+)
+
+// ClientInfo describes the client a request came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// event starts an audit event about the account uid caused from this client
+func (c ClientInfo) event(uid pgtype.UUID, eventType, outcome string) audit.Event {
+	return audit.Event{
+		Uid:       uid,
+		Actor:     uid,
+		Type:      eventType,
+		Outcome:   outcome,
+		IP:        c.IP,
+		UserAgent: c.UserAgent,
+	}
+}
+
+// Default lockout policies, an address is given more room than an account since many users can share it
+var (
+	AccountPolicy = throttle.Policy{Threshold: 5, BaseDelay: time.Second * 30, MaxDelay: time.Hour, Window: time.Hour * 24}
+	IPPolicy      = throttle.Policy{Threshold: 20, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour * 24}
+)
+
+// Throttlers for failed logins, main replaces these with Postgres backed ones shared by every instance
+var (
+	AccountThrottle throttle.Throttler = &throttle.MemoryThrottler{Policy: AccountPolicy}
+	IPThrottle      throttle.Throttler = &throttle.MemoryThrottler{Policy: IPPolicy}
+)
+
+// dummyHash returns a hash made by the configured Hasher, it is compared against when the account
+// does not exist so both failures take as long. Hasher is expected to be set before the first login.
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := Hasher.Hash("dwa-dummy-password")
+	if err != nil {
+		logging.Errorf("Error creating dummy hash -> %v", err)
+	}
+	return hash
+})
+
+// accountSubject and ipSubject name the throttling subjects for an email and a client address
+func accountSubject(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// invalidCredentials is the single response for an unknown email or a wrong password
+func invalidCredentials() utils.ServiceReturn[any] {
+	return utils.ServiceReturn[any]{
+		Status: http.StatusUnauthorized,
+		Data: utils.JMap{
+			"err":  "Invalid email or password",
+			"code": CodeInvalidCredentials,
+		},
+	}
+}
+
+// tooManyAttempts is the response for a locked out account or address
+func tooManyAttempts(wait time.Duration) utils.ServiceReturn[any] {
+	return utils.MakeCodedError(
+		fmt.Errorf("too many failed login attempts, try again in %v", wait.Round(time.Second)),
+		http.StatusTooManyRequests,
+		CodeTooManyAttempts,
+	)
+}
+
+// checkLockout returns how long the account or client must still wait before trying to log in
+func checkLockout(ctx context.Context, email string, client ClientInfo) (time.Duration, error) {
+	wait, err := AccountThrottle.Check(ctx, accountSubject(email))
+	if err != nil {
+		return 0, err
+	}
+
+	if client.IP != "" {
+		ipWait, err := IPThrottle.Check(ctx, ipSubject(client.IP))
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, ipWait)
+	}
+	return wait, nil
+}
+
+// recordFailedLogin counts a failed login against the account and the client address
+func recordFailedLogin(ctx context.Context, email string, client ClientInfo) error {
+	lockout, err := AccountThrottle.Fail(ctx, accountSubject(email))
+	if err != nil {
+		return err
+	}
+	if lockout > 0 {
+		logging.Infof("Locked out account for %v", lockout)
+	}
+
+	if client.IP == "" {
+		return nil
+	}
+
+	lockout, err = IPThrottle.Fail(ctx, ipSubject(client.IP))
+	if err != nil {
+		return err
+	}
+	if lockout > 0 {
+		logging.Infof("Locked out address %s for %v", client.IP, lockout)
+	}
+	return nil
+}
+
+// UnlockRequest names the account or client address an admin wants to unlock
+type UnlockRequest struct {
+	Email string `json:"email" validate:"required_without=IP,omitempty,email"`
+	IP    string `json:"ip" validate:"required_without=Email,omitempty,ip"`
+}
+
+// Unlock lifts the login lockout of an account and/or client address and clears its failed attempts
+func Unlock(ctx context.Context, pool db.Pool, adminUid pgtype.UUID, req UnlockRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	event := audit.Event{Actor: adminUid, Type: audit.LoginUnlock, Outcome: audit.Success, Email: req.Email}
+	if req.IP != "" {
+		event.Detail = "ip " + req.IP
+	}
+
+	if req.Email != "" {
+		q := repository.New(pool)
+		user, err := q.GetUserByEmail(ctx, req.Email)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return utils.MakeError(errors.New("user does not exist"), http.StatusNotFound)
+			}
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+
+		if err = AccountThrottle.Reset(ctx, accountSubject(req.Email)); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		event.Uid = user.Uid
+	}
+
+	if req.IP != "" {
+		if err = IPThrottle.Reset(ctx, ipSubject(req.IP)); err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+	}
+
+	audit.Record(ctx, event)
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Login unlocked",
+		},
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	it "backend/internal/testing"
+	"backend/internal/throttle"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := throttle.Policy{Threshold: 3, BaseDelay: time.Second * 30, MaxDelay: time.Minute * 5}
+
+	tests := []struct {
+		failures int
+		lockout  time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second * 30},
+		{4, time.Minute},
+		{5, time.Minute * 2},
+		{7, time.Minute * 5},
+		{100, time.Minute * 5},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.lockout, policy.Lockout(tt.failures), "failures: %d", tt.failures)
+	}
+}
+
+func TestMemoryThrottler(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	throttler := &throttle.MemoryThrottler{
+		Policy: throttle.Policy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour},
+		Now:    func() time.Time { return now },
+	}
+
+	lockout, _ := throttler.Fail(ctx, "subject")
+	assert.Zero(t, lockout)
+	lockout, _ = throttler.Fail(ctx, "subject")
+	assert.Equal(t, time.Minute, lockout)
+
+	wait, _ := throttler.Check(ctx, "subject")
+	assert.Equal(t, time.Minute, wait)
+
+	// The lockout runs out
+	now = now.Add(time.Minute)
+	wait, _ = throttler.Check(ctx, "subject")
+	assert.Zero(t, wait)
+
+	// Failures outside the window are forgotten
+	now = now.Add(time.Hour * 2)
+	lockout, _ = throttler.Fail(ctx, "subject")
+	assert.Zero(t, lockout)
+
+	throttler.Fail(ctx, "subject")
+	throttler.Reset(ctx, "subject")
+	wait, _ = throttler.Check(ctx, "subject")
+	assert.Zero(t, wait)
+}
+
+func TestLoginThrottling(t *testing.T) {
+	ctx := context.Background()
+	client := ClientInfo{IP: "10.0.0.1"}
+
+	Hasher = MockHasher{}
+	AccountThrottle = &throttle.MemoryThrottler{Policy: throttle.Policy{Threshold: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}}
+	IPThrottle = &throttle.MemoryThrottler{Policy: IPPolicy}
+	defer func() {
+		Hasher = originalHasher
+		AccountThrottle = &throttle.MemoryThrottler{Policy: AccountPolicy}
+		IPThrottle = &throttle.MemoryThrottler{Policy: IPPolicy}
+	}()
+
+	t.Run("Unknown email looks like a wrong password", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		unknownRow := &it.MockRow{}
+		userRow := &it.MockRow{}
+		buyerRow := &it.MockRow{}
+
+		it.UserScanNotExists(unknownRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, unknownRow, repository.GetUserByEmail, ctx, []any{"nobody@test.com"})
+		it.UserScanExists(userRow)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+		it.SetupScanExists(buyerRow)
+		it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{"buyer@test.com"})
+
+		unknown := Login(ctx, mockPool, LoginUser{Email: "nobody@test.com", Password: "correct"}, client)
+		wrong := Login(ctx, mockPool, LoginUser{Email: "buyer@test.com", Password: "wrong"}, client)
+
+		assert.Equal(t, http.StatusUnauthorized, unknown.Status)
+		assert.Equal(t, unknown, wrong)
+	})
+
+	t.Run("Account locks after repeated failures", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+		buyerRow := &it.MockRow{}
+
+		it.UserScanExists(userRow)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+		it.SetupScanExists(buyerRow)
+		it.SetupPoolQueryRow(mockPool, buyerRow, repository.GetBuyerByEmail, ctx, []any{"buyer@test.com"})
+
+		// The previous test already failed once for this account
+		result := Login(ctx, mockPool, LoginUser{Email: "buyer@test.com", Password: "wrong"}, client)
+		assert.Equal(t, http.StatusUnauthorized, result.Status)
+
+		// Even the right password is refused while locked
+		result = Login(ctx, mockPool, LoginUser{Email: "BUYER@test.com", Password: "correct"}, client)
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusTooManyRequests, result.ServiceErr.Status)
+		assert.Equal(t, CodeTooManyAttempts, result.ServiceErr.Code)
+	})
+
+	t.Run("Admin unlock", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		userRow := &it.MockRow{}
+
+		it.SetupScanReturnArgs(userRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		it.SetupPoolQueryRow(mockPool, userRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+
+		result := Unlock(ctx, mockPool, pgtype.UUID{}, UnlockRequest{Email: "buyer@test.com"})
+		assert.Equal(t, http.StatusOK, result.Status)
+
+		wait, err := checkLockout(ctx, "buyer@test.com", client)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	})
+
+	t.Run("Unlock needs an email or address", func(t *testing.T) {
+		result := Unlock(ctx, &it.MockPool{}, pgtype.UUID{}, UnlockRequest{})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"backend/db"
+	"backend/internal/keys"
+	"backend/internal/logging"
+	"backend/internal/mail"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// VerifyEmailRequest carries the confirmation token from an emailed link
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest defines the fields needed to resend a confirmation link
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// verifyPurpose marks confirmation tokens so they cannot be used as access tokens and vice versa
+const verifyPurpose = "verify_email"
+
+var errInvalidVerifyToken = errors.New("invalid or expired confirmation link")
+
+// signVerificationToken creates a signed token confirming ownership of email for the user.
+// The email is part of the token so links sent to a previous address stop working after a change.
+func signVerificationToken(uid pgtype.UUID, email string) (string, error) {
+	return keys.Default.Sign(jwt.MapClaims{
+		"uid":     uid,
+		"email":   email,
+		"purpose": verifyPurpose,
+		"exp":     time.Now().Add(VerifyTTL).Unix(),
+	})
+}
+
+// verificationEmail builds the email carrying the confirmation link
+func verificationEmail(email, token string) mail.Message {
+	link := fmt.Sprintf("%s/auth/verify?token=%s", AppURL, url.QueryEscape(token))
+
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your Ashesi Dwa email",
+		Body: fmt.Sprintf(
+			"Welcome to Ashesi Dwa!\n\n"+
+				"Follow this link within %v to confirm this is your email address:\n%s\n\n"+
+				"If you did not create an account you can ignore this email.\n",
+			VerifyTTL, link,
+		),
+	}
+}
+
+// sendVerification emails a confirmation link for the user's address
+func sendVerification(ctx context.Context, uid pgtype.UUID, email string) error {
+	token, err := signVerificationToken(uid, email)
+	if err != nil {
+		return err
+	}
+
+	return Mailer.Send(ctx, verificationEmail(email, token))
+}
+
+// ConfirmEmail marks the user's email as verified using the token from a confirmation link
+func ConfirmEmail(ctx context.Context, pool db.Pool, req VerifyEmailRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(req.Token, claims, keys.Default.Keyfunc, jwt.WithValidMethods(keys.Methods))
+	if err != nil {
+		logging.Infof("Invalid confirmation token -> %v", err)
+		return utils.MakeError(errInvalidVerifyToken, http.StatusBadRequest)
+	}
+
+	purpose, _ := claims["purpose"].(string)
+	uidStr, _ := claims["uid"].(string)
+	email, _ := claims["email"].(string)
+	if purpose != verifyPurpose || email == "" {
+		return utils.MakeError(errInvalidVerifyToken, http.StatusBadRequest)
+	}
+
+	uid, err := utils.ParseUUID(uidStr)
+	if err != nil {
+		return utils.MakeError(errInvalidVerifyToken, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	verified, err := q.VerifyUserEmail(ctx, repository.VerifyUserEmailParams{
+		Uid:   uid,
+		Email: email,
+	})
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	// No row matched, the account is gone or its email changed after the link was sent
+	if verified == 0 {
+		return utils.MakeError(errInvalidVerifyToken, http.StatusBadRequest)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Email verified",
+		},
+	}
+}
+
+// ResendVerification emails a fresh confirmation link to an unverified account.
+// The response is the same whether or not the account exists.
+func ResendVerification(ctx context.Context, pool db.Pool, req ResendVerificationRequest) utils.ServiceReturn[any] {
+	err := validation.ValidateStruct(req)
+	if err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	sent := utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "If an unverified account exists for this email a confirmation link has been sent",
+		},
+	}
+
+	q := repository.New(pool)
+	user, err := q.GetUserByEmail(ctx, req.Email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return sent
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if user.EmailVerified {
+		return sent
+	}
+
+	// A failed send answers like any other request, an error here would only happen for unverified accounts
+	if err = sendVerification(ctx, user.Uid, user.Email); err != nil {
+		logging.Errorf("Error sending verification email -> %v", err)
+		return sent
+	}
+
+	return sent
+}
+
+// IsEmailVerified reports whether the user has confirmed ownership of their email
+func IsEmailVerified(ctx context.Context, pool db.Pool, uid pgtype.UUID) (bool, error) {
+	q := repository.New(pool)
+	user, err := q.GetUserById(ctx, uid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
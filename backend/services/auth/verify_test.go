@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"backend/internal/principal"
+	it "backend/internal/testing"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestConfirmEmail(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		token, err := signVerificationToken(testUid, "buyer@test.com")
+		assert.NoError(t, err)
+
+		it.SetupPoolOnRet(mockPool, "Exec", repository.VerifyUserEmail, ctx, []any{testUid, "buyer@test.com"}, pgconn.NewCommandTag("UPDATE 1"), nil)
+
+		result := ConfirmEmail(ctx, mockPool, VerifyEmailRequest{Token: token})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Email changed since link was sent", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		token, err := signVerificationToken(testUid, "old@test.com")
+		assert.NoError(t, err)
+
+		it.SetupPoolOnRet(mockPool, "Exec", repository.VerifyUserEmail, ctx, []any{testUid, "old@test.com"}, pgconn.NewCommandTag("UPDATE 0"), nil)
+
+		result := ConfirmEmail(ctx, mockPool, VerifyEmailRequest{Token: token})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Access token rejected", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		token, err := signAccessToken(principal.Principal{
+			Uid:       testUid,
+			Email:     "buyer@test.com",
+			Roles:     []string{"buyer"},
+			SessionID: pgtype.UUID{Bytes: [16]byte{9}, Valid: true},
+		})
+		assert.NoError(t, err)
+
+		result := ConfirmEmail(ctx, mockPool, VerifyEmailRequest{Token: token})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Tampered token", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+
+		result := ConfirmEmail(ctx, mockPool, VerifyEmailRequest{Token: "not.a.token"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	ctx := context.Background()
+	testUid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	unknown := ResendVerification(ctx, unknownEmailPool(ctx), ResendVerificationRequest{Email: "nobody@test.com"})
+
+	t.Run("Mail failure answers like an unknown email", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRow := &it.MockRow{}
+		Mailer = failingMailer{}
+		defer func() {
+			Mailer = originalMailer
+		}()
+
+		it.UserScanExists(mockRow).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testUid
+			*args.Get(1).(*string) = "buyer@test.com"
+		})
+		it.SetupPoolQueryRow(mockPool, mockRow, repository.GetUserByEmail, ctx, []any{"buyer@test.com"})
+
+		result := ResendVerification(ctx, mockPool, ResendVerificationRequest{Email: "buyer@test.com"})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, unknown, result)
+		mockPool.AssertExpectations(t)
+	})
+}
@@ -3,8 +3,11 @@ package cart
 import (
 	"backend/db"
 	"backend/internal/logging"
+	"backend/internal/policy"
+	"backend/internal/principal"
 	"backend/internal/utils"
 	"backend/repository"
+	"backend/services/vendor"
 	"context"
 	"errors"
 	"net/http"
@@ -29,12 +32,32 @@ func IsItemInCart(q *repository.Queries, ctx context.Context, args repository.Ge
 }
 
 // AddToCart adds a new item to the buyer's cart if it's not already in the cart.
+// Items with variants are added as one of them, each variant being its own cart line.
 // Returns an error if the item is already in the cart or if any database operation fails.
-func AddToCart(ctx context.Context, pool db.Pool, addToCartObj repository.AddToCartParams) utils.ServiceReturn[any] {
+func AddToCart(ctx context.Context, pool db.Pool, p principal.Principal, addToCartObj repository.AddToCartParams) utils.ServiceReturn[any] {
+	// Buyers can only add to their own cart
+	if sr := policy.Authorize(p, policy.CartWrite, policy.Resource{Owner: addToCartObj.Bid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	q := repository.New(pool)
 
+	// Items hidden by moderation or account deletion cannot be added
+	if _, err := q.GetVisibleItemById(ctx, addToCartObj.Iid); err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errors.New("item not found"), http.StatusNotFound)
+		}
+		logging.Errorf("There was an error fetching the item")
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	if _, sr := vendor.VariantOf(ctx, q, addToCartObj.Iid, addToCartObj.Vrid); sr.ServiceErr != nil {
+		logging.Errorf("There was an error checking the variant of the item")
+		return sr
+	}
+
 	getCartItemArgs := repository.GetCartItemParams{
-		Bid: addToCartObj.Bid, Iid: addToCartObj.Iid, Vid: addToCartObj.Vid,
+		Bid: addToCartObj.Bid, Iid: addToCartObj.Iid, Vid: addToCartObj.Vid, Vrid: addToCartObj.Vrid,
 	}
 
 	itemInCart, err := IsItemInCart(q, ctx, getCartItemArgs)
@@ -66,7 +89,11 @@ func AddToCart(ctx context.Context, pool db.Pool, addToCartObj repository.AddToC
 }
 // RemoveFromCart deletes an item from the buyer's cart.
 // Returns an error if the item does not exist or if deletion fails.
-func RemoveFromCart(ctx context.Context, pool db.Pool, args repository.DeleteCartItemParams) utils.ServiceReturn[any] {
+func RemoveFromCart(ctx context.Context, pool db.Pool, p principal.Principal, args repository.DeleteCartItemParams) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.CartWrite, policy.Resource{Owner: args.Bid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	q := repository.New(pool)
 
 	getCartItemArgs := repository.GetCartItemParams(args)
@@ -98,11 +125,15 @@ func RemoveFromCart(ctx context.Context, pool db.Pool, args repository.DeleteCar
 
 // UpdateCartItemQuantity changes the quantity of an item already present in the cart.
 // Returns an error if the item doesn't exist or if the update operation fails.
-func UpdateCartItemQuantity(ctx context.Context, pool db.Pool, args repository.UpdateQuantityOfCartItemParams) utils.ServiceReturn[any] {
+func UpdateCartItemQuantity(ctx context.Context, pool db.Pool, p principal.Principal, args repository.UpdateQuantityOfCartItemParams) utils.ServiceReturn[any] {
+	if sr := policy.Authorize(p, policy.CartWrite, policy.Resource{Owner: args.Bid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	q := repository.New(pool)
 
 	getCartItemArgs := repository.GetCartItemParams{
-		Bid: args.Bid, Iid: args.Iid, Vid: args.Vid,
+		Bid: args.Bid, Iid: args.Iid, Vid: args.Vid, Vrid: args.Vrid,
 	}
 
 	itemInCart, err := IsItemInCart(q, ctx, getCartItemArgs)
@@ -141,11 +172,10 @@ func GetCartItemsForBuyer(ctx context.Context, pool db.Pool, bid pgtype.UUID) ut
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
 
+	// A cart is small enough to send whole, as a single page in the same envelope as other listings
 	return utils.ServiceReturn[any]{
 		Status: http.StatusOK,
-		Data: utils.JMap{
-			"items": cartItems,
-		},
+		Data:   utils.Page[repository.GetCartItemsForBuyerRow]{Key: "items", Items: cartItems},
 	}
 }
 
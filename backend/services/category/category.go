@@ -0,0 +1,240 @@
+// Package category holds the item categories, which admins arrange in a tree and buyers browse
+package category
+
+import (
+	"backend/db"
+	"backend/internal/utils"
+	"backend/internal/utils/validation"
+	"backend/repository"
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
+
+// slugPattern is what the category table accepts as a slug, lowercase words joined by single dashes
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var (
+	errInvalidSlug   = errors.New("slug must be lowercase letters and digits joined by dashes")
+	errNoParent      = errors.New("parent category does not exist")
+	errCycle         = errors.New("a category cannot be moved under itself or its subcategories")
+	errNotFound      = errors.New("category does not exist")
+	errSlugTaken     = errors.New("a category with the same slug already exists")
+	errCategoryInUse = errors.New("category still has items or subcategories")
+)
+
+// Category defines the fields admins give to create or change a category
+type Category struct {
+	ParentCid pgtype.UUID `json:"parent_cid"` // null for a top level category
+	Name      string      `json:"name" validate:"required,max=100"`
+	Slug      string      `json:"slug" validate:"required,max=100"`
+	Position  int32       `json:"position" validate:"min=0"` // Order among its siblings, then by name
+	Active    *bool       `json:"active"`                    // true when not given
+}
+
+// Node is a category along with the categories directly under it
+type Node struct {
+	repository.Category
+	Children []Node `json:"children"`
+}
+
+// tree arranges categories, already in display order, under their parents. With activeOnly, inactive
+// categories are left out along with everything under them.
+func tree(categories []repository.Category, activeOnly bool) []Node {
+	children := make(map[pgtype.UUID][]repository.Category)
+	for _, c := range categories {
+		if activeOnly && !c.Active {
+			continue
+		}
+		children[c.ParentCid] = append(children[c.ParentCid], c)
+	}
+
+	var build func(parent pgtype.UUID) []Node
+	build = func(parent pgtype.UUID) []Node {
+		nodes := make([]Node, 0, len(children[parent]))
+		for _, c := range children[parent] {
+			nodes = append(nodes, Node{Category: c, Children: build(c.Cid)})
+		}
+		return nodes
+	}
+	return build(pgtype.UUID{})
+}
+
+func listTree(ctx context.Context, pool db.Pool, activeOnly bool) utils.ServiceReturn[any] {
+	q := repository.New(pool)
+	categories, err := q.ListCategories(ctx)
+	if err != nil {
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"categories": tree(categories, activeOnly),
+		},
+	}
+}
+
+// Active returns the tree of categories buyers can browse and vendors can put items in
+func Active(ctx context.Context, pool db.Pool) utils.ServiceReturn[any] {
+	return listTree(ctx, pool, true)
+}
+
+// All returns the tree of every category, inactive ones included, for admins
+func All(ctx context.Context, pool db.Pool) utils.ServiceReturn[any] {
+	return listTree(ctx, pool, false)
+}
+
+// validate checks the fields of a category and fills in its defaults
+func (c *Category) validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if err := validation.ValidateStruct(c); err != nil {
+		return err
+	}
+	if !slugPattern.MatchString(c.Slug) {
+		return errInvalidSlug
+	}
+	if c.Active == nil {
+		c.Active = utils.MakePointer(true)
+	}
+	return nil
+}
+
+func doesCategoryExistById(ctx context.Context, pool db.Pool, cid pgtype.UUID) (bool, error) {
+	q := repository.New(pool)
+	_, err := q.GetCategoryById(ctx, cid)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// isSlugTaken reports whether err is the category table refusing a slug already in use
+func isSlugTaken(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+// Create adds a category under the given parent, or at the top level
+func Create(ctx context.Context, pool db.Pool, category Category) utils.ServiceReturn[any] {
+	if err := category.validate(); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	if category.ParentCid.Valid {
+		exists, err := doesCategoryExistById(ctx, pool, category.ParentCid)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		if !exists {
+			return utils.MakeError(errNoParent, http.StatusBadRequest)
+		}
+	}
+
+	q := repository.New(pool)
+	created, err := q.InsertCategory(ctx, repository.InsertCategoryParams{
+		ParentCid: category.ParentCid,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		Position:  category.Position,
+		Active:    *category.Active,
+	})
+	if err != nil {
+		if isSlugTaken(err) {
+			return utils.MakeError(errSlugTaken, http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusCreated,
+		Data:   created,
+	}
+}
+
+// Update replaces the fields of a category. Moving it keeps its subcategories under it, so it cannot
+// be moved under one of them. A new slug carries over to the items in the category.
+func Update(ctx context.Context, pool db.Pool, cid pgtype.UUID, category Category) utils.ServiceReturn[any] {
+	if err := category.validate(); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	q := repository.New(pool)
+	if category.ParentCid.Valid {
+		exists, err := doesCategoryExistById(ctx, pool, category.ParentCid)
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		if !exists {
+			return utils.MakeError(errNoParent, http.StatusBadRequest)
+		}
+
+		cycle, err := q.IsCategoryInSubtree(ctx, repository.IsCategoryInSubtreeParams{Root: cid, Cid: category.ParentCid})
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+		if cycle {
+			return utils.MakeError(errCycle, http.StatusBadRequest)
+		}
+	}
+
+	updated, err := q.UpdateCategory(ctx, repository.UpdateCategoryParams{
+		ParentCid: category.ParentCid,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		Position:  category.Position,
+		Active:    *category.Active,
+		Cid:       cid,
+	})
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return utils.MakeError(errNotFound, http.StatusNotFound)
+		}
+		if isSlugTaken(err) {
+			return utils.MakeError(errSlugTaken, http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data:   updated,
+	}
+}
+
+// Delete removes a category with no items and no subcategories. Categories in use can be made inactive instead.
+func Delete(ctx context.Context, pool db.Pool, cid pgtype.UUID) utils.ServiceReturn[any] {
+	q := repository.New(pool)
+	deleted, err := q.DeleteCategory(ctx, cid)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+			return utils.MakeError(errCategoryInUse, http.StatusConflict)
+		}
+		return utils.MakeError(err, http.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return utils.MakeError(errNotFound, http.StatusNotFound)
+	}
+
+	return utils.ServiceReturn[any]{
+		Status: http.StatusOK,
+		Data: utils.JMap{
+			"msg": "Category deleted",
+		},
+	}
+}
@@ -0,0 +1,225 @@
+package category
+
+import (
+	it "backend/internal/testing"
+	"backend/internal/utils"
+	"backend/repository"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// setupCategoryRows mocks the category listing returning the given categories
+func setupCategoryRows(mockPool *it.MockPool, ctx context.Context, categories []repository.Category) {
+	mockRows := &it.MockRows{}
+	it.SetupPoolOnRet(mockPool, "Query", repository.ListCategories, ctx, []any(nil), mockRows, nil)
+	it.SetupMock(mockRows, "Close", []any{}, nil)
+	if len(categories) > 0 {
+		it.SetupMock(mockRows, "Next", []any{}, true).Times(len(categories))
+	}
+	it.SetupMock(mockRows, "Next", []any{}, false).Once()
+	it.SetupMock(mockRows, "Err", []any{}, nil)
+
+	n := 0
+	scanArgs := make([]any, 7)
+	for i := range scanArgs {
+		scanArgs[i] = mock.Anything
+	}
+	it.SetupMock(mockRows, "Scan", scanArgs, nil).Run(func(args mock.Arguments) {
+		c := categories[n]
+		*args.Get(0).(*pgtype.UUID) = c.Cid
+		*args.Get(1).(*pgtype.UUID) = c.ParentCid
+		*args.Get(3).(*string) = c.Slug
+		*args.Get(5).(*bool) = c.Active
+		n++
+	})
+}
+
+func uuid(b byte) pgtype.UUID {
+	return pgtype.UUID{Bytes: [16]byte{b}, Valid: true}
+}
+
+func TestTree(t *testing.T) {
+	ctx := context.Background()
+	categories := []repository.Category{
+		{Cid: uuid(1), Slug: "electronics", Active: true},
+		{Cid: uuid(2), ParentCid: uuid(1), Slug: "phones", Active: true},
+		{Cid: uuid(3), ParentCid: uuid(1), Slug: "cameras", Active: false},
+		{Cid: uuid(4), ParentCid: uuid(3), Slug: "lenses", Active: true},
+		{Cid: uuid(5), Slug: "fashion", Active: true},
+	}
+
+	t.Run("Active only", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupCategoryRows(mockPool, ctx, categories)
+
+		result := Active(ctx, mockPool)
+
+		assert.Nil(t, result.ServiceErr)
+		nodes := result.Data.(utils.JMap)["categories"].([]Node)
+		// An inactive category hides the categories under it
+		assert.Len(t, nodes, 2)
+		assert.Equal(t, "electronics", nodes[0].Slug)
+		assert.Len(t, nodes[0].Children, 1)
+		assert.Equal(t, "phones", nodes[0].Children[0].Slug)
+		assert.Empty(t, nodes[1].Children)
+	})
+
+	t.Run("Everything for admins", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		setupCategoryRows(mockPool, ctx, categories)
+
+		result := All(ctx, mockPool)
+
+		assert.Nil(t, result.ServiceErr)
+		nodes := result.Data.(utils.JMap)["categories"].([]Node)
+		assert.Len(t, nodes, 2)
+		assert.Len(t, nodes[0].Children, 2)
+		assert.Equal(t, "lenses", nodes[0].Children[1].Children[0].Slug)
+	})
+}
+
+func TestCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		parentRow := &it.MockRow{}
+		insertRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, parentRow, repository.GetCategoryById, ctx, []any{uuid(1)})
+		it.CategoryScanActive(parentRow, true)
+		it.SetupPoolQueryRow(mockPool, insertRow, repository.InsertCategory, ctx, []any{uuid(1), "Phones", "phones", int32(2), true})
+		it.CategoryScanActive(insertRow, true)
+
+		result := Create(ctx, mockPool, Category{ParentCid: uuid(1), Name: " Phones ", Slug: "phones", Position: 2})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusCreated, result.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Invalid slug", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		for _, slug := range []string{"Phones", "smart phones", "phones-", "a--b", ""} {
+			result := Create(ctx, mockPool, Category{Name: "Phones", Slug: slug})
+
+			assert.NotNil(t, result.ServiceErr)
+			assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		}
+		mockPool.AssertNotCalled(t, "QueryRow")
+	})
+
+	t.Run("Unknown parent", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		parentRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, parentRow, repository.GetCategoryById, ctx, []any{uuid(9)})
+		it.SetupScanReturnArgs(parentRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		result := Create(ctx, mockPool, Category{ParentCid: uuid(9), Name: "Phones", Slug: "phones"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+	})
+
+	t.Run("Slug taken", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		insertRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, insertRow, repository.InsertCategory, ctx, []any{pgtype.UUID{}, "Fashion", "fashion", int32(0), false})
+		it.SetupScanReturnArgs(insertRow, &pgconn.PgError{Code: pgUniqueViolation}, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		result := Create(ctx, mockPool, Category{Name: "Fashion", Slug: "fashion", Active: utils.MakePointer(false)})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Moved under its own subcategory", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		parentRow := &it.MockRow{}
+		cycleRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, parentRow, repository.GetCategoryById, ctx, []any{uuid(2)})
+		it.CategoryScanActive(parentRow, true)
+		it.SetupPoolQueryRow(mockPool, cycleRow, repository.IsCategoryInSubtree, ctx, []any{uuid(1), uuid(2)})
+		it.SetupScanReturnArgs(cycleRow, nil, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*bool) = true
+		})
+
+		result := Update(ctx, mockPool, uuid(1), Category{ParentCid: uuid(2), Name: "Electronics", Slug: "electronics"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "QueryRow", ctx, repository.UpdateCategory, mock.Anything)
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		updateRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, updateRow, repository.UpdateCategory, ctx,
+			[]any{pgtype.UUID{}, "Books", "books", int32(4), false, uuid(4)})
+		it.CategoryScanActive(updateRow, false)
+
+		result := Update(ctx, mockPool, uuid(4), Category{Name: "Books", Slug: "books", Position: 4, Active: utils.MakePointer(false)})
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+		assert.False(t, result.Data.(repository.Category).Active)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		updateRow := &it.MockRow{}
+		it.SetupPoolQueryRow(mockPool, updateRow, repository.UpdateCategory, ctx,
+			[]any{pgtype.UUID{}, "Books", "books", int32(0), true, uuid(8)})
+		it.SetupScanReturnArgs(updateRow, pgx.ErrNoRows, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		result := Update(ctx, mockPool, uuid(8), Category{Name: "Books", Slug: "books"})
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.DeleteCategory, ctx, []any{uuid(1)}, pgconn.NewCommandTag("DELETE 1"), nil)
+
+		result := Delete(ctx, mockPool, uuid(1))
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusOK, result.Status)
+	})
+
+	t.Run("In use", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.DeleteCategory, ctx, []any{uuid(1)},
+			pgconn.CommandTag{}, &pgconn.PgError{Code: pgForeignKeyViolation})
+
+		result := Delete(ctx, mockPool, uuid(1))
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusConflict, result.ServiceErr.Status)
+	})
+
+	t.Run("Not found", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		it.SetupPoolOnRet(mockPool, "Exec", repository.DeleteCategory, ctx, []any{uuid(1)}, pgconn.NewCommandTag("DELETE 0"), nil)
+
+		result := Delete(ctx, mockPool, uuid(1))
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+	})
+}
@@ -3,8 +3,11 @@ package payment
 import (
 	"backend/db"
 	"backend/internal/logging"
+	"backend/internal/policy"
+	"backend/internal/principal"
 	"backend/internal/utils"
 	"backend/repository"
+	"backend/services/vendor"
 	"context"
 	"errors"
 	"net/http"
@@ -15,16 +18,22 @@ import (
 // CreateTransactionRecord handles the process of creating a transaction,
 // including validating item availability, reducing item quantity,
 // and recording the transaction in the database.
-func CreateTransactionRecord(ctx context.Context, pool db.Pool, transactionObj repository.CreateTransactionParams) utils.ServiceReturn[any] {
+// Items with variants are bought as one of them, at its price and from its stock.
+func CreateTransactionRecord(ctx context.Context, pool db.Pool, p principal.Principal, transactionObj repository.CreateTransactionParams) utils.ServiceReturn[any] {
+	// Buyers can only pay for their own purchases
+	if sr := policy.Authorize(p, policy.PaymentCreate, policy.Resource{Owner: transactionObj.Bid}); sr.ServiceErr != nil {
+		return sr
+	}
+
 	// Create a new query handler from the database pool
 	q := repository.New(pool)
 
-	// Fetch the item details by ID from the database
-	item, err := q.GetItemById(ctx, transactionObj.Iid)
+	// Fetch the item details by ID from the database, items hidden by moderation or account deletion cannot be bought
+	item, err := q.GetVisibleItemById(ctx, transactionObj.Iid)
 	if err != nil {
 		logging.Errorf("There was an error fetching the item")
 
-		// If the item doesn't exist, return a 404 Not Found error
+		// If the item doesn't exist or is hidden, return a 404 Not Found error
 		if err == pgx.ErrNoRows {
 			return utils.MakeError(errors.New("item not found"), http.StatusNotFound)
 		}
@@ -40,15 +49,31 @@ func CreateTransactionRecord(ctx context.Context, pool db.Pool, transactionObj r
 		return utils.MakeError(err, http.StatusBadRequest)
 	}
 
+	// Fetch the variant being bought, items without variants have none
+	variant, sr := vendor.VariantOf(ctx, q, item.Iid, transactionObj.Vrid)
+	if sr.ServiceErr != nil {
+		logging.Errorf("There was an error checking the variant")
+		return sr
+	}
+
+	// A variant is sold at its own price when it has one, and from its own stock
+	cost, quantity := item.Cost, item.Quantity
+	if variant.Vrid.Valid {
+		if variant.Cost.Valid {
+			cost = variant.Cost
+		}
+		quantity = variant.Quantity
+	}
+
 	// Check for mismatch in transaction amount and item cost
-	if !utils.NumericEqual(item.Cost, transactionObj.Amt) {
+	if !utils.NumericEqual(cost, transactionObj.Amt) {
 		logging.Errorf("There is an amount mismatch")
 		err = errors.New("mismatch in amount")
 		return utils.MakeError(err, http.StatusBadRequest)
 	}
 
 	// Check if enough quantity is available to fulfill the order
-	if item.Quantity-transactionObj.QtyBought < 0 {
+	if quantity-transactionObj.QtyBought < 0 {
 		logging.Errorf("You have bought more than is allowed")
 		err = errors.New("bought more than the quantity available")
 		return utils.MakeError(err, http.StatusBadRequest)
@@ -64,15 +89,19 @@ func CreateTransactionRecord(ctx context.Context, pool db.Pool, transactionObj r
 	// Use the transaction in subsequent queries
 	qtx := q.WithTx(tx)
 
-	// Prepare parameters to reduce the item quantity
-	params := repository.ReduceQuantityOfItemParams{
-		Iid:      item.Iid,
-		Vid:      item.Vid,
-		Quantity: transactionObj.QtyBought,
+	// Reduce the quantity in the database, of the variant when one is bought, which also reduces the item's
+	if variant.Vrid.Valid {
+		err = qtx.ReduceQuantityOfVariant(ctx, repository.ReduceQuantityOfVariantParams{
+			Vrid:     variant.Vrid,
+			Quantity: transactionObj.QtyBought,
+		})
+	} else {
+		err = qtx.ReduceQuantityOfItem(ctx, repository.ReduceQuantityOfItemParams{
+			Iid:      item.Iid,
+			Vid:      item.Vid,
+			Quantity: transactionObj.QtyBought,
+		})
 	}
-
-	// Reduce item quantity in the database
-	err = qtx.ReduceQuantityOfItem(ctx, params)
 	if err != nil {
 		logging.Errorf("There was an error reducing the quantity of items")
 		return utils.MakeError(err, http.StatusInternalServerError)
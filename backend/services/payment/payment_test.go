@@ -1,6 +1,7 @@
 package payment
 
 import (
+	"backend/internal/principal"
 	it "backend/internal/testing"
 	"backend/internal/utils"
 	"backend/repository"
@@ -17,6 +18,20 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// buyerPrincipal returns the authenticated buyer bid
+func buyerPrincipal(bid pgtype.UUID) principal.Principal {
+	return principal.Principal{Uid: bid, Email: "buyer@ashesi.edu.gh", Roles: []string{"buyer"}}
+}
+
+// setupHasVariants mocks whether the item iid has variants
+func setupHasVariants(mockPool *it.MockPool, ctx context.Context, iid pgtype.UUID, hasVariants bool) {
+	row := &it.MockRow{}
+	it.SetupPoolQueryRow(mockPool, row, repository.ItemHasVariants, ctx, []any{iid})
+	it.SetupScanReturnArgs(row, nil, mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*bool) = hasVariants
+	})
+}
+
 func TestCreateTransactionRecord(t *testing.T) {
 	ctx := context.Background()
 
@@ -44,21 +59,23 @@ func TestCreateTransactionRecord(t *testing.T) {
 			Name:        "Schrodinger's Cat 1",
 			Pictureurl:  utils.MakePointer("https://example.com/cat.jpg"),
 			Description: utils.MakePointer("Probably dead"),
-			Category:    repository.CategoryFASHION,
+			Category:    "fashion",
 			Quantity:    10,
 			Cost:        pgtype.Numeric{Int: big.NewInt(100), Valid: true},
 		}
 
-		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+		setupHasVariants(mockPool, ctx, testIid, false)
 		it.SetupMock(itemRow, "Scan", []any{
 			mock.AnythingOfType("*pgtype.UUID"),
 			mock.AnythingOfType("*pgtype.UUID"),
 			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("**string"),
 			mock.AnythingOfType("**string"),
-			mock.AnythingOfType("*repository.Category"),
+			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("*int32"),
-			mock.AnythingOfType("*pgtype.Numeric")}, nil).Run(
+			mock.AnythingOfType("*pgtype.Numeric"),
+			mock.AnythingOfType("*pgtype.Timestamp")}, nil).Run(
 			func(args mock.Arguments) {
 				if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 					*dest = testItem.Iid
@@ -75,7 +92,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 				if dest, ok := args.Get(4).(**string); ok {
 					*dest = testItem.Description
 				}
-				if dest, ok := args.Get(5).(*repository.Category); ok {
+				if dest, ok := args.Get(5).(*string); ok {
 					*dest = testItem.Category
 				}
 				if dest, ok := args.Get(6).(*int32); ok {
@@ -94,6 +111,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 			testTrans.Vid,
 			testTrans.Amt,
 			testTrans.QtyBought,
+			testTrans.Vrid,
 		})
 		it.SetupMock(mockTransRow, "Scan", []any{mock.AnythingOfType("*pgtype.UUID")}, nil).Run(func(args mock.Arguments) {
 			if dest, ok := args.Get(0).(*pgtype.UUID); ok {
@@ -105,7 +123,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 		it.SetupMock(mockTx, "Rollback", []any{ctx}, nil).Maybe()
 		it.SetupTxOnRet(mockTx, "Exec", repository.ReduceQuantityOfItem, ctx, []any{testIid, testVid, testQty}, pgconn.CommandTag{}, nil)
 
-		result := CreateTransactionRecord(ctx, mockPool, testTrans)
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
 		if result.ServiceErr != nil {
 			it.PrintError(result.ServiceErr.Err, t)
 		}
@@ -141,9 +159,9 @@ func TestCreateTransactionRecord(t *testing.T) {
 		}
 
 		it.ItemScanNotExists(itemRow, pgx.ErrNoRows)
-		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testItem.Iid})
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testItem.Iid})
 
-		result := CreateTransactionRecord(ctx, mockPool, testTrans)
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
 
 		assert.NotNil(t, result.ServiceErr)
 		assert.Error(t, result.ServiceErr.Err)
@@ -153,6 +171,60 @@ func TestCreateTransactionRecord(t *testing.T) {
 		mockPool.AssertExpectations(t)
 	})
 
+	t.Run("Item hidden by moderation", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+
+		testIid := pgtype.UUID{Bytes: [16]byte{4}, Valid: true}
+		testBid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testTrans := repository.CreateTransactionParams{
+			Bid:       testBid,
+			Vid:       pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+			Iid:       testIid,
+			Amt:       pgtype.Numeric{Int: big.NewInt(100), Valid: true},
+			QtyBought: 1,
+		}
+
+		// The lookup leaves out taken down items and items of suspended vendors
+		assert.Contains(t, repository.GetVisibleItemById, "item_takedown")
+		assert.Contains(t, repository.GetVisibleItemById, "user_suspension")
+		it.ItemScanNotExists(itemRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testBid), testTrans)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "QueryRow", ctx, repository.GetItemById, mock.Anything)
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+	})
+
+	t.Run("Vendor pending deletion", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+
+		testIid := pgtype.UUID{Bytes: [16]byte{5}, Valid: true}
+		testBid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testTrans := repository.CreateTransactionParams{
+			Bid:       testBid,
+			Vid:       pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+			Iid:       testIid,
+			Amt:       pgtype.Numeric{Int: big.NewInt(100), Valid: true},
+			QtyBought: 1,
+		}
+
+		// Items of a vendor whose account is deleted stay hidden through the grace period
+		assert.Contains(t, repository.GetVisibleItemById, "account_deletion")
+		it.ItemScanNotExists(itemRow, pgx.ErrNoRows)
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testBid), testTrans)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusNotFound, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+	})
+
 	t.Run("Vendor Id mismatch", func(t *testing.T) {
 		mockPool := &it.MockPool{}
 		itemRow := &it.MockRow{}
@@ -175,12 +247,12 @@ func TestCreateTransactionRecord(t *testing.T) {
 			Name:        "Schrodinger's Cat 1",
 			Pictureurl:  utils.MakePointer("https://example.com/cat.jpg"),
 			Description: utils.MakePointer("Probably dead"),
-			Category:    repository.CategoryBOOKSSUPPLIES,
+			Category:    "books-supplies",
 			Quantity:    10,
 			Cost:        pgtype.Numeric{Int: big.NewInt(100), Valid: true},
 		}
 
-		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
 		it.SetupMock(itemRow, "Scan", []any{mock.AnythingOfType("*pgtype.UUID")}, nil).Run(func(args mock.Arguments) {
 			if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 				*dest = testTid
@@ -192,9 +264,10 @@ func TestCreateTransactionRecord(t *testing.T) {
 			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("**string"),
 			mock.AnythingOfType("**string"),
-			mock.AnythingOfType("*repository.Category"),
+			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("*int32"),
-			mock.AnythingOfType("*pgtype.Numeric")}, nil).Run(
+			mock.AnythingOfType("*pgtype.Numeric"),
+			mock.AnythingOfType("*pgtype.Timestamp")}, nil).Run(
 			func(args mock.Arguments) {
 				if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 					*dest = testItem.Iid
@@ -211,7 +284,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 				if dest, ok := args.Get(4).(**string); ok {
 					*dest = testItem.Description
 				}
-				if dest, ok := args.Get(5).(*repository.Category); ok {
+				if dest, ok := args.Get(5).(*string); ok {
 					*dest = testItem.Category
 				}
 				if dest, ok := args.Get(6).(*int32); ok {
@@ -223,7 +296,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 			},
 		)
 
-		result := CreateTransactionRecord(ctx, mockPool, testTrans)
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
 		if result.ServiceErr != nil {
 			it.PrintError(result.ServiceErr.Err, t)
 		}
@@ -256,12 +329,13 @@ func TestCreateTransactionRecord(t *testing.T) {
 			Name:        "Schrodinger's Cat 1",
 			Pictureurl:  utils.MakePointer("https://example.com/cat.jpg"),
 			Description: utils.MakePointer("Probably dead"),
-			Category:    repository.CategoryBOOKSSUPPLIES,
+			Category:    "books-supplies",
 			Quantity:    10,
 			Cost:        pgtype.Numeric{Int: big.NewInt(100), Valid: true},
 		}
 
-		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+		setupHasVariants(mockPool, ctx, testIid, false)
 		it.SetupMock(itemRow, "Scan", []any{mock.AnythingOfType("*pgtype.UUID")}, nil).Run(func(args mock.Arguments) {
 			if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 				*dest = testTid
@@ -273,9 +347,10 @@ func TestCreateTransactionRecord(t *testing.T) {
 			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("**string"),
 			mock.AnythingOfType("**string"),
-			mock.AnythingOfType("*repository.Category"),
+			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("*int32"),
-			mock.AnythingOfType("*pgtype.Numeric")}, nil).Run(
+			mock.AnythingOfType("*pgtype.Numeric"),
+			mock.AnythingOfType("*pgtype.Timestamp")}, nil).Run(
 			func(args mock.Arguments) {
 				if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 					*dest = testItem.Iid
@@ -292,7 +367,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 				if dest, ok := args.Get(4).(**string); ok {
 					*dest = testItem.Description
 				}
-				if dest, ok := args.Get(5).(*repository.Category); ok {
+				if dest, ok := args.Get(5).(*string); ok {
 					*dest = testItem.Category
 				}
 				if dest, ok := args.Get(6).(*int32); ok {
@@ -304,7 +379,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 			},
 		)
 
-		result := CreateTransactionRecord(ctx, mockPool, testTrans)
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
 		if result.ServiceErr != nil {
 			it.PrintError(result.ServiceErr.Err, t)
 		}
@@ -339,21 +414,23 @@ func TestCreateTransactionRecord(t *testing.T) {
 			Name:        "Schrodinger's Cat 1",
 			Pictureurl:  utils.MakePointer("https://example.com/cat.jpg"),
 			Description: utils.MakePointer("Probably dead"),
-			Category:    repository.CategoryBOOKSSUPPLIES,
+			Category:    "books-supplies",
 			Quantity:    10,
 			Cost:        pgtype.Numeric{Int: big.NewInt(100), Valid: true},
 		}
 
-		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetItemById, ctx, []any{testIid})
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+		setupHasVariants(mockPool, ctx, testIid, false)
 		it.SetupMock(itemRow, "Scan", []any{
 			mock.AnythingOfType("*pgtype.UUID"),
 			mock.AnythingOfType("*pgtype.UUID"),
 			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("**string"),
 			mock.AnythingOfType("**string"),
-			mock.AnythingOfType("*repository.Category"),
+			mock.AnythingOfType("*string"),
 			mock.AnythingOfType("*int32"),
-			mock.AnythingOfType("*pgtype.Numeric")}, nil).Run(
+			mock.AnythingOfType("*pgtype.Numeric"),
+			mock.AnythingOfType("*pgtype.Timestamp")}, nil).Run(
 			func(args mock.Arguments) {
 				if dest, ok := args.Get(0).(*pgtype.UUID); ok {
 					*dest = testItem.Iid
@@ -370,7 +447,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 				if dest, ok := args.Get(4).(**string); ok {
 					*dest = testItem.Description
 				}
-				if dest, ok := args.Get(5).(*repository.Category); ok {
+				if dest, ok := args.Get(5).(*string); ok {
 					*dest = testItem.Category
 				}
 				if dest, ok := args.Get(6).(*int32); ok {
@@ -387,7 +464,7 @@ func TestCreateTransactionRecord(t *testing.T) {
 		it.SetupMock(mockTx, "Rollback", []any{ctx}, nil).Maybe()
 		it.SetupTxOnRet(mockTx, "Exec", repository.ReduceQuantityOfItem, ctx, []any{testIid, testVid, testQty}, pgconn.CommandTag{}, errors.New("e"))
 
-		result := CreateTransactionRecord(ctx, mockPool, testTrans)
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
 
 		assert.NotNil(t, result.ServiceErr)
 		assert.Error(t, result.ServiceErr.Err)
@@ -399,4 +476,112 @@ func TestCreateTransactionRecord(t *testing.T) {
 		mockTransRow.AssertExpectations(t)
 	})
 
+	t.Run("Not the buyer", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+
+		testBid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testTrans := repository.CreateTransactionParams{
+			Bid:       testBid,
+			Vid:       pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+			Iid:       pgtype.UUID{Bytes: [16]byte{3}, Valid: true},
+			Amt:       pgtype.Numeric{Int: big.NewInt(100), Valid: true},
+			QtyBought: 1,
+		}
+
+		// A vendor paying on a buyer's behalf is refused before anything is read
+		result := CreateTransactionRecord(ctx, mockPool, principal.Principal{Uid: testBid, Email: "vendor@ashesi.edu.gh", Roles: []string{"vendor"}}, testTrans)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusForbidden, result.ServiceErr.Status)
+		mockPool.AssertExpectations(t)
+	})
+
+	t.Run("Variant", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+		variantRow := &it.MockRow{}
+		mockTransRow := &it.MockRow{}
+		mockTx := &it.MockTx{}
+
+		testVid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testIid := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+		testVrid := pgtype.UUID{Bytes: [16]byte{3}, Valid: true}
+		testTid := pgtype.UUID{Bytes: [16]byte{4}, Valid: true}
+		// The variant is sold at its own price, from its own stock
+		testTrans := repository.CreateTransactionParams{
+			Bid:       pgtype.UUID{Bytes: [16]byte{5}, Valid: true},
+			Vid:       testVid,
+			Iid:       testIid,
+			Amt:       pgtype.Numeric{Int: big.NewInt(120), Valid: true},
+			QtyBought: 2,
+			Vrid:      testVrid,
+		}
+
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+		it.ItemScanWithVendor(itemRow, testVid).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testIid
+			*args.Get(1).(*pgtype.UUID) = testVid
+			*args.Get(6).(*int32) = 0
+			*args.Get(7).(*pgtype.Numeric) = pgtype.Numeric{Int: big.NewInt(100), Valid: true}
+		})
+		it.SetupPoolQueryRow(mockPool, variantRow, repository.GetItemVariant, ctx, []any{testVrid})
+		it.SetupScanReturnArgs(variantRow, nil, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testVrid
+			*args.Get(1).(*pgtype.UUID) = testIid
+			*args.Get(4).(*int32) = 2
+			*args.Get(5).(*pgtype.Numeric) = pgtype.Numeric{Int: big.NewInt(120), Valid: true}
+		})
+
+		it.SetupMock(mockPool, "Begin", []any{ctx}, mockTx, nil)
+		it.SetupTxOnRet(mockTx, "Exec", repository.ReduceQuantityOfVariant, ctx, []any{testVrid, int32(2)}, pgconn.CommandTag{}, nil)
+		it.SetupTxQueryRow(mockTx, mockTransRow, repository.CreateTransaction, ctx, []any{
+			testTrans.Bid,
+			testTrans.Vid,
+			testTrans.Iid,
+			testTrans.Amt,
+			testTrans.QtyBought,
+			testVrid,
+		})
+		it.SetupScanWithUUID(mockTransRow, testTid)
+		it.SetupMock(mockTx, "Commit", []any{ctx}, nil)
+		it.SetupMock(mockTx, "Rollback", []any{ctx}, nil).Maybe()
+
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
+		if result.ServiceErr != nil {
+			it.PrintError(result.ServiceErr.Err, t)
+		}
+
+		assert.Nil(t, result.ServiceErr)
+		assert.Equal(t, testTid, result.Data.(utils.JMap)["tid"])
+		mockTx.AssertExpectations(t)
+		mockTx.AssertNotCalled(t, "Exec", ctx, repository.ReduceQuantityOfItem, mock.Anything)
+	})
+
+	t.Run("Variant not chosen", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		itemRow := &it.MockRow{}
+
+		testVid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testIid := pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+		testTrans := repository.CreateTransactionParams{
+			Bid:       pgtype.UUID{Bytes: [16]byte{5}, Valid: true},
+			Vid:       testVid,
+			Iid:       testIid,
+			Amt:       pgtype.Numeric{Int: big.NewInt(100), Valid: true},
+			QtyBought: 1,
+		}
+
+		it.SetupPoolQueryRow(mockPool, itemRow, repository.GetVisibleItemById, ctx, []any{testIid})
+		it.ItemScanWithVendor(itemRow, testVid).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = testIid
+			*args.Get(1).(*pgtype.UUID) = testVid
+		})
+		setupHasVariants(mockPool, ctx, testIid, true)
+
+		result := CreateTransactionRecord(ctx, mockPool, buyerPrincipal(testTrans.Bid), testTrans)
+
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "Begin", ctx)
+	})
 }
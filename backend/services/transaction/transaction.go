@@ -3,21 +3,49 @@ package transaction
 import (
 	"backend/db"
 	"backend/internal/logging"
+	"backend/internal/pagination"
 	"backend/internal/utils"
+	"backend/internal/utils/validation"
 	"backend/repository"
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-// GetTransactionsByVendorId retrieves transactions for a specific vendor by vendor ID
-func GetTransactionsByVendorId(ctx context.Context, pool db.Pool, vId pgtype.UUID) utils.ServiceReturn[any] {
+// transactionKey is the position of a transaction in the newest first order, carried in cursors
+type transactionKey struct {
+	Tid   pgtype.UUID `json:"tid"`
+	TTime time.Time   `json:"t_time"`
+}
+
+// GetTransactionsByVendorId retrieves a page of transactions for a specific vendor by vendor ID, newest first
+func GetTransactionsByVendorId(ctx context.Context, pool db.Pool, vId pgtype.UUID, pq pagination.Query) utils.ServiceReturn[any] {
+	// Validate the cursor and page size
+	if err := validation.ValidateStruct(pq); err != nil {
+		return utils.MakeError(err, http.StatusBadRequest)
+	}
+
+	// Read the position of the last transaction of the previous page from the cursor
+	var after transactionKey
+	if pq.Cursor != "" {
+		if err := pagination.Decode(pq.Cursor, "newest", &after); err != nil {
+			return utils.MakeError(err, http.StatusBadRequest)
+		}
+	}
+
 	// Create a new repository instance to interact with the database
 	q := repository.New(pool)
 
-	// Query the database to get transactions for the vendor
-	transactions, err := q.GetTransactionsForVendor(ctx, vId)
+	// Query the database for one transaction more than the page holds, so the last page is known
+	limit := pq.PageLimit()
+	transactions, err := q.GetTransactionsForVendor(ctx, repository.GetTransactionsForVendorParams{
+		Vid:        vId,
+		AfterTid:   after.Tid,
+		AfterTTime: pgtype.Timestamp{Time: after.TTime, Valid: after.Tid.Valid},
+		RowLimit:   limit + 1,
+	})
 
 	// If there is an error retrieving transactions, log the error and return an internal server error
 	if err != nil {
@@ -25,11 +53,25 @@ func GetTransactionsByVendorId(ctx context.Context, pool db.Pool, vId pgtype.UUI
 		return utils.MakeError(err, http.StatusInternalServerError)
 	}
 
-	// Return a successful response with the transactions data
+	// Cut the extra transaction and point the next cursor after the last one of the page
+	transactions, more := pagination.Trim(transactions, limit)
+	next := ""
+	if more {
+		last := transactions[len(transactions)-1]
+		next, err = pagination.Encode("newest", transactionKey{Tid: last.Tid, TTime: last.TTime.Time})
+		if err != nil {
+			return utils.MakeError(err, http.StatusInternalServerError)
+		}
+	}
+
+	// Return a successful response with the page of transactions
 	return utils.ServiceReturn[any]{
 		Status: http.StatusOK, // Success HTTP status code
-		Data: utils.JMap{
-			"transactions": transactions, // Transactions data returned
+		Data: utils.Page[repository.GetTransactionsForVendorRow]{
+			Key:        "transactions", // Transactions data returned
+			Items:      transactions,
+			Limit:      limit,
+			NextCursor: next,
 		},
 	}
 }
@@ -1,6 +1,7 @@
 package transaction
 
 import (
+	"backend/internal/pagination"
 	it "backend/internal/testing"
 	"backend/internal/utils"
 	"backend/repository"
@@ -8,6 +9,7 @@ import (
 	"errors"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/stretchr/testify/assert"
@@ -33,20 +35,20 @@ func TestGetTransactionsByVendorId(t *testing.T) {
 		}
 
 		// Set up mock queries and results
-		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid}}, mockRows, nil)
+		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid, pgtype.UUID{}, pgtype.Timestamp{}, int32(21)}}, mockRows, nil)
 		it.SetupMock(mockRows, "Close", []any{}, nil)
 		it.SetupMock(mockRows, "Next", []any{}, true).Once()
 		it.SetupMock(mockRows, "Next", []any{}, false).Once()
 		it.SetupMock(mockRows, "Err", []any{}, nil)
-		it.SetupMock(mockRows, "Scan", []any{mock.AnythingOfType("**string"), mock.Anything, mock.Anything}, nil).Run(func(args mock.Arguments) {
+		it.SetupMock(mockRows, "Scan", []any{mock.Anything, mock.AnythingOfType("**string"), mock.Anything, mock.Anything, mock.Anything}, nil).Run(func(args mock.Arguments) {
 			// Mock scanning of transaction row
-			if dest, ok := args.Get(0).(**string); ok {
+			if dest, ok := args.Get(1).(**string); ok {
 				*dest = testTrans.Name
 			}
 		})
 
 		// Call the function under test
-		result := GetTransactionsByVendorId(ctx, mockPool, testVid)
+		result := GetTransactionsByVendorId(ctx, mockPool, testVid, pagination.Query{})
 
 		// Handle any errors
 		if result.ServiceErr != nil {
@@ -56,9 +58,10 @@ func TestGetTransactionsByVendorId(t *testing.T) {
 		// Validate the results
 		assert.Nil(t, result.ServiceErr)
 		assert.Equal(t, http.StatusOK, result.Status)
-		trans := result.Data.(utils.JMap)["transactions"].([]repository.GetTransactionsForVendorRow)
-		assert.NotEmpty(t, trans)
-		assert.Equal(t, trans[0].Name, testTrans.Name)
+		page := result.Data.(utils.Page[repository.GetTransactionsForVendorRow])
+		assert.NotEmpty(t, page.Items)
+		assert.Equal(t, page.Items[0].Name, testTrans.Name)
+		assert.Empty(t, page.NextCursor)
 
 		// Verify that mocks were called as expected
 		transRow.AssertExpectations(t)
@@ -76,10 +79,10 @@ func TestGetTransactionsByVendorId(t *testing.T) {
 		testVid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
 
 		// Set up mock query to return an error
-		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid}}, mockRows, errors.New("e"))
+		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid, pgtype.UUID{}, pgtype.Timestamp{}, int32(21)}}, mockRows, errors.New("e"))
 
 		// Call the function under test
-		result := GetTransactionsByVendorId(ctx, mockPool, testVid)
+		result := GetTransactionsByVendorId(ctx, mockPool, testVid, pagination.Query{})
 
 		// Validate that an error was returned
 		assert.NotNil(t, result.ServiceErr)
@@ -89,6 +92,58 @@ func TestGetTransactionsByVendorId(t *testing.T) {
 		transRow.AssertExpectations(t)
 		mockPool.AssertExpectations(t)
 	})
+
+	// Next page: the cursor of a full page picks up after its last transaction
+	t.Run("Next page", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		mockRows := &it.MockRows{}
+
+		testVid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+		testTime := pgtype.Timestamp{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Valid: true}
+		tids := []pgtype.UUID{{Bytes: [16]byte{3}, Valid: true}, {Bytes: [16]byte{2}, Valid: true}}
+
+		// A page of one reads two transactions, the second shows there is another page
+		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid, pgtype.UUID{}, pgtype.Timestamp{}, int32(2)}}, mockRows, nil)
+		it.SetupMock(mockRows, "Close", []any{}, nil)
+		it.SetupMock(mockRows, "Next", []any{}, true).Twice()
+		it.SetupMock(mockRows, "Next", []any{}, false).Once()
+		it.SetupMock(mockRows, "Err", []any{}, nil)
+		n := 0
+		it.SetupMock(mockRows, "Scan", []any{mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything}, nil).Run(func(args mock.Arguments) {
+			*args.Get(0).(*pgtype.UUID) = tids[n]
+			*args.Get(3).(*pgtype.Timestamp) = testTime
+			n++
+		})
+
+		result := GetTransactionsByVendorId(ctx, mockPool, testVid, pagination.Query{Limit: 1})
+		assert.Nil(t, result.ServiceErr)
+		page := result.Data.(utils.Page[repository.GetTransactionsForVendorRow])
+		assert.Len(t, page.Items, 1)
+		assert.NotEmpty(t, page.NextCursor)
+
+		// The next page is read after the last transaction of the first
+		nextRows := &it.MockRows{}
+		it.SetupMock(mockPool, "Query", []any{ctx, repository.GetTransactionsForVendor, []any{testVid, tids[0], testTime, int32(2)}}, nextRows, nil)
+		it.SetupMock(nextRows, "Close", []any{}, nil)
+		it.SetupMock(nextRows, "Next", []any{}, false).Once()
+		it.SetupMock(nextRows, "Err", []any{}, nil)
+
+		result = GetTransactionsByVendorId(ctx, mockPool, testVid, pagination.Query{Cursor: page.NextCursor, Limit: 1})
+		assert.Nil(t, result.ServiceErr)
+		assert.Empty(t, result.Data.(utils.Page[repository.GetTransactionsForVendorRow]).Items)
+		mockPool.AssertExpectations(t)
+	})
+
+	// Invalid cursor: a cursor that was not handed out is refused before querying
+	t.Run("Invalid cursor", func(t *testing.T) {
+		mockPool := &it.MockPool{}
+		testVid := pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+
+		result := GetTransactionsByVendorId(ctx, mockPool, testVid, pagination.Query{Cursor: "not-a-cursor"})
+		assert.NotNil(t, result.ServiceErr)
+		assert.Equal(t, http.StatusBadRequest, result.ServiceErr.Status)
+		mockPool.AssertNotCalled(t, "Query")
+	})
 }
 
 // TestGetTotalSalesByVendorId tests the function that retrieves total sales by vendor ID